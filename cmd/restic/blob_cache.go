@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/restic/restic/internal/blobcache"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/ui"
+)
+
+// openBlobCache returns the on-disk blob cache of repo which stores at most
+// size bytes. It returns nil if size is empty or zero.
+func openBlobCache(repo *repository.Repository, size string) (*blobcache.Cache, error) {
+	if size == "" {
+		return nil, nil
+	}
+	bytes, err := ui.ParseBytes(size)
+	if err != nil {
+		return nil, errors.Fatalf("invalid blob cache size: %v", err)
+	}
+	if bytes == 0 {
+		return nil, nil
+	}
+
+	if repo.Cache() == nil {
+		return nil, errors.Fatal("the blob cache requires the local cache, remove --no-cache")
+	}
+	c, err := blobcache.New(filepath.Join(repo.Cache().Dir(), "blobs"), repo.Key(), bytes)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open blob cache: %v", err)
+	}
+	return c, nil
+}
@@ -4,14 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -19,6 +22,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/changes"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
@@ -90,6 +94,7 @@ type BackupOptions struct {
 	StdinFilename     string
 	StdinCommand      bool
 	Tags              restic.TagLists
+	Labels            []string
 	Host              string
 	FilesFrom         []string
 	FilesFromVerbatim []string
@@ -101,14 +106,18 @@ type BackupOptions struct {
 	UseFsSnapshot     bool
 	DryRun            bool
 	ReadConcurrency   uint
+	ScanConcurrency   uint
 	NoScan            bool
 	SkipIfUnchanged   bool
+	SigningKeyFile    string
+	CheckpointEvery   time.Duration
+	ChangesFrom       string
 }
 
 func (opts *BackupOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&opts.Parent, "parent", "", "use this parent `snapshot` (default: latest snapshot in the group determined by --group-by and not newer than the timestamp determined by --time)")
 	opts.GroupBy = restic.SnapshotGroupByOptions{Host: true, Path: true}
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags and/or label:key, separated by comma (disable grouping with '')")
 	f.BoolVarP(&opts.Force, "force", "f", false, `force re-reading the source files/directories (overrides the "parent" flag)`)
 
 	opts.ExcludePatternOptions.Add(f)
@@ -121,7 +130,9 @@ func (opts *BackupOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&opts.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
 	f.BoolVar(&opts.StdinCommand, "stdin-from-command", false, "interpret arguments as command to execute and store its stdout")
 	f.Var(&opts.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.StringArrayVar(&opts.Labels, "label", nil, "add a `label` for the new snapshot in the format `key=value` (can be specified multiple times)")
 	f.UintVar(&opts.ReadConcurrency, "read-concurrency", 0, "read `n` files concurrently (default: $RESTIC_READ_CONCURRENCY or 2)")
+	f.UintVar(&opts.ScanConcurrency, "scan-concurrency", 0, "read `n` directories and file metadata concurrently (default: $RESTIC_SCAN_CONCURRENCY or 1)")
 	f.StringVarP(&opts.Host, "host", "H", "", "set the `hostname` for the snapshot manually (default: $RESTIC_HOST). To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&opts.Host, "hostname", "", "set the `hostname` for the snapshot manually")
 	err := f.MarkDeprecated("hostname", "use --host")
@@ -143,15 +154,21 @@ func (opts *BackupOptions) AddFlags(f *pflag.FlagSet) {
 		f.BoolVar(&opts.ExcludeCloudFiles, "exclude-cloud-files", false, "excludes online-only cloud files (such as OneDrive Files On-Demand)")
 	}
 	f.BoolVar(&opts.SkipIfUnchanged, "skip-if-unchanged", false, "skip snapshot creation if identical to parent snapshot")
+	f.StringVar(&opts.SigningKeyFile, "signing-key-file", "", "sign the snapshot using the ed25519 private key in `file` (default: $RESTIC_SIGNING_KEY_FILE)")
+	f.StringVar(&opts.ChangesFrom, "changes-from", "", "only read directories modified since the parent snapshot according to the change journal in `file` written by the watch command")
+	f.DurationVar(&opts.CheckpointEvery, "checkpoint-interval", 0, "write a checkpoint snapshot every `duration` which a later backup can resume from if this one is interrupted (e.g. 30m, default: disabled)")
 
 	// parse read concurrency from env, on error the default value will be used
 	readConcurrency, _ := strconv.ParseUint(os.Getenv("RESTIC_READ_CONCURRENCY"), 10, 32)
 	opts.ReadConcurrency = uint(readConcurrency)
+	scanConcurrency, _ := strconv.ParseUint(os.Getenv("RESTIC_SCAN_CONCURRENCY"), 10, 32)
+	opts.ScanConcurrency = uint(scanConcurrency)
 
 	// parse host from env, if not exists or empty the default value will be used
 	if host := os.Getenv("RESTIC_HOST"); host != "" {
 		opts.Host = host
 	}
+	opts.SigningKeyFile = os.Getenv("RESTIC_SIGNING_KEY_FILE")
 }
 
 var backupFSTestHook func(fs fs.FS) fs.FS
@@ -161,11 +178,11 @@ var ErrInvalidSourceData = errors.New("at least one source file could not be rea
 
 // filterExisting returns a slice of all existing items, or an error if no
 // items exist at all.
-func filterExisting(items []string) (result []string, err error) {
+func filterExisting(items []string, warnf func(msg string, args ...interface{})) (result []string, err error) {
 	for _, item := range items {
 		_, err := fs.Lstat(item)
 		if errors.Is(err, os.ErrNotExist) {
-			Warnf("%v does not exist, skipping\n", item)
+			warnf("%v does not exist, skipping\n", item)
 			continue
 		}
 
@@ -306,7 +323,7 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 
 // collectRejectByNameFuncs returns a list of all functions which may reject data
 // from being saved in a snapshot based on path only
-func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (fs []archiver.RejectByNameFunc, err error) {
+func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, warnf func(msg string, args ...interface{})) (fs []archiver.RejectByNameFunc, err error) {
 	// exclude restic cache
 	if repo.Cache() != nil {
 		f, err := rejectResticCache(repo)
@@ -317,7 +334,7 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (
 		fs = append(fs, f)
 	}
 
-	fsPatterns, err := opts.ExcludePatternOptions.CollectPatterns(Warnf)
+	fsPatterns, err := opts.ExcludePatternOptions.CollectPatterns(warnf)
 	if err != nil {
 		return nil, err
 	}
@@ -330,7 +347,7 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository) (
 
 // collectRejectFuncs returns a list of all functions which may reject data
 // from being saved in a snapshot based on path and file info
-func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS) (funcs []archiver.RejectFunc, err error) {
+func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS, warnf func(msg string, args ...interface{})) (funcs []archiver.RejectFunc, err error) {
 	// allowed devices
 	if opts.ExcludeOtherFS && !opts.Stdin && !opts.StdinCommand {
 		f, err := archiver.RejectByDevice(targets, fs)
@@ -357,7 +374,7 @@ func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS) (funcs [
 		if runtime.GOOS != "windows" {
 			return nil, errors.Fatalf("exclude-cloud-files is only supported on Windows")
 		}
-		f, err := archiver.RejectCloudFiles(Warnf)
+		f, err := archiver.RejectCloudFiles(warnf)
 		if err != nil {
 			return nil, err
 		}
@@ -369,7 +386,7 @@ func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS) (funcs [
 	}
 
 	for _, spec := range opts.ExcludeIfPresent {
-		f, err := archiver.RejectIfPresent(spec, Warnf)
+		f, err := archiver.RejectIfPresent(spec, warnf)
 		if err != nil {
 			return nil, err
 		}
@@ -381,7 +398,7 @@ func collectRejectFuncs(opts BackupOptions, targets []string, fs fs.FS) (funcs [
 }
 
 // collectTargets returns a list of target files/dirs from several sources.
-func collectTargets(opts BackupOptions, args []string) (targets []string, err error) {
+func collectTargets(opts BackupOptions, args []string, warnf func(msg string, args ...interface{})) (targets []string, err error) {
 	if opts.Stdin || opts.StdinCommand {
 		return nil, nil
 	}
@@ -405,7 +422,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 				return nil, fmt.Errorf("pattern: %s: %w", line, err)
 			}
 			if len(expanded) == 0 {
-				Warnf("pattern %q does not match any files, skipping\n", line)
+				warnf("pattern %q does not match any files, skipping\n", line)
 			}
 			targets = append(targets, expanded...)
 		}
@@ -439,7 +456,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 		return nil, errors.Fatal("nothing to backup, please specify source files/dirs")
 	}
 
-	targets, err = filterExisting(targets)
+	targets, err = filterExisting(targets, warnf)
 	if err != nil {
 		return nil, err
 	}
@@ -458,7 +475,8 @@ func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, o
 	if snName == "" {
 		snName = "latest"
 	}
-	f := restic.SnapshotFilter{TimestampLimit: timeStampLimit}
+	// checkpoints allow resuming an interrupted backup
+	f := restic.SnapshotFilter{TimestampLimit: timeStampLimit, IncludeCheckpoints: true}
 	if opts.GroupBy.Host {
 		f.Hosts = []string{opts.Host}
 	}
@@ -468,6 +486,9 @@ func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, o
 	if opts.GroupBy.Tag {
 		f.Tags = []restic.TagList{opts.Tags.Flatten()}
 	}
+	if l := opts.groupLabels(); len(l) > 0 {
+		f.Labels = []restic.LabelList{l}
+	}
 
 	sn, _, err := f.FindLatest(ctx, repo, repo, snName)
 	// Snapshot not found is ok if no explicit parent was set
@@ -477,6 +498,126 @@ func findParentSnapshot(ctx context.Context, repo restic.ListerLoaderUnpacked, o
 	return sn, err
 }
 
+// groupLabels returns the selectors for the labels of the new snapshot which
+// are used for grouping. Labels which are not set must be absent from the
+// parent snapshot, like GroupSnapshots puts such snapshots in their own group.
+func (opts BackupOptions) groupLabels() restic.LabelList {
+	var l restic.LabelList
+	if len(opts.GroupBy.Labels) == 0 {
+		return l
+	}
+	// the labels were already validated by runBackup
+	labels, _ := restic.ParseLabels(opts.Labels)
+	for _, key := range opts.GroupBy.Labels {
+		if value, ok := labels[key]; ok {
+			l = append(l, key+"="+value)
+		} else {
+			l = append(l, "!"+key)
+		}
+	}
+	return l
+}
+
+// hasUnrecordedFilters returns whether filter options are set which, unlike
+// the exclude patterns, are not recorded in the snapshot.
+func (opts BackupOptions) hasUnrecordedFilters() bool {
+	return len(opts.InsensitiveExcludes) > 0 || len(opts.ExcludeFiles) > 0 ||
+		len(opts.InsensitiveExcludeFiles) > 0 || len(opts.ExcludeIfPresent) > 0 ||
+		opts.ExcludeCaches || opts.ExcludeLargerThan != "" ||
+		opts.ExcludeOtherFS || opts.ExcludeCloudFiles
+}
+
+// loadChangeSet returns the modifications since the parent snapshot recorded
+// in the change journal. An error is returned if the journal cannot be used.
+// Unmodified directories are copied from the parent snapshot, the journal can
+// therefore only be used if the parent snapshot was created with the same
+// targets and filters.
+func loadChangeSet(ctx context.Context, opts BackupOptions, parent *restic.Snapshot, targets []string, backupStart time.Time) (*changes.ChangeSet, error) {
+	if parent == nil {
+		return nil, errors.New("no parent snapshot")
+	}
+
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, abs)
+	}
+	slices.Sort(paths)
+	parentPaths := slices.Clone(parent.Paths)
+	slices.Sort(parentPaths)
+
+	switch {
+	case parent.IsCheckpoint():
+		// checkpoints contain incomplete directories
+		return nil, errors.New("parent snapshot is a checkpoint")
+	case parent.Summary == nil:
+		return nil, errors.New("start time of parent snapshot is unknown")
+	case !slices.Equal(parentPaths, paths):
+		return nil, errors.New("paths differ from parent snapshot")
+	case !slices.Equal(parent.Excludes, opts.Excludes):
+		return nil, errors.New("excludes differ from parent snapshot")
+	case opts.hasUnrecordedFilters():
+		// the other filters are not recorded, thus the parent snapshot may
+		// have been created with different ones
+		return nil, errors.New("filter options other than --exclude are set")
+	}
+
+	j, err := changes.WaitSynced(ctx, opts.ChangesFrom, backupStart, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return j.Since(parent.Summary.BackupStart)
+}
+
+// removeCheckpoints removes the checkpoints of the backup set which were
+// created before the backup which started at timeStamp finished.
+func removeCheckpoints(ctx context.Context, repo *repository.Repository, opts BackupOptions, targets []string, timeStamp time.Time) error {
+	f := restic.SnapshotFilter{IncludeCheckpoints: true}
+	if opts.GroupBy.Host {
+		f.Hosts = []string{opts.Host}
+	}
+	if opts.GroupBy.Path {
+		for _, target := range targets {
+			abs, err := filepath.Abs(target)
+			if err != nil {
+				return err
+			}
+			f.Paths = append(f.Paths, abs)
+		}
+	}
+	if opts.GroupBy.Tag {
+		f.Tags = []restic.TagList{opts.Tags.Flatten()}
+	}
+	if l := opts.groupLabels(); len(l) > 0 {
+		f.Labels = []restic.LabelList{l}
+	}
+
+	var checkpoints restic.IDs
+	err := f.FindAll(ctx, repo, repo, nil, func(_ string, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		if sn.IsCheckpoint() && !sn.Time.After(timeStamp) {
+			checkpoints = append(checkpoints, *sn.ID())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range checkpoints {
+		debug.Log("removing checkpoint %v", id)
+		if err := repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	var vsscfg fs.VSSConfig
 	var err error
@@ -492,11 +633,29 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return err
 	}
 
-	targets, err := collectTargets(opts, args)
+	// use the output streams of gopts, the daemon runs backups concurrently
+	warnf := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(gopts.stderr, format, args...)
+	}
+
+	targets, err := collectTargets(opts, args, warnf)
 	if err != nil {
 		return err
 	}
 
+	labels, err := restic.ParseLabels(opts.Labels)
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
+
+	var signingKey ed25519.PrivateKey
+	if opts.SigningKeyFile != "" {
+		signingKey, err = loadSigningKey(opts.SigningKeyFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	timeStamp := time.Now()
 	backupStart := timeStamp
 	if opts.TimeStamp != "" {
@@ -507,7 +666,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	if gopts.verbosity >= 2 && !gopts.JSON {
-		Verbosef("open repository\n")
+		_, _ = fmt.Fprintf(gopts.stdout, "open repository\n")
 	}
 
 	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, opts.DryRun)
@@ -527,20 +686,30 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	defer progressReporter.Done()
 
 	// rejectByNameFuncs collect functions that can reject items from the backup based on path only
-	rejectByNameFuncs, err := collectRejectByNameFuncs(opts, repo)
+	rejectByNameFuncs, err := collectRejectByNameFuncs(opts, repo, warnf)
 	if err != nil {
 		return err
 	}
 
 	var parentSnapshot *restic.Snapshot
-	if !opts.Stdin {
+	if !repo.KeyRole().CanRead() {
+		// backup-only keys cannot load existing snapshots
+		if opts.Parent != "" {
+			return errors.Fatalf("--parent cannot be used with a %v key", repo.KeyRole())
+		}
+		if !gopts.JSON {
+			progressPrinter.P("%v key cannot use a parent snapshot, will read all files\n", repo.KeyRole())
+		}
+	} else if !opts.Stdin {
 		parentSnapshot, err = findParentSnapshot(ctx, repo, opts, targets, timeStamp)
 		if err != nil {
 			return err
 		}
 
 		if !gopts.JSON {
-			if parentSnapshot != nil {
+			if parentSnapshot != nil && parentSnapshot.IsCheckpoint() {
+				progressPrinter.P("resuming interrupted backup from checkpoint %v\n", parentSnapshot.ID().Str())
+			} else if parentSnapshot != nil {
 				progressPrinter.P("using parent snapshot %v\n", parentSnapshot.ID().Str())
 			} else {
 				progressPrinter.P("no parent snapshot found, will read all files\n")
@@ -548,6 +717,16 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		}
 	}
 
+	var changeSet *changes.ChangeSet
+	if opts.ChangesFrom != "" && !opts.Stdin && !opts.StdinCommand {
+		changeSet, err = loadChangeSet(ctx, opts, parentSnapshot, targets, backupStart)
+		if err != nil && !gopts.JSON {
+			progressPrinter.P("not using change journal: %v, will read all directories\n", err)
+		} else if err == nil && !gopts.JSON {
+			progressPrinter.V("using change journal %v", opts.ChangesFrom)
+		}
+	}
+
 	if !gopts.JSON {
 		progressPrinter.V("load index files")
 	}
@@ -605,7 +784,7 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	}
 
 	// rejectFuncs collect functions that can reject items from the backup based on path and file info
-	rejectFuncs, err := collectRejectFuncs(opts, targets, targetFS)
+	rejectFuncs, err := collectRejectFuncs(opts, targets, targetFS, warnf)
 	if err != nil {
 		return err
 	}
@@ -617,12 +796,14 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	cancelCtx, cancel := context.WithCancel(wgCtx)
 	defer cancel()
 
-	if !opts.NoScan {
+	// the scanner would read all directories skipped due to the change journal
+	if !opts.NoScan && changeSet == nil {
 		sc := archiver.NewScanner(targetFS)
 		sc.SelectByName = selectByNameFilter
 		sc.Select = selectFilter
 		sc.Error = progressPrinter.ScannerError
 		sc.Result = progressReporter.ReportTotal
+		sc.Concurrency = opts.ScanConcurrency
 
 		if !gopts.JSON {
 			progressPrinter.V("start scan on %v", targets)
@@ -630,13 +811,21 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		wg.Go(func() error { return sc.Scan(cancelCtx, targets) })
 	}
 
-	arch := archiver.New(repo, targetFS, archiver.Options{ReadConcurrency: opts.ReadConcurrency})
+	arch := archiver.New(repo, targetFS, archiver.Options{
+		ReadConcurrency: opts.ReadConcurrency,
+		ScanConcurrency: opts.ScanConcurrency,
+	})
 	arch.SelectByName = selectByNameFilter
 	arch.Select = selectFilter
 	arch.WithAtime = opts.WithAtime
+	if changeSet != nil {
+		arch.UnchangedDir = changeSet.Unchanged
+	}
 	success := true
+	var errorCount atomic.Uint64
 	arch.Error = func(item string, err error) error {
 		success = false
+		errorCount.Add(1)
 		reterr := progressReporter.Error(item, err)
 		// If we receive a fatal error during the execution of the snapshot,
 		// we abort the snapshot.
@@ -661,12 +850,32 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 	snapshotOpts := archiver.SnapshotOptions{
 		Excludes:        opts.Excludes,
 		Tags:            opts.Tags.Flatten(),
+		Labels:          labels,
 		BackupStart:     backupStart,
 		Time:            timeStamp,
 		Hostname:        opts.Host,
 		ParentSnapshot:  parentSnapshot,
 		ProgramVersion:  "restic " + version,
 		SkipIfUnchanged: opts.SkipIfUnchanged,
+		SigningKey:      signingKey,
+	}
+
+	// removing checkpoints is not possible in append-only mode
+	canRemoveCheckpoints := repo.KeyRole().CanRemove() && !repo.AppendOnly()
+	if opts.CheckpointEvery > 0 && !opts.DryRun {
+		snapshotOpts.CheckpointInterval = opts.CheckpointEvery
+		var lastCheckpoint *restic.ID
+		snapshotOpts.CheckpointSaved = func(ctx context.Context, id restic.ID) error {
+			progressPrinter.V("saved checkpoint %v", id.Str())
+			// only the latest checkpoint is useful to resume the backup
+			if lastCheckpoint != nil && canRemoveCheckpoints {
+				if err := repo.RemoveUnpacked(ctx, restic.WriteableSnapshotFile, *lastCheckpoint); err != nil {
+					return err
+				}
+			}
+			lastCheckpoint = &id
+			return nil
+		}
 	}
 
 	if !gopts.JSON {
@@ -685,8 +894,22 @@ func runBackup(ctx context.Context, opts BackupOptions, gopts GlobalOptions, ter
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
+	// checkpoints only exist if enabled or if a previous backup was interrupted
+	hasCheckpoints := opts.CheckpointEvery > 0 || (parentSnapshot != nil && parentSnapshot.IsCheckpoint())
+	if !opts.DryRun && hasCheckpoints {
+		if canRemoveCheckpoints {
+			err = removeCheckpoints(ctx, repo, opts, targets, timeStamp)
+			if err != nil {
+				return errors.Fatalf("unable to remove checkpoints: %v", err)
+			}
+		} else {
+			progressPrinter.V("checkpoints are kept as the key cannot remove snapshots")
+		}
+	}
+
 	// Report finished execution
 	progressReporter.Finish(id, summary, opts.DryRun)
+	recordBackupMetrics(gopts.metrics, summary, errorCount.Load())
 	if !success {
 		return ErrInvalidSourceData
 	}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/changes"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -723,3 +727,126 @@ func TestBackupSkipIfUnchanged(t *testing.T) {
 
 	testRunCheck(t, env.gopts)
 }
+
+func writeSigningKeys(t testing.TB, dir string) (privFile string, pubFile string) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	rtest.OK(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	rtest.OK(t, err)
+
+	rtest.OK(t, os.MkdirAll(dir, 0700))
+	privFile = filepath.Join(dir, "signing.pem")
+	pubFile = filepath.Join(dir, "trusted.pem")
+	rtest.OK(t, os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600))
+	rtest.OK(t, os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0600))
+	return privFile, pubFile
+}
+
+func TestBackupSigned(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	signingKey, trustedKeys := writeSigningKeys(t, filepath.Join(env.base, "signed"))
+	_, otherKeys := writeSigningKeys(t, filepath.Join(env.base, "other"))
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{SigningKeyFile: signingKey}, env.gopts)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	// invalid signatures are always reported, unsigned snapshots only with trusted keys
+	testRunCheck(t, env.gopts)
+	err := withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		opts := CheckOptions{trustedKeysOptions: trustedKeysOptions{TrustedKeysFile: trustedKeys}}
+		_, err := runCheck(ctx, opts, env.gopts, nil, term)
+		return err
+	})
+	rtest.Assert(t, err != nil, "check must report unsigned snapshot")
+
+	snapshotIDs := testListSnapshots(t, env.gopts, 2)
+	var signed, unsigned restic.ID
+	for _, id := range snapshotIDs {
+		if testLoadSnapshot(t, env.gopts, id).Signature != nil {
+			signed = id
+		} else {
+			unsigned = id
+		}
+	}
+	rtest.Assert(t, !signed.IsNull() && !unsigned.IsNull(), "expected one signed and one unsigned snapshot")
+
+	opts := RestoreOptions{Target: filepath.Join(env.base, "restore")}
+	opts.TrustedKeysFile = trustedKeys
+	rtest.OK(t, testRunRestoreAssumeFailure(signed.String(), opts, env.gopts))
+	err = testRunRestoreAssumeFailure(unsigned.String(), opts, env.gopts)
+	rtest.Assert(t, err != nil, "restore of unsigned snapshot must fail")
+	opts.TrustedKeysFile = otherKeys
+	err = testRunRestoreAssumeFailure(signed.String(), opts, env.gopts)
+	rtest.Assert(t, err != nil, "restore of snapshot signed by untrusted key must fail")
+}
+
+func TestBackupCheckpoints(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env.gopts.backendTestHook = nil
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{CheckpointEvery: time.Millisecond}
+
+	// checkpoints written during the backup are removed afterwards
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	testListSnapshots(t, env.gopts, 1)
+
+	// turn the snapshot into the checkpoint of an interrupted backup
+	testRunTag(t, TagOptions{AddTags: restic.TagLists{{restic.CheckpointTag}}}, env.gopts)
+	checkpointID := testListSnapshots(t, env.gopts, 1)[0]
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest == nil, "checkpoint must not be listed by default")
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+	rtest.Assert(t, snapshotIDs[0] != checkpointID, "checkpoint was not removed")
+	sn := testLoadSnapshot(t, env.gopts, snapshotIDs[0])
+	rtest.Assert(t, !sn.IsCheckpoint(), "final snapshot is marked as checkpoint")
+	// the trees of removed checkpoints are unused until the next prune
+	_, err := testRunCheckOutput(env.gopts, false)
+	rtest.OK(t, err)
+}
+
+func TestBackupChangesFrom(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env.gopts.backendTestHook = nil
+	testRunInit(t, env.gopts)
+
+	src := filepath.Join(env.base, "src")
+	for _, dir := range []string{"unchanged", "changed"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(src, dir), 0o755))
+		rtest.OK(t, os.WriteFile(filepath.Join(src, dir, "file"), []byte("foo"), 0o644))
+	}
+
+	journal := filepath.Join(env.base, "journal")
+	w, err := changes.Create(journal, []string{src}, time.Now())
+	rtest.OK(t, err)
+	testRunBackup(t, "", []string{src}, BackupOptions{}, env.gopts)
+
+	// only the modification in changed/ is recorded
+	for _, dir := range []string{"unchanged", "changed"} {
+		rtest.OK(t, os.WriteFile(filepath.Join(src, dir, "file"), []byte("foobar"), 0o644))
+	}
+	rtest.OK(t, w.Changed(filepath.Join(src, "changed", "file"), false, time.Now()))
+	rtest.OK(t, w.Sync(time.Now().Add(time.Hour)))
+	rtest.OK(t, w.Close())
+
+	testRunBackup(t, "", []string{src}, BackupOptions{ChangesFrom: journal}, env.gopts)
+	testListSnapshots(t, env.gopts, 2)
+
+	restored := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restored, "latest")
+	for dir, content := range map[string]string{"unchanged": "foo", "changed": "foobar"} {
+		buf, err := os.ReadFile(filepath.Join(restored, src, dir, "file"))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(buf), dir)
+	}
+	testRunCheck(t, env.gopts)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,7 +10,10 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -67,7 +71,7 @@ func TestCollectTargets(t *testing.T) {
 		FilesFromRaw:      []string{f3.Name()},
 	}
 
-	targets, err := collectTargets(opts, []string{filepath.Join(dir, "cmdline arg")})
+	targets, err := collectTargets(opts, []string{filepath.Join(dir, "cmdline arg")}, Warnf)
 	rtest.OK(t, err)
 	sort.Strings(targets)
 	rtest.Equals(t, expect, targets)
@@ -113,3 +117,51 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestLoadChangeSetFilters(t *testing.T) {
+	target := filepath.Join(rtest.TempDir(t), "src")
+	parent := &restic.Snapshot{
+		Paths:    []string{target},
+		Excludes: []string{"*.tmp"},
+		Summary:  &restic.SnapshotSummary{BackupStart: time.Now()},
+	}
+	excludes := filter.ExcludePatternOptions{Excludes: []string{"*.tmp"}}
+
+	for _, test := range []struct {
+		opts    BackupOptions
+		targets []string
+		err     string
+	}{
+		{BackupOptions{ExcludePatternOptions: excludes}, []string{target, target + "2"}, "paths differ"},
+		{BackupOptions{}, []string{target}, "excludes differ"},
+		{BackupOptions{ExcludePatternOptions: filter.ExcludePatternOptions{Excludes: excludes.Excludes, ExcludeFiles: []string{"excludes"}}}, []string{target}, "filter options"},
+		{BackupOptions{ExcludePatternOptions: excludes, ExcludeIfPresent: []string{".nobackup"}}, []string{target}, "filter options"},
+		{BackupOptions{ExcludePatternOptions: excludes, ExcludeLargerThan: "1M"}, []string{target}, "filter options"},
+		{BackupOptions{ExcludePatternOptions: excludes, ExcludeOtherFS: true}, []string{target}, "filter options"},
+	} {
+		_, err := loadChangeSet(context.TODO(), test.opts, parent, test.targets, time.Now())
+		rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err), "expected error %q, got %v", test.err, err)
+	}
+}
+
+func TestBackupGroupLabels(t *testing.T) {
+	opts := BackupOptions{
+		Labels:  []string{"env=prod", "ticket=INC123"},
+		GroupBy: restic.SnapshotGroupByOptions{Labels: []string{"env", "team"}},
+	}
+	l := opts.groupLabels()
+	rtest.Equals(t, restic.LabelList{"env=prod", "!team"}, l)
+
+	// a parent without the label team is in the same group, like for GroupSnapshots
+	for _, test := range []struct {
+		labels map[string]string
+		match  bool
+	}{
+		{map[string]string{"env": "prod"}, true},
+		{map[string]string{"env": "prod", "team": "ops"}, false},
+		{map[string]string{"env": "dev"}, false},
+	} {
+		sn := &restic.Snapshot{Labels: test.labels}
+		rtest.Assert(t, sn.HasLabels(l) == test.match, "unexpected result for %v, want %v", test.labels, test.match)
+	}
+}
@@ -50,10 +50,11 @@ Exit status is 12 if the password is incorrect.
 			term, cancel := setupTermstatus()
 			defer cancel()
 			summary, err := runCheck(cmd.Context(), opts, globalOptions, args, term)
+			if err != nil && summary.NumErrors == 0 {
+				summary.NumErrors = 1
+			}
+			recordCheckMetrics(globalOptions.metrics, summary)
 			if globalOptions.JSON {
-				if err != nil && summary.NumErrors == 0 {
-					summary.NumErrors = 1
-				}
 				term.Print(ui.ToJSONString(summary))
 			}
 			return err
@@ -69,6 +70,7 @@ Exit status is 12 if the password is incorrect.
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
+	trustedKeysOptions
 	ReadData       bool
 	ReadDataSubset string
 	CheckUnused    bool
@@ -86,6 +88,7 @@ func (opts *CheckOptions) AddFlags(f *pflag.FlagSet) {
 		panic(err)
 	}
 	f.BoolVar(&opts.WithCache, "with-cache", false, "use existing cache, only read uncached data from repository")
+	opts.trustedKeysOptions.AddFlags(f)
 }
 
 func checkFlags(opts CheckOptions) error {
@@ -233,13 +236,20 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		printer = newJSONErrorPrinter(term)
 	}
 
+	trustedKeys, err := opts.trustedKeysOptions.load()
+	if err != nil {
+		return summary, err
+	}
+
 	cleanup := prepareCheckCache(opts, &gopts, printer)
 	defer cleanup()
 
 	if !gopts.NoLock {
 		printer.P("create exclusive lock for repository\n")
 	}
-	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, gopts.NoLock)
+	// check does not modify the repository and is therefore also allowed for
+	// read-only keys
+	ctx, repo, unlock, err := internalOpenWithRole(ctx, gopts, gopts.NoLock, true, repository.KeyRole.CanRead, "read the repository")
 	if err != nil {
 		return summary, err
 	}
@@ -363,6 +373,29 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		return summary, ctx.Err()
 	}
 
+	errChan = make(chan error)
+	go chkr.Signatures(ctx, trustedKeys, errChan)
+
+	for err := range errChan {
+		errorsFound = true
+		summary.NumErrors++
+		printer.E("error: %v\n", err)
+	}
+	if ctx.Err() != nil {
+		return summary, ctx.Err()
+	}
+
+	policy, violations, err := chkr.PolicyViolations(ctx)
+	if err != nil {
+		printer.E("error: unable to check the retention policy: %v\n", err)
+	} else if len(violations) > 0 {
+		summary.HintForget = true
+		printer.S("%d snapshots are not kept by the retention policy version %d, you can run `restic forget` to remove them.\n", len(violations), policy.Version)
+		for _, sn := range violations {
+			printer.V("  %v\n", sn)
+		}
+	}
+
 	if opts.CheckUnused {
 		unused, err := chkr.UnusedBlobs(ctx)
 		if err != nil {
@@ -433,15 +466,48 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 		doReadData(packs)
 	}
 
+	if opts.ReadData {
+		printer.P("read all parity files\n")
+		p := printer.NewCounter("parity files")
+		errChan := make(chan error)
+		go chkr.ReadParity(ctx, p, errChan)
+
+		for err := range errChan {
+			errorsFound = true
+			summary.NumErrors++
+			printer.E("%v\n", err)
+			var parityErr *checker.ParityError
+			if errors.As(err, &parityErr) {
+				summary.BrokenParity = append(summary.BrokenParity, parityErr.ID.String())
+			}
+		}
+		p.Done()
+	}
+
 	if len(salvagePacks) > 0 {
-		printer.E("\nThe repository contains damaged pack files. These damaged files must be removed to repair the repository. This can be done using the following commands. Please read the troubleshooting guide at https://restic.readthedocs.io/en/stable/077_troubleshooting.html first.\n\n")
 		for id := range salvagePacks {
 			summary.BrokenPacks = append(summary.BrokenPacks, id.String())
 		}
-		printer.E("restic repair packs %v\nrestic repair snapshots --forget\n\n", strings.Join(summary.BrokenPacks, " "))
+		summary.RebuildablePacks = parityProtectedPacks(ctx, repo, salvagePacks)
+
+		if len(summary.RebuildablePacks) == len(salvagePacks) {
+			printer.E("\nThe repository contains damaged pack files. All of them are protected by parity files and can be rebuilt using the following command:\n\n")
+			printer.E("restic repair packs %v\n\n", strings.Join(summary.BrokenPacks, " "))
+		} else {
+			printer.E("\nThe repository contains damaged pack files. These damaged files must be removed to repair the repository. This can be done using the following commands. Please read the troubleshooting guide at https://restic.readthedocs.io/en/stable/077_troubleshooting.html first.\n\n")
+			printer.E("restic repair packs %v\nrestic repair snapshots --forget\n\n", strings.Join(summary.BrokenPacks, " "))
+			if len(summary.RebuildablePacks) > 0 {
+				printer.E("%d of the damaged pack files are protected by parity files, `restic repair packs` rebuilds them instead of removing them.\n\n", len(summary.RebuildablePacks))
+			}
+		}
 		printer.E("Damaged pack files can be caused by backend problems, hardware problems or bugs in restic. Please open an issue at https://github.com/restic/restic/issues/new/choose for further troubleshooting!\n")
 	}
 
+	if len(summary.BrokenParity) > 0 {
+		printer.E("\nThe repository contains damaged parity files. They can be replaced using the following command:\n\n")
+		printer.E("restic parity %v\n\n", strings.Join(summary.BrokenParity, " "))
+	}
+
 	if ctx.Err() != nil {
 		return summary, ctx.Err()
 	}
@@ -456,6 +522,25 @@ func runCheck(ctx context.Context, opts CheckOptions, gopts GlobalOptions, args
 	return summary, nil
 }
 
+// parityProtectedPacks returns which of the given pack files are protected by
+// a parity file.
+func parityProtectedPacks(ctx context.Context, repo *repository.Repository, packs restic.IDSet) []string {
+	headers, err := repository.LoadParity(ctx, repo, nil)
+	if err != nil {
+		return nil
+	}
+
+	var protected []string
+	for _, h := range headers {
+		for _, p := range h.Packs {
+			if packs.Has(p.ID) {
+				protected = append(protected, p.ID.String())
+			}
+		}
+	}
+	return protected
+}
+
 // selectPacksByBucket selects subsets of packs by ranges of buckets.
 func selectPacksByBucket(allPacks map[restic.ID]int64, bucket, totalBuckets uint) map[restic.ID]int64 {
 	packs := make(map[restic.ID]int64)
@@ -501,11 +586,14 @@ func selectRandomPacksByFileSize(allPacks map[restic.ID]int64, subsetSize int64,
 }
 
 type checkSummary struct {
-	MessageType     string   `json:"message_type"` // "summary"
-	NumErrors       int      `json:"num_errors"`
-	BrokenPacks     []string `json:"broken_packs"`         // run "restic repair packs ID..." and "restic repair snapshots --forget" to remove damaged files
-	HintRepairIndex bool     `json:"suggest_repair_index"` // run "restic repair index"
-	HintPrune       bool     `json:"suggest_prune"`        // run "restic prune"
+	MessageType      string   `json:"message_type"` // "summary"
+	NumErrors        int      `json:"num_errors"`
+	BrokenPacks      []string `json:"broken_packs"`                // run "restic repair packs ID..." and "restic repair snapshots --forget" to remove damaged files
+	RebuildablePacks []string `json:"rebuildable_packs,omitempty"` // broken packs protected by parity files, "restic repair packs ID..." rebuilds them
+	BrokenParity     []string `json:"broken_parity,omitempty"`     // run "restic parity ID..." to replace damaged parity files
+	HintRepairIndex  bool     `json:"suggest_repair_index"`        // run "restic repair index"
+	HintPrune        bool     `json:"suggest_prune"`               // run "restic prune"
+	HintForget       bool     `json:"suggest_forget"`              // run "restic forget" to apply the retention policy
 }
 
 type checkError struct {
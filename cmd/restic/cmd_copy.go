@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -32,7 +33,14 @@ between the files copied and files already stored in the destination repository.
 This means that copied files, which existed in both the source and destination
 repository, /may occupy up to twice their space/ in the destination repository.
 This can be mitigated by the "--copy-chunker-params" option when initializing a
-new destination repository using the "init" command.
+new destination repository using the "init" command. If the destination
+repository was additionally initialized with "--copy-master-key", pack files
+are copied without decrypting and encrypting them again where possible.
+
+The data of all snapshots to copy is collected first and copied in batches,
+snapshots are saved as soon as all of their data was copied. The list of data
+to copy is kept in a journal in the cache directory, such that an interrupted
+copy can be resumed without collecting the data again.
 
 EXIT STATUS
 ===========
@@ -87,6 +95,11 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 	}
 	defer unlock()
 
+	if srcRepo.Config().ChunkerParams() != dstRepo.Config().ChunkerParams() {
+		Warnf("the source and destination repository use different chunker parameters, copied data\n" +
+			"will not be deduplicated against data backed up directly to the destination repository\n")
+	}
+
 	srcSnapshotLister, err := restic.MemorizeList(ctx, srcRepo, restic.SnapshotFile)
 	if err != nil {
 		return err
@@ -120,9 +133,7 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 		return ctx.Err()
 	}
 
-	// remember already processed trees across all snapshots
-	visitedTrees := restic.NewIDSet()
-
+	var pending []*restic.Snapshot
 	for sn := range FindFilteredSnapshots(ctx, srcSnapshotLister, srcRepo, &opts.SnapshotFilter, args) {
 		// check whether the destination has a snapshot with the same persistent ID which has similar snapshot fields
 		srcOriginal := *sn.ID()
@@ -144,49 +155,161 @@ func runCopy(ctx context.Context, opts CopyOptions, gopts GlobalOptions, args []
 				continue
 			}
 		}
-		Verbosef("\n%v\n", sn)
-		Verbosef("  copy started, this may take a while...\n")
-		if err := copyTree(ctx, srcRepo, dstRepo, visitedTrees, *sn.Tree, gopts.Quiet); err != nil {
+		pending = append(pending, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	journalPath := copyJournalPath(srcRepo, dstRepo)
+	if len(pending) > 0 {
+		isCopied := func(original restic.ID) bool {
+			return len(dstSnapshotByOriginal[original]) > 0
+		}
+		groups, err := planCopy(ctx, srcRepo, dstRepo, pending, isCopied, journalPath, gopts)
+		if err != nil {
 			return err
 		}
-		debug.Log("tree copied")
 
-		// save snapshot
-		sn.Parent = nil // Parent does not have relevance in the new repo.
-		// Use Original as a persistent snapshot ID
-		if sn.Original == nil {
-			sn.Original = sn.ID()
-		}
-		newID, err := restic.SaveSnapshot(ctx, dstRepo, sn)
+		progress := newCopyProgress(gopts)
+		err = copyGroups(ctx, srcRepo, dstRepo, groups, progress, gopts)
+		progress.Finish()
 		if err != nil {
 			return err
 		}
-		Verbosef("snapshot %s saved\n", newID.Str())
+	}
+
+	if journalPath != "" {
+		if err := os.Remove(journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			Warnf("unable to remove copy journal: %v\n", err)
+		}
 	}
 	return ctx.Err()
 }
 
-func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
-	// everything except Parent and Original must match
-	if !sna.Time.Equal(snb.Time) || !sna.Tree.Equal(*snb.Tree) || sna.Hostname != snb.Hostname ||
-		sna.Username != snb.Username || sna.UID != snb.UID || sna.GID != snb.GID ||
-		len(sna.Paths) != len(snb.Paths) || len(sna.Excludes) != len(snb.Excludes) ||
-		len(sna.Tags) != len(snb.Tags) {
-		return false
+// copyBatchSize is the amount of data after which the blobs collected so far
+// are copied and the snapshots which only reference copied blobs are saved.
+const copyBatchSize = 4 << 30
+
+// copyGroup is a snapshot together with the blobs which have to be copied for
+// it and which are not copied for one of the previous snapshots.
+type copyGroup struct {
+	sn       *restic.Snapshot
+	original restic.ID
+	blobs    restic.BlobSet
+}
+
+// planCopy determines the blobs which have to be copied for each of the
+// pending snapshots. The plan is saved to the journal at journalPath, such that
+// an interrupted copy can be resumed without traversing the snapshots again.
+func planCopy(ctx context.Context, srcRepo, dstRepo *repository.Repository, pending []*restic.Snapshot,
+	isCopied func(original restic.ID) bool, journalPath string, gopts GlobalOptions) ([]copyGroup, error) {
+
+	pendingByID := make(map[restic.ID]*restic.Snapshot, len(pending))
+	for _, sn := range pending {
+		pendingByID[*sn.ID()] = sn
 	}
-	if !sna.HasPaths(snb.Paths) || !sna.HasTags(snb.Tags) {
-		return false
+
+	dstIndexes := dstRepo.IndexIDs()
+
+	var err error
+	var journal *copyJournal
+	if journalPath != "" {
+		journal, err = loadCopyJournal(journalPath)
+		if err != nil {
+			Warnf("ignoring copy journal: %v\n", err)
+			journal = nil
+		}
 	}
-	for i, a := range sna.Excludes {
-		if a != snb.Excludes[i] {
-			return false
+
+	// Later snapshots in the journal do not list the blobs of earlier ones,
+	// which must therefore either be copied already or be copied again.
+	if journal != nil && journal.usable(srcRepo, dstRepo, dstIndexes) {
+		for _, e := range journal.Snapshots {
+			if pendingByID[e.Snapshot] == nil && !isCopied(e.Original) {
+				debug.Log("snapshot %v from the copy journal is neither pending nor copied", e.Snapshot.Str())
+				journal = nil
+				break
+			}
 		}
+	} else {
+		journal = nil
 	}
-	return true
+
+	var groups []copyGroup
+	planned := restic.NewBlobSet()
+	if journal != nil {
+		for _, e := range journal.Snapshots {
+			sn := pendingByID[e.Snapshot]
+			if sn == nil {
+				continue
+			}
+			delete(pendingByID, e.Snapshot)
+
+			blobs := restic.NewBlobSet()
+			for _, h := range e.Blobs {
+				// skip blobs copied before the interruption
+				if _, ok := dstRepo.LookupBlobSize(h.Type, h.ID); !ok && !planned.Has(h) {
+					blobs.Insert(h)
+					planned.Insert(h)
+				}
+			}
+			groups = append(groups, copyGroup{sn: sn, original: e.Original, blobs: blobs})
+		}
+		if !gopts.JSON {
+			Verbosef("resuming interrupted copy of %d snapshots\n", len(groups))
+		}
+	}
+
+	// remember already processed trees across all snapshots
+	visitedTrees := restic.NewIDSet()
+	for _, sn := range pending {
+		if pendingByID[*sn.ID()] == nil {
+			// planned by the journal
+			continue
+		}
+		if !gopts.JSON {
+			Verbosef("\n%v\n", sn)
+			Verbosef("  collecting blobs to copy, this may take a while...\n")
+		}
+		blobs, err := collectBlobs(ctx, srcRepo, dstRepo, visitedTrees, planned, *sn.Tree)
+		if err != nil {
+			return nil, err
+		}
+
+		original := *sn.ID()
+		if sn.Original != nil {
+			original = *sn.Original
+		}
+		groups = append(groups, copyGroup{sn: sn, original: original, blobs: blobs})
+	}
+
+	if journalPath != "" {
+		journal = &copyJournal{
+			Source:      srcRepo.Config().ID,
+			Destination: dstRepo.Config().ID,
+			Indexes:     dstIndexes.List(),
+		}
+		for _, g := range groups {
+			journal.Snapshots = append(journal.Snapshots, copyJournalEntry{
+				Snapshot: *g.sn.ID(),
+				Original: g.original,
+				Blobs:    g.blobs.List(),
+			})
+		}
+		if err := journal.save(journalPath); err != nil {
+			Warnf("unable to save copy journal, an interrupted copy cannot be resumed: %v\n", err)
+		}
+	}
+
+	return groups, nil
 }
 
-func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Repository,
-	visitedTrees restic.IDSet, rootTreeID restic.ID, quiet bool) error {
+// collectBlobs returns the blobs referenced by the tree rootTreeID which are
+// neither stored in dstRepo nor contained in planned. The returned blobs are
+// added to planned.
+func collectBlobs(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Repository,
+	visitedTrees restic.IDSet, planned restic.BlobSet, rootTreeID restic.ID) (restic.BlobSet, error) {
 
 	wg, wgCtx := errgroup.WithContext(ctx)
 
@@ -197,14 +320,15 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 	}, nil)
 
 	copyBlobs := restic.NewBlobSet()
-	packList := restic.NewIDSet()
-
 	enqueue := func(h restic.BlobHandle) {
-		pb := srcRepo.LookupBlob(h.Type, h.ID)
-		copyBlobs.Insert(h)
-		for _, p := range pb {
-			packList.Insert(p.PackID)
+		if planned.Has(h) {
+			return
 		}
+		if _, ok := dstRepo.LookupBlobSize(h.Type, h.ID); ok {
+			return
+		}
+		copyBlobs.Insert(h)
+		planned.Insert(h)
 	}
 
 	wg.Go(func() error {
@@ -213,44 +337,149 @@ func copyTree(ctx context.Context, srcRepo restic.Repository, dstRepo restic.Rep
 				return fmt.Errorf("LoadTree(%v) returned error %v", tree.ID.Str(), tree.Error)
 			}
 
-			// Do we already have this tree blob?
-			treeHandle := restic.BlobHandle{ID: tree.ID, Type: restic.TreeBlob}
-			if _, ok := dstRepo.LookupBlobSize(treeHandle.Type, treeHandle.ID); !ok {
-				// copy raw tree bytes to avoid problems if the serialization changes
-				enqueue(treeHandle)
-			}
+			// copy raw tree bytes to avoid problems if the serialization changes
+			enqueue(restic.BlobHandle{ID: tree.ID, Type: restic.TreeBlob})
 
 			for _, entry := range tree.Nodes {
 				// Recursion into directories is handled by StreamTrees
 				// Copy the blobs for this file.
 				for _, blobID := range entry.Content {
-					h := restic.BlobHandle{Type: restic.DataBlob, ID: blobID}
-					if _, ok := dstRepo.LookupBlobSize(h.Type, h.ID); !ok {
-						enqueue(h)
-					}
+					enqueue(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
 				}
 			}
 		}
 		return nil
 	})
-	err := wg.Wait()
-	if err != nil {
-		return err
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	return copyBlobs, nil
+}
+
+// copyGroups copies the blobs of the groups in batches of about copyBatchSize.
+// After each batch, the snapshots of the batch are saved.
+func copyGroups(ctx context.Context, srcRepo, dstRepo *repository.Repository, groups []copyGroup,
+	progress *copyProgress, gopts GlobalOptions) error {
+
+	var totalBlobs, totalBytes uint64
+	for _, g := range groups {
+		for h := range g.blobs {
+			size, _ := srcRepo.LookupBlobSize(h.Type, h.ID)
+			totalBlobs++
+			totalBytes += uint64(size)
+		}
 	}
+	progress.SetTotal(uint64(len(groups)), totalBlobs, totalBytes)
 
-	bar := newProgressMax(!quiet, uint64(len(packList)), "packs copied")
-	_, err = repository.Repack(
-		ctx,
-		srcRepo,
-		dstRepo,
-		packList,
-		copyBlobs,
-		bar,
-		func(msg string, args ...interface{}) { fmt.Printf(msg+"\n", args...) },
-	)
-	bar.Done()
-	if err != nil {
-		return errors.Fatal(err.Error())
+	rawCopy := repository.CanCopyPacks(srcRepo, dstRepo)
+	if rawCopy && !gopts.JSON {
+		Verbosef("both repositories use the same master key, copying pack files without re-encrypting them\n")
+	}
+
+	var batch []copyGroup
+	batchBlobs := restic.NewBlobSet()
+	var batchSize uint64
+	for i, g := range groups {
+		batch = append(batch, g)
+		for h := range g.blobs {
+			size, _ := srcRepo.LookupBlobSize(h.Type, h.ID)
+			batchBlobs.Insert(h)
+			batchSize += uint64(size)
+		}
+		if batchSize < copyBatchSize && i+1 < len(groups) {
+			continue
+		}
+
+		debug.Log("copying %d blobs for %d snapshots", len(batchBlobs), len(batch))
+		if err := copyBlobs(ctx, srcRepo, dstRepo, batchBlobs, rawCopy, progress, gopts); err != nil {
+			return err
+		}
+
+		for _, g := range batch {
+			sn := g.sn
+			srcID := *sn.ID()
+			// save snapshot
+			sn.Parent = nil // Parent does not have relevance in the new repo.
+			// Use Original as a persistent snapshot ID
+			if sn.Original == nil {
+				sn.Original = sn.ID()
+			}
+			newID, err := restic.SaveSnapshot(ctx, dstRepo, sn)
+			if err != nil {
+				return err
+			}
+			progress.SnapshotDone()
+			if !gopts.JSON {
+				Verbosef("snapshot %s saved as %s\n", srcID.Str(), newID.Str())
+			}
+		}
+
+		batch = nil
+		batchBlobs = restic.NewBlobSet()
+		batchSize = 0
+	}
+	return nil
+}
+
+// copyBlobs copies blobs from srcRepo to dstRepo. If rawCopy is set, packs of
+// which all blobs are needed are copied without decrypting them.
+func copyBlobs(ctx context.Context, srcRepo, dstRepo *repository.Repository, blobs restic.BlobSet,
+	rawCopy bool, progress *copyProgress, gopts GlobalOptions) error {
+
+	keepBlobs := &countingBlobSet{BlobSet: blobs, repo: srcRepo, progress: progress}
+	logf := func(msg string, args ...interface{}) {
+		// the messages would break the output in JSON mode
+		if !gopts.JSON {
+			Verbosef(msg+"\n", args...)
+		}
+	}
+
+	if rawCopy && len(blobs) > 0 {
+		_, err := repository.CopyPacks(ctx, srcRepo, dstRepo, packsContaining(srcRepo, blobs), keepBlobs, nil)
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+	}
+
+	if len(blobs) > 0 {
+		_, err := repository.Repack(ctx, srcRepo, dstRepo, packsContaining(srcRepo, blobs), keepBlobs, nil, logf)
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+	}
+
+	if len(blobs) > 0 {
+		return errors.Fatalf("unable to copy %d blobs, they are missing in the source repository", len(blobs))
 	}
 	return nil
 }
+
+// packsContaining returns the packs of repo which contain the blobs.
+func packsContaining(repo restic.Repository, blobs restic.BlobSet) restic.IDSet {
+	packs := restic.NewIDSet()
+	for h := range blobs {
+		for _, pb := range repo.LookupBlob(h.Type, h.ID) {
+			packs.Insert(pb.PackID)
+		}
+	}
+	return packs
+}
+
+func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
+	// everything except Parent and Original must match
+	if !sna.Time.Equal(snb.Time) || !sna.Tree.Equal(*snb.Tree) || sna.Hostname != snb.Hostname ||
+		sna.Username != snb.Username || sna.UID != snb.UID || sna.GID != snb.GID ||
+		len(sna.Paths) != len(snb.Paths) || len(sna.Excludes) != len(snb.Excludes) ||
+		len(sna.Tags) != len(snb.Tags) {
+		return false
+	}
+	if !sna.HasPaths(snb.Paths) || !sna.HasTags(snb.Tags) {
+		return false
+	}
+	for i, a := range sna.Excludes {
+		if a != snb.Excludes[i] {
+			return false
+		}
+	}
+	return true
+}
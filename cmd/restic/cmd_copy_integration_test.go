@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -155,3 +160,107 @@ func TestCopyToEmptyPassword(t *testing.T) {
 	testListSnapshots(t, env2.gopts, 1)
 	testRunCheck(t, env2.gopts)
 }
+
+func TestCopyResume(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+	testRunInit(t, env2.gopts)
+
+	ctx := context.TODO()
+	srcRepo, err := OpenRepository(ctx, env.gopts)
+	rtest.OK(t, err)
+	var pending []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, srcRepo, srcRepo, &restic.SnapshotFilter{}, nil) {
+		pending = append(pending, sn)
+	}
+	rtest.OK(t, srcRepo.LoadIndex(ctx, nil))
+	dstRepo, err := OpenRepository(ctx, env2.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, dstRepo.LoadIndex(ctx, nil))
+	isCopied := func(restic.ID) bool { return false }
+
+	// simulate a copy which was interrupted after collecting the blobs
+	journalPath := copyJournalPath(srcRepo, dstRepo)
+	groups, err := planCopy(ctx, srcRepo, dstRepo, pending, isCopied, journalPath, env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(groups))
+
+	// a journal is not used if an index of the destination repository was removed
+	journal, err := loadCopyJournal(journalPath)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(journal.Snapshots))
+	journal.Indexes = append(journal.Indexes, restic.NewRandomID())
+	rtest.OK(t, journal.save(journalPath))
+
+	out, err := withCaptureStdout(func() error {
+		globalOptions.verbosity = 1
+		_, err := planCopy(ctx, srcRepo, dstRepo, pending, isCopied, journalPath, env.gopts)
+		return err
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, !strings.Contains(out.String(), "resuming"), "unexpected resume:\n%v", out)
+
+	out, err = withCaptureStdout(func() error {
+		globalOptions.verbosity = 1
+		testRunCopy(t, env.gopts, env2.gopts)
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(out.String(), "resuming interrupted copy of 3 snapshots"), "copy was not resumed:\n%v", out)
+
+	_, err = os.Stat(journalPath)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "journal was not removed: %v", err)
+	testRunCheck(t, env2.gopts)
+	testListSnapshots(t, env2.gopts, 3)
+}
+
+func TestCopyRawPacks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+
+	initOpts := InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     env.gopts.Repo,
+			password: env.gopts.password,
+		},
+		CopyChunkerParameters: true,
+		CopyMasterKey:         true,
+		RepositoryVersion:     "latest",
+	}
+	rtest.OK(t, runInit(context.TODO(), initOpts, env2.gopts, nil))
+
+	env.gopts.JSON = true
+	out, err := withCaptureStdout(func() error {
+		testRunCopy(t, env.gopts, env2.gopts)
+		return nil
+	})
+	rtest.OK(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var summary copySummary
+	rtest.OK(t, json.Unmarshal([]byte(lines[len(lines)-1]), &summary))
+	rtest.Equals(t, "summary", summary.MessageType)
+	rtest.Equals(t, uint64(2), summary.SnapshotsCopied)
+	rtest.Assert(t, summary.BlobsCopied > 0 && summary.BytesCopied > 0, "unexpected summary %v", summary)
+
+	// all packs are needed and are copied as they are
+	env.gopts.JSON = false
+	rtest.Equals(t, testRunList(t, "packs", env.gopts), testRunList(t, "packs", env2.gopts))
+	testRunCheck(t, env2.gopts)
+	testListSnapshots(t, env2.gopts, 2)
+}
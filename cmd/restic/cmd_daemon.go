@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/daemon"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newDaemonCommand() *cobra.Command {
+	var opts DaemonOptions
+
+	cmd := &cobra.Command{
+		Use:   "daemon [flags] profile",
+		Short: "Run backups and maintenance jobs according to a profile",
+		Long: `
+The "daemon" command reads the repositories, backup sets and schedules from a
+YAML profile and runs the configured backup, forget, check and prune jobs until
+it is interrupted. Repositories stay open between jobs, jobs for the same
+repository are never run concurrently.
+
+See the documentation for a description of the profile format.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+`,
+		GroupID:           cmdGroupDefault,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			term, cancel := setupTermstatus()
+			defer cancel()
+			return runDaemon(cmd.Context(), opts, globalOptions, term, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// DaemonOptions collects all options for the daemon command.
+type DaemonOptions struct {
+	Once bool
+}
+
+func (opts *DaemonOptions) AddFlags(f *pflag.FlagSet) {
+	f.BoolVar(&opts.Once, "once", false, "run all jobs once and exit, ignoring their schedules")
+}
+
+// daemonRepository keeps a repository open between the jobs of the daemon.
+type daemonRepository struct {
+	name  string
+	gopts GlobalOptions
+}
+
+// open returns global options for which OpenRepository returns the already
+// opened repository.
+func (r *daemonRepository) open(ctx context.Context) (GlobalOptions, error) {
+	if r.gopts.repo == nil {
+		Verbosef("opening repository %v\n", r.name)
+		repo, err := OpenRepository(ctx, r.gopts)
+		if err != nil {
+			return GlobalOptions{}, err
+		}
+		r.gopts.repo = repo
+	}
+	return r.gopts, nil
+}
+
+// run runs fn for the job with the opened repository and the output of the
+// job. If fn fails, the repository is reopened before the next job as its
+// state is unknown.
+func (r *daemonRepository) run(ctx context.Context, job string, term *termstatus.Terminal, fn func(gopts GlobalOptions, term *termstatus.Terminal) error) error {
+	gopts, err := r.open(ctx)
+	if err != nil {
+		return err
+	}
+	err = withDaemonJobOutput(job, term, &gopts, func(term *termstatus.Terminal) error {
+		return fn(gopts, term)
+	})
+	if err != nil {
+		r.close()
+	}
+	return err
+}
+
+// close closes the opened repository, if any, such that the next job opens
+// it again.
+func (r *daemonRepository) close() {
+	if r.gopts.repo == nil {
+		return
+	}
+	if err := r.gopts.repo.Close(); err != nil {
+		Warnf("unable to close repository %v: %v\n", r.name, err)
+	}
+	r.gopts.repo = nil
+}
+
+// withDaemonJobOutput runs fn with a terminal for the job, which prefixes all
+// lines with the job name before passing them to term. The stdout and stderr
+// streams of gopts are replaced accordingly. This keeps apart the output of
+// jobs running concurrently. Status lines are disabled, as the jobs would
+// overwrite each other's status.
+func withDaemonJobOutput(job string, term *termstatus.Terminal, gopts *GlobalOptions, fn func(term *termstatus.Terminal) error) error {
+	prefix := "[" + job + "] "
+	jobTerm := termstatus.New(&prefixWriter{prefix: prefix, print: term.Print}, &prefixWriter{prefix: prefix, print: term.Error}, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		jobTerm.Run(ctx)
+	}()
+
+	stdout, stderr := termstatus.WrapStdio(jobTerm)
+	gopts.stdout, gopts.stderr = stdout, stderr
+	err := fn(jobTerm)
+
+	_ = stdout.Close()
+	_ = stderr.Close()
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// prefixWriter passes complete lines to print, each line starts with prefix.
+type prefixWriter struct {
+	prefix string
+	print  func(string)
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	var lines strings.Builder
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		lines.WriteString(w.prefix)
+		lines.Write(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	if lines.Len() > 0 {
+		w.print(lines.String())
+	}
+	return len(p), nil
+}
+
+func newDaemonRepository(ctx context.Context, name string, cfg *daemon.Repository, gopts GlobalOptions) (*daemonRepository, error) {
+	gopts.Repo = cfg.Repository
+	gopts.RepositoryFile = cfg.RepositoryFile
+	gopts.KeyHint = cfg.KeyHint
+	if cfg.RetryLock != 0 {
+		gopts.RetryLock = cfg.RetryLock
+	}
+
+	if cfg.PasswordFile != "" || cfg.PasswordCommand != "" {
+		gopts.PasswordFile = cfg.PasswordFile
+		gopts.PasswordCommand = cfg.PasswordCommand
+		pwd, err := resolvePassword(&gopts, "RESTIC_PASSWORD")
+		if err != nil {
+			return nil, errors.Fatalf("resolving password for repository %v failed: %v", name, err)
+		}
+		gopts.password = pwd
+	}
+	// the password is requested at most once, this prevents prompting for it before each job
+	pwd, err := ReadPassword(ctx, gopts, "enter password for repository "+name+": ")
+	if err != nil {
+		return nil, err
+	}
+	gopts.password = pwd
+
+	if len(cfg.Options) > 0 {
+		gopts.Options = append(append([]string{}, gopts.Options...), cfg.Options...)
+		gopts.extended, err = options.Parse(gopts.Options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &daemonRepository{name: name, gopts: gopts}, nil
+}
+
+func daemonBackupJob(name string, cfg *daemon.Backup, repo *daemonRepository, maxUnused string, term *termstatus.Terminal) (*daemon.Job, error) {
+	schedule, err := daemon.ParseSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := BackupOptions{
+		ExcludePatternOptions: filter.ExcludePatternOptions{
+			Excludes:            cfg.Excludes,
+			InsensitiveExcludes: cfg.IExcludes,
+			ExcludeFiles:        cfg.ExcludeFiles,
+		},
+		GroupBy:          restic.SnapshotGroupByOptions{Host: true, Path: true},
+		ExcludeIfPresent: cfg.ExcludeIfPresent,
+		ExcludeCaches:    cfg.ExcludeCaches,
+		ExcludeOtherFS:   cfg.OneFileSystem,
+		Host:             cfg.Host,
+		CheckpointEvery:  cfg.CheckpointInterval,
+	}
+	if len(cfg.Tags) > 0 {
+		opts.Tags = restic.TagLists{cfg.Tags}
+	}
+	if opts.Host == "" {
+		opts.Host, err = os.Hostname()
+		if err != nil {
+			debug.Log("os.Hostname() returned err: %v", err)
+		}
+	}
+
+	var forgetOpts *ForgetOptions
+	if cfg.Forget != nil {
+		policy, err := cfg.Forget.ExpirePolicy()
+		if err != nil {
+			return nil, err
+		}
+
+		// only forget snapshots created by this backup set
+		f := restic.SnapshotFilter{Hosts: []string{opts.Host}}
+		if len(cfg.Tags) > 0 {
+			f.Tags = restic.TagLists{cfg.Tags}
+		}
+		for _, path := range cfg.Paths {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+			f.Paths = append(f.Paths, abs)
+		}
+
+		forgetOpts = &ForgetOptions{
+			Last:           ForgetPolicyCount(policy.Last),
+			Hourly:         ForgetPolicyCount(policy.Hourly),
+			Daily:          ForgetPolicyCount(policy.Daily),
+			Weekly:         ForgetPolicyCount(policy.Weekly),
+			Monthly:        ForgetPolicyCount(policy.Monthly),
+			Yearly:         ForgetPolicyCount(policy.Yearly),
+			Within:         policy.Within,
+			WithinHourly:   policy.WithinHourly,
+			WithinDaily:    policy.WithinDaily,
+			WithinWeekly:   policy.WithinWeekly,
+			WithinMonthly:  policy.WithinMonthly,
+			WithinYearly:   policy.WithinYearly,
+			KeepTags:       policy.Tags,
+			SnapshotFilter: f,
+			GroupBy:        restic.SnapshotGroupByOptions{Host: true, Path: true},
+			Prune:          cfg.Forget.Prune,
+		}
+	}
+
+	jobName := "backup " + name
+	return &daemon.Job{
+		Name:       jobName,
+		Repository: repo.name,
+		Schedule:   schedule,
+		Run: func(ctx context.Context) error {
+			return repo.run(ctx, jobName, term, func(gopts GlobalOptions, term *termstatus.Terminal) error {
+				err := runBackup(ctx, opts, gopts, term, cfg.Paths)
+				if err != nil || forgetOpts == nil {
+					return err
+				}
+				return runForget(ctx, *forgetOpts, PruneOptions{MaxUnused: maxUnused}, gopts, term, nil)
+			})
+		},
+	}, nil
+}
+
+func daemonJobs(ctx context.Context, profile *daemon.Profile, gopts GlobalOptions, term *termstatus.Terminal) ([]*daemon.Job, error) {
+	repos := make(map[string]*daemonRepository)
+	var repoNames []string
+	for name := range profile.Repositories {
+		repoNames = append(repoNames, name)
+	}
+	sort.Strings(repoNames)
+
+	for _, name := range repoNames {
+		repo, err := newDaemonRepository(ctx, name, profile.Repositories[name], gopts)
+		if err != nil {
+			return nil, err
+		}
+		repos[name] = repo
+	}
+
+	maxUnused := func(repo string) string {
+		if cfg := profile.Repositories[repo]; cfg.Prune != nil && cfg.Prune.MaxUnused != "" {
+			return cfg.Prune.MaxUnused
+		}
+		return "5%"
+	}
+
+	var jobs []*daemon.Job
+	var backupNames []string
+	for name := range profile.Backups {
+		backupNames = append(backupNames, name)
+	}
+	sort.Strings(backupNames)
+
+	for _, name := range backupNames {
+		cfg := profile.Backups[name]
+		job, err := daemonBackupJob(name, cfg, repos[cfg.Repository], maxUnused(cfg.Repository), term)
+		if err != nil {
+			return nil, errors.Fatalf("backup %v: %v", name, err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	for _, name := range repoNames {
+		cfg := profile.Repositories[name]
+		repo := repos[name]
+
+		if cfg.Prune != nil {
+			schedule, err := daemon.ParseSchedule(cfg.Prune.Schedule)
+			if err != nil {
+				return nil, err
+			}
+			opts := PruneOptions{MaxUnused: maxUnused(name)}
+			jobName := "prune " + name
+			jobs = append(jobs, &daemon.Job{
+				Name:       jobName,
+				Repository: name,
+				Schedule:   schedule,
+				Run: func(ctx context.Context) error {
+					return repo.run(ctx, jobName, term, func(gopts GlobalOptions, term *termstatus.Terminal) error {
+						return runPrune(ctx, opts, gopts, term)
+					})
+				},
+			})
+		}
+
+		if cfg.Check != nil {
+			schedule, err := daemon.ParseSchedule(cfg.Check.Schedule)
+			if err != nil {
+				return nil, err
+			}
+			// the repository is already open and uses the regular cache
+			opts := CheckOptions{ReadDataSubset: cfg.Check.ReadDataSubset, WithCache: true}
+			jobName := "check " + name
+			jobs = append(jobs, &daemon.Job{
+				Name:       jobName,
+				Repository: name,
+				Schedule:   schedule,
+				Run: func(ctx context.Context) error {
+					return repo.run(ctx, jobName, term, func(gopts GlobalOptions, term *termstatus.Terminal) error {
+						_, err := runCheck(ctx, opts, gopts, nil, term)
+						return err
+					})
+				},
+			})
+		}
+	}
+
+	return jobs, nil
+}
+
+func runDaemon(ctx context.Context, opts DaemonOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("the daemon command expects the profile as its only argument")
+	}
+	if gopts.JSON {
+		return errors.Fatal("the daemon command does not support JSON output")
+	}
+
+	profile, err := daemon.LoadProfile(args[0])
+	if err != nil {
+		return err
+	}
+
+	jobs, err := daemonJobs(ctx, profile, gopts, term)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	report := func(job *daemon.Job, err error) {
+		if err != nil {
+			failed++
+			Warnf("job %v failed: %v\n", job.Name, err)
+			return
+		}
+		Verbosef("job %v finished\n", job.Name)
+	}
+
+	if opts.Once {
+		daemon.RunOnce(ctx, jobs, report)
+		if failed > 0 {
+			return errors.Fatalf("%d jobs failed", failed)
+		}
+		return ctx.Err()
+	}
+
+	for _, job := range jobs {
+		Verbosef("scheduled job %v\n", job.Name)
+	}
+	daemon.Run(ctx, jobs, report)
+	return nil
+}
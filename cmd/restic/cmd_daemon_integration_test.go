@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func testRunDaemonOnce(t testing.TB, gopts GlobalOptions, profile string) error {
+	filename := filepath.Join(t.TempDir(), "profile.yaml")
+	rtest.OK(t, os.WriteFile(filename, []byte(profile), 0o600))
+
+	return withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runDaemon(ctx, DaemonOptions{Once: true}, gopts, term, []string{filename})
+	})
+}
+
+func TestDaemonOnce(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	// the repository is kept open and therefore lists files more than once
+	env.gopts.backendTestHook = nil
+
+	profile := fmt.Sprintf(`
+repositories:
+  local:
+    repository: %q
+    check:
+      schedule: "@weekly"
+    prune:
+      schedule: "@weekly"
+backups:
+  testdata:
+    repository: local
+    schedule: "@daily"
+    paths: [%q]
+    tags: [daemon]
+    forget:
+      keep-last: 1
+`, env.repo, env.testdata)
+
+	for i := 0; i < 2; i++ {
+		rtest.OK(t, testRunDaemonOnce(t, env.gopts, profile))
+	}
+
+	// the output of each job is prefixed with the job name
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	gopts.Verbose = 1
+	rtest.OK(t, testRunDaemonOnce(t, gopts, profile))
+	output := strings.TrimSpace(buf.String())
+	rtest.Assert(t, strings.Contains(output, "[backup testdata] snapshots for"), "missing forget output in %q", output)
+	for _, line := range strings.Split(output, "\n") {
+		rtest.Assert(t, strings.HasPrefix(line, "[backup testdata] ") ||
+			strings.HasPrefix(line, "[check local] ") ||
+			strings.HasPrefix(line, "[prune local] "), "line without job prefix %q", line)
+	}
+
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+	sn := testLoadSnapshot(t, env.gopts, snapshotIDs[0])
+	rtest.Equals(t, []string{"daemon"}, sn.Tags)
+}
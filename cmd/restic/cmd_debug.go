@@ -16,7 +16,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
@@ -336,7 +335,7 @@ func decryptUnsigned(k *crypto.Key, buf []byte) []byte {
 }
 
 func loadBlobs(ctx context.Context, opts DebugExamineOptions, repo restic.Repository, packID restic.ID, list []restic.Blob) error {
-	dec, err := zstd.NewReader(nil)
+	dec, err := repo.(*repository.Repository).NewZstdDecoder()
 	if err != nil {
 		panic(err)
 	}
@@ -19,7 +19,7 @@ func newDiffCommand() *cobra.Command {
 	var opts DiffOptions
 
 	cmd := &cobra.Command{
-		Use:   "diff [flags] snapshotID snapshotID",
+		Use:   "diff [flags] snapshotID [snapshotID]",
 		Short: "Show differences between two snapshots",
 		Long: `
 The "diff" command shows differences from the first to the second snapshot. The
@@ -40,6 +40,14 @@ To only compare files in specific subfolders, you can use the
 "snapshotID:subfolder" syntax, where "subfolder" is a path within the
 snapshot.
 
+With "--live path", the snapshot is compared with the files and directories
+in the local directory "path" instead of a second snapshot. Unless a subfolder
+is specified, the absolute local path is compared with the same path within
+the snapshot. Files are reported as modified if their size, modification time,
+change time or inode differ, like the "backup" command detects changes. Pass
+"--read-content" to instead read the files and compare their contents with the
+data stored in the snapshot.
+
 EXIT STATUS
 ===========
 
@@ -63,10 +71,14 @@ Exit status is 12 if the password is incorrect.
 // DiffOptions collects all options for the diff command.
 type DiffOptions struct {
 	ShowMetadata bool
+	Live         string
+	ReadContent  bool
 }
 
 func (opts *DiffOptions) AddFlags(f *pflag.FlagSet) {
 	f.BoolVar(&opts.ShowMetadata, "metadata", false, "print changes in metadata")
+	f.StringVar(&opts.Live, "live", "", "compare the snapshot with the local directory `path`")
+	f.BoolVar(&opts.ReadContent, "read-content", false, "compare the content of files with --live instead of only their metadata")
 }
 
 func loadSnapshot(ctx context.Context, be restic.Lister, repo restic.LoaderUnpacked, desc string) (*restic.Snapshot, string, error) {
@@ -359,10 +371,44 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStatsContainer, pref
 	return ctx.Err()
 }
 
+// newComparer returns a Comparer which prints changes as configured by gopts.
+func newComparer(repo restic.Repository, opts DiffOptions, gopts GlobalOptions) *Comparer {
+	c := &Comparer{
+		repo: repo,
+		opts: opts,
+		printChange: func(change *Change) {
+			Printf("%-5s%v\n", change.Modifier, change.Path)
+		},
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(globalOptions.stdout)
+		c.printChange = func(change *Change) {
+			err := enc.Encode(change)
+			if err != nil {
+				Warnf("JSON encode failed: %v\n", err)
+			}
+		}
+	}
+
+	if gopts.Quiet {
+		c.printChange = func(_ *Change) {}
+	}
+
+	return c
+}
+
 func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []string) error {
-	if len(args) != 2 {
+	if opts.Live != "" {
+		if len(args) != 1 {
+			return errors.Fatal("specify one snapshot ID to compare with --live")
+		}
+	} else if len(args) != 2 {
 		return errors.Fatalf("specify two snapshot IDs")
 	}
+	if opts.ReadContent && opts.Live == "" {
+		return errors.Fatal("--read-content requires --live")
+	}
 
 	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
 	if err != nil {
@@ -380,6 +426,10 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 		return err
 	}
 
+	if opts.Live != "" {
+		return runDiffLive(ctx, repo, opts, gopts, sn1, subfolder1, args[0])
+	}
+
 	sn2, subfolder2, err := loadSnapshot(ctx, be, repo, args[1])
 	if err != nil {
 		return err
@@ -411,27 +461,7 @@ func runDiff(ctx context.Context, opts DiffOptions, gopts GlobalOptions, args []
 		return err
 	}
 
-	c := &Comparer{
-		repo: repo,
-		opts: opts,
-		printChange: func(change *Change) {
-			Printf("%-5s%v\n", change.Modifier, change.Path)
-		},
-	}
-
-	if gopts.JSON {
-		enc := json.NewEncoder(globalOptions.stdout)
-		c.printChange = func(change *Change) {
-			err := enc.Encode(change)
-			if err != nil {
-				Warnf("JSON encode failed: %v\n", err)
-			}
-		}
-	}
-
-	if gopts.Quiet {
-		c.printChange = func(_ *Change) {}
-	}
+	c := newComparer(repo, opts, gopts)
 
 	stats := &DiffStatsContainer{
 		MessageType:    "statistics",
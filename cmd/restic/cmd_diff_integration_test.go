@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -191,3 +192,73 @@ func TestDiffJSON(t *testing.T) {
 		stat.ChangedFiles == 1, "unexpected statistics")
 	rtest.Assert(t, stat.SourceSnapshot == firstSnapshotID && stat.TargetSnapshot == secondSnapshotID, "unexpected snapshot ids")
 }
+
+func testRunDiffLiveOutput(gopts GlobalOptions, opts DiffOptions, snapshotID string) (string, error) {
+	buf, err := withCaptureStdout(func() error {
+		return runDiff(context.TODO(), opts, gopts, []string{snapshotID})
+	})
+	return buf.String(), err
+}
+
+func TestDiffLive(t *testing.T) {
+	env, cleanup, firstSnapshotID, secondSnapshotID := setupDiffRepo(t)
+	defer cleanup()
+	env.gopts.Quiet = false
+	datadir := filepath.Join(env.base, "testdata")
+
+	_, err := testRunDiffLiveOutput(env.gopts, DiffOptions{Live: filepath.Join(datadir, "testdir", "testfile")}, secondSnapshotID)
+	rtest.Assert(t, err != nil, "expected error for a file as live path")
+
+	// the data directory now matches the second snapshot
+	out, err := testRunDiffLiveOutput(env.gopts, DiffOptions{Live: datadir}, firstSnapshotID)
+	rtest.OK(t, err)
+	for _, pattern := range diffOutputRegexPatterns[:11] {
+		r, err := regexp.Compile(pattern)
+		rtest.Assert(t, err == nil, "failed to compile regexp %v", pattern)
+		rtest.Assert(t, r.MatchString(out), "expected pattern %v in output, got\n%v", pattern, out)
+	}
+
+	for _, readContent := range []bool{false, true} {
+		out, err = testRunDiffLiveOutput(env.gopts, DiffOptions{Live: datadir, ReadContent: readContent}, secondSnapshotID)
+		rtest.OK(t, err)
+		rtest.Assert(t, strings.Contains(out, "Files:           0 new,     0 removed,     0 changed"), "expected no changes, got\n%v", out)
+	}
+
+	// a new modification time is only reported as content change without --read-content
+	testfile := filepath.Join(datadir, "testdir", "testfile")
+	rtest.OK(t, os.Chtimes(testfile, time.Now(), time.Now().Add(time.Hour)))
+	out, err = testRunDiffLiveOutput(env.gopts, DiffOptions{Live: datadir}, secondSnapshotID)
+	rtest.OK(t, err)
+	rtest.Assert(t, regexp.MustCompile(`M +/testdir/testfile`).MatchString(out), "expected modified file, got\n%v", out)
+
+	out, err = testRunDiffLiveOutput(env.gopts, DiffOptions{Live: datadir, ReadContent: true, ShowMetadata: true}, secondSnapshotID)
+	rtest.OK(t, err)
+	rtest.Assert(t, regexp.MustCompile(`U +/testdir/testfile`).MatchString(out), "expected updated metadata, got\n%v", out)
+
+	// the snapshotID:subfolder syntax selects the directory to compare with
+	env.gopts.JSON = true
+	out, err = testRunDiffLiveOutput(env.gopts, DiffOptions{Live: filepath.Join(datadir, "moddir"), ReadContent: true},
+		firstSnapshotID+":"+liveSnapshotPath(filepath.Join(datadir, "moddir")))
+	rtest.OK(t, err)
+
+	var stat DiffStatsContainer
+	var changes int
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		var sniffer typeSniffer
+		rtest.OK(t, json.Unmarshal([]byte(line), &sniffer))
+		switch sniffer.MessageType {
+		case "change":
+			changes++
+		case "statistics":
+			rtest.OK(t, json.Unmarshal([]byte(line), &stat))
+		default:
+			t.Fatalf("unexpected message type %v", sniffer.MessageType)
+		}
+	}
+	rtest.Equals(t, 9, changes)
+	rtest.Assert(t, stat.Added.Files == 2 && stat.Added.Dirs == 3 &&
+		stat.Removed.Files == 1 && stat.Removed.Dirs == 2 &&
+		stat.ChangedFiles == 1, "unexpected statistics %+v", stat)
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/feature"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// liveComparer compares a snapshot with the files and directories in the
+// local filesystem.
+type liveComparer struct {
+	*Comparer
+	fs fs.FS
+
+	// chunker parameters of the repository, used to hash file contents
+	params  restic.ChunkerParams
+	chunker *chunker.Chunker
+	buf     []byte
+}
+
+func newLiveComparer(c *Comparer, params restic.ChunkerParams) *liveComparer {
+	return &liveComparer{Comparer: c, fs: fs.Local{}, params: params}
+}
+
+// liveSnapshotPath returns the path within a snapshot at which the absolute
+// local path p is stored by the backup command.
+func liveSnapshotPath(p string) string {
+	volume := filepath.VolumeName(p)
+	p = filepath.ToSlash(p[len(volume):])
+	if len(volume) == 2 && volume[1] == ':' {
+		// the backup command stores C:\foo as /C/foo
+		p = "/" + volume[:1] + p
+	}
+	return path.Clean("/" + p)
+}
+
+// readLiveDir returns the metadata of all entries in the local directory dir.
+func (c *liveComparer) readLiveDir(dir string) (map[string]*restic.Node, error) {
+	f, err := c.fs.OpenFile(dir, fs.O_NOFOLLOW, false)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*restic.Node, len(names))
+	for _, name := range names {
+		node, err := c.liveNode(c.fs.Join(dir, name))
+		if err != nil {
+			Warnf("error: %v\n", err)
+			continue
+		}
+		nodes[name] = node
+	}
+	return nodes, nil
+}
+
+// liveNode returns the metadata of filename normalized like the backup
+// command does.
+func (c *liveComparer) liveNode(filename string) (*restic.Node, error) {
+	meta, err := c.fs.OpenFile(filename, fs.O_NOFOLLOW, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = meta.Close()
+	}()
+
+	node, err := meta.ToNode(true)
+	if err != nil && node == nil {
+		return nil, err
+	}
+	if feature.Flag.Enabled(feature.DeviceIDForHardlinks) && (node.Links == 1 || node.Type == restic.NodeTypeDir) {
+		node.DeviceID = 0
+	}
+	return node, nil
+}
+
+// liveMetadataEqual reports whether the metadata of the snapshot node and
+// the live node match.
+func liveMetadataEqual(snNode, liveNode *restic.Node) bool {
+	a, b := *snNode, *liveNode
+	a.Content, b.Content = nil, nil
+	a.Subtree, b.Subtree = nil, nil
+	if a.AccessTime.Equal(a.ModTime) {
+		// the access time is only stored with backup --with-atime
+		b.AccessTime = b.ModTime
+	}
+	return a.Equals(b)
+}
+
+// liveFileChanged reports whether the metadata indicates that the content of
+// the file was modified, like the change detection of the backup command.
+func liveFileChanged(snNode, liveNode *restic.Node) bool {
+	return snNode.Size != liveNode.Size ||
+		!snNode.ModTime.Equal(liveNode.ModTime) ||
+		!snNode.ChangeTime.Equal(liveNode.ChangeTime) ||
+		snNode.Inode != liveNode.Inode
+}
+
+// liveContentEqual reports whether splitting the file filename results in
+// exactly the blobs in content.
+func (c *liveComparer) liveContentEqual(filename string, content restic.IDs) (bool, error) {
+	f, err := c.fs.OpenFile(filename, fs.O_NOFOLLOW, false)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if c.chunker == nil {
+		c.chunker = c.params.NewChunker(f)
+		c.buf = make([]byte, c.params.MaxSize)
+	} else {
+		c.params.ResetChunker(c.chunker, f)
+	}
+
+	for i := 0; ; i++ {
+		chunk, err := c.chunker.Next(c.buf)
+		if err == io.EOF {
+			return i == len(content), nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if i >= len(content) || !restic.Hash(chunk.Data).Equal(content[i]) {
+			return false, nil
+		}
+	}
+}
+
+// printLiveDir prints all entries below the local directory dir with mode.
+func (c *liveComparer) printLiveDir(ctx context.Context, mode string, stats *DiffStat, prefix string, dir string) error {
+	debug.Log("print %v local dir %v", mode, dir)
+	nodes, err := c.readLiveDir(dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		node := nodes[name]
+		snName := path.Join(prefix, name)
+		if node.Type == restic.NodeTypeDir {
+			snName += "/"
+		}
+		c.printChange(NewChange(snName, mode))
+		stats.Add(node)
+
+		if node.Type == restic.NodeTypeDir {
+			err := c.printLiveDir(ctx, mode, stats, snName, c.fs.Join(dir, name))
+			if err != nil && err != context.Canceled {
+				Warnf("error: %v\n", err)
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// diffLive compares the tree id with the local directory dir.
+func (c *liveComparer) diffLive(ctx context.Context, stats *DiffStatsContainer, prefix string, id restic.ID, dir string) error {
+	debug.Log("diffing %v to local dir %v", id, dir)
+	tree, err := restic.LoadTree(ctx, c.repo, id)
+	if err != nil {
+		return err
+	}
+	liveNodes, err := c.readLiveDir(dir)
+	if err != nil {
+		return err
+	}
+
+	treeNodes := make(map[string]*restic.Node, len(tree.Nodes))
+	names := make([]string, 0, len(tree.Nodes)+len(liveNodes))
+	for _, node := range tree.Nodes {
+		treeNodes[node.Name] = node
+		names = append(names, node.Name)
+	}
+	for name := range liveNodes {
+		if _, ok := treeNodes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		node1, t1 := treeNodes[name]
+		node2, t2 := liveNodes[name]
+		filename := c.fs.Join(dir, name)
+
+		switch {
+		case t1 && t2:
+			name := path.Join(prefix, name)
+			mod := ""
+
+			if node1.Type != node2.Type {
+				mod += "T"
+			}
+
+			if node2.Type == restic.NodeTypeDir {
+				name += "/"
+			}
+
+			metadataEqual := liveMetadataEqual(node1, node2)
+			modified := false
+			if node1.Type == restic.NodeTypeFile && node2.Type == restic.NodeTypeFile {
+				if c.opts.ReadContent {
+					equal, err := c.liveContentEqual(filename, node1.Content)
+					if err != nil {
+						Warnf("error: %v\n", err)
+					}
+					modified = err == nil && !equal
+				} else {
+					modified = liveFileChanged(node1, node2)
+				}
+			}
+
+			if modified {
+				mod += "M"
+				stats.ChangedFiles++
+				if metadataEqual {
+					// the content has changed but all metadata is the same
+					mod += "?"
+				}
+			} else if c.opts.ShowMetadata && !metadataEqual {
+				mod += "U"
+			}
+
+			if mod != "" {
+				c.printChange(NewChange(name, mod))
+			}
+
+			if node1.Type == restic.NodeTypeDir && node2.Type == restic.NodeTypeDir {
+				err := c.diffLive(ctx, stats, name, *node1.Subtree, filename)
+				if err != nil && err != context.Canceled {
+					Warnf("error: %v\n", err)
+				}
+			}
+		case t1 && !t2:
+			prefix := path.Join(prefix, name)
+			if node1.Type == restic.NodeTypeDir {
+				prefix += "/"
+			}
+			c.printChange(NewChange(prefix, "-"))
+			stats.Removed.Add(node1)
+
+			if node1.Type == restic.NodeTypeDir {
+				err := c.printDir(ctx, "-", &stats.Removed, stats.BlobsBefore, prefix, *node1.Subtree)
+				if err != nil && err != context.Canceled {
+					Warnf("error: %v\n", err)
+				}
+			}
+		case !t1 && t2:
+			prefix := path.Join(prefix, name)
+			if node2.Type == restic.NodeTypeDir {
+				prefix += "/"
+			}
+			c.printChange(NewChange(prefix, "+"))
+			stats.Added.Add(node2)
+
+			if node2.Type == restic.NodeTypeDir {
+				err := c.printLiveDir(ctx, "+", &stats.Added, prefix, filename)
+				if err != nil && err != context.Canceled {
+					Warnf("error: %v\n", err)
+				}
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+func runDiffLive(ctx context.Context, repo restic.Repository, opts DiffOptions, gopts GlobalOptions, sn *restic.Snapshot, subfolder string, snapshotDesc string) error {
+	local := fs.Local{}
+	target, err := local.Abs(opts.Live)
+	if err != nil {
+		return err
+	}
+	fi, err := local.Lstat(target)
+	if err != nil {
+		return errors.Fatalf("unable to compare with %v: %v", opts.Live, err)
+	}
+	if !fi.Mode.IsDir() {
+		return errors.Fatalf("unable to compare with %v: not a directory", opts.Live)
+	}
+	if subfolder == "" {
+		subfolder = liveSnapshotPath(target)
+	}
+
+	if !gopts.JSON {
+		Verbosef("comparing snapshot %v to %v:\n\n", sn.ID().Str(), target)
+	}
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err = repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+	tree, err := restic.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	if err != nil {
+		return err
+	}
+
+	c := newLiveComparer(newComparer(repo, opts, gopts), repo.Config().ChunkerParams())
+	stats := &DiffStatsContainer{
+		MessageType:    "statistics",
+		SourceSnapshot: snapshotDesc,
+		TargetSnapshot: target,
+		BlobsBefore:    restic.NewBlobSet(),
+		BlobsAfter:     restic.NewBlobSet(),
+		BlobsCommon:    restic.NewBlobSet(),
+	}
+
+	err = c.diffLive(ctx, stats, "/", *tree, target)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		err := json.NewEncoder(globalOptions.stdout).Encode(stats)
+		if err != nil {
+			Warnf("JSON encode failed: %v\n", err)
+		}
+	} else {
+		Printf("\n")
+		Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
+		Printf("Dirs:        %5d new, %5d removed\n", stats.Added.Dirs, stats.Removed.Dirs)
+		Printf("Others:      %5d new, %5d removed\n", stats.Added.Others, stats.Removed.Others)
+	}
+
+	return nil
+}
@@ -24,8 +24,15 @@ func newDumpCommand() *cobra.Command {
 		Long: `
 The "dump" command extracts files from a snapshot from the repository. If a
 single file is selected, it prints its contents to stdout. Folders are output
-as a tar (default) or zip file containing the contents of the specified folder.
-Pass "/" as file name to dump the whole snapshot as an archive file.
+as a tar (default), pax, zip or cpio file or as a squashfs image containing the
+contents of the specified folder. Pass "/" as file name to dump the whole
+snapshot as an archive file.
+
+The "pax" format is a tar variant which additionally stores all extended
+attributes, sub-second timestamps and hardlinks. The "cpio" format uses the
+"newc" variant as expected for initramfs images. A "squashfs" image can be
+mounted read-only without FUSE, it requires "--target" or output redirected
+to a regular file.
 
 The special snapshotID "latest" can be used to use the latest snapshot in the
 repository.
@@ -57,14 +64,16 @@ Exit status is 12 if the password is incorrect.
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
 	restic.SnapshotFilter
-	Archive string
-	Target  string
+	Archive       string
+	Target        string
+	BlobCacheSize string
 }
 
 func (opts *DumpOptions) AddFlags(f *pflag.FlagSet) {
 	initSingleSnapshotFilter(f, &opts.SnapshotFilter)
-	f.StringVarP(&opts.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
+	f.StringVarP(&opts.Archive, "archive", "a", "tar", "set archive `format` as \"tar\", \"pax\", \"zip\", \"cpio\" or \"squashfs\"")
 	f.StringVarP(&opts.Target, "target", "t", "", "write the output to target `path`")
+	f.StringVar(&opts.BlobCacheSize, "blob-cache-size", "", "keep up to `size` of loaded data in the local cache for later runs (default: disabled)")
 }
 
 func splitPath(p string) []string {
@@ -130,7 +139,7 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 	}
 
 	switch opts.Archive {
-	case "tar", "zip":
+	case "tar", "pax", "zip", "cpio", "squashfs":
 	default:
 		return fmt.Errorf("unknown archive format %q", opts.Archive)
 	}
@@ -189,7 +198,13 @@ func runDump(ctx context.Context, opts DumpOptions, gopts GlobalOptions, args []
 		canWriteArchiveFunc = func() error { return nil }
 	}
 
+	blobCache, err := openBlobCache(repo, opts.BlobCacheSize)
+	if err != nil {
+		return err
+	}
+
 	d := dump.New(opts.Archive, repo, outputFileWriter)
+	d.UseBlobCache(blobCache)
 	err = printFromTree(ctx, tree, repo, "/", splittedPath, d, canWriteArchiveFunc)
 	if err != nil {
 		return errors.Fatalf("cannot dump file: %v", err)
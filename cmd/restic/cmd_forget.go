@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/termstatus"
 	"github.com/spf13/cobra"
@@ -29,6 +31,9 @@ If there are not enough snapshots to keep one for each duration related
 "--keep-{within-,}*" option, the oldest snapshot in the group is kept
 additionally.
 
+Without "--keep-*" options, the retention policy stored in the repository using
+"restic policy set" is applied, which replaces "--group-by".
+
 Please note that this command really only deletes the snapshot object in the
 repository, which is a reference to data stored there. In order to remove the
 unreferenced data after "forget" was run successfully, see the "prune" command.
@@ -98,19 +103,24 @@ func (c *ForgetPolicyCount) Type() string {
 
 // ForgetOptions collects all options for the forget command.
 type ForgetOptions struct {
-	Last          ForgetPolicyCount
-	Hourly        ForgetPolicyCount
-	Daily         ForgetPolicyCount
-	Weekly        ForgetPolicyCount
-	Monthly       ForgetPolicyCount
-	Yearly        ForgetPolicyCount
-	Within        restic.Duration
-	WithinHourly  restic.Duration
-	WithinDaily   restic.Duration
-	WithinWeekly  restic.Duration
-	WithinMonthly restic.Duration
-	WithinYearly  restic.Duration
-	KeepTags      restic.TagLists
+	Last            ForgetPolicyCount
+	Hourly          ForgetPolicyCount
+	Daily           ForgetPolicyCount
+	Weekly          ForgetPolicyCount
+	Monthly         ForgetPolicyCount
+	Quarterly       ForgetPolicyCount
+	Yearly          ForgetPolicyCount
+	Weekdays        restic.Weekdays
+	Within          restic.Duration
+	WithinHourly    restic.Duration
+	WithinDaily     restic.Duration
+	WithinWeekly    restic.Duration
+	WithinMonthly   restic.Duration
+	WithinQuarterly restic.Duration
+	WithinYearly    restic.Duration
+	KeepTags        restic.TagLists
+	FirstInPeriod   bool
+	WithinFromNow   bool
 
 	UnsafeAllowRemoveAll bool
 
@@ -124,19 +134,7 @@ type ForgetOptions struct {
 }
 
 func (opts *ForgetOptions) AddFlags(f *pflag.FlagSet) {
-	f.VarP(&opts.Last, "keep-last", "l", "keep the last `n` snapshots (use 'unlimited' to keep all snapshots)")
-	f.VarP(&opts.Hourly, "keep-hourly", "H", "keep the last `n` hourly snapshots (use 'unlimited' to keep all hourly snapshots)")
-	f.VarP(&opts.Daily, "keep-daily", "d", "keep the last `n` daily snapshots (use 'unlimited' to keep all daily snapshots)")
-	f.VarP(&opts.Weekly, "keep-weekly", "w", "keep the last `n` weekly snapshots (use 'unlimited' to keep all weekly snapshots)")
-	f.VarP(&opts.Monthly, "keep-monthly", "m", "keep the last `n` monthly snapshots (use 'unlimited' to keep all monthly snapshots)")
-	f.VarP(&opts.Yearly, "keep-yearly", "y", "keep the last `n` yearly snapshots (use 'unlimited' to keep all yearly snapshots)")
-	f.VarP(&opts.Within, "keep-within", "", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.VarP(&opts.WithinHourly, "keep-within-hourly", "", "keep hourly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.VarP(&opts.WithinDaily, "keep-within-daily", "", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.VarP(&opts.WithinWeekly, "keep-within-weekly", "", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.VarP(&opts.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.VarP(&opts.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
-	f.Var(&opts.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	opts.addKeepFlags(f)
 	f.BoolVar(&opts.UnsafeAllowRemoveAll, "unsafe-allow-remove-all", false, "allow deleting all snapshots of a snapshot group")
 
 	f.StringArrayVar(&opts.Hosts, "hostname", nil, "only consider snapshots with the given `hostname` (can be specified multiple times)")
@@ -150,21 +148,67 @@ func (opts *ForgetOptions) AddFlags(f *pflag.FlagSet) {
 
 	f.BoolVarP(&opts.Compact, "compact", "c", false, "use compact output format")
 	opts.GroupBy = restic.SnapshotGroupByOptions{Host: true, Path: true}
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma (disable grouping with '')")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags and/or label:key, separated by comma (disable grouping with '')")
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&opts.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
 
 	f.SortFlags = false
 }
 
+// addKeepFlags adds the --keep-* options, which are shared with "policy set".
+func (opts *ForgetOptions) addKeepFlags(f *pflag.FlagSet) {
+	f.VarP(&opts.Last, "keep-last", "l", "keep the last `n` snapshots (use 'unlimited' to keep all snapshots)")
+	f.VarP(&opts.Hourly, "keep-hourly", "H", "keep the last `n` hourly snapshots (use 'unlimited' to keep all hourly snapshots)")
+	f.VarP(&opts.Daily, "keep-daily", "d", "keep the last `n` daily snapshots (use 'unlimited' to keep all daily snapshots)")
+	f.VarP(&opts.Weekly, "keep-weekly", "w", "keep the last `n` weekly snapshots (use 'unlimited' to keep all weekly snapshots)")
+	f.VarP(&opts.Monthly, "keep-monthly", "m", "keep the last `n` monthly snapshots (use 'unlimited' to keep all monthly snapshots)")
+	f.VarP(&opts.Quarterly, "keep-quarterly", "", "keep the last `n` quarterly snapshots (use 'unlimited' to keep all quarterly snapshots)")
+	f.VarP(&opts.Yearly, "keep-yearly", "y", "keep the last `n` yearly snapshots (use 'unlimited' to keep all yearly snapshots)")
+	f.Var(&opts.Weekdays, "keep-weekday", "keep the snapshots of the last `n` days which are the given weekday, e.g. 'sunday:4' (omit n to keep all, can be specified multiple times)")
+	f.VarP(&opts.Within, "keep-within", "", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinHourly, "keep-within-hourly", "", "keep hourly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinDaily, "keep-within-daily", "", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinWeekly, "keep-within-weekly", "", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinQuarterly, "keep-within-quarterly", "", "keep quarterly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&opts.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&opts.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+	f.BoolVar(&opts.FirstInPeriod, "keep-first-in-period", false, "keep the first instead of the last snapshot of each hour, day, week, month, quarter or year")
+	f.BoolVar(&opts.WithinFromNow, "keep-within-from-now", false, "measure the --keep-within* durations from the current time instead of the latest snapshot")
+}
+
+// expirePolicy returns the policy specified by the --keep-* options.
+func (opts *ForgetOptions) expirePolicy() restic.ExpirePolicy {
+	return restic.ExpirePolicy{
+		Last:            int(opts.Last),
+		Hourly:          int(opts.Hourly),
+		Daily:           int(opts.Daily),
+		Weekly:          int(opts.Weekly),
+		Monthly:         int(opts.Monthly),
+		Quarterly:       int(opts.Quarterly),
+		Yearly:          int(opts.Yearly),
+		Weekdays:        opts.Weekdays,
+		Within:          opts.Within,
+		WithinHourly:    opts.WithinHourly,
+		WithinDaily:     opts.WithinDaily,
+		WithinWeekly:    opts.WithinWeekly,
+		WithinMonthly:   opts.WithinMonthly,
+		WithinQuarterly: opts.WithinQuarterly,
+		WithinYearly:    opts.WithinYearly,
+		Tags:            opts.KeepTags,
+		FirstInPeriod:   opts.FirstInPeriod,
+		WithinFromNow:   opts.WithinFromNow,
+	}
+}
+
 func verifyForgetOptions(opts *ForgetOptions) error {
 	if opts.Last < -1 || opts.Hourly < -1 || opts.Daily < -1 || opts.Weekly < -1 ||
-		opts.Monthly < -1 || opts.Yearly < -1 {
+		opts.Monthly < -1 || opts.Quarterly < -1 || opts.Yearly < -1 {
 		return errors.Fatal("negative values other than -1 are not allowed for --keep-*")
 	}
 
 	for _, d := range []restic.Duration{opts.Within, opts.WithinHourly, opts.WithinDaily,
-		opts.WithinMonthly, opts.WithinWeekly, opts.WithinYearly} {
+		opts.WithinMonthly, opts.WithinWeekly, opts.WithinQuarterly, opts.WithinYearly} {
 		if d.Hours < 0 || d.Days < 0 || d.Months < 0 || d.Years < 0 {
 			return errors.Fatal("durations containing negative values are not allowed for --keep-within*")
 		}
@@ -194,6 +238,12 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	}
 	defer unlock()
 
+	if !opts.DryRun {
+		if err := checkRemoveAllowed(repo); err != nil {
+			return err
+		}
+	}
+
 	verbosity := gopts.verbosity
 	if gopts.JSON {
 		verbosity = 0
@@ -211,54 +261,67 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	}
 
 	var jsonGroups []*ForgetGroup
+	keepCount := 0
 
 	if len(args) > 0 {
 		// When explicit snapshots args are given, remove them immediately.
 		for _, sn := range snapshots {
 			removeSnIDs.Insert(*sn.ID())
 		}
-	} else {
-		snapshotGroups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
+		retained, err := repo.RetainedFiles(ctx, restic.SnapshotFile, removeSnIDs)
 		if err != nil {
 			return err
 		}
-
-		policy := restic.ExpirePolicy{
-			Last:          int(opts.Last),
-			Hourly:        int(opts.Hourly),
-			Daily:         int(opts.Daily),
-			Weekly:        int(opts.Weekly),
-			Monthly:       int(opts.Monthly),
-			Yearly:        int(opts.Yearly),
-			Within:        opts.Within,
-			WithinHourly:  opts.WithinHourly,
-			WithinDaily:   opts.WithinDaily,
-			WithinWeekly:  opts.WithinWeekly,
-			WithinMonthly: opts.WithinMonthly,
-			WithinYearly:  opts.WithinYearly,
-			Tags:          opts.KeepTags,
+		for id, until := range retained {
+			printer.E("snapshot %v is retained until %v and cannot be removed yet\n", id.Str(), until.Format(time.RFC3339))
+			removeSnIDs.Delete(id)
 		}
-
-		if policy.Empty() {
-			if opts.UnsafeAllowRemoveAll {
-				if opts.SnapshotFilter.Empty() {
-					return errors.Fatal("--unsafe-allow-remove-all is not allowed unless a snapshot filter option is specified")
-				}
-				// UnsafeAllowRemoveAll together with snapshot filter is fine
-			} else {
+	} else {
+		var groups []restic.PolicyGroup
+		policy := opts.expirePolicy()
+		if policy.Empty() && !opts.UnsafeAllowRemoveAll {
+			// without --keep-* options, apply the policy stored in the repository
+			stored, err := restic.LoadRetentionPolicy(ctx, repo)
+			if err != nil {
+				return err
+			}
+			if stored == nil || len(stored.Rules) == 0 {
 				return errors.Fatal("no policy was specified, no snapshots will be removed")
 			}
-		}
 
-		printer.P("Applying Policy: %v\n", policy)
+			printer.P("Applying retention policy version %d stored in the repository:\n", stored.Version)
+			for _, rule := range stored.Rules {
+				printer.P("  %v: %v\n", rule.Selection(), rule.Keep)
+			}
+			groups, err = stored.Groups(snapshots)
+			if err != nil {
+				return err
+			}
+		} else {
+			if policy.Empty() && opts.SnapshotFilter.Empty() {
+				return errors.Fatal("--unsafe-allow-remove-all is not allowed unless a snapshot filter option is specified")
+			}
+			// UnsafeAllowRemoveAll together with snapshot filter is fine
 
-		for k, snapshotGroup := range snapshotGroups {
+			printer.P("Applying Policy: %v\n", policy)
+
+			snapshotGroups, _, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
+			if err != nil {
+				return err
+			}
+			for k, snapshotGroup := range snapshotGroups {
+				groups = append(groups, restic.PolicyGroup{Key: k, Policy: policy, Snapshots: snapshotGroup})
+			}
+		}
+
+		for _, group := range groups {
+			k := group.Key
 			if ctx.Err() != nil {
 				return ctx.Err()
 			}
 
 			if gopts.Verbose >= 1 && !gopts.JSON {
-				err = PrintSnapshotGroupHeader(globalOptions.stdout, k)
+				err = PrintSnapshotGroupHeader(gopts.stdout, k)
 				if err != nil {
 					return err
 				}
@@ -273,22 +336,28 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 			fg.Tags = key.Tags
 			fg.Host = key.Hostname
 			fg.Paths = key.Paths
+			fg.Labels = key.Labels
 
-			keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, policy)
+			keep, remove, reasons := restic.ApplyPolicy(group.Snapshots, group.Policy)
+			keep, remove, reasons, err = keepRetainedSnapshots(ctx, repo, keep, remove, reasons)
+			if err != nil {
+				return err
+			}
 
-			if !policy.Empty() && len(keep) == 0 {
+			if !group.Policy.Empty() && len(keep) == 0 {
 				return fmt.Errorf("refusing to delete last snapshot of snapshot group \"%v\"", key.String())
 			}
 			if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 				printer.P("keep %d snapshots:\n", len(keep))
-				PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact)
+				PrintSnapshots(gopts.stdout, keep, reasons, opts.Compact)
 				printer.P("\n")
 			}
 			fg.Keep = asJSONSnapshots(keep)
+			keepCount += len(keep)
 
 			if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 				printer.P("remove %d snapshots:\n", len(remove))
-				PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact)
+				PrintSnapshots(gopts.stdout, remove, nil, opts.Compact)
 				printer.P("\n")
 			}
 			fg.Remove = asJSONSnapshots(remove)
@@ -330,8 +399,10 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 		}
 	}
 
+	recordForgetMetrics(gopts.metrics, keepCount, len(removeSnIDs)-len(failedSnIDs))
+
 	if gopts.JSON && len(jsonGroups) > 0 {
-		err = printJSONForget(globalOptions.stdout, jsonGroups)
+		err = printJSONForget(gopts.stdout, jsonGroups)
 		if err != nil {
 			return err
 		}
@@ -354,14 +425,43 @@ func runForget(ctx context.Context, opts ForgetOptions, pruneOptions PruneOption
 	return nil
 }
 
+// keepRetainedSnapshots moves the snapshots which the backend protects from
+// removal from remove to keep.
+func keepRetainedSnapshots(ctx context.Context, repo *repository.Repository, keep, remove restic.Snapshots, reasons []restic.KeepReason) (restic.Snapshots, restic.Snapshots, []restic.KeepReason, error) {
+	ids := restic.NewIDSet()
+	for _, sn := range remove {
+		ids.Insert(*sn.ID())
+	}
+	retained, err := repo.RetainedFiles(ctx, restic.SnapshotFile, ids)
+	if err != nil || len(retained) == 0 {
+		return keep, remove, reasons, err
+	}
+
+	var removable restic.Snapshots
+	for _, sn := range remove {
+		until, ok := retained[*sn.ID()]
+		if !ok {
+			removable = append(removable, sn)
+			continue
+		}
+		keep = append(keep, sn)
+		reasons = append(reasons, restic.KeepReason{
+			Snapshot: sn,
+			Matches:  []string{"retained until " + until.Format(time.RFC3339)},
+		})
+	}
+	return keep, removable, reasons, nil
+}
+
 // ForgetGroup helps to print what is forgotten in JSON.
 type ForgetGroup struct {
-	Tags    []string     `json:"tags"`
-	Host    string       `json:"host"`
-	Paths   []string     `json:"paths"`
-	Keep    []Snapshot   `json:"keep"`
-	Remove  []Snapshot   `json:"remove"`
-	Reasons []KeepReason `json:"reasons"`
+	Tags    []string          `json:"tags"`
+	Host    string            `json:"host"`
+	Paths   []string          `json:"paths"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Keep    []Snapshot        `json:"keep"`
+	Remove  []Snapshot        `json:"remove"`
+	Reasons []KeepReason      `json:"reasons"`
 }
 
 func asJSONSnapshots(list restic.Snapshots) []Snapshot {
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -64,3 +66,33 @@ func TestRunForgetSafetyNet(t *testing.T) {
 	})
 	testListSnapshots(t, env.gopts, 0)
 }
+
+func TestRunForgetGroupByLabel(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	target := []string{filepath.Join(env.testdata, "0", "0", "9")}
+	for _, value := range []string{"prod", "prod", "dev"} {
+		testRunBackup(t, "", target, BackupOptions{Labels: []string{"env=" + value}}, env.gopts)
+	}
+	testListSnapshots(t, env.gopts, 3)
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.stdout = buf
+	rtest.OK(t, testRunForgetMayFail(gopts, ForgetOptions{
+		DryRun:  true,
+		Last:    1,
+		GroupBy: restic.SnapshotGroupByOptions{Labels: []string{"env"}},
+	}))
+
+	var groups []ForgetGroup
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+	removed := make(map[string]int)
+	for _, group := range groups {
+		removed[group.Labels["env"]] = len(group.Remove)
+	}
+	rtest.Equals(t, map[string]int{"prod": 1, "dev": 0}, removed)
+}
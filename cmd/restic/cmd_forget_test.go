@@ -69,6 +69,9 @@ func TestForgetOptionValues(t *testing.T) {
 		{ForgetOptions{Weekly: -2}, negValErrorMsg},
 		{ForgetOptions{Monthly: -2}, negValErrorMsg},
 		{ForgetOptions{Yearly: -2}, negValErrorMsg},
+		{ForgetOptions{Quarterly: 1}, ""},
+		{ForgetOptions{Quarterly: -1}, ""},
+		{ForgetOptions{Quarterly: -2}, negValErrorMsg},
 		{ForgetOptions{Within: restic.ParseDurationOrPanic("1y2m3d3h")}, ""},
 		{ForgetOptions{WithinHourly: restic.ParseDurationOrPanic("1y2m3d3h")}, ""},
 		{ForgetOptions{WithinDaily: restic.ParseDurationOrPanic("1y2m3d3h")}, ""},
@@ -81,6 +84,8 @@ func TestForgetOptionValues(t *testing.T) {
 		{ForgetOptions{WithinWeekly: restic.ParseDurationOrPanic("1y2m3d-3h")}, negDurationValErrorMsg},
 		{ForgetOptions{WithinMonthly: restic.ParseDurationOrPanic("-2y4m6d8h")}, negDurationValErrorMsg},
 		{ForgetOptions{WithinYearly: restic.ParseDurationOrPanic("2y-4m6d8h")}, negDurationValErrorMsg},
+		{ForgetOptions{WithinQuarterly: restic.ParseDurationOrPanic("1y")}, ""},
+		{ForgetOptions{WithinQuarterly: restic.ParseDurationOrPanic("-1y")}, negDurationValErrorMsg},
 	}
 
 	for _, testCase := range testCases {
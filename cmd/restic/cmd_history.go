@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/table"
+)
+
+func newHistoryCommand() *cobra.Command {
+	var opts HistoryOptions
+
+	cmd := &cobra.Command{
+		Use:   "history [flags] path",
+		Short: "Show the versions of a file or directory",
+		Long: `
+The "history" command lists the versions of a file or directory across all
+snapshots, oldest first. A version is listed whenever the content of the path
+differs from the previous snapshot which contains it, together with the first
+snapshot containing that version. A version which reappears later, for
+example after a change was reverted, is listed again.
+
+The content hash identifies the content of a version. For files, it is
+computed from the IDs of the data blobs, for directories it is the ID of the
+tree. The path must be given as it is stored in the snapshots, for example
+"/etc/foo.conf".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		Example: `restic history /etc/foo.conf
+restic history --host example --json /home/user/notes.txt`,
+		GroupID:           cmdGroupDefault,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistory(cmd.Context(), opts, globalOptions, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// HistoryOptions bundles all options for the history command.
+type HistoryOptions struct {
+	restic.SnapshotFilter
+}
+
+func (opts *HistoryOptions) AddFlags(f *pflag.FlagSet) {
+	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+}
+
+// historyVersion is a version of the path, which was first contained in
+// snapshot.
+type historyVersion struct {
+	snapshot *restic.Snapshot
+	node     *restic.Node
+	hash     restic.ID
+}
+
+// contentHash identifies the content of node.
+func contentHash(node *restic.Node) restic.ID {
+	switch node.Type {
+	case restic.NodeTypeDir:
+		if node.Subtree != nil {
+			return *node.Subtree
+		}
+	case restic.NodeTypeFile:
+		buf := make([]byte, 0, len(node.Content)*len(restic.ID{}))
+		for _, id := range node.Content {
+			buf = append(buf, id[:]...)
+		}
+		return restic.Hash(buf)
+	}
+	return restic.Hash([]byte(node.LinkTarget))
+}
+
+// pathFinder finds a path within snapshots. The trees along the path are
+// cached, such that identical subtrees of different snapshots are only
+// searched once.
+type pathFinder struct {
+	repo restic.BlobLoader
+	// dirs are the names of the directories containing the path
+	dirs []string
+	name string
+	// subdirs maps an ancestor of the path to the tree of the next directory
+	// along the path, which is nil if the ancestor does not contain it
+	subdirs map[pathAncestor]*restic.ID
+	// nodes maps the tree of the directory containing the path to the node of
+	// the path, the node is nil if the tree does not contain the path
+	nodes map[restic.ID]*restic.Node
+}
+
+// pathAncestor is the tree of a directory along the path, depth is the number
+// of directories between the tree and the root of the snapshot.
+type pathAncestor struct {
+	depth int
+	tree  restic.ID
+}
+
+func newPathFinder(repo restic.BlobLoader, p string) *pathFinder {
+	p = path.Clean("/" + p)
+	dir, name := path.Split(p)
+	var dirs []string
+	for _, d := range strings.Split(dir, "/") {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+
+	return &pathFinder{
+		repo:    repo,
+		dirs:    dirs,
+		name:    name,
+		subdirs: make(map[pathAncestor]*restic.ID),
+		nodes:   make(map[restic.ID]*restic.Node),
+	}
+}
+
+// find returns the node of the path within sn, or nil if sn does not contain
+// the path.
+func (f *pathFinder) find(ctx context.Context, sn *restic.Snapshot) (*restic.Node, error) {
+	if sn.Tree == nil {
+		return nil, errors.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+
+	tree := *sn.Tree
+	for depth, name := range f.dirs {
+		key := pathAncestor{depth: depth, tree: tree}
+		subdir, ok := f.subdirs[key]
+		if !ok {
+			var err error
+			subdir, err = restic.FindTreeDirectory(ctx, f.repo, &tree, name)
+			if err != nil {
+				// errors which occurred while loading the tree are wrapped,
+				// the others report that the directory does not exist
+				if errors.Unwrap(err) != nil {
+					return nil, err
+				}
+				subdir = nil
+			}
+			f.subdirs[key] = subdir
+		}
+		if subdir == nil {
+			return nil, nil
+		}
+		tree = *subdir
+	}
+
+	node, ok := f.nodes[tree]
+	if !ok {
+		t, err := restic.LoadTree(ctx, f.repo, tree)
+		if err != nil {
+			return nil, err
+		}
+		node = t.Find(f.name)
+		f.nodes[tree] = node
+	}
+	return node, nil
+}
+
+// findHistory returns the versions of the path within snapshots, which must
+// be sorted by time.
+func findHistory(ctx context.Context, f *pathFinder, snapshots restic.Snapshots) ([]historyVersion, error) {
+	var versions []historyVersion
+	for _, sn := range snapshots {
+		node, err := f.find(ctx, sn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "snapshot %v", sn.ID().Str())
+		}
+		if node == nil {
+			continue
+		}
+
+		hash := contentHash(node)
+		if len(versions) > 0 && versions[len(versions)-1].hash.Equal(hash) {
+			continue
+		}
+		versions = append(versions, historyVersion{snapshot: sn, node: node, hash: hash})
+	}
+	return versions, nil
+}
+
+// historyVersionJSON is the JSON representation of a historyVersion.
+type historyVersionJSON struct {
+	SnapshotID  string          `json:"snapshot_id"`
+	Time        time.Time       `json:"time"`
+	Type        restic.NodeType `json:"type"`
+	Size        uint64          `json:"size"`
+	Mtime       time.Time       `json:"mtime"`
+	ContentHash restic.ID       `json:"content_hash"`
+}
+
+func printHistoryJSON(stdout io.Writer, versions []historyVersion) error {
+	list := make([]historyVersionJSON, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, historyVersionJSON{
+			SnapshotID:  v.snapshot.ID().String(),
+			Time:        v.snapshot.Time,
+			Type:        v.node.Type,
+			Size:        v.node.Size,
+			Mtime:       v.node.ModTime,
+			ContentHash: v.hash,
+		})
+	}
+	return json.NewEncoder(stdout).Encode(list)
+}
+
+func printHistoryTable(stdout io.Writer, versions []historyVersion, snapshots int) error {
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Timestamp }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+	tab.AddColumn("Modified", "{{ .ModTime }}")
+	tab.AddColumn("Content Hash", "{{ .Hash }}")
+
+	type version struct {
+		ID, Timestamp, Size, ModTime, Hash string
+	}
+	for _, v := range versions {
+		tab.AddRow(version{
+			ID:        v.snapshot.ID().Str(),
+			Timestamp: v.snapshot.Time.Local().Format(TimeFormat),
+			Size:      ui.FormatBytes(v.node.Size),
+			ModTime:   v.node.ModTime.Local().Format(TimeFormat),
+			Hash:      v.hash.Str(),
+		})
+	}
+	tab.AddFooter(fmt.Sprintf("%d versions in %d snapshots", len(versions), snapshots))
+	return tab.Write(stdout)
+}
+
+func runHistory(ctx context.Context, opts HistoryOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("wrong number of arguments, specify exactly one path")
+	}
+	if path.Clean("/"+args[0]) == "/" {
+		return errors.Fatal("the root directory has no history, use the snapshots command instead")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	snapshotLister, err := restic.MemorizeList(ctx, repo, restic.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	if err = repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	var snapshots restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, snapshotLister, repo, &opts.SnapshotFilter, nil) {
+		snapshots = append(snapshots, sn)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	versions, err := findHistory(ctx, newPathFinder(repo, args[0]), snapshots)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		return printHistoryJSON(gopts.stdout, versions)
+	}
+	return printHistoryTable(gopts.stdout, versions, len(snapshots))
+}
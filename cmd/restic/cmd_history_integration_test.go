@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testRunHistory(t testing.TB, wantJSON bool, gopts GlobalOptions, p string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = wantJSON
+
+	rtest.OK(t, runHistory(context.TODO(), HistoryOptions{}, gopts, []string{p}))
+	return buf.Bytes()
+}
+
+func TestHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "history")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	file := filepath.Join(dir, "sub", "file")
+
+	previous := ""
+	for _, content := range []string{"first", "first", "second", "first"} {
+		if content != previous {
+			rtest.OK(t, os.WriteFile(file, []byte(content), 0644))
+			previous = content
+		}
+		testRunBackup(t, dir, []string{"."}, BackupOptions{}, env.gopts)
+	}
+
+	// unchanged snapshots are skipped, the reverted version is listed again
+	out := testRunHistory(t, true, env.gopts, "/sub/file")
+	var versions []historyVersionJSON
+	rtest.OK(t, json.Unmarshal(out, &versions))
+	rtest.Equals(t, 3, len(versions))
+	rtest.Equals(t, uint64(len("second")), versions[1].Size)
+	rtest.Equals(t, versions[0].ContentHash, versions[2].ContentHash)
+	rtest.Assert(t, versions[0].Time.Before(versions[1].Time), "versions are not sorted by time")
+
+	// the directory changed along with the file
+	out = testRunHistory(t, true, env.gopts, "sub")
+	rtest.OK(t, json.Unmarshal(out, &versions))
+	rtest.Equals(t, 3, len(versions))
+
+	out = testRunHistory(t, false, env.gopts, "/sub/file")
+	rtest.Assert(t, strings.Contains(string(out), "3 versions in 4 snapshots"),
+		"unexpected output %q", out)
+
+	out = testRunHistory(t, true, env.gopts, "/missing")
+	rtest.OK(t, json.Unmarshal(out, &versions))
+	rtest.Equals(t, 0, len(versions))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type countingBlobLoader struct {
+	restic.BlobLoader
+	loads int
+}
+
+func (l *countingBlobLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	l.loads++
+	return l.BlobLoader.LoadBlob(ctx, t, id, buf)
+}
+
+func TestPathFinder(t *testing.T) {
+	repo := repository.TestRepository(t)
+	src := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, src, archiver.TestDir{
+		"dir": archiver.TestDir{
+			"sub": archiver.TestDir{
+				"file": archiver.TestFile{Content: "content"},
+			},
+			"other": archiver.TestDir{
+				"nested": archiver.TestDir{},
+			},
+		},
+		"sibling": archiver.TestDir{
+			"nested": archiver.TestDir{},
+		},
+	})
+	back := rtest.Chdir(t, src)
+	defer back()
+	sn := archiver.TestSnapshot(t, repo, ".", nil)
+
+	loader := &countingBlobLoader{BlobLoader: repo}
+	f := newPathFinder(loader, "dir/sub/file")
+	node, err := f.find(context.TODO(), sn)
+	rtest.OK(t, err)
+	rtest.Assert(t, node != nil, "file not found")
+	rtest.Equals(t, "file", node.Name)
+	// only the trees along the path are loaded
+	rtest.Equals(t, 3, loader.loads)
+
+	// the trees are cached
+	node, err = f.find(context.TODO(), sn)
+	rtest.OK(t, err)
+	rtest.Assert(t, node != nil, "file not found")
+	rtest.Equals(t, 3, loader.loads)
+
+	for _, p := range []string{"/missing/file", "/dir/missing", "/dir/sub/file/below"} {
+		node, err := newPathFinder(repo, p).find(context.TODO(), sn)
+		rtest.OK(t, err)
+		rtest.Assert(t, node == nil, "unexpected node for %v", p)
+	}
+}
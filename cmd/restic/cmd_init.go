@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"strconv"
 
-	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -24,6 +25,19 @@ func newInitCommand() *cobra.Command {
 		Long: `
 The "init" command initializes a new repository.
 
+The chunk size bounds used to split files can only be chosen when the
+repository is created. Smaller chunks can improve deduplication of files with
+small modifications at the cost of a larger index. Files are only deduplicated
+against data which was split using the same parameters, use
+"--copy-chunker-params" to copy them from a repository you want to copy
+snapshots from or to.
+
+With "--copy-master-key" the new repository uses the same master key as the
+secondary repository, but the password can differ. The "copy" command can then
+transfer whole pack files without decrypting and encrypting them again,
+provided the chunker parameters are copied as well. Anyone who knows the
+password of one of the repositories can decrypt the data of both.
+
 EXIT STATUS
 ===========
 
@@ -44,13 +58,23 @@ Exit status is 1 if there was any error.
 type InitOptions struct {
 	secondaryRepoOptions
 	CopyChunkerParameters bool
+	CopyMasterKey         bool
+	ChunkerMinSize        string
+	ChunkerAvgSize        string
+	ChunkerMaxSize        string
 	RepositoryVersion     string
+	AppendOnly            bool
 }
 
 func (opts *InitOptions) AddFlags(f *pflag.FlagSet) {
-	opts.secondaryRepoOptions.AddFlags(f, "secondary", "to copy chunker parameters from")
+	opts.secondaryRepoOptions.AddFlags(f, "secondary", "to copy chunker parameters or the master key from")
 	f.BoolVar(&opts.CopyChunkerParameters, "copy-chunker-params", false, "copy chunker parameters from the secondary repository (useful with the copy command)")
+	f.BoolVar(&opts.CopyMasterKey, "copy-master-key", false, "use the master key of the secondary repository (useful with the copy command)")
+	f.StringVar(&opts.ChunkerMinSize, "chunker-min-size", "", "minimum chunk `size` used to split files (default: 512K)")
+	f.StringVar(&opts.ChunkerAvgSize, "chunker-avg-size", "", "average chunk `size` used to split files, must be a power of two (default: 1M)")
+	f.StringVar(&opts.ChunkerMaxSize, "chunker-max-size", "", "maximum chunk `size` used to split files (default: 8M)")
 	f.StringVar(&opts.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'latest' and 'stable'")
+	f.BoolVar(&opts.AppendOnly, "append-only", false, "create an append-only repository, only admin keys may remove data from it")
 }
 
 func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []string) error {
@@ -74,10 +98,31 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return errors.Fatalf("only repository versions between %v and %v are allowed", restic.MinRepoVersion, restic.MaxRepoVersion)
 	}
 
-	chunkerPolynomial, err := maybeReadChunkerPolynomial(ctx, opts, gopts)
+	chunkerParams, masterKey, err := readSecondaryRepoParams(ctx, opts, gopts)
 	if err != nil {
 		return err
 	}
+	if chunkerParams != nil && chunkerParams.CustomSizes() && version < restic.MinFeatureRepoVersion {
+		if opts.RepositoryVersion != "stable" {
+			return errors.Fatalf("custom chunk sizes require repository version %v or newer", restic.MinFeatureRepoVersion)
+		}
+		// older versions of restic would ignore the chunk sizes
+		version = restic.MinFeatureRepoVersion
+	}
+	if opts.AppendOnly && version < restic.MinFeatureRepoVersion {
+		if opts.RepositoryVersion != "stable" {
+			return errors.Fatalf("the append-only mode requires repository version %v or newer", restic.MinFeatureRepoVersion)
+		}
+		// older versions of restic would ignore the append-only mode
+		version = restic.MinFeatureRepoVersion
+	}
+	if gopts.ColdRepo != "" && version < restic.MinFeatureRepoVersion {
+		if opts.RepositoryVersion != "stable" {
+			return errors.Fatalf("a cold tier requires repository version %v or newer", restic.MinFeatureRepoVersion)
+		}
+		// older versions of restic would consider the data packs to be missing
+		version = restic.MinFeatureRepoVersion
+	}
 
 	gopts.Repo, err = ReadRepo(gopts)
 	if err != nil {
@@ -104,19 +149,29 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 		return errors.Fatal(err.Error())
 	}
 
-	err = s.Init(ctx, version, gopts.password, chunkerPolynomial)
+	err = s.Init(ctx, version, gopts.password, chunkerParams, opts.AppendOnly, masterKey)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", location.StripPassword(gopts.backends, gopts.Repo), err)
 	}
 
 	if !gopts.JSON {
 		Verbosef("created restic repository %v at %s", s.Config().ID[:10], location.StripPassword(gopts.backends, gopts.Repo))
-		if opts.CopyChunkerParameters && chunkerPolynomial != nil {
+		switch {
+		case opts.CopyChunkerParameters && opts.CopyMasterKey:
+			Verbosef(" with chunker parameters and master key copied from secondary repository\n")
+		case opts.CopyChunkerParameters && chunkerParams != nil:
 			Verbosef(" with chunker parameters copied from secondary repository\n")
-		} else {
+		case opts.CopyMasterKey:
+			Verbosef(" with master key copied from secondary repository\n")
+		default:
 			Verbosef("\n")
 		}
 		Verbosef("\n")
+		if opts.AppendOnly {
+			Verbosef("The repository is append-only. The key created for it is an admin key,\n")
+			Verbosef("use `restic key add` to create regular keys for backup clients.\n")
+			Verbosef("\n")
+		}
 		Verbosef("Please note that knowledge of your password is required to access\n")
 		Verbosef("the repository. Losing your password means that your data is\n")
 		Verbosef("irrecoverably lost.\n")
@@ -133,26 +188,88 @@ func runInit(ctx context.Context, opts InitOptions, gopts GlobalOptions, args []
 	return nil
 }
 
-func maybeReadChunkerPolynomial(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*chunker.Pol, error) {
-	if opts.CopyChunkerParameters {
-		otherGopts, _, err := fillSecondaryGlobalOpts(ctx, opts.secondaryRepoOptions, gopts, "secondary")
-		if err != nil {
-			return nil, err
+// readSecondaryRepoParams returns the chunker parameters and the master key
+// for the new repository. Both are nil if they are not set by the options.
+func readSecondaryRepoParams(ctx context.Context, opts InitOptions, gopts GlobalOptions) (*restic.ChunkerParams, *crypto.Key, error) {
+	customSizes := opts.ChunkerMinSize != "" || opts.ChunkerAvgSize != "" || opts.ChunkerMaxSize != ""
+
+	if opts.CopyChunkerParameters && customSizes {
+		return nil, nil, errors.Fatal("chunk sizes cannot be specified when copying the chunker parameters")
+	}
+
+	if !opts.CopyChunkerParameters && !opts.CopyMasterKey {
+		if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
+			return nil, nil, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters or the master key")
 		}
+		params, err := readChunkerParams(opts)
+		return params, nil, err
+	}
 
-		otherRepo, err := OpenRepository(ctx, otherGopts)
+	otherGopts, _, err := fillSecondaryGlobalOpts(ctx, opts.secondaryRepoOptions, gopts, "secondary")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	otherRepo, err := OpenRepository(ctx, otherGopts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var params *restic.ChunkerParams
+	if opts.CopyChunkerParameters {
+		cfg := otherRepo.Config()
+		params = &restic.ChunkerParams{
+			Polynomial: cfg.ChunkerPolynomial,
+			MinSize:    cfg.ChunkerMinSize,
+			AvgSize:    cfg.ChunkerAvgSize,
+			MaxSize:    cfg.ChunkerMaxSize,
+		}
+	} else {
+		params, err = readChunkerParams(opts)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+	}
+
+	var masterKey *crypto.Key
+	if opts.CopyMasterKey {
+		masterKey = otherRepo.Key()
+	}
+	return params, masterKey, nil
+}
 
-		pol := otherRepo.Config().ChunkerPolynomial
-		return &pol, nil
+// readChunkerParams returns the chunk sizes set by the options.
+func readChunkerParams(opts InitOptions) (*restic.ChunkerParams, error) {
+	customSizes := opts.ChunkerMinSize != "" || opts.ChunkerAvgSize != "" || opts.ChunkerMaxSize != ""
+	if !customSizes {
+		return nil, nil
+	}
+
+	params := &restic.ChunkerParams{}
+	for _, size := range []struct {
+		flag  string
+		value string
+		dst   *uint
+	}{
+		{"--chunker-min-size", opts.ChunkerMinSize, &params.MinSize},
+		{"--chunker-avg-size", opts.ChunkerAvgSize, &params.AvgSize},
+		{"--chunker-max-size", opts.ChunkerMaxSize, &params.MaxSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		v, err := ui.ParseBytes(size.value)
+		if err != nil || v <= 0 {
+			return nil, errors.Fatalf("invalid %v %q", size.flag, size.value)
+		}
+		*size.dst = uint(v)
 	}
 
-	if opts.Repo != "" || opts.RepositoryFile != "" || opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" {
-		return nil, errors.Fatal("Secondary repository must only be specified when copying the chunker parameters")
+	cfg := restic.Config{ChunkerMinSize: params.MinSize, ChunkerAvgSize: params.AvgSize, ChunkerMaxSize: params.MaxSize}
+	if err := cfg.ChunkerParams().Validate(); err != nil {
+		return nil, errors.Fatalf("invalid chunker parameters: %v", err)
 	}
-	return nil, nil
+	return params, nil
 }
 
 type initSuccess struct {
@@ -54,3 +54,99 @@ func TestInitCopyChunkerParams(t *testing.T) {
 		"expected equal chunker polynomials, got %v expected %v", repo.Config().ChunkerPolynomial,
 		otherRepo.Config().ChunkerPolynomial)
 }
+
+func TestInitChunkerSizes(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+
+	initOpts := InitOptions{ChunkerAvgSize: "100K"}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env2.gopts, nil) != nil, "expected invalid average chunk size to fail")
+
+	// older versions of restic would ignore the chunk sizes
+	initOpts = InitOptions{ChunkerMinSize: "64K", ChunkerAvgSize: "256K", ChunkerMaxSize: "2M", RepositoryVersion: "2"}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env2.gopts, nil) != nil, "expected custom chunk sizes to require repository version 3")
+
+	initOpts.RepositoryVersion = "stable"
+	rtest.OK(t, runInit(context.TODO(), initOpts, env2.gopts, nil))
+
+	otherRepo, err := OpenRepository(context.TODO(), env2.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(restic.MinFeatureRepoVersion), otherRepo.Config().Version)
+	rtest.Assert(t, otherRepo.Config().HasFeature(restic.FeatureChunkerSizes), "missing required feature for chunk sizes")
+	rtest.Equals(t, restic.ChunkerParams{
+		Polynomial: otherRepo.Config().ChunkerPolynomial,
+		MinSize:    64 * 1024,
+		AvgSize:    256 * 1024,
+		MaxSize:    2 * 1024 * 1024,
+	}, otherRepo.Config().ChunkerParams())
+
+	initOpts = InitOptions{
+		secondaryRepoOptions: secondaryRepoOptions{
+			Repo:     env2.gopts.Repo,
+			password: env2.gopts.password,
+		},
+		CopyChunkerParameters: true,
+		ChunkerMinSize:        "64K",
+	}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected chunk sizes and --copy-chunker-params to conflict")
+
+	initOpts.ChunkerMinSize = ""
+	rtest.OK(t, runInit(context.TODO(), initOpts, env.gopts, nil))
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, otherRepo.Config().ChunkerParams(), repo.Config().ChunkerParams())
+
+	// backups into a repository with custom chunk sizes must produce a valid repository
+	rtest.OK(t, os.MkdirAll(env2.testdata, 0o755))
+	rtest.OK(t, os.WriteFile(filepath.Join(env2.testdata, "file"), rtest.Random(42, 5*1024*1024), 0o600))
+	testRunBackup(t, "", []string{env2.testdata}, BackupOptions{}, env2.gopts)
+	testRunCheck(t, env2.gopts)
+}
+
+func TestInitColdTier(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	cold := filepath.Join(env.base, "cold")
+	env.gopts.ColdRepo = cold
+
+	// older repository versions cannot record the cold tier
+	initOpts := InitOptions{RepositoryVersion: "2"}
+	rtest.Assert(t, runInit(context.TODO(), initOpts, env.gopts, nil) != nil, "expected a cold tier to require repository version 3")
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// tree packs are stored in the hot repository, data packs in the cold one
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Assert(t, repo.Config().HasFeature(restic.FeatureColdTier), "cold tier not recorded in config")
+	rtest.Equals(t, uint(restic.MinFeatureRepoVersion), repo.Config().Version)
+	rtest.OK(t, repo.LoadIndex(context.TODO(), nil))
+
+	packs := make(map[string]restic.BlobType)
+	rtest.OK(t, repo.ListBlobs(context.TODO(), func(pb restic.PackedBlob) {
+		packs[pb.PackID.String()] = pb.Type
+	}))
+	rtest.Assert(t, len(packs) > 1, "expected tree and data packs, got %v", len(packs))
+	for id, tpe := range packs {
+		dir := env.repo
+		if tpe == restic.DataBlob {
+			dir = cold
+		}
+		_, err := os.Stat(filepath.Join(dir, "data", id[:2], id))
+		rtest.OK(t, err)
+	}
+
+	gopts := env.gopts
+	gopts.ColdRepo = ""
+	_, err = OpenRepository(context.TODO(), gopts)
+	rtest.Assert(t, err != nil, "opening the repository without the cold tier succeeded")
+}
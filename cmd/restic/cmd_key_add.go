@@ -19,6 +19,10 @@ func newKeyAddCommand() *cobra.Command {
 		Long: `
 The "add" sub-command creates a new key and validates the key. Returns the new key ID.
 
+The --role option restricts the commands restic permits with the new key. Roles
+are advisory only: all keys unlock the same master key, such that a modified
+client can still read and modify all data in the repository.
+
 EXIT STATUS
 ===========
 
@@ -43,6 +47,7 @@ type KeyAddOptions struct {
 	InsecureNoPassword bool
 	Username           string
 	Hostname           string
+	Role               string
 }
 
 func (opts *KeyAddOptions) Add(flags *pflag.FlagSet) {
@@ -50,6 +55,7 @@ func (opts *KeyAddOptions) Add(flags *pflag.FlagSet) {
 	flags.BoolVar(&opts.InsecureNoPassword, "new-insecure-no-password", false, "add an empty password for the repository (insecure)")
 	flags.StringVarP(&opts.Username, "user", "", "", "the username for new key")
 	flags.StringVarP(&opts.Hostname, "host", "", "", "the hostname for new key")
+	flags.StringVar(&opts.Role, "role", "", "the `role` of the new key (admin|backup-only|read-only), defaults to a key with full access")
 }
 
 func runKeyAdd(ctx context.Context, gopts GlobalOptions, opts KeyAddOptions, args []string) error {
@@ -67,12 +73,20 @@ func runKeyAdd(ctx context.Context, gopts GlobalOptions, opts KeyAddOptions, arg
 }
 
 func addKey(ctx context.Context, repo *repository.Repository, gopts GlobalOptions, opts KeyAddOptions) error {
+	role, err := repository.ParseKeyRole(opts.Role)
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
+	if !repo.KeyRole().CanRemove() {
+		return errors.Fatalf("a %v key cannot add new keys", repo.KeyRole())
+	}
+
 	pw, err := getNewPassword(ctx, gopts, opts.NewPasswordFile, opts.InsecureNoPassword)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(ctx, repo, pw, opts.Username, opts.Hostname, repo.Key())
+	id, err := repository.AddKey(ctx, repo, pw, opts.Username, opts.Hostname, role, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/repository"
 	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
 )
 
 func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
@@ -212,3 +213,54 @@ func TestKeyCommandInvalidArguments(t *testing.T) {
 	t.Log(err)
 	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "one argument"), "unexpected error for key remove: %v", err)
 }
+
+func testRunKeyAddRole(t testing.TB, newPassword string, role string, gopts GlobalOptions) {
+	testKeyNewPassword = newPassword
+	defer func() {
+		testKeyNewPassword = ""
+	}()
+
+	rtest.OK(t, runKeyAdd(context.TODO(), gopts, KeyAddOptions{Role: role}, []string{}))
+}
+
+func TestKeyRoles(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	// must list keys more than once
+	env.gopts.backendTestHook = nil
+	testRunKeyAddRole(t, "backup-only", "backup-only", env.gopts)
+	testRunKeyAddRole(t, "read-only", "read-only", env.gopts)
+
+	err := runKeyAdd(context.TODO(), env.gopts, KeyAddOptions{Role: "foo"}, []string{})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "invalid key role"), "unexpected error for invalid role: %v", err)
+
+	backupOnly := env.gopts
+	backupOnly.password = "backup-only"
+	// the parent snapshot lookup is skipped for backup-only keys
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, backupOnly)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, backupOnly)
+	err = testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{Parent: "latest"}, backupOnly)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "--parent"), "unexpected error for --parent: %v", err)
+	err = runSnapshots(context.TODO(), SnapshotOptions{}, backupOnly, []string{})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "backup-only key does not permit"), "unexpected error for snapshots: %v", err)
+	err = runKeyAdd(context.TODO(), backupOnly, KeyAddOptions{}, []string{})
+	rtest.Assert(t, err != nil, "backup-only key must not be able to add keys")
+
+	readOnly := env.gopts
+	readOnly.password = "read-only"
+	testListSnapshots(t, readOnly, 2)
+	err = testRunBackupAssumeFailure(t, "", []string{env.testdata}, BackupOptions{}, readOnly)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "read-only key does not permit"), "unexpected error for backup: %v", err)
+	err = testRunForgetMayFail(readOnly, ForgetOptions{Last: 1})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "read-only key does not permit"), "unexpected error for forget: %v", err)
+	// commands which take an exclusive lock to modify the repository are rejected
+	err = withTermStatus(readOnly, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runRecover(ctx, readOnly, term)
+	})
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "read-only key does not permit"), "unexpected error for recover: %v", err)
+	testRunCheck(t, readOnly)
+
+	testRunCheck(t, env.gopts)
+}
@@ -58,6 +58,10 @@ func runKeyPasswd(ctx context.Context, gopts GlobalOptions, opts KeyPasswdOption
 	}
 	defer unlock()
 
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	return changePassword(ctx, repo, gopts, opts)
 }
 
@@ -67,7 +71,7 @@ func changePassword(ctx context.Context, repo *repository.Repository, gopts Glob
 		return err
 	}
 
-	id, err := repository.AddKey(ctx, repo, pw, "", "", repo.Key())
+	id, err := repository.AddKey(ctx, repo, pw, "", "", repo.KeyRole(), repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
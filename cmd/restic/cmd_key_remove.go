@@ -46,6 +46,10 @@ func runKeyRemove(ctx context.Context, gopts GlobalOptions, args []string) error
 	}
 	defer unlock()
 
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	return deleteKey(ctx, repo, args[0])
 }
 
@@ -12,7 +12,7 @@ import (
 )
 
 func newListCommand() *cobra.Command {
-	var listAllowedArgs = []string{"blobs", "packs", "index", "snapshots", "keys", "locks"}
+	var listAllowedArgs = []string{"blobs", "packs", "index", "snapshots", "keys", "locks", "dictionaries", "parity", "policies"}
 	var listAllowedArgsUseString = strings.Join(listAllowedArgs, "|")
 
 	cmd := &cobra.Command{
@@ -64,6 +64,12 @@ func runList(ctx context.Context, gopts GlobalOptions, args []string) error {
 		t = restic.KeyFile
 	case "locks":
 		t = restic.LockFile
+	case "dictionaries":
+		t = restic.DictionaryFile
+	case "parity":
+		t = restic.ParityFile
+	case "policies":
+		t = restic.PolicyFile
 	case "blobs":
 		return index.ForAllIndexes(ctx, repo, repo, func(_ restic.ID, idx *index.Index, err error) error {
 			if err != nil {
@@ -148,5 +148,10 @@ func runMigrate(ctx context.Context, opts MigrateOptions, gopts GlobalOptions, a
 		return checkMigrations(ctx, repo, printer)
 	}
 
+	// migrations replace or remove files of the repository
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	return applyMigrations(ctx, opts, gopts, repo, args, term, printer)
 }
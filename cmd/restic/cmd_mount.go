@@ -7,7 +7,7 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -15,7 +15,9 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 
 	"github.com/restic/restic/internal/fuse"
 
@@ -37,6 +39,30 @@ func newMountCommand() *cobra.Command {
 The "mount" command mounts the repository via fuse to a directory. This is a
 read-only mount.
 
+Writable Mount
+==============
+
+With --writable, a single snapshot is mounted at the mountpoint and can be
+modified. Changes are stored in the local directory passed via --scratch-dir,
+unmodified data is read from the repository. When the mountpoint is unmounted,
+or when a file named "commit" is created in the scratch directory, the changes
+are saved as a new snapshot, whose parent is the mounted snapshot. Files should
+be closed before creating the "commit" file. If restic is interrupted before
+the changes were saved, they are kept in the scratch directory and are saved by
+the next writable mount of the same snapshot with that scratch directory.
+
+Example:
+
+    restic mount --writable latest --scratch-dir /tmp/scratch /mnt/restic
+
+Reading Files
+=============
+
+While a file is read sequentially, up to --read-ahead bytes following the
+current position are loaded in advance. With --blob-cache-size, the loaded
+data is additionally stored in the local cache directory, where it is also
+available to later invocations of "mount" and "dump".
+
 Snapshot Directories
 ====================
 
@@ -61,8 +87,21 @@ For path templates, you can use the following patterns which will be replaced:
     %u by username
     %h by hostname
     %t by tags
+    %p by the backed up paths, which form a directory hierarchy
     %T by timestamp as specified by --time-template
 
+A path template can end with one of the following patterns. The resulting
+directory then combines all snapshots for which the template yields the same
+path, instead of containing a directory per snapshot:
+    %m merges the latest snapshot of each host, showing the newest version of
+       each entry
+    %f lists each file as a directory containing its distinct versions, which
+       are named after the time of the first snapshot containing that version
+
+If the template contains %p, these directories show the content of that path
+within the snapshots. For example, "merged/%p/%m" provides the merged latest
+state of /etc of all hosts in "merged/etc".
+
 The default path templates are:
     "ids/%i"
     "snapshots/%T"
@@ -97,6 +136,10 @@ type MountOptions struct {
 	restic.SnapshotFilter
 	TimeTemplate  string
 	PathTemplates []string
+	Writable      string
+	ScratchDir    string
+	BlobCacheSize string
+	ReadAhead     string
 }
 
 func (opts *MountOptions) AddFlags(f *pflag.FlagSet) {
@@ -110,20 +153,29 @@ func (opts *MountOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVar(&opts.TimeTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
 	f.StringVar(&opts.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
 	_ = f.MarkDeprecated("snapshot-template", "use --time-template")
+
+	f.StringVar(&opts.Writable, "writable", "", "mount `snapshot` writable and save changes as a new snapshot")
+	f.StringVar(&opts.ScratchDir, "scratch-dir", "", "store changes of a writable mount in `dir`")
+
+	f.StringVar(&opts.BlobCacheSize, "blob-cache-size", "", "keep up to `size` of loaded data in the local cache for later runs (default: disabled)")
+	f.StringVar(&opts.ReadAhead, "read-ahead", "8M", "load up to `size` in advance when a file is read sequentially, 0 disables read-ahead")
 }
 
 func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args []string) error {
-	if opts.TimeTemplate == "" {
-		return errors.Fatal("time template string cannot be empty")
-	}
-
-	if strings.HasPrefix(opts.TimeTemplate, "/") || strings.HasSuffix(opts.TimeTemplate, "/") {
-		return errors.Fatal("time template string cannot start or end with '/'")
+	if err := checkTimeTemplate(opts.TimeTemplate); err != nil {
+		return err
 	}
 
 	if len(args) == 0 {
 		return errors.Fatal("wrong number of parameters")
 	}
+	if (opts.Writable == "") != (opts.ScratchDir == "") {
+		return errors.Fatal("--writable and --scratch-dir must be specified together")
+	}
+	readAhead, err := ui.ParseBytes(opts.ReadAhead)
+	if err != nil {
+		return errors.Fatalf("invalid read-ahead size: %v", err)
+	}
 
 	mountpoint := args[0]
 
@@ -137,7 +189,13 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
-	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	var repo *repository.Repository
+	var unlock func()
+	if opts.Writable != "" {
+		ctx, repo, unlock, err = openWithAppendLock(ctx, gopts, false)
+	} else {
+		ctx, repo, unlock, err = openWithReadLock(ctx, gopts, gopts.NoLock)
+	}
 	if err != nil {
 		return err
 	}
@@ -149,13 +207,35 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		return err
 	}
 
+	blobCache, err := openBlobCache(repo, opts.BlobCacheSize)
+	if err != nil {
+		return err
+	}
+
+	var overlay *fuse.Overlay
+	if opts.Writable != "" {
+		sn, subfolder, err := opts.SnapshotFilter.FindLatest(ctx, repo, repo, opts.Writable)
+		if err != nil {
+			return errors.Fatalf("failed to find snapshot: %v", err)
+		}
+		if subfolder != "" {
+			return errors.Fatal("a subfolder of a snapshot cannot be mounted writable")
+		}
+		overlay, err = fuse.NewOverlay(repo, sn, opts.ScratchDir)
+		if err != nil {
+			return errors.Fatalf("unable to use scratch directory: %v", err)
+		}
+	}
+
 	fuseMountName := fmt.Sprintf("restic:%s", repo.Config().ID[:10])
 
 	mountOptions := []systemFuse.MountOption{
-		systemFuse.ReadOnly(),
 		systemFuse.FSName(fuseMountName),
 		systemFuse.MaxReadahead(128 * 1024),
 	}
+	if overlay == nil {
+		mountOptions = append(mountOptions, systemFuse.ReadOnly())
+	}
 
 	if opts.AllowOther {
 		mountOptions = append(mountOptions, systemFuse.AllowOther())
@@ -180,10 +260,19 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 		Filter:        opts.SnapshotFilter,
 		TimeTemplate:  opts.TimeTemplate,
 		PathTemplates: opts.PathTemplates,
+		BlobCache:     blobCache,
+		ReadAhead:     readAhead,
+	}
+	var root *fuse.Root
+	if overlay != nil {
+		root = fuse.NewOverlayRoot(repo, cfg, overlay)
+		Printf("Now serving snapshot %s writable at %s\n", overlay.Snapshot().ID().Str(), mountpoint)
+		Printf("Create the file %s to save the changes as a new snapshot.\n", filepath.Join(opts.ScratchDir, overlayCommitFile))
+		go commitOverlayOnRequest(ctx, overlay, opts.ScratchDir)
+	} else {
+		root = fuse.NewRoot(repo, cfg)
+		Printf("Now serving the repository at %s\n", mountpoint)
 	}
-	root := fuse.NewRoot(repo, cfg)
-
-	Printf("Now serving the repository at %s\n", mountpoint)
 	Printf("Use another terminal or tool to browse the contents of this folder.\n")
 	Printf("When finished, quit with Ctrl-c here or umount the mountpoint.\n")
 
@@ -204,10 +293,81 @@ func runMount(ctx context.Context, opts MountOptions, gopts GlobalOptions, args
 			Warnf("unable to umount (maybe already umounted or still in use?): %v\n", err)
 		}
 
+		if overlay != nil {
+			// save the changes even though restic was interrupted
+			if err := finishOverlay(context.WithoutCancel(ctx), overlay, opts.ScratchDir); err != nil {
+				return err
+			}
+		}
 		return ErrOK
 	case <-done:
 		// clean shutdown, nothing to do
 	}
 
+	if err == nil && overlay != nil {
+		err = finishOverlay(ctx, overlay, opts.ScratchDir)
+	}
 	return err
 }
+
+// commitOverlay saves the changes of a writable mount as a new snapshot.
+func commitOverlay(ctx context.Context, overlay *fuse.Overlay) error {
+	id, err := overlay.Commit(ctx)
+	if err != nil {
+		return errors.Fatalf("unable to save changes: %v", err)
+	}
+	if id.IsNull() {
+		Verbosef("no changes to save\n")
+		return nil
+	}
+	Printf("saved changes as snapshot %s\n", id.Str())
+	return nil
+}
+
+// overlayCommitFile is the file in the scratch directory which requests
+// saving the changes of a writable mount.
+const overlayCommitFile = "commit"
+
+// overlayCommitInterval is the interval at which the scratch directory is
+// checked for overlayCommitFile.
+var overlayCommitInterval = time.Second
+
+// commitOverlayOnRequest saves the changes whenever overlayCommitFile is
+// created in the scratch directory. The file is removed before the changes
+// are saved.
+func commitOverlayOnRequest(ctx context.Context, overlay *fuse.Overlay, scratchDir string) {
+	ticker := time.NewTicker(overlayCommitInterval)
+	defer ticker.Stop()
+
+	filename := filepath.Join(scratchDir, overlayCommitFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := os.Remove(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			Warnf("unable to remove %v: %v\n", filename, err)
+			continue
+		}
+
+		if err := commitOverlay(ctx, overlay); err != nil {
+			Warnf("%v\n", err)
+		}
+	}
+}
+
+// finishOverlay saves the changes after unmounting and removes them from the
+// scratch directory.
+func finishOverlay(ctx context.Context, overlay *fuse.Overlay, scratchDir string) error {
+	if err := commitOverlay(ctx, overlay); err != nil {
+		Warnf("the changes are kept in %v\n", scratchDir)
+		return err
+	}
+	return overlay.Clear()
+}
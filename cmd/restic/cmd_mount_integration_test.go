@@ -14,6 +14,7 @@ import (
 
 	systemFuse "github.com/anacrolix/fuse"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fuse"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -226,3 +227,52 @@ func TestMountSameTimestamps(t *testing.T) {
 
 	checkSnapshots(t, env.gopts, env.mountpoint, ids, 4)
 }
+
+func TestMountCommitRequest(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo, err := OpenRepository(ctx, env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(ctx, nil))
+	sn, err := restic.LoadSnapshot(ctx, repo, snapshotIDs[0])
+	rtest.OK(t, err)
+
+	scratch := filepath.Join(env.base, "scratch")
+	overlay, err := fuse.NewOverlay(repo, sn, scratch)
+	rtest.OK(t, err)
+	f, err := overlay.Create(ctx, "new-file", os.O_WRONLY, 0o644)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	defer func(interval time.Duration) {
+		overlayCommitInterval = interval
+	}(overlayCommitInterval)
+	overlayCommitInterval = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		commitOverlayOnRequest(ctx, overlay, scratch)
+	}()
+
+	// creating the commit file saves the changes
+	commitFile := filepath.Join(scratch, overlayCommitFile)
+	rtest.OK(t, os.WriteFile(commitFile, nil, 0o600))
+	for i := 0; i < 500 && overlay.Snapshot().ID().Equal(snapshotIDs[0]); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	rtest.Assert(t, !overlay.Snapshot().ID().Equal(snapshotIDs[0]), "changes were not saved")
+	_, err = os.Stat(commitFile)
+	rtest.Assert(t, os.IsNotExist(err), "commit file was not removed: %v", err)
+	testListSnapshots(t, env.gopts, 2)
+}
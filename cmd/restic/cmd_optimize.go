@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newOptimizeCommand() *cobra.Command {
+	var opts OptimizeOptions
+
+	cmd := &cobra.Command{
+		Use:   "optimize [flags]",
+		Short: "Train compression dictionaries for small blobs",
+		Long: `
+The "optimize" command trains zstd dictionaries from a random sample of the
+small tree and data blobs stored in the repository. Small blobs which are
+saved afterwards are compressed using the dictionaries, which considerably
+improves the compression ratio for directory metadata and small files.
+
+A dictionary is only stored if it reduces the compressed size of the sampled
+blobs by at least 5%. Existing blobs are not recompressed. The command requires
+repository version 3, use "restic migrate upgrade_repo_v3" to upgrade a
+repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		GroupID:           cmdGroupAdvanced,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			term, cancel := setupTermstatus()
+			defer cancel()
+			return runOptimize(cmd.Context(), opts, globalOptions, term)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// OptimizeOptions collects all options for the optimize command.
+type OptimizeOptions struct {
+	DryRun         bool
+	DictionarySize string
+	MaxSamples     int
+}
+
+func (opts *OptimizeOptions) AddFlags(f *pflag.FlagSet) {
+	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not store the trained dictionaries")
+	f.StringVar(&opts.DictionarySize, "dictionary-size", "112K", "maximum `size` of each dictionary")
+	f.IntVar(&opts.MaxSamples, "max-samples", 10000, "maximum number of blobs `n` to sample per blob type")
+}
+
+// minDictionaryGain is the minimum reduction of the compressed size required
+// to store a dictionary.
+const minDictionaryGain = 0.05
+
+func runOptimize(ctx context.Context, opts OptimizeOptions, gopts GlobalOptions, term *termstatus.Terminal) error {
+	size, err := ui.ParseBytes(opts.DictionarySize)
+	if err != nil || size < 1024 || size > 1024*1024 {
+		return errors.Fatalf("invalid dictionary size %q, must be between 1K and 1M", opts.DictionarySize)
+	}
+	if opts.MaxSamples < 1 {
+		return errors.Fatal("--max-samples must be positive")
+	}
+
+	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, opts.DryRun && gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if repo.Config().Version < 3 {
+		return errors.Fatal("compression dictionaries require repository version 3, upgrade the repository using `restic migrate upgrade_repo_v3`")
+	}
+
+	printer := newTerminalProgressPrinter(gopts.verbosity, term)
+
+	printer.P("loading indexes...\n")
+	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
+	if err := repo.LoadIndex(ctx, bar); err != nil {
+		return err
+	}
+
+	for _, t := range []restic.BlobType{restic.TreeBlob, restic.DataBlob} {
+		printer.P("training dictionary for %v blobs...\n", t)
+		d, stats, err := repository.TrainDictionary(ctx, repo, t, repository.TrainOptions{
+			Size:       int(size),
+			MaxSamples: opts.MaxSamples,
+		})
+		if err != nil {
+			printer.P("skipping %v blobs: %v\n", t, err)
+			continue
+		}
+
+		printer.V("sampled %d of %d small %v blobs\n", stats.Samples, stats.Blobs, t)
+		printer.P("compressed size of sampled %v blobs: %s without, %s with dictionary\n", t,
+			ui.FormatBytes(stats.Compressed), ui.FormatBytes(stats.CompressedDict))
+		if float64(stats.CompressedDict) > float64(stats.Compressed)*(1-minDictionaryGain) {
+			printer.P("dictionary does not improve compression enough, not storing it\n")
+			continue
+		}
+		if opts.DryRun {
+			printer.P("would store dictionary of %s\n", ui.FormatBytes(uint64(len(d.Data))))
+			continue
+		}
+
+		id, err := repo.SaveDictionary(ctx, d)
+		if err != nil {
+			return err
+		}
+		printer.P("stored dictionary %v of %s\n", id.Str(), ui.FormatBytes(uint64(len(d.Data))))
+	}
+
+	return nil
+}
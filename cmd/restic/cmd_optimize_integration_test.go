@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func testRunOptimize(t testing.TB, gopts GlobalOptions, opts OptimizeOptions) {
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runOptimize(context.TODO(), opts, gopts, term)
+	}))
+}
+
+func TestOptimize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	// the dictionaries are listed by every command and the test
+	env.gopts.backendTestHook = nil
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	rtest.OK(t, runInit(context.TODO(), InitOptions{RepositoryVersion: "2"}, env.gopts, nil))
+	for i := 0; i < 150; i++ {
+		dir := filepath.Join(env.testdata, fmt.Sprintf("dir%d", i))
+		rtest.OK(t, os.MkdirAll(dir, 0o755))
+		content := fmt.Sprintf("[settings]\nname = host%d\nport = %d\nenabled = true\n", i, 8000+i)
+		rtest.OK(t, os.WriteFile(filepath.Join(dir, "config.ini"), []byte(content), 0o644))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	err := withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runOptimize(context.TODO(), OptimizeOptions{DictionarySize: "16K", MaxSamples: 1000}, env.gopts, term)
+	})
+	rtest.Assert(t, err != nil, "optimize must fail for repository version 2")
+
+	rtest.OK(t, withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runMigrate(context.TODO(), MigrateOptions{}, env.gopts, []string{"upgrade_repo_v3"}, term)
+	}))
+	testRunOptimize(t, env.gopts, OptimizeOptions{DictionarySize: "16K", MaxSamples: 1000})
+
+	repo, err := OpenRepository(context.TODO(), env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(3), repo.Config().Version)
+	dicts := repo.Dictionaries()
+	rtest.Assert(t, len(dicts) > 0, "no dictionary was stored")
+	rtest.Equals(t, len(dicts), len(testListDictionaries(t, repo)))
+
+	// new blobs are compressed using the dictionaries and must be readable
+	for i := 0; i < 20; i++ {
+		rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, fmt.Sprintf("dir%d", i), "new.ini"), []byte(fmt.Sprintf("[new]\nvalue = %d\n", i)), 0o644))
+	}
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.OK(t, withTermStatus(env.gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		_, err := runCheck(context.TODO(), CheckOptions{ReadData: true}, env.gopts, nil, term)
+		return err
+	}))
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, "latest")
+	diff := directoriesContentsDiff(env.testdata, filepath.Join(restoredir, env.testdata))
+	rtest.Assert(t, diff == "", "restored directory differs:\n%v", diff)
+}
+
+func testListDictionaries(t testing.TB, repo *repository.Repository) restic.IDs {
+	var ids restic.IDs
+	rtest.OK(t, repo.List(context.TODO(), restic.DictionaryFile, func(id restic.ID, _ int64) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	return ids
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newParityCommand() *cobra.Command {
+	var opts ParityOptions
+
+	cmd := &cobra.Command{
+		Use:   "parity [flags] [parityID...]",
+		Short: "Create parity files to rebuild damaged pack files",
+		Long: `
+The "parity" command protects the pack files of the repository against bit rot
+and sector failures. It splits all pack files which are not yet protected into
+groups and computes Reed-Solomon parity data for each group, which is stored
+in a parity file. Run the command again after each backup to also protect the
+new pack files.
+
+Each group can be rebuilt as long as at most --parity-shards of its pack files
+are damaged at the same position. Damaged pack files reported by
+"restic check --read-data" can then be rebuilt in place using
+"restic repair packs". The parity files require about --parity-shards /
+--group-size of the size of the repository.
+
+Parity files which reference pack files that were removed, for example by
+"prune", are replaced by new ones. Parity files specified as arguments, such
+as damaged ones reported by "restic check --read-data", are also replaced.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		GroupID:           cmdGroupAdvanced,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			term, cancel := setupTermstatus()
+			defer cancel()
+			return runParity(cmd.Context(), opts, globalOptions, term, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// ParityOptions collects all options for the parity command.
+type ParityOptions struct {
+	GroupSize    int
+	ParityShards int
+}
+
+func (opts *ParityOptions) AddFlags(f *pflag.FlagSet) {
+	f.IntVar(&opts.GroupSize, "group-size", 10, "protect groups of `n` pack files by one parity file")
+	f.IntVar(&opts.ParityShards, "parity-shards", 1, "number of damaged pack files `n` per group which can be rebuilt")
+}
+
+func runParity(ctx context.Context, opts ParityOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	recreate := restic.NewIDSet()
+	for _, arg := range args {
+		id, err := restic.ParseID(arg)
+		if err != nil {
+			return errors.Fatalf("invalid parity file ID %q", arg)
+		}
+		recreate.Insert(id)
+	}
+
+	ctx, repo, unlock, err := openWithAppendLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if len(recreate) > 0 {
+		if err := checkRemoveAllowed(repo); err != nil {
+			return err
+		}
+	}
+
+	printer := newTerminalProgressPrinter(gopts.verbosity, term)
+	return repository.CreateParity(ctx, repo, repository.ParityOptions{
+		GroupSize:    opts.GroupSize,
+		ParityShards: opts.ParityShards,
+	}, recreate, printer)
+}
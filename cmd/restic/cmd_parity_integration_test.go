@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func testRunParity(t testing.TB, gopts GlobalOptions, opts ParityOptions, args ...string) {
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runParity(context.TODO(), opts, gopts, term, args)
+	}))
+}
+
+func testRunRepairPacks(t testing.TB, gopts GlobalOptions, args ...string) {
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runRepairPacks(context.TODO(), gopts, term, args)
+	}))
+}
+
+func TestParityRepairPacks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunParity(t, env.gopts, ParityOptions{GroupSize: 4, ParityShards: 1})
+	rtest.Assert(t, len(testRunList(t, "parity", env.gopts)) > 0, "no parity files were created")
+	testRunCheck(t, env.gopts)
+
+	// damage a data pack file
+	var damaged string
+	rtest.OK(t, filepath.Walk(filepath.Join(env.repo, "data"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || damaged != "" {
+			return err
+		}
+		if _, err := restic.ParseID(info.Name()); err != nil {
+			return nil
+		}
+		damaged = path
+		return nil
+	}))
+	original, err := os.ReadFile(damaged)
+	rtest.OK(t, err)
+	buf := append([]byte{}, original...)
+	buf[len(buf)/2] ^= 0xff
+	rtest.OK(t, os.Chmod(damaged, 0o644))
+	rtest.OK(t, os.WriteFile(damaged, buf, 0o644))
+	testRunCheckMustFail(t, env.gopts)
+
+	defer rtest.Chdir(t, env.base)()
+	testRunRepairPacks(t, env.gopts, filepath.Base(damaged))
+	buf, err = os.ReadFile(damaged)
+	rtest.OK(t, err)
+	rtest.Equals(t, original, buf, "pack file was not rebuilt")
+	testRunCheck(t, env.gopts)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/termstatus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newPolicyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Manage the retention policy stored in the repository",
+		Long: `
+The "policy" command manages the retention policy stored in the repository.
+The policy consists of rules which specify the "--keep-*" options for the
+snapshots of certain hosts, paths or tags. Running "forget" without
+"--keep-*" options applies the stored policy, such that all clients use the
+same policy. "check" warns about snapshots which the policy does not keep.
+`,
+		DisableAutoGenTag: true,
+		GroupID:           cmdGroupDefault,
+	}
+
+	cmd.AddCommand(
+		newPolicySetCommand(),
+		newPolicyShowCommand(),
+		newPolicyUnsetCommand(),
+	)
+	return cmd
+}
+
+// PolicyRuleOptions selects the snapshots a rule of the retention policy
+// applies to.
+type PolicyRuleOptions struct {
+	Hosts []string
+	Paths []string
+	Tags  restic.TagLists
+}
+
+func (opts *PolicyRuleOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringArrayVar(&opts.Hosts, "host", nil, "apply the rule to snapshots of this `host` (can be specified multiple times)")
+	f.StringArrayVar(&opts.Paths, "path", nil, "apply the rule to snapshots including this (absolute) `path` (can be specified multiple times, snapshots must include all specified paths)")
+	f.Var(&opts.Tags, "tag", "apply the rule to snapshots including `tag[,tag,...]` (can be specified multiple times)")
+}
+
+func (opts *PolicyRuleOptions) rule() restic.PolicyRule {
+	return restic.PolicyRule{Hosts: opts.Hosts, Paths: opts.Paths, Tags: opts.Tags}
+}
+
+func newPolicySetCommand() *cobra.Command {
+	var opts PolicySetOptions
+
+	cmd := &cobra.Command{
+		Use:   "set [flags]",
+		Short: "Set a rule of the retention policy",
+		Long: `
+The "set" sub-command stores a new version of the retention policy. The
+"--keep-*" options replace the rule for the snapshots selected by "--host",
+"--path" and "--tag". Without these options, the rule applies to all snapshots
+not matched by another rule. Each snapshot is handled by the first rule
+matching it, rules for specific snapshots are checked before the rule for all
+snapshots.
+
+The "--group-by" option changes how the snapshots of each rule are grouped
+before the rule is applied. It defaults to "host,paths".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.groupBySet = cmd.Flags().Changed("group-by")
+			term, cancel := setupTermstatus()
+			defer cancel()
+			return runPolicySet(cmd.Context(), opts, globalOptions, term, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// PolicySetOptions collects all options for the policy set command.
+type PolicySetOptions struct {
+	PolicyRuleOptions
+	Keep    ForgetOptions
+	GroupBy restic.SnapshotGroupByOptions
+
+	groupBySet bool
+}
+
+func (opts *PolicySetOptions) AddFlags(f *pflag.FlagSet) {
+	opts.Keep.addKeepFlags(f)
+	opts.PolicyRuleOptions.AddFlags(f)
+	opts.GroupBy = restic.SnapshotGroupByOptions{Host: true, Path: true}
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags and/or label:key, separated by comma (disable grouping with '')")
+	f.SortFlags = false
+}
+
+func runPolicySet(ctx context.Context, opts PolicySetOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the policy set command expects no arguments, only options - please see `restic help policy set` for usage and flags")
+	}
+	if err := verifyForgetOptions(&opts.Keep); err != nil {
+		return err
+	}
+	keep := opts.Keep.expirePolicy()
+	if keep.Empty() && !opts.groupBySet {
+		return errors.Fatal("no policy was specified, use the --keep-* options")
+	}
+
+	return changePolicy(ctx, gopts, term, func(p *restic.RetentionPolicy) error {
+		if opts.groupBySet {
+			p.GroupBy = opts.GroupBy.String()
+		}
+		if !keep.Empty() {
+			rule := opts.rule()
+			rule.Keep = keep
+			p.SetRule(rule)
+		}
+		return nil
+	})
+}
+
+func newPolicyUnsetCommand() *cobra.Command {
+	var opts PolicyRuleOptions
+
+	cmd := &cobra.Command{
+		Use:   "unset [flags]",
+		Short: "Remove a rule from the retention policy",
+		Long: `
+The "unset" sub-command stores a new version of the retention policy without
+the rule for the snapshots selected by "--host", "--path" and "--tag". Without
+these options, the rule for all snapshots is removed. Snapshots which are not
+matched by any rule are never removed by "forget".
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			term, cancel := setupTermstatus()
+			defer cancel()
+			return runPolicyUnset(cmd.Context(), opts, globalOptions, term, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+func runPolicyUnset(ctx context.Context, opts PolicyRuleOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the policy unset command expects no arguments, only options - please see `restic help policy unset` for usage and flags")
+	}
+
+	return changePolicy(ctx, gopts, term, func(p *restic.RetentionPolicy) error {
+		rule := opts.rule()
+		if !p.RemoveRule(rule) {
+			return errors.Fatalf("the retention policy contains no rule for %v", rule.Selection())
+		}
+		return nil
+	})
+}
+
+// changePolicy stores a new version of the retention policy, which is
+// modified by fn.
+func changePolicy(ctx context.Context, gopts GlobalOptions, term *termstatus.Terminal, fn func(p *restic.RetentionPolicy) error) error {
+	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the policy decides which snapshots are removed
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
+	current, err := restic.LoadRetentionPolicy(ctx, repo)
+	if err != nil {
+		return err
+	}
+	p := restic.NewRetentionPolicy(current)
+	if err := fn(p); err != nil {
+		return err
+	}
+
+	id, err := restic.SaveRetentionPolicy(ctx, repo, p)
+	if err != nil {
+		return errors.Fatalf("unable to save retention policy: %v", err)
+	}
+
+	printer := newTerminalProgressPrinter(gopts.verbosity, term)
+	printer.P("saved retention policy version %d as %v\n", p.Version, id.Str())
+	return nil
+}
+
+func newPolicyShowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the retention policy",
+		Long: `
+The "show" sub-command prints the current version of the retention policy
+stored in the repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyShow(cmd.Context(), globalOptions, args)
+		},
+	}
+	return cmd
+}
+
+func runPolicyShow(ctx context.Context, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the policy show command expects no arguments - please see `restic help policy show` for usage")
+	}
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	p, err := restic.LoadRetentionPolicy(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		if p == nil {
+			p = &restic.RetentionPolicy{}
+		}
+		return json.NewEncoder(globalOptions.stdout).Encode(p)
+	}
+
+	if p == nil {
+		Printf("no retention policy is stored in the repository\n")
+		return nil
+	}
+	Printf("retention policy version %d, set by %v@%v at %v\n", p.Version, p.Username, p.Hostname, p.Time.Format(TimeFormat))
+	Printf("group by: %q\n", p.GroupBy)
+	if len(p.Rules) == 0 {
+		Printf("the policy contains no rules, forget does not remove any snapshots\n")
+	}
+	for _, rule := range p.Rules {
+		Printf("%v: %v\n", rule.Selection(), rule.Keep)
+	}
+	return nil
+}
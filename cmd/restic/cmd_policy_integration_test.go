@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+func testRunPolicySet(t testing.TB, gopts GlobalOptions, opts PolicySetOptions) {
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runPolicySet(context.TODO(), opts, gopts, term, nil)
+	}))
+}
+
+func testRunPolicyShow(t testing.TB, gopts GlobalOptions) *restic.RetentionPolicy {
+	buf, err := withCaptureStdout(func() error {
+		gopts.JSON = true
+		return runPolicyShow(context.TODO(), gopts, nil)
+	})
+	rtest.OK(t, err)
+
+	var p restic.RetentionPolicy
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &p))
+	return &p
+}
+
+func testRunCheckSummary(t testing.TB, gopts GlobalOptions) checkSummary {
+	var summary checkSummary
+	rtest.OK(t, withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		var err error
+		summary, err = runCheck(context.TODO(), CheckOptions{}, gopts, nil, term)
+		return err
+	}))
+	return summary
+}
+
+func TestPolicy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	dir := filepath.Join(env.testdata, "0", "0", "9")
+	for _, host := range []string{"a", "a", "a", "b", "b"} {
+		testRunBackup(t, "", []string{dir}, BackupOptions{Host: host}, env.gopts)
+	}
+	testListSnapshots(t, env.gopts, 5)
+
+	// forget refuses to run without a policy
+	rtest.Assert(t, testRunForgetMayFail(env.gopts, ForgetOptions{}) != nil, "forget without policy did not fail")
+	rtest.Equals(t, 0, testRunPolicyShow(t, env.gopts).Version)
+
+	testRunPolicySet(t, env.gopts, PolicySetOptions{Keep: ForgetOptions{Last: 2}})
+	testRunPolicySet(t, env.gopts, PolicySetOptions{
+		PolicyRuleOptions: PolicyRuleOptions{Hosts: []string{"b"}},
+		Keep:              ForgetOptions{Last: 1},
+	})
+
+	p := testRunPolicyShow(t, env.gopts)
+	rtest.Equals(t, 2, p.Version)
+	rtest.Equals(t, 2, len(p.Rules))
+	rtest.Equals(t, []string{"b"}, p.Rules[0].Hosts)
+
+	rtest.Assert(t, testRunCheckSummary(t, env.gopts).HintForget, "check did not report snapshots violating the policy")
+
+	testRunForget(t, env.gopts, ForgetOptions{})
+	testListSnapshots(t, env.gopts, 3)
+	rtest.Assert(t, !testRunCheckSummary(t, env.gopts).HintForget, "check reported violations after forget")
+}
@@ -175,6 +175,12 @@ func runPrune(ctx context.Context, opts PruneOptions, gopts GlobalOptions, term
 	}
 	defer unlock()
 
+	if !opts.DryRun {
+		if err := checkRemoveAllowed(repo); err != nil {
+			return err
+		}
+	}
+
 	if opts.UnsafeNoSpaceRecovery != "" {
 		repoID := repo.Config().ID
 		if opts.UnsafeNoSpaceRecovery != repoID {
@@ -236,7 +242,15 @@ func runPruneWithRepo(ctx context.Context, opts PruneOptions, gopts GlobalOption
 	// Trigger GC to reset garbage collection threshold
 	runtime.GC()
 
-	return plan.Execute(ctx, printer)
+	err = plan.Execute(ctx, printer)
+	if err != nil {
+		return err
+	}
+	// only report changes which were actually made
+	if !popts.DryRun {
+		recordPruneMetrics(gopts.metrics, plan.Stats())
+	}
+	return nil
 }
 
 // printPruneStats prints out the statistics
@@ -267,6 +281,9 @@ func printPruneStats(printer progress.Printer, stats repository.PruneStats) erro
 	unusedAfter := unusedSize - stats.Size.Remove - stats.Size.Repackrm
 	printer.P("unused size after prune: %s (%s of remaining size)\n",
 		ui.FormatBytes(unusedAfter), ui.FormatPercent(unusedAfter, totalSize-totalPruneSize))
+	if stats.Packs.Retained > 0 {
+		printer.P("retained:     %10d packs cannot be removed yet, containing %s unused\n", stats.Packs.Retained, ui.FormatBytes(stats.Size.Retained))
+	}
 	printer.P("\n")
 	printer.V("totally used packs: %10d\n", stats.Packs.Used)
 	printer.V("partly used packs:  %10d\n", stats.Packs.PartlyUsed)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"path/filepath"
@@ -90,18 +91,18 @@ func createPrunableRepo(t *testing.T, env *testEnvironment) {
 }
 
 func testRunForgetJSON(t testing.TB, gopts GlobalOptions, args ...string) {
-	buf, err := withCaptureStdout(func() error {
-		gopts.JSON = true
-		opts := ForgetOptions{
-			DryRun: true,
-			Last:   1,
-		}
-		pruneOpts := PruneOptions{
-			MaxUnused: "5%",
-		}
-		return withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
-			return runForget(context.TODO(), opts, pruneOpts, gopts, term, args)
-		})
+	buf := bytes.NewBuffer(nil)
+	gopts.JSON = true
+	gopts.stdout = buf
+	opts := ForgetOptions{
+		DryRun: true,
+		Last:   1,
+	}
+	pruneOpts := PruneOptions{
+		MaxUnused: "5%",
+	}
+	err := withTermStatus(gopts, func(ctx context.Context, term *termstatus.Terminal) error {
+		return runForget(context.TODO(), opts, pruneOpts, gopts, term, args)
 	})
 	rtest.OK(t, err)
 
@@ -79,6 +79,10 @@ func runRebuildIndex(ctx context.Context, opts RepairIndexOptions, gopts GlobalO
 	}
 	defer unlock()
 
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	printer := newTerminalProgressPrinter(gopts.verbosity, term)
 
 	err = repository.RepairIndex(ctx, repo, repository.RepairIndexOptions{
@@ -18,8 +18,10 @@ func newRepairPacksCommand() *cobra.Command {
 		Use:   "packs [packIDs...]",
 		Short: "Salvage damaged pack files",
 		Long: `
-The "repair packs" command extracts intact blobs from the specified pack files, rebuilds
-the index to remove the damaged pack files and removes the pack files from the repository.
+The "repair packs" command rebuilds the specified pack files in place if they are
+protected by parity files, see "restic parity". From all other specified pack files
+it extracts intact blobs, rebuilds the index to remove the damaged pack files and
+removes the pack files from the repository.
 
 EXIT STATUS
 ===========
@@ -59,6 +61,10 @@ func runRepairPacks(ctx context.Context, gopts GlobalOptions, term *termstatus.T
 	}
 	defer unlock()
 
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	printer := newTerminalProgressPrinter(gopts.verbosity, term)
 
 	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
@@ -88,6 +94,18 @@ func runRepairPacks(ctx context.Context, gopts GlobalOptions, term *termstatus.T
 		}
 	}
 
+	rebuilt, err := repository.ReconstructPacks(ctx, repo, ids, printer)
+	if err != nil {
+		return errors.Fatalf("%s", err)
+	}
+	for id := range rebuilt {
+		ids.Delete(id)
+	}
+	if len(ids) == 0 {
+		printer.P("all pack files were rebuilt using parity files\n")
+		return nil
+	}
+
 	err = repository.RepairPacks(ctx, repo, ids, printer)
 	if err != nil {
 		return errors.Fatalf("%s", err)
@@ -79,6 +79,12 @@ func runRepairSnapshots(ctx context.Context, gopts GlobalOptions, opts RepairOpt
 	}
 	defer unlock()
 
+	if opts.Forget && !opts.DryRun {
+		if err := checkRemoveAllowed(repo); err != nil {
+			return err
+		}
+	}
+
 	snapshotLister, err := restic.MemorizeList(ctx, repo, restic.SnapshotFile)
 	if err != nil {
 		return err
@@ -60,6 +60,7 @@ Exit status is 12 if the password is incorrect.
 type RestoreOptions struct {
 	filter.ExcludePatternOptions
 	filter.IncludePatternOptions
+	trustedKeysOptions
 	Target string
 	restic.SnapshotFilter
 	DryRun              bool
@@ -86,6 +87,7 @@ func (opts *RestoreOptions) AddFlags(f *pflag.FlagSet) {
 	f.BoolVar(&opts.Verify, "verify", false, "verify restored files content")
 	f.Var(&opts.Overwrite, "overwrite", "overwrite behavior, one of (always|if-changed|if-newer|never)")
 	f.BoolVar(&opts.Delete, "delete", false, "delete files from target directory if they do not exist in snapshot. Use '--dry-run -vv' to check what would be deleted")
+	opts.trustedKeysOptions.AddFlags(f)
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
@@ -127,6 +129,11 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return errors.Fatal("'--target / --delete' must be combined with an include or exclude filter")
 	}
 
+	trustedKeys, err := opts.trustedKeysOptions.load()
+	if err != nil {
+		return err
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -146,6 +153,12 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts GlobalOptions,
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
 
+	if trustedKeys != nil {
+		if err := sn.VerifySignature(trustedKeys); err != nil {
+			return errors.Fatalf("refusing to restore snapshot %v: %v", sn.ID().Str(), err)
+		}
+	}
+
 	bar := newIndexTerminalProgress(gopts.Quiet, gopts.JSON, term)
 	err = repo.LoadIndex(ctx, bar)
 	if err != nil {
@@ -25,7 +25,9 @@ func newRewriteCommand() *cobra.Command {
 		Long: `
 The "rewrite" command excludes files from existing snapshots. It creates new
 snapshots containing the same data as the original ones, but without the files
-you specify to exclude. All metadata (time, host, tags) will be preserved.
+you specify to exclude. All metadata (time, host, tags, labels) will be preserved,
+unless it is changed using the --new-host, --new-time, --set-label or
+--remove-label options.
 
 The snapshots to rewrite are specified using the --host, --tag and --path options,
 or by providing a list of snapshot IDs. Please note that specifying neither any of
@@ -67,17 +69,21 @@ Exit status is 12 if the password is incorrect.
 }
 
 type snapshotMetadata struct {
-	Hostname string
-	Time     *time.Time
+	Hostname     string
+	Time         *time.Time
+	SetLabels    map[string]string
+	RemoveLabels []string
 }
 
 type snapshotMetadataArgs struct {
-	Hostname string
-	Time     string
+	Hostname     string
+	Time         string
+	SetLabels    []string
+	RemoveLabels []string
 }
 
 func (sma snapshotMetadataArgs) empty() bool {
-	return sma.Hostname == "" && sma.Time == ""
+	return sma.Hostname == "" && sma.Time == "" && len(sma.SetLabels) == 0 && len(sma.RemoveLabels) == 0
 }
 
 func (sma snapshotMetadataArgs) convert() (*snapshotMetadata, error) {
@@ -93,7 +99,11 @@ func (sma snapshotMetadataArgs) convert() (*snapshotMetadata, error) {
 		}
 		timeStamp = &t
 	}
-	return &snapshotMetadata{Hostname: sma.Hostname, Time: timeStamp}, nil
+	labels, err := restic.ParseLabels(sma.SetLabels)
+	if err != nil {
+		return nil, errors.Fatal(err.Error())
+	}
+	return &snapshotMetadata{Hostname: sma.Hostname, Time: timeStamp, SetLabels: labels, RemoveLabels: sma.RemoveLabels}, nil
 }
 
 // RewriteOptions collects all options for the rewrite command.
@@ -112,6 +122,8 @@ func (opts *RewriteOptions) AddFlags(f *pflag.FlagSet) {
 	f.BoolVarP(&opts.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
 	f.StringVar(&opts.Metadata.Hostname, "new-host", "", "replace hostname")
 	f.StringVar(&opts.Metadata.Time, "new-time", "", "replace time of the backup")
+	f.StringArrayVar(&opts.Metadata.SetLabels, "set-label", nil, "set the `label` in the format `key=value` (can be specified multiple times)")
+	f.StringArrayVar(&opts.Metadata.RemoveLabels, "remove-label", nil, "remove the label with this `key` (can be specified multiple times)")
 	f.BoolVarP(&opts.SnapshotSummary, "snapshot-summary", "s", false, "create snapshot summary record if it does not exist")
 
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
@@ -246,9 +258,21 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 			Verbosef("would set hostname to %s\n", newMetadata.Hostname)
 		}
 
+		if newMetadata != nil && len(newMetadata.SetLabels) != 0 {
+			Verbosef("would set labels %v\n", restic.FormatLabels(newMetadata.SetLabels))
+		}
+
+		if newMetadata != nil && len(newMetadata.RemoveLabels) != 0 {
+			Verbosef("would remove labels %v\n", newMetadata.RemoveLabels)
+		}
+
 		return true, nil
 	}
 
+	// the signature does not cover tags, labels and the original snapshot id
+	signedChanged := filteredTree != *sn.Tree || !matchingSummary ||
+		(newMetadata != nil && (newMetadata.Time != nil || (newMetadata.Hostname != "" && newMetadata.Hostname != sn.Hostname)))
+
 	// Always set the original snapshot id as this essentially a new snapshot.
 	sn.Original = sn.ID()
 	sn.Tree = &filteredTree
@@ -270,6 +294,22 @@ func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *r
 		sn.Hostname = newMetadata.Hostname
 	}
 
+	if newMetadata != nil && len(newMetadata.SetLabels) != 0 {
+		Verbosef("setting labels %v\n", restic.FormatLabels(newMetadata.SetLabels))
+		sn.SetLabels(newMetadata.SetLabels)
+	}
+
+	if newMetadata != nil && len(newMetadata.RemoveLabels) != 0 {
+		Verbosef("removing labels %v\n", newMetadata.RemoveLabels)
+		sn.RemoveLabels(newMetadata.RemoveLabels)
+	}
+
+	if sn.Signature != nil && signedChanged {
+		// the signature no longer matches the modified snapshot
+		Verbosef("removing signature of key %v\n", restic.SigningKeyID(sn.Signature.PublicKey))
+		sn.Signature = nil
+	}
+
 	// Save the new snapshot.
 	id, err := restic.SaveSnapshot(ctx, repo, sn)
 	if err != nil {
@@ -309,6 +349,12 @@ func runRewrite(ctx context.Context, opts RewriteOptions, gopts GlobalOptions, a
 	}
 	defer unlock()
 
+	if opts.Forget && !opts.DryRun {
+		if err := checkRemoveAllowed(repo); err != nil {
+			return err
+		}
+	}
+
 	snapshotLister, err := restic.MemorizeList(ctx, repo, restic.SnapshotFile)
 	if err != nil {
 		return err
@@ -125,6 +125,12 @@ func testRewriteMetadata(t *testing.T, metadata snapshotMetadataArgs) {
 	if metadata.Hostname != "" {
 		rtest.Assert(t, newSnapshot.Hostname == metadata.Hostname, "New snapshot should have host %s", metadata.Hostname)
 	}
+
+	if len(metadata.SetLabels) != 0 {
+		labels, err := restic.ParseLabels(metadata.SetLabels)
+		rtest.OK(t, err)
+		rtest.Equals(t, labels, newSnapshot.Labels, "New snapshot should have the new labels")
+	}
 }
 
 func TestRewriteMetadata(t *testing.T) {
@@ -135,6 +141,7 @@ func TestRewriteMetadata(t *testing.T) {
 		{Hostname: "", Time: newTime},
 		{Hostname: newHost, Time: ""},
 		{Hostname: newHost, Time: newTime},
+		{SetLabels: []string{"env=prod", "ticket=INC123"}},
 	} {
 		testRewriteMetadata(t, metadata)
 	}
@@ -172,3 +179,25 @@ func TestRewriteSnaphotSummary(t *testing.T) {
 	rtest.Equals(t, oldSummary.TotalBytesProcessed, sn.Summary.TotalBytesProcessed, "unexpected TotalBytesProcessed value")
 	rtest.Equals(t, oldSummary.TotalFilesProcessed, sn.Summary.TotalFilesProcessed, "unexpected TotalFilesProcessed value")
 }
+
+func TestRewriteSigned(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	signingKey, _ := writeSigningKeys(t, filepath.Join(env.base, "signed"))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{SigningKeyFile: signingKey}, env.gopts)
+
+	// labels are not covered by the signature
+	testRunRewriteExclude(t, env.gopts, nil, true, snapshotMetadataArgs{SetLabels: []string{"env=prod"}})
+	snapshotIDs := testListSnapshots(t, env.gopts, 1)
+	sn := testLoadSnapshot(t, env.gopts, snapshotIDs[0])
+	rtest.Equals(t, map[string]string{"env": "prod"}, sn.Labels)
+	rtest.OK(t, sn.VerifySignature(nil))
+
+	// the signature is removed if the snapshot itself is modified
+	testRunRewriteExclude(t, env.gopts, nil, true, snapshotMetadataArgs{Hostname: "new host"})
+	snapshotIDs = testListSnapshots(t, env.gopts, 1)
+	sn = testLoadSnapshot(t, env.gopts, snapshotIDs[0])
+	rtest.Assert(t, sn.Signature == nil, "signature of modified snapshot was kept")
+}
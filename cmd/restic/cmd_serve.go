@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/serve"
+)
+
+func newServeCommand() *cobra.Command {
+	var opts ServeOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve [flags]",
+		Short: "Serve the repository via HTTP and WebDAV",
+		Long: `
+The "serve" command serves the snapshots of the repository read-only via HTTP.
+The directory structure is the same as for the "mount" command. Directories
+can be browsed using a web browser or a WebDAV client, files can be downloaded
+using HTTP range requests, which only load the required parts of a file from
+the repository. This works on all platforms and does not require FUSE.
+
+Symlinks and special files are not served. The server does not support
+authentication or TLS, by default it only listens on localhost. Use a reverse
+proxy to make the repository available to other hosts. Requests are only
+answered if their Host header is localhost, a loopback address or the host
+given in --listen.
+
+The --path-template and --time-template options work as described for the
+"mount" command.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+Exit status is 10 if the repository does not exist.
+Exit status is 11 if the repository is already locked.
+Exit status is 12 if the password is incorrect.
+`,
+		DisableAutoGenTag: true,
+		GroupID:           cmdGroupDefault,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runServe(cmd.Context(), opts, globalOptions)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// ServeOptions collects all options for the serve command.
+type ServeOptions struct {
+	Listen string
+	restic.SnapshotFilter
+	TimeTemplate  string
+	PathTemplates []string
+}
+
+func (opts *ServeOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.Listen, "listen", "localhost:8000", "listen on `address`")
+
+	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
+
+	f.StringArrayVar(&opts.PathTemplates, "path-template", nil, "set `template` for path names (can be specified multiple times)")
+	f.StringVar(&opts.TimeTemplate, "time-template", time.RFC3339, "set `template` to use for times")
+}
+
+// checkTimeTemplate verifies that the time template can be used for the
+// names of snapshot directories.
+func checkTimeTemplate(timeTemplate string) error {
+	if timeTemplate == "" {
+		return errors.Fatal("time template string cannot be empty")
+	}
+	if strings.HasPrefix(timeTemplate, "/") || strings.HasSuffix(timeTemplate, "/") {
+		return errors.Fatal("time template string cannot start or end with '/'")
+	}
+	return nil
+}
+
+func runServe(ctx context.Context, opts ServeOptions, gopts GlobalOptions) error {
+	if err := checkTimeTemplate(opts.TimeTemplate); err != nil {
+		return err
+	}
+
+	debug.Log("start serve")
+	defer debug.Log("finish serve")
+
+	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	bar := newIndexProgress(gopts.Quiet, gopts.JSON)
+	err = repo.LoadIndex(ctx, bar)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		return errors.Fatalf("unable to listen on %v: %v", opts.Listen, err)
+	}
+
+	// only answer requests for the listen address to prevent DNS rebinding
+	var hosts []string
+	if host, _, err := net.SplitHostPort(opts.Listen); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+
+	srv := &http.Server{
+		Handler: serve.New(repo, serve.Config{
+			Filter:        opts.SnapshotFilter,
+			TimeTemplate:  opts.TimeTemplate,
+			PathTemplates: opts.PathTemplates,
+			Hosts:         hosts,
+		}),
+		ReadHeaderTimeout: time.Minute,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	Printf("Now serving the repository at http://%s/\n", listener.Addr())
+	Printf("When finished, quit with Ctrl-c here.\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(listener)
+	}()
+
+	select {
+	case <-ctx.Done():
+		debug.Log("shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		return ErrOK
+	case err := <-done:
+		return err
+	}
+}
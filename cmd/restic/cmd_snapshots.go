@@ -47,6 +47,7 @@ Exit status is 12 if the password is incorrect.
 // SnapshotOptions bundles all options for the snapshots command.
 type SnapshotOptions struct {
 	restic.SnapshotFilter
+	trustedKeysOptions
 	Compact bool
 	Last    bool // This option should be removed in favour of Latest.
 	Latest  int
@@ -63,10 +64,17 @@ func (opts *SnapshotOptions) AddFlags(f *pflag.FlagSet) {
 		panic(err)
 	}
 	f.IntVar(&opts.Latest, "latest", 0, "only show the last `n` snapshots for each host and path")
-	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths and/or tags, separated by comma")
+	f.VarP(&opts.GroupBy, "group-by", "g", "`group` snapshots by host, paths, tags and/or label:key, separated by comma")
+	f.BoolVar(&opts.IncludeCheckpoints, "checkpoints", false, "also show checkpoints of unfinished backups")
+	opts.trustedKeysOptions.AddFlags(f)
 }
 
 func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions, args []string) error {
+	trustedKeys, err := opts.trustedKeysOptions.load()
+	if err != nil {
+		return err
+	}
+
 	ctx, repo, unlock, err := openWithReadLock(ctx, gopts, gopts.NoLock)
 	if err != nil {
 		return err
@@ -80,6 +88,14 @@ func runSnapshots(ctx context.Context, opts SnapshotOptions, gopts GlobalOptions
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+
+	if trustedKeys != nil {
+		for _, sn := range snapshots {
+			if err := sn.VerifySignature(trustedKeys); err != nil {
+				Warnf("snapshot %v: %v\n", sn.ID().Str(), err)
+			}
+		}
+	}
 	snapshotGroups, grouped, err := restic.GroupSnapshots(snapshots, opts.GroupBy)
 	if err != nil {
 		return err
@@ -294,7 +310,7 @@ func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
 		return err
 	}
 
-	if key.Hostname == "" && key.Tags == nil && key.Paths == nil {
+	if key.Hostname == "" && key.Tags == nil && key.Paths == nil && key.Labels == nil {
 		return nil
 	}
 
@@ -312,6 +328,9 @@ func PrintSnapshotGroupHeader(stdout io.Writer, groupKeyJSON string) error {
 	if key.Paths != nil {
 		infoStrings = append(infoStrings, "paths ["+strings.Join(key.Paths, ", ")+"]")
 	}
+	if key.Labels != nil {
+		infoStrings = append(infoStrings, "labels ["+strings.Join(restic.FormatLabels(key.Labels), ", ")+"]")
+	}
 	if infoStrings != nil {
 		if _, err := fmt.Fprintf(stdout, " for (%s)", strings.Join(infoStrings, ", ")); err != nil {
 			return err
@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -393,7 +392,7 @@ func statsDebugFileType(ctx context.Context, repo restic.Lister, tpe restic.File
 func statsDebugBlobs(ctx context.Context, repo restic.Repository) ([restic.NumBlobTypes]*sizeHistogram, error) {
 	var hist [restic.NumBlobTypes]*sizeHistogram
 	for i := 0; i < len(hist); i++ {
-		hist[i] = newSizeHistogram(2 * chunker.MaxSize)
+		hist[i] = newSizeHistogram(2 * uint64(repo.Config().ChunkerParams().MaxSize))
 	}
 
 	err := repo.ListBlobs(ctx, func(pb restic.PackedBlob) {
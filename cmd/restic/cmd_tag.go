@@ -19,13 +19,16 @@ func newTagCommand() *cobra.Command {
 
 	cmd := &cobra.Command{
 		Use:   "tag [flags] [snapshotID ...]",
-		Short: "Modify tags on snapshots",
+		Short: "Modify tags and labels on snapshots",
 		Long: `
 The "tag" command allows you to modify tags on exiting snapshots.
 
 You can either set/replace the entire set of tags on a snapshot, or
 add tags to/remove tags from the existing set.
 
+Labels are set with --set-label key=value, which replaces an existing label
+with the same key, and removed with --remove-label key.
+
 When no snapshotID is given, all snapshots matching the host, tag and path filter criteria are modified.
 
 EXIT STATUS
@@ -56,12 +59,17 @@ type TagOptions struct {
 	SetTags    restic.TagLists
 	AddTags    restic.TagLists
 	RemoveTags restic.TagLists
+
+	SetLabels    []string
+	RemoveLabels []string
 }
 
 func (opts *TagOptions) AddFlags(f *pflag.FlagSet) {
 	f.Var(&opts.SetTags, "set", "`tags` which will replace the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	f.Var(&opts.AddTags, "add", "`tags` which will be added to the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
 	f.Var(&opts.RemoveTags, "remove", "`tags` which will be removed from the existing tags in the format `tag[,tag,...]` (can be given multiple times)")
+	f.StringArrayVar(&opts.SetLabels, "set-label", nil, "set the `label` in the format `key=value` (can be given multiple times)")
+	f.StringArrayVar(&opts.RemoveLabels, "remove-label", nil, "remove the label with this `key` (can be given multiple times)")
 	initMultiSnapshotFilter(f, &opts.SnapshotFilter, true)
 }
 
@@ -76,7 +84,8 @@ type changedSnapshotsSummary struct {
 	ChangedSnapshots int    `json:"changed_snapshots"`
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string, printFunc func(changedSnapshot)) (bool, error) {
+func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string,
+	setLabels map[string]string, removeLabels []string, printFunc func(changedSnapshot)) (bool, error) {
 	var changed bool
 
 	if len(setTags) != 0 {
@@ -92,6 +101,12 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 			changed = true
 		}
 	}
+	if sn.SetLabels(setLabels) {
+		changed = true
+	}
+	if sn.RemoveLabels(removeLabels) {
+		changed = true
+	}
 
 	if changed {
 		// Retain the original snapshot id over all tag changes.
@@ -120,12 +135,17 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 }
 
 func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
-	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
+	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 &&
+		len(opts.SetLabels) == 0 && len(opts.RemoveLabels) == 0 {
 		return errors.Fatal("nothing to do!")
 	}
 	if len(opts.SetTags) != 0 && (len(opts.AddTags) != 0 || len(opts.RemoveTags) != 0) {
 		return errors.Fatal("--set and --add/--remove cannot be given at the same time")
 	}
+	setLabels, err := restic.ParseLabels(opts.SetLabels)
+	if err != nil {
+		return errors.Fatal(err.Error())
+	}
 
 	Verbosef("create exclusive lock for repository\n")
 	ctx, repo, unlock, err := openWithExclusiveLock(ctx, gopts, false)
@@ -134,6 +154,10 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, term *ter
 	}
 	defer unlock()
 
+	if err := checkRemoveAllowed(repo); err != nil {
+		return err
+	}
+
 	printFunc := func(c changedSnapshot) {
 		Verboseff("old snapshot ID: %v -> new snapshot ID: %v\n", c.OldSnapshotID, c.NewSnapshotID)
 	}
@@ -157,7 +181,8 @@ func runTag(ctx context.Context, opts TagOptions, gopts GlobalOptions, term *ter
 	}
 
 	for sn := range FindFilteredSnapshots(ctx, repo, repo, &opts.SnapshotFilter, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(), printFunc)
+		changed, err := changeTags(ctx, repo, sn, opts.SetTags.Flatten(), opts.AddTags.Flatten(), opts.RemoveTags.Flatten(),
+			setLabels, opts.RemoveLabels, printFunc)
 		if err != nil {
 			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
@@ -93,3 +93,33 @@ func TestTag(t *testing.T) {
 	rtest.Assert(t, *newest.Original == originalID,
 		"expected original ID to be set to the first snapshot id")
 }
+
+func TestTagLabels(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{Labels: []string{"env=prod", "ticket=INC123"}}, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest != nil, "expected a new backup, got nil")
+	rtest.Equals(t, map[string]string{"env": "prod", "ticket": "INC123"}, newest.Labels)
+
+	// snapshots which do not match the label filter are not modified
+	opts := TagOptions{SetLabels: []string{"env=dev"}}
+	opts.Labels = restic.LabelLists{{"env=test"}}
+	testRunTag(t, opts, env.gopts)
+	newest, _ = testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Original == nil, "expected unmodified snapshot, got original ID %v", newest.Original)
+
+	opts.Labels = restic.LabelLists{{"env=prod", "ticket"}}
+	opts.RemoveLabels = []string{"ticket"}
+	testRunTag(t, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+	newest, _ = testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, map[string]string{"env": "dev"}, newest.Labels)
+	rtest.Assert(t, newest.Original != nil, "expected original snapshot id, got nil")
+
+	testRunTag(t, TagOptions{RemoveLabels: []string{"env"}}, env.gopts)
+	newest, _ = testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Labels == nil, "expected no labels, got %v", newest.Labels)
+}
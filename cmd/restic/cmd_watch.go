@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/restic/internal/changes"
+	"github.com/restic/restic/internal/errors"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func newWatchCommand() *cobra.Command {
+	var opts WatchOptions
+
+	cmd := &cobra.Command{
+		Use:   "watch [flags] --journal file path [path...]",
+		Short: "Record modified directories for faster backups",
+		Long: `
+The "watch" command observes the given paths using fanotify and records all
+modified directories in a change journal. When the journal is passed to
+"backup --changes-from", directories which have not changed since the parent
+snapshot are not read again.
+
+The command runs until it is interrupted. It is only available on Linux 5.9 or
+newer and requires the CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH capabilities.
+Filesystems which are mounted below the paths after the command was started
+are not observed.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful.
+Exit status is 1 if there was any error.
+`,
+		GroupID:           cmdGroupAdvanced,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runWatch(cmd.Context(), opts, args)
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// WatchOptions collects all options for the watch command.
+type WatchOptions struct {
+	Journal string
+}
+
+func (opts *WatchOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.Journal, "journal", "", "write the change journal to `file`")
+}
+
+func runWatch(ctx context.Context, opts WatchOptions, args []string) error {
+	if opts.Journal == "" {
+		return errors.Fatal("please specify the change journal using --journal")
+	}
+	if len(args) == 0 {
+		return errors.Fatal("no paths to watch specified")
+	}
+
+	roots := make([]string, 0, len(args))
+	for _, arg := range args {
+		root, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+
+	w, err := changes.Create(opts.Journal, roots, time.Now())
+	if err != nil {
+		return errors.Fatalf("unable to create change journal: %v", err)
+	}
+
+	Verbosef("watching %v\n", roots)
+	// runs until the command is interrupted
+	err = changes.Watch(ctx, roots, w, Warnf)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// copyJournal allows resuming an interrupted copy without traversing the trees
+// of all snapshots again. It lists the blobs which must be copied for each
+// snapshot. Blobs which are needed by several snapshots are only listed for the
+// first one, the snapshots are therefore copied in the order of the journal.
+//
+// Blobs which already existed in the destination repository are not listed.
+// This is only valid as long as none of the index files of the destination
+// repository that existed when the journal was written have been removed, for
+// example by prune.
+type copyJournal struct {
+	Source      string             `json:"source"`
+	Destination string             `json:"destination"`
+	Indexes     restic.IDs         `json:"indexes"`
+	Snapshots   []copyJournalEntry `json:"snapshots"`
+}
+
+type copyJournalEntry struct {
+	Snapshot restic.ID           `json:"snapshot"`
+	Original restic.ID           `json:"original"`
+	Blobs    []restic.BlobHandle `json:"blobs"`
+}
+
+// copyJournalPath returns the location of the journal for copying snapshots
+// from srcRepo to dstRepo. The journal is stored in the cache directory of
+// srcRepo, the empty string is returned if the cache is disabled.
+func copyJournalPath(srcRepo, dstRepo *repository.Repository) string {
+	if srcRepo.Cache() == nil {
+		return ""
+	}
+	return filepath.Join(srcRepo.Cache().Dir(), "copy", dstRepo.Config().ID+".json")
+}
+
+// loadCopyJournal reads the journal at path. It returns nil if the journal does
+// not exist.
+func loadCopyJournal(path string) (*copyJournal, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &copyJournal{}
+	if err := json.Unmarshal(buf, j); err != nil {
+		return nil, errors.Wrapf(err, "invalid copy journal %v", path)
+	}
+	return j, nil
+}
+
+// save atomically replaces the journal at path.
+func (j *copyJournal) save(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(j)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	debug.Log("saved copy journal with %d snapshots to %v", len(j.Snapshots), path)
+	return nil
+}
+
+// usable returns whether the journal belongs to the given repositories and
+// whether the blobs omitted from it still exist in the destination repository.
+func (j *copyJournal) usable(srcRepo, dstRepo *repository.Repository, dstIndexes restic.IDSet) bool {
+	if j.Source != srcRepo.Config().ID || j.Destination != dstRepo.Config().ID {
+		return false
+	}
+	for _, id := range j.Indexes {
+		if !dstIndexes.Has(id) {
+			debug.Log("index %v of the destination repository was removed", id.Str())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// copyState is the progress of the copy command.
+type copyState struct {
+	SnapshotsDone  uint64
+	SnapshotsTotal uint64
+	BlobsDone      uint64
+	BlobsTotal     uint64
+	BytesDone      uint64
+	BytesTotal     uint64
+}
+
+// copyProgress reports the progress of the copy command, either as a status
+// line or as JSON messages.
+type copyProgress struct {
+	updater *progress.Updater
+	m       sync.Mutex
+	s       copyState
+
+	show bool
+	json bool
+}
+
+func newCopyProgress(gopts GlobalOptions) *copyProgress {
+	p := &copyProgress{
+		show: !gopts.Quiet,
+		json: gopts.JSON,
+	}
+	p.updater = progress.NewUpdater(calculateProgressInterval(p.show, p.json), p.update)
+	return p
+}
+
+// SetTotal sets the number of snapshots and the number and size of the blobs
+// which have to be copied.
+func (p *copyProgress) SetTotal(snapshots, blobs, bytes uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.SnapshotsTotal = snapshots
+	p.s.BlobsTotal = blobs
+	p.s.BytesTotal = bytes
+}
+
+// AddBlob records that a blob of the given size was copied.
+func (p *copyProgress) AddBlob(size uint64) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.BlobsDone++
+	p.s.BytesDone += size
+}
+
+// SnapshotDone records that a snapshot was saved.
+func (p *copyProgress) SnapshotDone() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.SnapshotsDone++
+}
+
+// Finish prints the summary.
+func (p *copyProgress) Finish() {
+	p.updater.Done()
+}
+
+func (p *copyProgress) update(runtime time.Duration, final bool) {
+	p.m.Lock()
+	s := p.s
+	p.m.Unlock()
+
+	if p.json {
+		if final {
+			p.print(copySummary{
+				MessageType:     "summary",
+				SecondsElapsed:  uint64(runtime / time.Second),
+				SnapshotsCopied: s.SnapshotsDone,
+				BlobsCopied:     s.BlobsDone,
+				BytesCopied:     s.BytesDone,
+			})
+			return
+		}
+
+		status := copyStatus{
+			MessageType:    "status",
+			SecondsElapsed: uint64(runtime / time.Second),
+			TotalSnapshots: s.SnapshotsTotal,
+			SnapshotsDone:  s.SnapshotsDone,
+			TotalBlobs:     s.BlobsTotal,
+			BlobsDone:      s.BlobsDone,
+			TotalBytes:     s.BytesTotal,
+			BytesDone:      s.BytesDone,
+		}
+		if s.BytesTotal > 0 {
+			status.PercentDone = float64(s.BytesDone) / float64(s.BytesTotal)
+		}
+		p.print(status)
+		return
+	}
+
+	if !p.show || (final && s.SnapshotsTotal == 0) {
+		return
+	}
+	printProgress(fmt.Sprintf("[%s] %s  %d / %d snapshots, %d / %d blobs, %s / %s",
+		ui.FormatDuration(runtime), ui.FormatPercent(s.BytesDone, s.BytesTotal),
+		s.SnapshotsDone, s.SnapshotsTotal, s.BlobsDone, s.BlobsTotal,
+		ui.FormatBytes(s.BytesDone), ui.FormatBytes(s.BytesTotal)), final)
+}
+
+func (p *copyProgress) print(status interface{}) {
+	Println(ui.ToJSONString(status))
+}
+
+type copyStatus struct {
+	MessageType    string  `json:"message_type"` // "status"
+	SecondsElapsed uint64  `json:"seconds_elapsed,omitempty"`
+	PercentDone    float64 `json:"percent_done"`
+	TotalSnapshots uint64  `json:"total_snapshots"`
+	SnapshotsDone  uint64  `json:"snapshots_done"`
+	TotalBlobs     uint64  `json:"total_blobs"`
+	BlobsDone      uint64  `json:"blobs_done"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	BytesDone      uint64  `json:"bytes_done"`
+}
+
+type copySummary struct {
+	MessageType     string `json:"message_type"` // "summary"
+	SecondsElapsed  uint64 `json:"seconds_elapsed,omitempty"`
+	SnapshotsCopied uint64 `json:"snapshots_copied"`
+	BlobsCopied     uint64 `json:"blobs_copied"`
+	BytesCopied     uint64 `json:"bytes_copied"`
+}
+
+// countingBlobSet reports the blobs deleted by Repack or CopyPacks, that is
+// the blobs which were copied, to the progress.
+type countingBlobSet struct {
+	restic.BlobSet
+	repo     restic.Repository
+	progress *copyProgress
+}
+
+func (s *countingBlobSet) Delete(h restic.BlobHandle) {
+	s.BlobSet.Delete(h)
+	size, _ := s.repo.LookupBlobSize(h.Type, h.ID)
+	s.progress.AddBlob(uint64(size))
+}
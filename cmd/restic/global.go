@@ -29,6 +29,7 @@ import (
 	"github.com/restic/restic/internal/backend/sema"
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tiered"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/repository"
@@ -57,6 +58,7 @@ type backendWrapper func(r backend.Backend) (backend.Backend, error)
 type GlobalOptions struct {
 	Repo               string
 	RepositoryFile     string
+	ColdRepo           string
 	PasswordFile       string
 	PasswordCommand    string
 	KeyHint            string
@@ -75,6 +77,10 @@ type GlobalOptions struct {
 
 	backend.TransportOptions
 	limiter.Limits
+	LimitSchedule     string
+	LimitScheduleFile string
+	MetricsFile       string
+	MetricsListen     string
 
 	password string
 	stdout   io.Writer
@@ -83,6 +89,13 @@ type GlobalOptions struct {
 	backends                              *location.Registry
 	backendTestHook, backendInnerTestHook backendWrapper
 
+	// repo is returned by OpenRepository instead of opening the repository
+	// again, this allows the daemon to keep repositories open between jobs.
+	repo *repository.Repository
+
+	// metrics is nil unless --metrics-file or --metrics-listen is set
+	metrics *commandMetrics
+
 	// verbosity is set as follows:
 	//  0 means: don't print any messages except errors, this is used when --quiet is specified
 	//  1 is the default: print essential messages
@@ -98,6 +111,7 @@ type GlobalOptions struct {
 func (opts *GlobalOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVarP(&opts.Repo, "repo", "r", "", "`repository` to backup to or restore from (default: $RESTIC_REPOSITORY)")
 	f.StringVarP(&opts.RepositoryFile, "repository-file", "", "", "`file` to read the repository location from (default: $RESTIC_REPOSITORY_FILE)")
+	f.StringVar(&opts.ColdRepo, "cold-repo", "", "`repository` to store the data pack files in, see the documentation for details (default: $RESTIC_COLD_REPOSITORY)")
 	f.StringVarP(&opts.PasswordFile, "password-file", "p", "", "`file` to read the repository password from (default: $RESTIC_PASSWORD_FILE)")
 	f.StringVarP(&opts.KeyHint, "key-hint", "", "", "`key` ID of key to try decrypting first (default: $RESTIC_KEY_HINT)")
 	f.StringVarP(&opts.PasswordCommand, "password-command", "", "", "shell `command` to obtain the repository password from (default: $RESTIC_PASSWORD_COMMAND)")
@@ -118,13 +132,18 @@ func (opts *GlobalOptions) AddFlags(f *pflag.FlagSet) {
 	f.BoolVar(&opts.NoExtraVerify, "no-extra-verify", false, "skip additional verification of data before upload (see documentation)")
 	f.IntVar(&opts.Limits.UploadKb, "limit-upload", 0, "limits uploads to a maximum `rate` in KiB/s. (default: unlimited)")
 	f.IntVar(&opts.Limits.DownloadKb, "limit-download", 0, "limits downloads to a maximum `rate` in KiB/s. (default: unlimited)")
+	f.StringVar(&opts.LimitSchedule, "limit-schedule", "", "limit uploads and downloads according to a time of day `schedule`, e.g. \"08:00-18:00 2M, else unlimited\" (rates in KiB/s, or kbit/s, Mbit/s, Gbit/s with suffix K, M, G)")
+	f.StringVar(&opts.LimitScheduleFile, "limit-schedule-file", "", "read the limit schedule from `file`, which is reloaded on SIGUSR2 (same format as --limit-schedule)")
 	f.UintVar(&opts.PackSize, "pack-size", 0, "set target pack `size` in MiB, created pack files may be larger (default: $RESTIC_PACK_SIZE)")
 	f.StringSliceVarP(&opts.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
+	f.StringVar(&opts.MetricsFile, "metrics-file", "", "write metrics in the Prometheus text format to `file` when the command finishes")
+	f.StringVar(&opts.MetricsListen, "metrics-listen", "", "serve metrics in the Prometheus text format at http://`address`/metrics while the command runs")
 	f.StringVar(&opts.HTTPUserAgent, "http-user-agent", "", "set a http user agent for outgoing http requests")
 	f.DurationVar(&opts.StuckRequestTimeout, "stuck-request-timeout", 5*time.Minute, "`duration` after which to retry stuck requests")
 
 	opts.Repo = os.Getenv("RESTIC_REPOSITORY")
 	opts.RepositoryFile = os.Getenv("RESTIC_REPOSITORY_FILE")
+	opts.ColdRepo = os.Getenv("RESTIC_COLD_REPOSITORY")
 	opts.PasswordFile = os.Getenv("RESTIC_PASSWORD_FILE")
 	opts.KeyHint = os.Getenv("RESTIC_KEY_HINT")
 	opts.PasswordCommand = os.Getenv("RESTIC_PASSWORD_COMMAND")
@@ -470,6 +489,10 @@ const maxKeys = 20
 
 // OpenRepository reads the password and opens the repository.
 func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Repository, error) {
+	if opts.repo != nil {
+		return opts.repo, nil
+	}
+
 	repo, err := ReadRepo(opts)
 	if err != nil {
 		return nil, err
@@ -520,6 +543,14 @@ func OpenRepository(ctx context.Context, opts GlobalOptions) (*repository.Reposi
 		return nil, errors.Fatalf("%s", err)
 	}
 
+	coldTier := s.Config().HasFeature(restic.FeatureColdTier)
+	if coldTier && opts.ColdRepo == "" {
+		return nil, errors.Fatal("the repository stores its data in a cold tier, please specify it using --cold-repo")
+	}
+	if !coldTier && opts.ColdRepo != "" {
+		return nil, errors.Fatal("the repository does not use a cold tier, but --cold-repo was specified")
+	}
+
 	if stdoutIsTerminal() && !opts.JSON {
 		id := s.Config().ID
 		if len(id) > 8 {
@@ -599,7 +630,7 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 	return cfg, nil
 }
 
-func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.Options, create bool) (backend.Backend, error) {
+func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.Options, lim limiter.Limiter, create bool) (backend.Backend, error) {
 	debug.Log("parsing location %v", location.StripPassword(gopts.backends, s))
 	loc, err := location.Parse(gopts.backends, s)
 	if err != nil {
@@ -617,7 +648,6 @@ func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.
 	}
 
 	// wrap the transport so that the throughput via HTTP is limited
-	lim := limiter.NewStaticLimiter(gopts.Limits)
 	rt = lim.Transport(rt)
 
 	factory := gopts.backends.Lookup(loc.Scheme)
@@ -660,7 +690,11 @@ func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.
 	success := func(msg string, retries int) {
 		Warnf("%v operation successful after %d retries\n", msg, retries)
 	}
-	be = retry.New(be, 15*time.Minute, report, success)
+	rb := retry.New(be, 15*time.Minute, report, success)
+	if gopts.metrics != nil {
+		rb.Stats = gopts.metrics.backendStats
+	}
+	be = rb
 
 	// wrap backend if a test specified a hook
 	if gopts.backendTestHook != nil {
@@ -674,8 +708,20 @@ func innerOpen(ctx context.Context, s string, gopts GlobalOptions, opts options.
 }
 
 // Open the backend specified by a location config.
-func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (backend.Backend, error) {
-	be, err := innerOpen(ctx, s, gopts, opts, false)
+func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (_ backend.Backend, err error) {
+	lim, stopLimiter, err := newLimiter(ctx, gopts)
+	if err != nil {
+		return nil, err
+	}
+	if stopLimiter != nil {
+		defer func() {
+			if err != nil {
+				stopLimiter()
+			}
+		}()
+	}
+
+	be, err := innerOpen(ctx, s, gopts, opts, lim, false)
 	if err != nil {
 		return nil, err
 	}
@@ -693,10 +739,60 @@ func open(ctx context.Context, s string, gopts GlobalOptions, opts options.Optio
 		return nil, errors.New("config file has zero size, invalid repository?")
 	}
 
-	return be, nil
+	be, err = withColdTier(ctx, be, gopts, opts, lim, false)
+	if err != nil {
+		return nil, err
+	}
+	return withLimiterStop(be, stopLimiter), nil
 }
 
 // Create the backend specified by URI.
-func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (backend.Backend, error) {
-	return innerOpen(ctx, s, gopts, opts, true)
+func create(ctx context.Context, s string, gopts GlobalOptions, opts options.Options) (_ backend.Backend, err error) {
+	lim, stopLimiter, err := newLimiter(ctx, gopts)
+	if err != nil {
+		return nil, err
+	}
+	if stopLimiter != nil {
+		defer func() {
+			if err != nil {
+				stopLimiter()
+			}
+		}()
+	}
+
+	be, err := innerOpen(ctx, s, gopts, opts, lim, true)
+	if err != nil {
+		return nil, err
+	}
+	be, err = withColdTier(ctx, be, gopts, opts, lim, true)
+	if err != nil {
+		return nil, err
+	}
+	return withLimiterStop(be, stopLimiter), nil
+}
+
+// withLimiterStop returns be such that stop is called once be is closed. be
+// is returned as is if stop is nil.
+func withLimiterStop(be backend.Backend, stop func()) backend.Backend {
+	if stop == nil {
+		return be
+	}
+	return &scheduleBackend{Backend: be, stop: stop}
+}
+
+// withColdTier combines be with the backend specified by --cold-repo, which
+// then stores the data pack files. be is returned as is if no cold repository
+// was specified. Both backends share the limiter lim, such that the limits
+// apply to the combined traffic.
+func withColdTier(ctx context.Context, be backend.Backend, gopts GlobalOptions, opts options.Options, lim limiter.Limiter, create bool) (backend.Backend, error) {
+	if gopts.ColdRepo == "" {
+		return be, nil
+	}
+
+	cold, err := innerOpen(ctx, gopts.ColdRepo, gopts, opts, lim, create)
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+	return tiered.New(be, cold), nil
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// newLimiter returns the limiter configured by the global options. If a limit
+// schedule is used, the limits are updated until either ctx is cancelled or
+// stop is called. stop is nil for static limits.
+func newLimiter(ctx context.Context, gopts GlobalOptions) (lim limiter.Limiter, stop func(), err error) {
+	if gopts.LimitSchedule == "" && gopts.LimitScheduleFile == "" {
+		return limiter.NewStaticLimiter(gopts.Limits), nil, nil
+	}
+	if gopts.LimitSchedule != "" && gopts.LimitScheduleFile != "" {
+		return nil, nil, errors.Fatal("--limit-schedule and --limit-schedule-file cannot be used together")
+	}
+
+	schedule, err := loadLimitSchedule(gopts)
+	if err != nil {
+		return nil, nil, err
+	}
+	dl := limiter.NewDynamicLimiter(schedule)
+	ctx, cancel := context.WithCancel(ctx)
+	go dl.Run(ctx)
+
+	if gopts.LimitScheduleFile != "" && len(reloadSignals) > 0 {
+		go reloadLimitSchedule(ctx, dl, gopts)
+	}
+	return dl, cancel, nil
+}
+
+// scheduleBackend stops updating the limits of a limit schedule once the
+// backend is closed, such that no goroutines and signal handlers remain for
+// repositories which are no longer used.
+type scheduleBackend struct {
+	backend.Backend
+	stop func()
+}
+
+func (be *scheduleBackend) Close() error {
+	be.stop()
+	return be.Backend.Close()
+}
+
+func (be *scheduleBackend) Unwrap() backend.Backend {
+	return be.Backend
+}
+
+// loadLimitSchedule parses the limit schedule, the limits set by
+// --limit-upload and --limit-download apply outside of the scheduled time
+// ranges unless the schedule contains an else rule.
+func loadLimitSchedule(gopts GlobalOptions) (limiter.Schedule, error) {
+	text := gopts.LimitSchedule
+	if gopts.LimitScheduleFile != "" {
+		buf, err := os.ReadFile(gopts.LimitScheduleFile)
+		if err != nil {
+			return limiter.Schedule{}, errors.Fatalf("unable to read limit schedule: %v", err)
+		}
+		// allow one rule per line
+		text = strings.ReplaceAll(string(buf), "\n", ",")
+	}
+
+	schedule, err := limiter.ParseSchedule(text, gopts.Limits)
+	if err != nil {
+		return limiter.Schedule{}, errors.Fatalf("invalid limit schedule: %v", err)
+	}
+	return schedule, nil
+}
+
+// reloadLimitSchedule reads the limit schedule file again whenever one of
+// the reloadSignals is received. If the file is invalid, the previous schedule
+// remains in use.
+func reloadLimitSchedule(ctx context.Context, lim *limiter.DynamicLimiter, gopts GlobalOptions) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, reloadSignals...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+
+		schedule, err := loadLimitSchedule(gopts)
+		if err != nil {
+			Warnf("not reloading limit schedule: %v\n", err)
+			continue
+		}
+		lim.SetSchedule(schedule)
+		debug.Log("reloaded limit schedule, current limits: %+v", lim.Limits())
+		Verbosef("reloaded limit schedule from %v\n", gopts.LimitScheduleFile)
+	}
+}
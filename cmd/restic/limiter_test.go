@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/backend/mem"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLoadLimitSchedule(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "schedule")
+	rtest.OK(t, os.WriteFile(filename, []byte("08:00-18:00 2M\n\n22:00-06:00 1M/unlimited\n"), 0o600))
+
+	gopts := GlobalOptions{LimitScheduleFile: filename, Limits: limiter.Limits{UploadKb: 100}}
+	schedule, err := loadLimitSchedule(gopts)
+	rtest.OK(t, err)
+	// the rates are given in bits per second
+	rtest.Equals(t, limiter.Schedule{
+		Rules: []limiter.ScheduleRule{
+			{Start: 8 * time.Hour, End: 18 * time.Hour, Limits: limiter.Limits{UploadKb: 244, DownloadKb: 244}},
+			{Start: 22 * time.Hour, End: 6 * time.Hour, Limits: limiter.Limits{UploadKb: 122}},
+		},
+		Default: limiter.Limits{UploadKb: 100},
+	}, schedule)
+
+	rtest.OK(t, os.WriteFile(filename, []byte("08:00-18:00 2X\n"), 0o600))
+	_, err = loadLimitSchedule(gopts)
+	rtest.Assert(t, err != nil, "expected error for invalid schedule")
+
+	_, _, err = newLimiter(context.TODO(), GlobalOptions{LimitSchedule: "else 1M", LimitScheduleFile: filename})
+	rtest.Assert(t, err != nil, "expected error for --limit-schedule and --limit-schedule-file")
+}
+
+func TestLimiterStopOnClose(t *testing.T) {
+	be := mem.New()
+	rtest.Assert(t, withLimiterStop(be, nil) == be, "backend with static limits must not be wrapped")
+
+	stopped := false
+	wrapped := withLimiterStop(be, func() { stopped = true })
+	rtest.Assert(t, backend.AsBackend[*mem.MemoryBackend](wrapped) == be, "wrapped backend cannot be unwrapped")
+	rtest.OK(t, wrapped.Close())
+	rtest.Assert(t, stopped, "limit schedule was not stopped when closing the backend")
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals trigger reloading the limit schedule file.
+var reloadSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// reloadSignals trigger reloading the limit schedule file, reloading is not
+// supported on Windows.
+var reloadSignals []os.Signal
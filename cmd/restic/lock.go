@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 )
 
@@ -35,14 +36,51 @@ func internalOpenWithLocked(ctx context.Context, gopts GlobalOptions, dryRun boo
 
 func openWithReadLock(ctx context.Context, gopts GlobalOptions, noLock bool) (context.Context, *repository.Repository, func(), error) {
 	// TODO enforce read-only operations once the locking code has moved to the repository
-	return internalOpenWithLocked(ctx, gopts, noLock, false)
+	return internalOpenWithRole(ctx, gopts, noLock, false, repository.KeyRole.CanRead, "read the repository")
 }
 
 func openWithAppendLock(ctx context.Context, gopts GlobalOptions, dryRun bool) (context.Context, *repository.Repository, func(), error) {
 	// TODO enforce non-exclusive operations once the locking code has moved to the repository
-	return internalOpenWithLocked(ctx, gopts, dryRun, false)
+	check := repository.KeyRole.CanWrite
+	if dryRun {
+		check = nil
+	}
+	return internalOpenWithRole(ctx, gopts, dryRun, false, check, "write to the repository")
 }
 
 func openWithExclusiveLock(ctx context.Context, gopts GlobalOptions, dryRun bool) (context.Context, *repository.Repository, func(), error) {
-	return internalOpenWithLocked(ctx, gopts, dryRun, true)
+	// commands which need an exclusive lock modify the repository, unless
+	// they only perform a dry run. Commands which remove data must also call
+	// checkRemoveAllowed.
+	if dryRun {
+		return internalOpenWithRole(ctx, gopts, dryRun, true, repository.KeyRole.CanRead, "read the repository")
+	}
+	return internalOpenWithRole(ctx, gopts, dryRun, true, repository.KeyRole.CanWrite, "write to the repository")
+}
+
+// internalOpenWithRole opens the repository like internalOpenWithLocked, but
+// fails early if the role of the used key does not satisfy allowed.
+func internalOpenWithRole(ctx context.Context, gopts GlobalOptions, dryRun bool, exclusive bool, allowed func(repository.KeyRole) bool, op string) (context.Context, *repository.Repository, func(), error) {
+	ctx, repo, unlock, err := internalOpenWithLocked(ctx, gopts, dryRun, exclusive)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if allowed != nil && !allowed(repo.KeyRole()) {
+		unlock()
+		return nil, nil, nil, errors.Fatal((&repository.KeyRoleError{Role: repo.KeyRole(), Op: op}).Error())
+	}
+	return ctx, repo, unlock, nil
+}
+
+// checkRemoveAllowed returns an error if the role of the key does not permit
+// removing data or if the repository is in append-only mode and was not
+// opened using an admin key.
+func checkRemoveAllowed(repo *repository.Repository) error {
+	if !repo.KeyRole().CanRemove() {
+		return errors.Fatal((&repository.KeyRoleError{Role: repo.KeyRole(), Op: "remove data"}).Error())
+	}
+	if repo.AppendOnly() {
+		return errors.Fatal(repository.ErrAppendOnly.Error())
+	}
+	return nil
 }
@@ -46,7 +46,10 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		DisableAutoGenTag: true,
 
 		PersistentPreRunE: func(c *cobra.Command, _ []string) error {
-			return globalOptions.PreRun(needsPassword(c.Name()))
+			if err := globalOptions.PreRun(needsPassword(c.Name())); err != nil {
+				return err
+			}
+			return globalOptions.startMetrics(c.CommandPath())
 		},
 	}
 
@@ -72,29 +75,36 @@ The full documentation can be found at https://restic.readthedocs.io/ .
 		newCatCommand(),
 		newCheckCommand(),
 		newCopyCommand(),
+		newDaemonCommand(),
 		newDiffCommand(),
 		newDumpCommand(),
 		newFeaturesCommand(),
 		newFindCommand(),
 		newForgetCommand(),
 		newGenerateCommand(),
+		newHistoryCommand(),
 		newInitCommand(),
 		newKeyCommand(),
 		newListCommand(),
 		newLsCommand(),
 		newMigrateCommand(),
+		newOptimizeCommand(),
 		newOptionsCommand(),
+		newParityCommand(),
+		newPolicyCommand(),
 		newPruneCommand(),
 		newRebuildIndexCommand(),
 		newRecoverCommand(),
 		newRepairCommand(),
 		newRestoreCommand(),
 		newRewriteCommand(),
+		newServeCommand(),
 		newSnapshotsCommand(),
 		newStatsCommand(),
 		newTagCommand(),
 		newUnlockCommand(),
 		newVersionCommand(),
+		newWatchCommand(),
 	)
 
 	registerDebugCommand(cmd)
@@ -223,5 +233,6 @@ func main() {
 	if exitCode != 0 {
 		printExitError(exitCode, exitMessage)
 	}
+	globalOptions.finishMetrics(exitCode)
 	Exit(exitCode)
 }
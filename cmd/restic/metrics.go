@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/metrics"
+	"github.com/restic/restic/internal/repository"
+)
+
+// commandMetrics holds the state for --metrics-file and --metrics-listen.
+type commandMetrics struct {
+	*metrics.Registry
+	start        time.Time
+	backendStats *retry.Stats
+}
+
+// startMetrics enables metrics for the command if requested. All metrics are
+// labeled with the name of the command, such that the files of several
+// commands can be read by the same textfile collector.
+func (opts *GlobalOptions) startMetrics(command string) error {
+	if opts.MetricsFile == "" && opts.MetricsListen == "" {
+		return nil
+	}
+
+	m := &commandMetrics{
+		Registry:     metrics.NewRegistry("command", strings.TrimPrefix(command, "restic ")),
+		start:        time.Now(),
+		backendStats: &retry.Stats{},
+	}
+	m.Gauge("restic_command_start_timestamp_seconds", "Start time of the command.", float64(m.start.Unix()))
+	m.OnCollect(func(r *metrics.Registry) {
+		for op, stats := range m.backendStats.Operations() {
+			r.Set("restic_backend_requests_total", metrics.Counter, "Number of backend operations.", float64(stats.Requests), "operation", op)
+			r.Set("restic_backend_retries_total", metrics.Counter, "Number of failed backend requests which were retried.", float64(stats.Retries), "operation", op)
+			r.Set("restic_backend_failures_total", metrics.Counter, "Number of backend operations which failed after all retries.", float64(stats.Failures), "operation", op)
+		}
+	})
+
+	if opts.MetricsListen != "" {
+		listener, err := net.Listen("tcp", opts.MetricsListen)
+		if err != nil {
+			return errors.Fatalf("unable to listen on %v: %v", opts.MetricsListen, err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Registry)
+		srv := &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: time.Minute,
+		}
+		// the server runs until restic exits
+		go func() {
+			err := srv.Serve(listener)
+			debug.Log("metrics server stopped: %v", err)
+		}()
+	}
+
+	opts.metrics = m
+	return nil
+}
+
+// finishMetrics records the result of the command and writes the metrics
+// file.
+func (opts *GlobalOptions) finishMetrics(exitCode int) {
+	m := opts.metrics
+	if m == nil {
+		return
+	}
+
+	now := time.Now()
+	m.Gauge("restic_command_end_timestamp_seconds", "End time of the command.", float64(now.Unix()))
+	m.Gauge("restic_command_duration_seconds", "Duration of the command.", now.Sub(m.start).Seconds())
+	m.Gauge("restic_command_exit_code", "Exit code of the command.", float64(exitCode))
+
+	if opts.MetricsFile != "" {
+		if err := m.WriteFile(opts.MetricsFile); err != nil {
+			Warnf("unable to write metrics file: %v\n", err)
+		}
+	}
+}
+
+// registry returns the registry to record metrics in, which is nil if metrics
+// are disabled.
+func (m *commandMetrics) registry() *metrics.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.Registry
+}
+
+func recordBackupMetrics(m *commandMetrics, summary *archiver.Summary, errorCount uint64) {
+	r := m.registry()
+	r.Gauge("restic_backup_errors", "Number of files or directories which could not be read.", float64(errorCount))
+	if summary == nil {
+		return
+	}
+
+	for _, s := range []struct {
+		state      string
+		files, dir uint
+	}{
+		{"new", summary.Files.New, summary.Dirs.New},
+		{"changed", summary.Files.Changed, summary.Dirs.Changed},
+		{"unmodified", summary.Files.Unchanged, summary.Dirs.Unchanged},
+	} {
+		r.Gauge("restic_backup_files", "Number of files by state.", float64(s.files), "state", s.state)
+		r.Gauge("restic_backup_dirs", "Number of directories by state.", float64(s.dir), "state", s.state)
+	}
+	r.Gauge("restic_backup_data_blobs", "Number of new data blobs.", float64(summary.DataBlobs))
+	r.Gauge("restic_backup_tree_blobs", "Number of new tree blobs.", float64(summary.TreeBlobs))
+	r.Gauge("restic_backup_data_added_bytes", "Size of the data added to the repository, uncompressed.", float64(summary.DataSize+summary.TreeSize))
+	r.Gauge("restic_backup_data_added_packed_bytes", "Size of the data added to the repository, compressed.", float64(summary.DataSizeInRepo+summary.TreeSizeInRepo))
+	r.Gauge("restic_backup_total_files_processed", "Number of files processed.", float64(summary.Files.New+summary.Files.Changed+summary.Files.Unchanged))
+	r.Gauge("restic_backup_total_bytes_processed", "Size of the files processed.", float64(summary.ProcessedBytes))
+	if !summary.BackupEnd.IsZero() {
+		r.Gauge("restic_backup_duration_seconds", "Duration of the backup.", summary.BackupEnd.Sub(summary.BackupStart).Seconds())
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func recordCheckMetrics(m *commandMetrics, summary checkSummary) {
+	r := m.registry()
+	r.Gauge("restic_check_errors", "Number of errors found by check.", float64(summary.NumErrors))
+	r.Gauge("restic_check_broken_packs", "Number of damaged pack files.", float64(len(summary.BrokenPacks)))
+	r.Gauge("restic_check_rebuildable_packs", "Number of damaged pack files which can be rebuilt from parity files.", float64(len(summary.RebuildablePacks)))
+	r.Gauge("restic_check_broken_parity", "Number of damaged parity files.", float64(len(summary.BrokenParity)))
+	r.Gauge("restic_check_suggest_repair_index", "Whether check suggests to run repair index.", boolGauge(summary.HintRepairIndex))
+	r.Gauge("restic_check_suggest_prune", "Whether check suggests to run prune.", boolGauge(summary.HintPrune))
+	r.Gauge("restic_check_suggest_forget", "Whether check suggests to run forget.", boolGauge(summary.HintForget))
+}
+
+func recordForgetMetrics(m *commandMetrics, keep, remove int) {
+	r := m.registry()
+	r.Gauge("restic_forget_snapshots_kept", "Number of snapshots kept by the policy.", float64(keep))
+	r.Gauge("restic_forget_snapshots_removed", "Number of snapshots removed.", float64(remove))
+}
+
+func recordPruneMetrics(m *commandMetrics, stats repository.PruneStats) {
+	r := m.registry()
+	totalSize := stats.Size.Used + stats.Size.Duplicate + stats.Size.Unused + stats.Size.Unref
+	pruneSize := stats.Size.Remove + stats.Size.Repackrm + stats.Size.Unref
+	unusedAfter := stats.Size.Duplicate + stats.Size.Unused - stats.Size.Remove - stats.Size.Repackrm
+	r.Gauge("restic_prune_reclaimed_bytes", "Size of the data removed from the repository.", float64(pruneSize))
+	r.Gauge("restic_prune_repacked_bytes", "Size of the data repacked.", float64(stats.Size.Repack))
+	r.Gauge("restic_prune_remaining_bytes", "Size of the data remaining in the repository.", float64(totalSize-pruneSize))
+	r.Gauge("restic_prune_unused_after_bytes", "Size of the unused data remaining in the repository.", float64(unusedAfter))
+	r.Gauge("restic_prune_removed_packs", "Number of pack files removed.", float64(stats.Packs.Remove+stats.Packs.Unref))
+	r.Gauge("restic_prune_repacked_packs", "Number of pack files repacked.", float64(stats.Packs.Repack))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestMetricsFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+
+	gopts := env.gopts
+	gopts.MetricsFile = filepath.Join(env.base, "restic.prom")
+	rtest.OK(t, gopts.startMetrics("restic backup"))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, gopts)
+	gopts.finishMetrics(0)
+
+	buf, err := os.ReadFile(gopts.MetricsFile)
+	rtest.OK(t, err)
+	metrics := string(buf)
+	for _, line := range []string{
+		"# TYPE restic_backup_files gauge\n",
+		`restic_backup_files{command="backup",state="changed"} 0` + "\n",
+		`restic_backup_errors{command="backup"} 0` + "\n",
+		`restic_command_exit_code{command="backup"} 0` + "\n",
+		"# TYPE restic_backend_requests_total counter\n",
+		`restic_backend_failures_total{command="backup",operation="save"} 0` + "\n",
+	} {
+		rtest.Assert(t, strings.Contains(metrics, line), "metrics file is missing %q:\n%v", line, metrics)
+	}
+	rtest.Assert(t, !strings.Contains(metrics, `restic_backup_files{command="backup",state="new"} 0`),
+		"backup reported no new files:\n%v", metrics)
+}
+
+func TestMetricsPrune(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	readMetrics := func(opts PruneOptions) string {
+		gopts := env.gopts
+		gopts.MetricsFile = filepath.Join(env.base, "restic.prom")
+		rtest.OK(t, gopts.startMetrics("restic prune"))
+		testRunPrune(t, gopts, opts)
+		gopts.finishMetrics(0)
+
+		buf, err := os.ReadFile(gopts.MetricsFile)
+		rtest.OK(t, err)
+		return string(buf)
+	}
+
+	// a dry run does not change the repository
+	metrics := readMetrics(PruneOptions{MaxUnused: "5%", DryRun: true})
+	rtest.Assert(t, !strings.Contains(metrics, "restic_prune_"), "dry run reported prune metrics:\n%v", metrics)
+
+	metrics = readMetrics(PruneOptions{MaxUnused: "5%"})
+	rtest.Assert(t, strings.Contains(metrics, `restic_prune_removed_packs{command="prune"} 0`+"\n"),
+		"prune metrics are missing:\n%v", metrics)
+}
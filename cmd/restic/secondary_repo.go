@@ -13,6 +13,7 @@ type secondaryRepoOptions struct {
 	// from-repo options
 	Repo               string
 	RepositoryFile     string
+	ColdRepo           string
 	PasswordFile       string
 	PasswordCommand    string
 	KeyHint            string
@@ -47,6 +48,7 @@ func (opts *secondaryRepoOptions) AddFlags(f *pflag.FlagSet, repoPrefix string,
 
 	f.StringVarP(&opts.Repo, "from-repo", "", "", "source `repository` "+repoUsage+" (default: $RESTIC_FROM_REPOSITORY)")
 	f.StringVarP(&opts.RepositoryFile, "from-repository-file", "", "", "`file` from which to read the source repository location "+repoUsage+" (default: $RESTIC_FROM_REPOSITORY_FILE)")
+	f.StringVarP(&opts.ColdRepo, "from-cold-repo", "", "", "`repository` which stores the data pack files of the source repository (default: $RESTIC_FROM_COLD_REPOSITORY)")
 	f.StringVarP(&opts.PasswordFile, "from-password-file", "", "", "`file` to read the source repository password from (default: $RESTIC_FROM_PASSWORD_FILE)")
 	f.StringVarP(&opts.KeyHint, "from-key-hint", "", "", "key ID of key to try decrypting the source repository first (default: $RESTIC_FROM_KEY_HINT)")
 	f.StringVarP(&opts.PasswordCommand, "from-password-command", "", "", "shell `command` to obtain the source repository password from (default: $RESTIC_FROM_PASSWORD_COMMAND)")
@@ -54,6 +56,7 @@ func (opts *secondaryRepoOptions) AddFlags(f *pflag.FlagSet, repoPrefix string,
 
 	opts.Repo = os.Getenv("RESTIC_FROM_REPOSITORY")
 	opts.RepositoryFile = os.Getenv("RESTIC_FROM_REPOSITORY_FILE")
+	opts.ColdRepo = os.Getenv("RESTIC_FROM_COLD_REPOSITORY")
 	opts.PasswordFile = os.Getenv("RESTIC_FROM_PASSWORD_FILE")
 	opts.KeyHint = os.Getenv("RESTIC_FROM_KEY_HINT")
 	opts.PasswordCommand = os.Getenv("RESTIC_FROM_PASSWORD_COMMAND")
@@ -64,7 +67,7 @@ func fillSecondaryGlobalOpts(ctx context.Context, opts secondaryRepoOptions, gop
 		return GlobalOptions{}, false, errors.Fatal("Please specify a source repository location (--from-repo or --from-repository-file)")
 	}
 
-	hasFromRepo := opts.Repo != "" || opts.RepositoryFile != "" || opts.PasswordFile != "" ||
+	hasFromRepo := opts.Repo != "" || opts.RepositoryFile != "" || opts.ColdRepo != "" || opts.PasswordFile != "" ||
 		opts.KeyHint != "" || opts.PasswordCommand != "" || opts.InsecureNoPassword
 	hasRepo2 := opts.LegacyRepo != "" || opts.LegacyRepositoryFile != "" || opts.LegacyPasswordFile != "" ||
 		opts.LegacyKeyHint != "" || opts.LegacyPasswordCommand != ""
@@ -84,6 +87,7 @@ func fillSecondaryGlobalOpts(ctx context.Context, opts secondaryRepoOptions, gop
 
 		dstGopts.Repo = opts.Repo
 		dstGopts.RepositoryFile = opts.RepositoryFile
+		dstGopts.ColdRepo = opts.ColdRepo
 		dstGopts.PasswordFile = opts.PasswordFile
 		dstGopts.PasswordCommand = opts.PasswordCommand
 		dstGopts.KeyHint = opts.KeyHint
@@ -98,6 +102,7 @@ func fillSecondaryGlobalOpts(ctx context.Context, opts secondaryRepoOptions, gop
 
 		dstGopts.Repo = opts.LegacyRepo
 		dstGopts.RepositoryFile = opts.LegacyRepositoryFile
+		dstGopts.ColdRepo = ""
 		dstGopts.PasswordFile = opts.LegacyPasswordFile
 		dstGopts.PasswordCommand = opts.LegacyPasswordCommand
 		dstGopts.KeyHint = opts.LegacyKeyHint
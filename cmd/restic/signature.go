@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/pflag"
+)
+
+// loadSigningKey reads the ed25519 private key used to sign snapshots from filename.
+func loadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read signing key: %v", err)
+	}
+
+	key, err := restic.ParseSigningKey(data)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse signing key %v: %v", filename, err)
+	}
+	return key, nil
+}
+
+// trustedKeysOptions bundles the options to verify snapshot signatures.
+type trustedKeysOptions struct {
+	TrustedKeysFile string
+}
+
+func (opts *trustedKeysOptions) AddFlags(f *pflag.FlagSet) {
+	f.StringVar(&opts.TrustedKeysFile, "trusted-keys-file", "", "verify that snapshots are signed by one of the ed25519 public keys in `file` (default: $RESTIC_TRUSTED_KEYS_FILE)")
+	opts.TrustedKeysFile = os.Getenv("RESTIC_TRUSTED_KEYS_FILE")
+}
+
+// load returns the trusted keys. If no file was specified, nil is returned.
+func (opts *trustedKeysOptions) load() (restic.TrustedKeys, error) {
+	if opts.TrustedKeysFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(opts.TrustedKeysFile)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read trusted keys: %v", err)
+	}
+
+	keys, err := restic.ParseTrustedKeys(data)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse trusted keys %v: %v", opts.TrustedKeysFile, err)
+	}
+	return keys, nil
+}
@@ -2,6 +2,7 @@ package archiver
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"path"
@@ -78,6 +79,7 @@ type archiverRepo interface {
 
 	Config() restic.Config
 	StartPackUploader(ctx context.Context, wg *errgroup.Group)
+	Checkpoint(ctx context.Context) error
 	Flush(ctx context.Context) error
 }
 
@@ -103,6 +105,11 @@ type Archiver struct {
 	mu        sync.Mutex
 	summary   *Summary
 
+	// checkpoint records the completed items if checkpoints are enabled
+	checkpoint *checkpointRecorder
+	// scanLimiter bounds the number of directory entries processed concurrently
+	scanLimiter *concurrencyLimiter
+
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
 
@@ -131,6 +138,12 @@ type Archiver struct {
 
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// UnchangedDir, if set, reports whether the directory at the absolute
+	// path and everything below it is known to be unchanged since the parent
+	// snapshot. Such directories are not read, instead their subtree is taken
+	// from the parent snapshot.
+	UnchangedDir func(path string) bool
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -154,6 +167,12 @@ type Options struct {
 	// SaveTreeConcurrency sets how many trees are marshalled and saved to the
 	// repo concurrently.
 	SaveTreeConcurrency uint
+
+	// ScanConcurrency sets how many directory entries are inspected
+	// concurrently, this includes reading directories and collecting the
+	// metadata of files. If it's set to zero, entries are inspected one after
+	// another.
+	ScanConcurrency uint
 }
 
 // ApplyDefaults returns a copy of o with the default options set for all unset
@@ -181,6 +200,10 @@ func (o Options) ApplyDefaults() Options {
 		o.SaveTreeConcurrency = uint(runtime.GOMAXPROCS(0)) + o.ReadConcurrency
 	}
 
+	if o.ScanConcurrency == 0 {
+		o.ScanConcurrency = 1
+	}
+
 	return o
 }
 
@@ -197,6 +220,7 @@ func New(repo archiverRepo, filesystem fs.FS, opts Options) *Archiver {
 		StartFile:    func(string) {},
 		CompleteBlob: func(uint64) {},
 	}
+	arch.scanLimiter = newConcurrencyLimiter(arch.Options.ScanConcurrency)
 
 	return arch
 }
@@ -225,6 +249,9 @@ func (arch *Archiver) error(item string, err error) error {
 
 func (arch *Archiver) trackItem(item string, previous, current *restic.Node, s ItemStats, d time.Duration) {
 	arch.CompleteItem(item, previous, current, s, d)
+	if arch.checkpoint != nil {
+		arch.checkpoint.Complete(item, current)
+	}
 
 	arch.mu.Lock()
 	defer arch.mu.Unlock()
@@ -321,36 +348,67 @@ func (arch *Archiver) saveDir(ctx context.Context, snPath string, dir string, me
 		return futureNode{}, err
 	}
 
-	nodes := make([]futureNode, 0, len(names))
+	// the entries may be saved concurrently, collect the results by index to
+	// keep the order of the nodes in the tree
+	type result struct {
+		fn   futureNode
+		skip bool
+	}
+	results := make([]result, len(names))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed error
+	)
+	hasFailed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
 
-	for _, name := range names {
+	for i, name := range names {
 		// test if context has been cancelled
 		if ctx.Err() != nil {
 			debug.Log("context has been cancelled, aborting")
+			wg.Wait()
 			return futureNode{}, ctx.Err()
 		}
+		// return error early if possible
+		if hasFailed() != nil {
+			break
+		}
 
 		pathname := arch.FS.Join(dir, name)
 		oldNode := previous.Find(name)
 		snItem := join(snPath, name)
-		fn, excluded, err := arch.save(ctx, snItem, pathname, oldNode)
-
-		// return error early if possible
-		if err != nil {
-			err = arch.error(pathname, err)
-			if err == nil {
+		arch.scanLimiter.Go(&wg, func() {
+			fn, excluded, err := arch.save(ctx, snItem, pathname, oldNode)
+			if err != nil {
+				results[i].skip = true
+				err = arch.error(pathname, err)
+				if err != nil {
+					mu.Lock()
+					if failed == nil {
+						failed = err
+					}
+					mu.Unlock()
+				}
 				// ignore error
-				continue
+				return
 			}
+			results[i] = result{fn: fn, skip: excluded}
+		})
+	}
+	wg.Wait()
+	if failed != nil {
+		return futureNode{}, failed
+	}
 
-			return futureNode{}, err
-		}
-
-		if excluded {
-			continue
+	nodes := make([]futureNode, 0, len(names))
+	for _, res := range results {
+		if !res.skip {
+			nodes = append(nodes, res.fn)
 		}
-
-		nodes = append(nodes, fn)
 	}
 
 	fn := arch.treeSaver.Save(ctx, snPath, dir, treeNode, nodes, complete)
@@ -441,6 +499,18 @@ func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
 	return true
 }
 
+// unchangedDir checks whether the subtree of the previous directory node can
+// be used without reading the directory at abstarget.
+func (arch *Archiver) unchangedDir(abstarget string, previous *restic.Node) bool {
+	if arch.UnchangedDir == nil || previous == nil || previous.Type != restic.NodeTypeDir || previous.Subtree == nil {
+		return false
+	}
+	if _, ok := arch.Repo.LookupBlobSize(restic.TreeBlob, *previous.Subtree); !ok {
+		return false
+	}
+	return arch.UnchangedDir(abstarget)
+}
+
 // save saves a target (file or directory) to the repo. If the item is
 // excluded, this function returns a nil node and error, with excluded set to
 // true.
@@ -476,6 +546,17 @@ func (arch *Archiver) save(ctx context.Context, snPath, target string, previous
 		return futureNode{}, true, nil
 	}
 
+	if arch.unchangedDir(abstarget, previous) {
+		debug.Log("%v is unchanged, using old subtree", target)
+		arch.trackItem(snPath+"/", previous, previous, ItemStats{}, time.Since(start))
+		fn = newFutureNodeWithResult(futureNodeResult{
+			snPath: snPath,
+			target: target,
+			node:   previous,
+		})
+		return fn, false, nil
+	}
+
 	meta, err := arch.FS.OpenFile(target, fs.O_NOFOLLOW, true)
 	if err != nil {
 		debug.Log("open metadata for %v returned error: %v", target, err)
@@ -790,6 +871,7 @@ func resolveRelativeTargets(filesys fs.FS, targets []string) ([]string, error) {
 // SnapshotOptions collect attributes for a new snapshot.
 type SnapshotOptions struct {
 	Tags           restic.TagList
+	Labels         map[string]string
 	Hostname       string
 	Excludes       []string
 	BackupStart    time.Time
@@ -798,6 +880,25 @@ type SnapshotOptions struct {
 	ProgramVersion string
 	// SkipIfUnchanged omits the snapshot creation if it is identical to the parent snapshot.
 	SkipIfUnchanged bool
+	// SigningKey is used to sign the snapshot, if set.
+	SigningKey ed25519.PrivateKey
+	// CheckpointInterval is the interval at which checkpoint snapshots of the
+	// files saved so far are written. Zero disables checkpoints.
+	CheckpointInterval time.Duration
+	// CheckpointSaved is called after a checkpoint snapshot has been saved.
+	CheckpointSaved func(ctx context.Context, id restic.ID) error
+}
+
+// parentID returns the ID to store as parent of the new snapshot. A checkpoint
+// is replaced by its own parent as it is removed after the backup.
+func (opts SnapshotOptions) parentID() *restic.ID {
+	if opts.ParentSnapshot == nil {
+		return nil
+	}
+	if opts.ParentSnapshot.IsCheckpoint() {
+		return opts.ParentSnapshot.Parent
+	}
+	return opts.ParentSnapshot.ID()
 }
 
 // loadParentTree loads a tree referenced by snapshot id. If id is null, nil is returned.
@@ -827,7 +928,7 @@ func (arch *Archiver) runWorkers(ctx context.Context, wg *errgroup.Group) {
 
 	arch.fileSaver = newFileSaver(ctx, wg,
 		arch.blobSaver.Save,
-		arch.Repo.Config().ChunkerPolynomial,
+		arch.Repo.Config().ChunkerParams(),
 		arch.Options.ReadConcurrency, arch.Options.SaveBlobConcurrency)
 	arch.fileSaver.CompleteBlob = arch.CompleteBlob
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
@@ -862,6 +963,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	var rootTreeID restic.ID
 
+	arch.checkpoint = nil
+	if opts.CheckpointInterval > 0 {
+		arch.checkpoint = newCheckpointRecorder()
+	}
+
 	wgUp, wgUpCtx := errgroup.WithContext(ctx)
 	arch.Repo.StartPackUploader(wgUpCtx, wgUp)
 
@@ -869,7 +975,15 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		wg, wgCtx := errgroup.WithContext(wgUpCtx)
 		start := time.Now()
 
+		treeDone := make(chan struct{})
+		if arch.checkpoint != nil {
+			wg.Go(func() error {
+				return arch.runCheckpoints(wgCtx, targets, opts, treeDone)
+			})
+		}
+
 		wg.Go(func() error {
+			defer close(treeDone)
 			arch.runWorkers(wgCtx, wg)
 
 			debug.Log("starting snapshot")
@@ -927,9 +1041,8 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 
 	sn.ProgramVersion = opts.ProgramVersion
 	sn.Excludes = opts.Excludes
-	if opts.ParentSnapshot != nil {
-		sn.Parent = opts.ParentSnapshot.ID()
-	}
+	sn.SetLabels(opts.Labels)
+	sn.Parent = opts.parentID()
 	sn.Tree = &rootTreeID
 	arch.summary.BackupEnd = time.Now()
 	sn.Summary = &restic.SnapshotSummary{
@@ -950,6 +1063,12 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		TotalBytesProcessed: arch.summary.ProcessedBytes,
 	}
 
+	if opts.SigningKey != nil {
+		if err := sn.Sign(opts.SigningKey); err != nil {
+			return nil, restic.ID{}, nil, err
+		}
+	}
+
 	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
 	if err != nil {
 		return nil, restic.ID{}, nil, err
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -1846,6 +1847,78 @@ func TestArchiverParent(t *testing.T) {
 	}
 }
 
+func TestArchiverUnchangedDir(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tempdir, repo := prepareTempdirRepoSrc(t, TestDir{
+		"unchanged": TestDir{"file": TestFile{Content: "foo"}},
+		"changed":   TestDir{"file": TestFile{Content: "foo"}},
+	})
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	first, _, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+
+	// the modification of unchanged/file is not reported
+	save(t, filepath.Join(tempdir, "unchanged", "file"), []byte("foobar"))
+	save(t, filepath.Join(tempdir, "changed", "file"), []byte("foobar"))
+
+	var checked []string
+	arch.UnchangedDir = func(path string) bool {
+		checked = append(checked, path)
+		return filepath.Base(path) == "unchanged"
+	}
+	second, _, summary, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: first})
+	rtest.OK(t, err)
+	rtest.Equals(t, ChangeStats{0, 1, 0}, summary.Files)
+	rtest.Equals(t, ChangeStats{0, 1, 1}, summary.Dirs)
+	sort.Strings(checked)
+	rtest.Equals(t, []string{filepath.Join(tempdir, "changed"), filepath.Join(tempdir, "unchanged")}, checked)
+
+	fileSize := func(dir string) uint64 {
+		tree, err := restic.LoadTree(ctx, repo, *second.Tree)
+		rtest.OK(t, err)
+		subtree, err := restic.LoadTree(ctx, repo, *tree.Find(dir).Subtree)
+		rtest.OK(t, err)
+		return subtree.Find("file").Size
+	}
+	rtest.Equals(t, uint64(3), fileSize("unchanged"))
+	rtest.Equals(t, uint64(6), fileSize("changed"))
+
+	checker.TestCheckRepo(t, repo, false)
+}
+
+func TestArchiverScanConcurrency(t *testing.T) {
+	src := TestDir{}
+	for i := 0; i < 5; i++ {
+		dir := TestDir{"sub": TestDir{"file": TestFile{Content: "foo"}}}
+		for j := 0; j < 20; j++ {
+			dir[fmt.Sprintf("file%d", j)] = TestFile{Content: string(rtest.Random(i*100+j, 100))}
+		}
+		src[fmt.Sprintf("dir%d", i)] = dir
+	}
+	tempdir, repo := prepareTempdirRepoSrc(t, src)
+	back := rtest.Chdir(t, tempdir)
+	defer back()
+
+	var trees restic.IDs
+	for _, concurrency := range []uint{1, 8} {
+		arch := New(repo, fs.Track{FS: fs.Local{}}, Options{ScanConcurrency: concurrency})
+		sn, _, summary, err := arch.Snapshot(context.TODO(), []string{"."}, SnapshotOptions{Time: time.Now()})
+		rtest.OK(t, err)
+		rtest.Equals(t, uint(105), summary.Files.New+summary.Files.Unchanged)
+		trees = append(trees, *sn.Tree)
+	}
+
+	// concurrent scanning must result in the same trees
+	rtest.Equals(t, trees[0], trees[1])
+	TestEnsureTree(context.TODO(), t, "/", repo, trees[1], src)
+	checker.TestCheckRepo(t, repo, false)
+}
+
 func TestArchiverErrorReporting(t *testing.T) {
 	ignoreErrorForBasename := func(basename string) ErrorFunc {
 		return func(item string, err error) error {
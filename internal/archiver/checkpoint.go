@@ -0,0 +1,215 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkpointDir contains the completed entries of a directory which is still
+// being archived.
+type checkpointDir struct {
+	nodes map[string]*restic.Node
+	dirs  map[string]*checkpointDir
+}
+
+func newCheckpointDir() *checkpointDir {
+	return &checkpointDir{
+		nodes: make(map[string]*restic.Node),
+		dirs:  make(map[string]*checkpointDir),
+	}
+}
+
+func (d *checkpointDir) copy() *checkpointDir {
+	c := newCheckpointDir()
+	for name, node := range d.nodes {
+		c.nodes[name] = node
+	}
+	for name, dir := range d.dirs {
+		c.dirs[name] = dir.copy()
+	}
+	return c
+}
+
+// checkpointRecorder collects the files and directories completed by the
+// archiver. Once a directory is complete, its entries are replaced by the
+// directory node, such that only the incomplete directories are kept in memory.
+type checkpointRecorder struct {
+	m    sync.Mutex
+	root *checkpointDir
+}
+
+func newCheckpointRecorder() *checkpointRecorder {
+	return &checkpointRecorder{root: newCheckpointDir()}
+}
+
+// Complete records that the item at snPath has been saved as node.
+func (r *checkpointRecorder) Complete(snPath string, node *restic.Node) {
+	if node == nil || (node.Type != restic.NodeTypeFile && node.Type != restic.NodeTypeDir) {
+		return
+	}
+	elems := strings.Split(strings.Trim(snPath, "/"), "/")
+	if len(elems) == 0 || elems[0] == "" {
+		// the root directory is only completed at the end of the backup
+		return
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	dir := r.root
+	for _, name := range elems[:len(elems)-1] {
+		sub, ok := dir.dirs[name]
+		if !ok {
+			sub = newCheckpointDir()
+			dir.dirs[name] = sub
+		}
+		dir = sub
+	}
+
+	name := elems[len(elems)-1]
+	dir.nodes[name] = node
+	delete(dir.dirs, name)
+}
+
+// snapshot returns a copy of the recorded entries.
+func (r *checkpointRecorder) snapshot() *checkpointDir {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.root.copy()
+}
+
+// checkpointRepo is the part of the repository required to write checkpoints.
+type checkpointRepo interface {
+	restic.BlobSaver
+	LookupBlobSize(tpe restic.BlobType, id restic.ID) (uint, bool)
+}
+
+// saveCheckpointTree saves the trees for dir and returns the ID of the root
+// tree. Entries which reference data not yet contained in the index are left
+// out, directories which are still being archived are added with placeholder
+// metadata.
+func saveCheckpointTree(ctx context.Context, repo checkpointRepo, dir *checkpointDir) (restic.ID, error) {
+	tree := restic.NewTree(len(dir.nodes) + len(dir.dirs))
+
+	for name, node := range dir.nodes {
+		if !checkpointNodeUploaded(repo, node) {
+			debug.Log("skipping %v, data is not yet uploaded", name)
+			continue
+		}
+		if err := tree.Insert(node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	for name, sub := range dir.dirs {
+		id, err := saveCheckpointTree(ctx, repo, sub)
+		if err != nil {
+			return restic.ID{}, err
+		}
+		err = tree.Insert(&restic.Node{
+			Name:    name,
+			Type:    restic.NodeTypeDir,
+			Mode:    os.ModeDir | 0o755,
+			ModTime: time.Now(),
+			Subtree: &id,
+		})
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	return restic.SaveTree(ctx, repo, tree)
+}
+
+func checkpointNodeUploaded(repo checkpointRepo, node *restic.Node) bool {
+	if node.Type == restic.NodeTypeDir {
+		_, ok := repo.LookupBlobSize(restic.TreeBlob, *node.Subtree)
+		return ok
+	}
+	for _, id := range node.Content {
+		if _, ok := repo.LookupBlobSize(restic.DataBlob, id); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// runCheckpoints writes a checkpoint snapshot every opts.CheckpointInterval
+// until done is closed.
+func (arch *Archiver) runCheckpoints(ctx context.Context, targets []string, opts SnapshotOptions, done <-chan struct{}) error {
+	ticker := time.NewTicker(opts.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+
+		err := arch.saveCheckpoint(ctx, targets, opts)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("saving checkpoint failed: %w", err)
+		}
+	}
+}
+
+// saveCheckpoint writes a snapshot containing all items completed so far.
+func (arch *Archiver) saveCheckpoint(ctx context.Context, targets []string, opts SnapshotOptions) error {
+	entries := arch.checkpoint.snapshot()
+	if len(entries.nodes) == 0 && len(entries.dirs) == 0 {
+		return nil
+	}
+
+	// upload the data of the completed items
+	if err := arch.Repo.Checkpoint(ctx); err != nil {
+		return err
+	}
+	treeID, err := saveCheckpointTree(ctx, arch.Repo, entries)
+	if err != nil {
+		return err
+	}
+	// and the trees of the checkpoint itself
+	if err := arch.Repo.Checkpoint(ctx); err != nil {
+		return err
+	}
+
+	tags := append(append(restic.TagList{}, opts.Tags...), restic.CheckpointTag)
+	// date the checkpoint just before the final snapshot, such that it is only
+	// used as parent if the backup did not finish
+	sn, err := restic.NewSnapshot(targets, tags, opts.Hostname, opts.Time.Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	sn.ProgramVersion = opts.ProgramVersion
+	sn.Excludes = opts.Excludes
+	sn.SetLabels(opts.Labels)
+	sn.Parent = opts.parentID()
+	sn.Tree = &treeID
+
+	if opts.SigningKey != nil {
+		if err := sn.Sign(opts.SigningKey); err != nil {
+			return err
+		}
+	}
+
+	id, err := restic.SaveSnapshot(ctx, arch.Repo, sn)
+	if err != nil {
+		return err
+	}
+	debug.Log("saved checkpoint %v", id)
+
+	if opts.CheckpointSaved != nil {
+		return opts.CheckpointSaved(ctx, id)
+	}
+	return nil
+}
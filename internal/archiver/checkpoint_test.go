@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestCheckpointRecorder(t *testing.T) {
+	r := newCheckpointRecorder()
+	subtree := restic.NewRandomID()
+
+	r.Complete("/", &restic.Node{Name: "", Type: restic.NodeTypeDir, Subtree: &subtree})
+	r.Complete("/home/user/file", &restic.Node{Name: "file", Type: restic.NodeTypeFile})
+	r.Complete("/home/user/link", &restic.Node{Name: "link", Type: restic.NodeTypeSymlink})
+	r.Complete("/home/other/a", &restic.Node{Name: "a", Type: restic.NodeTypeFile})
+	r.Complete("/home/other/", &restic.Node{Name: "other", Type: restic.NodeTypeDir, Subtree: &subtree})
+
+	root := r.snapshot()
+	rtest.Equals(t, 0, len(root.nodes))
+	home, ok := root.dirs["home"]
+	rtest.Assert(t, ok, "directory home is missing")
+
+	// the completed directory replaces its entries
+	rtest.Equals(t, 1, len(home.nodes))
+	rtest.Equals(t, "other", home.nodes["other"].Name)
+	_, ok = home.dirs["other"]
+	rtest.Assert(t, !ok, "entries of completed directory are still recorded")
+
+	// symlinks are not recorded
+	user := home.dirs["user"]
+	rtest.Equals(t, 1, len(user.nodes))
+	rtest.Equals(t, "file", user.nodes["file"].Name)
+
+	// the snapshot is not modified by later changes
+	r.Complete("/home/user/", &restic.Node{Name: "user", Type: restic.NodeTypeDir, Subtree: &subtree})
+	rtest.Equals(t, 1, len(user.nodes))
+	_, ok = root.dirs["home"].dirs["user"]
+	rtest.Assert(t, ok, "snapshot was modified")
+}
+
+func TestSaveCheckpointTree(t *testing.T) {
+	repo := repository.TestRepository(t)
+	wg, ctx := errgroup.WithContext(context.TODO())
+	repo.StartPackUploader(ctx, wg)
+
+	uploaded, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, []byte("uploaded data"), restic.ID{}, false)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Checkpoint(ctx))
+	pending, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, []byte("pending data"), restic.ID{}, false)
+	rtest.OK(t, err)
+
+	r := newCheckpointRecorder()
+	r.Complete("/dir/uploaded", &restic.Node{Name: "uploaded", Type: restic.NodeTypeFile, Content: restic.IDs{uploaded}})
+	r.Complete("/dir/pending", &restic.Node{Name: "pending", Type: restic.NodeTypeFile, Content: restic.IDs{pending}})
+	r.Complete("/dir/sub/empty", &restic.Node{Name: "empty", Type: restic.NodeTypeFile})
+
+	treeID, err := saveCheckpointTree(ctx, repo, r.snapshot())
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(ctx))
+
+	tree, err := restic.LoadTree(ctx, repo, treeID)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(tree.Nodes))
+	rtest.Equals(t, "dir", tree.Nodes[0].Name)
+
+	dir, err := restic.LoadTree(ctx, repo, *tree.Nodes[0].Subtree)
+	rtest.OK(t, err)
+	var names []string
+	for _, node := range dir.Nodes {
+		names = append(names, node.Name)
+	}
+	// the file whose data was not yet uploaded is left out
+	rtest.Equals(t, []string{"sub", "uploaded"}, names)
+}
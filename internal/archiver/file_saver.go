@@ -22,7 +22,7 @@ type fileSaver struct {
 	saveFilePool *bufferPool
 	saveBlob     saveBlobFn
 
-	pol chunker.Pol
+	chunkerParams restic.ChunkerParams
 
 	ch chan<- saveFileJob
 
@@ -33,7 +33,7 @@ type fileSaver struct {
 
 // newFileSaver returns a new file saver. A worker pool with fileWorkers is
 // started, it is stopped when ctx is cancelled.
-func newFileSaver(ctx context.Context, wg *errgroup.Group, save saveBlobFn, pol chunker.Pol, fileWorkers, blobWorkers uint) *fileSaver {
+func newFileSaver(ctx context.Context, wg *errgroup.Group, save saveBlobFn, chunkerParams restic.ChunkerParams, fileWorkers, blobWorkers uint) *fileSaver {
 	ch := make(chan saveFileJob)
 
 	debug.Log("new file saver with %v file workers and %v blob workers", fileWorkers, blobWorkers)
@@ -41,10 +41,10 @@ func newFileSaver(ctx context.Context, wg *errgroup.Group, save saveBlobFn, pol
 	poolSize := fileWorkers + blobWorkers
 
 	s := &fileSaver{
-		saveBlob:     save,
-		saveFilePool: newBufferPool(int(poolSize), chunker.MaxSize),
-		pol:          pol,
-		ch:           ch,
+		saveBlob:      save,
+		saveFilePool:  newBufferPool(int(poolSize), int(chunkerParams.MaxSize)),
+		chunkerParams: chunkerParams,
+		ch:            ch,
 
 		CompleteBlob: func(uint64) {},
 	}
@@ -167,7 +167,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 	}
 
 	// reuse the chunker
-	chnker.Reset(f, s.pol)
+	s.chunkerParams.ResetChunker(chnker, f)
 
 	node.Content = []restic.ID{}
 	node.Size = 0
@@ -245,7 +245,7 @@ func (s *fileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 func (s *fileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 	// a worker has one chunker which is reused for each file (because it contains a rather large buffer)
-	chnker := chunker.New(nil, s.pol)
+	chnker := s.chunkerParams.NewChunker(nil)
 
 	for {
 		var job saveFileJob
@@ -0,0 +1,42 @@
+package archiver
+
+import "sync"
+
+// concurrencyLimiter runs functions on a bounded number of additional
+// goroutines. If all of them are busy, the function is run by the caller
+// instead. This allows functions run by the limiter to use it again without
+// risking a deadlock.
+type concurrencyLimiter struct {
+	sem chan struct{}
+}
+
+// newConcurrencyLimiter returns a limiter which runs at most n functions
+// concurrently, including the calling goroutine.
+func newConcurrencyLimiter(n uint) *concurrencyLimiter {
+	if n == 0 {
+		n = 1
+	}
+	return &concurrencyLimiter{sem: make(chan struct{}, n-1)}
+}
+
+// Go runs fn either on a new goroutine which is tracked by wg, or directly.
+func (l *concurrencyLimiter) Go(wg *sync.WaitGroup, fn func()) {
+	if l == nil {
+		fn()
+		return
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-l.sem
+				wg.Done()
+			}()
+			fn()
+		}()
+	default:
+		fn()
+	}
+}
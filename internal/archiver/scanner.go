@@ -3,6 +3,7 @@ package archiver
 import (
 	"context"
 	"sort"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -17,6 +18,15 @@ type Scanner struct {
 	Select       SelectFunc
 	Error        ErrorFunc
 	Result       func(item string, s ScanStats)
+
+	// Concurrency sets how many directory entries are inspected concurrently.
+	// If it's set to zero, entries are inspected one after another. Calls to
+	// Error and Result are serialized.
+	Concurrency uint
+
+	limiter *concurrencyLimiter
+	m       sync.Mutex
+	stats   ScanStats
 }
 
 // NewScanner initializes a new Scanner.
@@ -36,36 +46,30 @@ type ScanStats struct {
 	Bytes               uint64
 }
 
-func (s *Scanner) scanTree(ctx context.Context, stats ScanStats, tree tree) (ScanStats, error) {
+func (s *Scanner) scanTree(ctx context.Context, tree tree) error {
 	// traverse the path in the file system for all leaf nodes
 	if tree.Leaf() {
 		abstarget, err := s.FS.Abs(tree.Path)
 		if err != nil {
-			return ScanStats{}, err
-		}
-
-		stats, err = s.scan(ctx, stats, abstarget)
-		if err != nil {
-			return ScanStats{}, err
+			return err
 		}
 
-		return stats, nil
+		return s.scan(ctx, abstarget)
 	}
 
 	// otherwise recurse into the nodes in a deterministic order
 	for _, name := range tree.NodeNames() {
-		var err error
-		stats, err = s.scanTree(ctx, stats, tree.Nodes[name])
+		err := s.scanTree(ctx, tree.Nodes[name])
 		if err != nil {
-			return ScanStats{}, err
+			return err
 		}
 
 		if ctx.Err() != nil {
-			return stats, nil
+			return nil
 		}
 	}
 
-	return stats, nil
+	return nil
 }
 
 // Scan traverses the targets. The function Result is called for each new item
@@ -86,59 +90,104 @@ func (s *Scanner) Scan(ctx context.Context, targets []string) error {
 		return err
 	}
 
-	stats, err := s.scanTree(ctx, ScanStats{}, *tree)
+	s.limiter = newConcurrencyLimiter(s.Concurrency)
+	s.stats = ScanStats{}
+	err = s.scanTree(ctx, *tree)
 	if err != nil {
 		return err
 	}
 
-	s.Result("", stats)
-	debug.Log("result: %+v", stats)
+	s.Result("", s.stats)
+	debug.Log("result: %+v", s.stats)
 	return nil
 }
 
-func (s *Scanner) scan(ctx context.Context, stats ScanStats, target string) (ScanStats, error) {
+// add adds the stats of item to the cumulated stats.
+func (s *Scanner) add(item string, stats ScanStats) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.stats.Files += stats.Files
+	s.stats.Dirs += stats.Dirs
+	s.stats.Others += stats.Others
+	s.stats.Bytes += stats.Bytes
+	s.Result(item, s.stats)
+}
+
+func (s *Scanner) error(item string, err error) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Error(item, err)
+}
+
+func (s *Scanner) scan(ctx context.Context, target string) error {
 	if ctx.Err() != nil {
-		return stats, nil
+		return nil
 	}
 
 	// exclude files by path before running stat to reduce number of lstat calls
 	if !s.SelectByName(target) {
-		return stats, nil
+		return nil
 	}
 
 	// get file information
 	fi, err := s.FS.Lstat(target)
 	if err != nil {
-		return stats, s.Error(target, err)
+		return s.error(target, err)
 	}
 
 	// run remaining select functions that require file information
 	if !s.Select(target, fi, s.FS) {
-		return stats, nil
+		return nil
 	}
 
 	switch {
 	case fi.Mode.IsRegular():
-		stats.Files++
-		stats.Bytes += uint64(fi.Size)
+		s.add(target, ScanStats{Files: 1, Bytes: uint64(fi.Size)})
 	case fi.Mode.IsDir():
 		names, err := fs.Readdirnames(s.FS, target, fs.O_NOFOLLOW)
 		if err != nil {
-			return stats, s.Error(target, err)
+			return s.error(target, err)
 		}
 		sort.Strings(names)
 
-		for _, name := range names {
-			stats, err = s.scan(ctx, stats, s.FS.Join(target, name))
-			if err != nil {
-				return stats, err
-			}
+		if err := s.scanEntries(ctx, target, names); err != nil {
+			return err
 		}
-		stats.Dirs++
+		s.add(target, ScanStats{Dirs: 1})
 	default:
-		stats.Others++
+		s.add(target, ScanStats{Others: 1})
 	}
 
-	s.Result(target, stats)
-	return stats, nil
+	return nil
+}
+
+// scanEntries scans the entries of dir, possibly concurrently.
+func (s *Scanner) scanEntries(ctx context.Context, dir string, names []string) error {
+	var (
+		wg     sync.WaitGroup
+		m      sync.Mutex
+		failed error
+	)
+	for _, name := range names {
+		m.Lock()
+		err := failed
+		m.Unlock()
+		if err != nil {
+			break
+		}
+
+		s.limiter.Go(&wg, func() {
+			err := s.scan(ctx, s.FS.Join(dir, name))
+			if err != nil {
+				m.Lock()
+				if failed == nil {
+					failed = err
+				}
+				m.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return failed
 }
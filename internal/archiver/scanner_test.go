@@ -2,9 +2,11 @@ package archiver
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -124,6 +126,35 @@ func TestScanner(t *testing.T) {
 	}
 }
 
+func TestScannerConcurrency(t *testing.T) {
+	src := TestDir{}
+	for i := 0; i < 10; i++ {
+		dir := TestDir{}
+		for j := 0; j < 10; j++ {
+			dir[fmt.Sprintf("file%d", j)] = TestFile{Content: strings.Repeat("x", i+j)}
+		}
+		dir["sub"] = TestDir{"file": TestFile{Content: "foo"}}
+		src[fmt.Sprintf("dir%d", i)] = dir
+	}
+
+	tempdir := rtest.TempDir(t)
+	TestCreateFiles(t, tempdir, src)
+
+	for _, concurrency := range []uint{0, 1, 4} {
+		sc := NewScanner(fs.Track{FS: fs.Local{}})
+		sc.Concurrency = concurrency
+		var result ScanStats
+		sc.Result = func(item string, s ScanStats) {
+			if item == "" {
+				result = s
+			}
+		}
+
+		rtest.OK(t, sc.Scan(context.TODO(), []string{tempdir}))
+		rtest.Equals(t, ScanStats{Files: 110, Dirs: 21, Bytes: 10*45 + 10*45 + 30}, result)
+	}
+}
+
 func TestScannerError(t *testing.T) {
 	var tests = []struct {
 		name    string
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"time"
 )
 
 var ErrNoRepository = fmt.Errorf("repository does not exist")
@@ -131,6 +132,32 @@ type FreezeBackend interface {
 	Unfreeze()
 }
 
+// AppendOnlyAnnouncer is implemented by backends which can inform the storage
+// server that the repository is in append-only mode.
+type AppendOnlyAnnouncer interface {
+	Backend
+	// AnnounceAppendOnly marks all further requests as belonging to an
+	// append-only repository.
+	AnnounceAppendOnly()
+}
+
+// Retainer is implemented by backends which can protect files from removal
+// until a retention period has expired.
+type Retainer interface {
+	Backend
+	// RetainedUntil returns the time until which the file cannot be removed.
+	// It returns the zero time if the file is not protected.
+	RetainedUntil(ctx context.Context, h Handle) (time.Time, error)
+}
+
+// TieredBackend is implemented by backends which store the pack files
+// containing data blobs in a separate cold storage tier.
+type TieredBackend interface {
+	Backend
+	// ColdBackend returns the backend which stores the data pack files.
+	ColdBackend() Backend
+}
+
 // FileInfo is contains information about a file in the backend.
 type FileInfo struct {
 	Size int64
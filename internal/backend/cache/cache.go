@@ -245,3 +245,8 @@ func (c *Cache) Wrap(be backend.Backend) backend.Backend {
 func (c *Cache) BaseDir() string {
 	return c.Base
 }
+
+// Dir returns the directory of the cache for the repository.
+func (c *Cache) Dir() string {
+	return c.path
+}
@@ -17,6 +17,9 @@ const (
 	SnapshotFile
 	IndexFile
 	ConfigFile
+	DictionaryFile
+	ParityFile
+	PolicyFile
 )
 
 func (t FileType) String() string {
@@ -35,6 +38,12 @@ func (t FileType) String() string {
 		s = "index"
 	case ConfigFile:
 		s = "config"
+	case DictionaryFile:
+		s = "dictionary"
+	case ParityFile:
+		s = "parity"
+	case PolicyFile:
+		s = "policy"
 	}
 	return s
 }
@@ -63,6 +72,9 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case DictionaryFile:
+	case ParityFile:
+	case PolicyFile:
 	default:
 		return errors.Errorf("invalid Type %d", h.Type)
 	}
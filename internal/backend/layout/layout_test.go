@@ -110,6 +110,9 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "dictionaries"),
+			filepath.Join(tempdir, "parity"),
+			filepath.Join(tempdir, "policies"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -185,6 +188,9 @@ func TestRESTLayout(t *testing.T) {
 			strings.Join([]string{url, "index"}, "/"),
 			strings.Join([]string{url, "locks"}, "/"),
 			strings.Join([]string{url, "keys"}, "/"),
+			strings.Join([]string{url, "dictionaries"}, "/"),
+			strings.Join([]string{url, "parity"}, "/"),
+			strings.Join([]string{url, "policies"}, "/"),
 		}
 
 		sort.Strings(want)
@@ -0,0 +1,141 @@
+package limiter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"golang.org/x/time/rate"
+)
+
+// DynamicLimiter is a Limiter whose limits follow a schedule, which can be
+// replaced while the limiter is in use.
+type DynamicLimiter struct {
+	upstream   atomic.Pointer[rate.Limiter]
+	downstream atomic.Pointer[rate.Limiter]
+
+	mu       sync.Mutex
+	schedule Schedule
+	current  Limits
+}
+
+// NewDynamicLimiter returns a limiter which applies the limits of schedule.
+// Run must be called to follow changes of the limits over the day.
+func NewDynamicLimiter(schedule Schedule) *DynamicLimiter {
+	l := &DynamicLimiter{}
+	l.SetSchedule(schedule)
+	return l
+}
+
+// SetSchedule replaces the schedule and applies it immediately.
+func (l *DynamicLimiter) SetSchedule(schedule Schedule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.schedule = schedule
+	l.apply(schedule.Limits(time.Now()))
+}
+
+// Limits returns the limits which are currently applied.
+func (l *DynamicLimiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.current
+}
+
+func (l *DynamicLimiter) update(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.apply(l.schedule.Limits(now))
+}
+
+func (l *DynamicLimiter) apply(limits Limits) {
+	if limits == l.current {
+		return
+	}
+	debug.Log("setting limits to upload %d KiB/s, download %d KiB/s", limits.UploadKb, limits.DownloadKb)
+	l.current = limits
+	// uploads and downloads which are waiting for the previous buckets
+	// continue with the previous limits for the remainder of their request
+	l.upstream.Store(newBucket(limits.UploadKb))
+	l.downstream.Store(newBucket(limits.DownloadKb))
+}
+
+func newBucket(kb int) *rate.Limiter {
+	if kb <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(toByteRate(kb)), int(toByteRate(kb)))
+}
+
+// Run re-evaluates the schedule at the start of every minute until ctx is
+// cancelled.
+func (l *DynamicLimiter) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+		l.update(now)
+	}
+}
+
+func (l *DynamicLimiter) Upstream(r io.Reader) io.Reader {
+	return &dynamicLimitedReader{r, &l.upstream}
+}
+
+func (l *DynamicLimiter) UpstreamWriter(w io.Writer) io.Writer {
+	return &dynamicLimitedWriter{w, &l.upstream}
+}
+
+func (l *DynamicLimiter) Downstream(r io.Reader) io.Reader {
+	return &dynamicLimitedReader{r, &l.downstream}
+}
+
+func (l *DynamicLimiter) DownstreamWriter(w io.Writer) io.Writer {
+	return &dynamicLimitedWriter{w, &l.downstream}
+}
+
+// Transport returns an HTTP transport limited with the limiter l.
+func (l *DynamicLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		return limitRoundTrip(l, rt, req)
+	})
+}
+
+type dynamicLimitedReader struct {
+	reader io.Reader
+	bucket *atomic.Pointer[rate.Limiter]
+}
+
+func (r *dynamicLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if bucket := r.bucket.Load(); bucket != nil {
+		if err := consumeTokens(n, bucket); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+type dynamicLimitedWriter struct {
+	writer io.Writer
+	bucket *atomic.Pointer[rate.Limiter]
+}
+
+func (w *dynamicLimitedWriter) Write(buf []byte) (int, error) {
+	if bucket := w.bucket.Load(); bucket != nil {
+		if err := consumeTokens(len(buf), bucket); err != nil {
+			return 0, err
+		}
+	}
+	return w.writer.Write(buf)
+}
@@ -0,0 +1,37 @@
+package limiter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestDynamicLimiterSetSchedule(t *testing.T) {
+	limiter := NewDynamicLimiter(Schedule{})
+	test.Equals(t, Limits{}, limiter.Limits())
+	test.Assert(t, limiter.upstream.Load() == nil && limiter.downstream.Load() == nil, "expected unlimited buckets")
+
+	reader := limiter.Upstream(bytes.NewReader(make([]byte, 100)))
+	writer := new(bytes.Buffer)
+	limitedWriter := limiter.DownstreamWriter(writer)
+
+	// changed limits also apply to readers and writers created earlier
+	limiter.SetSchedule(Schedule{Default: Limits{UploadKb: 42, DownloadKb: 23}})
+	test.Equals(t, Limits{UploadKb: 42, DownloadKb: 23}, limiter.Limits())
+	test.Equals(t, toByteRate(42), float64(limiter.upstream.Load().Limit()))
+	test.Equals(t, toByteRate(23), float64(limiter.downstream.Load().Limit()))
+
+	n, err := reader.Read(make([]byte, 100))
+	test.OK(t, err)
+	test.Equals(t, 100, n)
+	test.Assert(t, limiter.upstream.Load().Tokens() < toByteRate(42), "expected tokens to be consumed")
+
+	_, err = limitedWriter.Write(make([]byte, 100))
+	test.OK(t, err)
+	test.Equals(t, 100, writer.Len())
+	test.Assert(t, limiter.downstream.Load().Tokens() < toByteRate(23), "expected tokens to be consumed")
+
+	limiter.SetSchedule(Schedule{Default: Limits{DownloadKb: 23}})
+	test.Assert(t, limiter.upstream.Load() == nil, "expected unlimited uploads")
+}
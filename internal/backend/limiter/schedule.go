@@ -0,0 +1,166 @@
+package limiter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleRule applies limits during a daily time range.
+type ScheduleRule struct {
+	// Start and End are offsets from midnight. If End is before Start, the
+	// range spans midnight.
+	Start, End time.Duration
+	Limits     Limits
+}
+
+func (r ScheduleRule) contains(offset time.Duration) bool {
+	if r.Start <= r.End {
+		return offset >= r.Start && offset < r.End
+	}
+	return offset >= r.Start || offset < r.End
+}
+
+// Schedule selects the upload and download limits depending on the time of
+// day. The first rule which contains the time of day applies, Default is
+// used outside of all rules.
+type Schedule struct {
+	Rules   []ScheduleRule
+	Default Limits
+}
+
+// Limits returns the limits which apply at time t.
+func (s Schedule) Limits(t time.Time) Limits {
+	hour, min, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	for _, r := range s.Rules {
+		if r.contains(offset) {
+			return r.Limits
+		}
+	}
+	return s.Default
+}
+
+// ParseSchedule parses a comma separated list of rules such as
+// "08:00-18:00 2M, else unlimited". Each rule consists of a time range and a
+// rate, the optional "else" rule sets the limits outside of all time ranges
+// and defaults to def.
+//
+// A rate is either "unlimited", a single value for uploads and downloads or
+// two values separated by a slash for uploads and downloads, respectively.
+// Values without a suffix are in KiB/s, like the fixed limits. The suffixes K,
+// M and G select the bit rates kbit/s, Mbit/s and Gbit/s.
+func ParseSchedule(s string, def Limits) (Schedule, error) {
+	sched := Schedule{Default: def}
+	hasDefault := false
+
+	for _, rule := range strings.Split(s, ",") {
+		fields := strings.Fields(rule)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return Schedule{}, fmt.Errorf("invalid schedule rule %q, expected a time range and a rate", strings.TrimSpace(rule))
+		}
+
+		limits, err := parseScheduleRate(fields[1])
+		if err != nil {
+			return Schedule{}, err
+		}
+
+		if fields[0] == "else" {
+			if hasDefault {
+				return Schedule{}, fmt.Errorf("schedule contains more than one else rule")
+			}
+			hasDefault = true
+			sched.Default = limits
+			continue
+		}
+
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			return Schedule{}, fmt.Errorf("invalid time range %q, expected e.g. 08:00-18:00", fields[0])
+		}
+		r := ScheduleRule{Limits: limits}
+		if r.Start, err = parseTimeOfDay(start); err != nil {
+			return Schedule{}, err
+		}
+		if r.End, err = parseTimeOfDay(end); err != nil {
+			return Schedule{}, err
+		}
+		if r.Start == r.End {
+			return Schedule{}, fmt.Errorf("time range %q is empty", fields[0])
+		}
+		sched.Rules = append(sched.Rules, r)
+	}
+
+	if len(sched.Rules) == 0 && !hasDefault {
+		return Schedule{}, fmt.Errorf("schedule %q contains no rules", s)
+	}
+	return sched, nil
+}
+
+// parseTimeOfDay parses a time of the day in the form HH:MM.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// parseScheduleRate parses "unlimited", "RATE" or "UPLOAD/DOWNLOAD".
+func parseScheduleRate(s string) (Limits, error) {
+	if s == "unlimited" {
+		return Limits{}, nil
+	}
+
+	upload, download, ok := strings.Cut(s, "/")
+	if !ok {
+		download = upload
+	}
+	up, err := parseRate(upload)
+	if err != nil {
+		return Limits{}, err
+	}
+	down, err := parseRate(download)
+	if err != nil {
+		return Limits{}, err
+	}
+	return Limits{UploadKb: up, DownloadKb: down}, nil
+}
+
+// parseRate parses a rate in KiB/s, or a bit rate with one of the suffixes K,
+// M or G for kbit/s, Mbit/s and Gbit/s, and returns it in KiB/s. Zero and
+// "unlimited" mean unlimited.
+func parseRate(s string) (int, error) {
+	if s == "unlimited" {
+		return 0, nil
+	}
+
+	num, bitsPerUnit := s, 0.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		num, bitsPerUnit = s[:len(s)-1], 1e3
+	case strings.HasSuffix(s, "M"):
+		num, bitsPerUnit = s[:len(s)-1], 1e6
+	case strings.HasSuffix(s, "G"):
+		num, bitsPerUnit = s[:len(s)-1], 1e9
+	}
+
+	v, err := strconv.Atoi(num)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	if bitsPerUnit == 0 || v == 0 {
+		return v, nil
+	}
+
+	// convert to KiB/s, a non-zero rate must not become unlimited
+	kib := int(math.Round(float64(v) * bitsPerUnit / 8 / 1024))
+	return max(kib, 1), nil
+}
@@ -0,0 +1,89 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestParseSchedule(t *testing.T) {
+	def := Limits{UploadKb: 5, DownloadKb: 6}
+	for _, tc := range []struct {
+		input    string
+		schedule Schedule
+	}{
+		{"08:00-18:00 2M, else unlimited", Schedule{
+			Rules:   []ScheduleRule{{Start: 8 * time.Hour, End: 18 * time.Hour, Limits: Limits{244, 244}}},
+			Default: Limits{},
+		}},
+		{"08:00-18:00 2M", Schedule{
+			Rules:   []ScheduleRule{{Start: 8 * time.Hour, End: 18 * time.Hour, Limits: Limits{244, 244}}},
+			Default: def,
+		}},
+		{"22:30-06:00 100/1G,12:00-13:00 unlimited/512K", Schedule{
+			Rules: []ScheduleRule{
+				{Start: 22*time.Hour + 30*time.Minute, End: 6 * time.Hour, Limits: Limits{100, 122070}},
+				{Start: 12 * time.Hour, End: 13 * time.Hour, Limits: Limits{0, 63}},
+			},
+			Default: def,
+		}},
+		{"else 1M/0", Schedule{Default: Limits{122, 0}}},
+		{"else 1K", Schedule{Default: Limits{1, 1}}},
+		{"00:00-24:00 10", Schedule{
+			Rules:   []ScheduleRule{{Start: 0, End: 24 * time.Hour, Limits: Limits{10, 10}}},
+			Default: def,
+		}},
+	} {
+		t.Run("", func(t *testing.T) {
+			schedule, err := ParseSchedule(tc.input, def)
+			test.OK(t, err)
+			test.Equals(t, tc.schedule, schedule)
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"08:00-18:00",
+		"08:00 2M",
+		"08:00-18:00 2M 3M",
+		"8-18 2M",
+		"08:00-25:00 2M",
+		"24:01-01:00 2M",
+		"08:00-08:00 2M",
+		"08:00-18:00 2T",
+		"08:00-18:00 -1",
+		"else 1M, else 2M",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseSchedule(input, Limits{})
+			test.Assert(t, err != nil, "expected error for %q", input)
+		})
+	}
+}
+
+func TestScheduleLimits(t *testing.T) {
+	schedule, err := ParseSchedule("08:00-18:00 2048, 22:00-06:00 1024/unlimited, 17:00-20:00 3072, else unlimited", Limits{})
+	test.OK(t, err)
+
+	for _, tc := range []struct {
+		clock  string
+		limits Limits
+	}{
+		{"07:59:59", Limits{}},
+		{"08:00:00", Limits{2048, 2048}},
+		{"17:30:00", Limits{2048, 2048}},
+		{"18:00:00", Limits{3072, 3072}},
+		{"20:00:00", Limits{}},
+		{"23:00:00", Limits{1024, 0}},
+		{"00:00:00", Limits{1024, 0}},
+		{"05:59:59", Limits{1024, 0}},
+		{"06:00:00", Limits{}},
+	} {
+		now, err := time.ParseInLocation("2006-01-02 15:04:05", "2024-05-01 "+tc.clock, time.Local)
+		test.OK(t, err)
+		test.Equals(t, tc.limits, schedule.Limits(now), "at %v", tc.clock)
+	}
+}
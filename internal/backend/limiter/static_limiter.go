@@ -64,7 +64,9 @@ func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return rt(req)
 }
 
-func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+// limitRoundTrip performs the request req using rt while limiting the request
+// and response body with the limiter l.
+func limitRoundTrip(l Limiter, rt http.RoundTripper, req *http.Request) (*http.Response, error) {
 	type readCloser struct {
 		io.Reader
 		io.Closer
@@ -92,7 +94,7 @@ func (l staticLimiter) roundTripper(rt http.RoundTripper, req *http.Request) (*h
 // Transport returns an HTTP transport limited with the limiter l.
 func (l staticLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
 	return roundTripper(func(req *http.Request) (*http.Response, error) {
-		return l.roundTripper(rt, req)
+		return limitRoundTrip(l, rt, req)
 	})
 }
 
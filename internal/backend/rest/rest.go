@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/layout"
@@ -21,12 +22,14 @@ import (
 
 // make sure the rest backend implements backend.Backend
 var _ backend.Backend = &Backend{}
+var _ backend.AppendOnlyAnnouncer = &Backend{}
 
 // Backend uses the REST protocol to access data stored on a server.
 type Backend struct {
 	url         *url.URL
 	connections uint
 	client      http.Client
+	appendOnly  atomic.Bool
 	layout.Layout
 }
 
@@ -54,6 +57,14 @@ const (
 	ContentTypeV2 = "application/vnd.x.restic.rest.v2"
 )
 
+// RepositoryModeHeader announces the repository mode to the server. It is
+// only sent for append-only repositories, such that a rest-server running in
+// append-only mode can verify that the client expects the same.
+const (
+	RepositoryModeHeader     = "Restic-Repository-Mode"
+	RepositoryModeAppendOnly = "append-only"
+)
+
 // Open opens the REST backend with the given config.
 func Open(_ context.Context, cfg Config, rt http.RoundTripper) (*Backend, error) {
 	// use url without trailing slash for layout
@@ -129,6 +140,19 @@ func (b *Backend) Hasher() hash.Hash {
 	return nil
 }
 
+// AnnounceAppendOnly adds the repository mode header to all further requests.
+func (b *Backend) AnnounceAppendOnly() {
+	b.appendOnly.Store(true)
+}
+
+// setHeaders sets the headers common to all requests.
+func (b *Backend) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", ContentTypeV2)
+	if b.appendOnly.Load() {
+		req.Header.Set(RepositoryModeHeader, RepositoryModeAppendOnly)
+	}
+}
+
 // Save stores data in the backend at the handle.
 func (b *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
 	ctx, cancel := context.WithCancel(ctx)
@@ -147,7 +171,7 @@ func (b *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindR
 		return io.NopCloser(rd), nil
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	// explicitly set the content length, this prevents chunked encoding and
 	// let's the server know what's coming.
@@ -232,7 +256,7 @@ func (b *Backend) openReader(ctx context.Context, h backend.Handle, length int,
 		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1)
 	}
 	req.Header.Set("Range", byteRange)
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	resp, err := b.client.Do(req)
 	if err != nil {
@@ -257,7 +281,7 @@ func (b *Backend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo,
 	if err != nil {
 		return backend.FileInfo{}, errors.WithStack(err)
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	resp, err := b.client.Do(req)
 	if err != nil {
@@ -290,7 +314,7 @@ func (b *Backend) Remove(ctx context.Context, h backend.Handle) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	resp, err := b.client.Do(req)
 	if err != nil {
@@ -320,7 +344,7 @@ func (b *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	resp, err := b.client.Do(req)
 	if err != nil {
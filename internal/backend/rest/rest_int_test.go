@@ -148,3 +148,41 @@ func TestListAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestAppendOnlyHeader(t *testing.T) {
+	var modes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		modes = append(modes, req.Header.Get(rest.RepositoryModeHeader))
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	be, err := rest.Open(context.TODO(), rest.Config{Connections: 5, URL: srvURL}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := be.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	h := backend.Handle{Type: backend.PackFile, Name: "foo"}
+	if err := be.Remove(context.TODO(), h); err != nil {
+		t.Fatal(err)
+	}
+	be.AnnounceAppendOnly()
+	if err := be.Remove(context.TODO(), h); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", rest.RepositoryModeAppendOnly}
+	if !reflect.DeepEqual(modes, want) {
+		t.Fatalf("wrong repository mode headers, want %q, got %q", want, modes)
+	}
+}
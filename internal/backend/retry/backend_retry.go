@@ -21,10 +21,50 @@ type Backend struct {
 	MaxElapsedTime time.Duration
 	Report         func(string, error, time.Duration)
 	Success        func(string, int)
+	// Stats counts the requests if set, it can be shared between backends.
+	Stats *Stats
 
 	failedLoads sync.Map
 }
 
+// OperationStats counts the requests of one kind of backend operation.
+type OperationStats struct {
+	Requests uint64 // number of operations
+	Retries  uint64 // number of failed attempts which were retried
+	Failures uint64 // number of operations which failed after all retries, excluding missing files and permanent errors
+}
+
+// Stats counts the requests per operation (save, load, stat, remove, list).
+type Stats struct {
+	mu  sync.Mutex
+	ops map[string]OperationStats
+}
+
+func (s *Stats) update(op string, fn func(o *OperationStats)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ops == nil {
+		s.ops = make(map[string]OperationStats)
+	}
+	o := s.ops[op]
+	fn(&o)
+	s.ops[op] = o
+}
+
+// Operations returns a copy of the current counters, indexed by operation.
+func (s *Stats) Operations() map[string]OperationStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ops := make(map[string]OperationStats, len(s.ops))
+	for op, o := range s.ops {
+		ops[op] = o
+	}
+	return ops
+}
+
 // statically ensure that RetryBackend implements backend.Backend.
 var _ backend.Backend = &Backend{}
 
@@ -94,7 +134,7 @@ func (b *retryAtLeastOnce) Reset() {
 
 var fastRetries = false
 
-func (be *Backend) retry(ctx context.Context, msg string, f func() error) error {
+func (be *Backend) retry(ctx context.Context, op string, msg string, f func() error) error {
 	// Don't do anything when called with an already cancelled context. There would be
 	// no retries in that case either, so be consistent and abort always.
 	// This enforces a strict contract for backend methods: Using a cancelled context
@@ -127,6 +167,8 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 		b = backoff.WithMaxRetries(b, 10)
 	}
 
+	be.Stats.update(op, func(o *OperationStats) { o.Requests++ })
+
 	permanentErrorAttempts := 1
 	if be.Backend.Properties().HasFlakyErrors {
 		permanentErrorAttempts = 5
@@ -147,6 +189,9 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 		},
 		backoff.WithContext(b, ctx),
 		func(err error, d time.Duration) {
+			if d >= 0 {
+				be.Stats.update(op, func(o *OperationStats) { o.Retries++ })
+			}
 			if be.Report != nil {
 				be.Report(msg, err, d)
 			}
@@ -157,13 +202,18 @@ func (be *Backend) retry(ctx context.Context, msg string, f func() error) error
 			}
 		},
 	)
+	// missing files are an expected result, for example when checking
+	// whether a file exists, and permanent errors cannot be fixed by retrying
+	if err != nil && ctx.Err() == nil && !be.Backend.IsNotExist(err) && !be.Backend.IsPermanentError(err) {
+		be.Stats.update(op, func(o *OperationStats) { o.Failures++ })
+	}
 
 	return err
 }
 
 // Save stores the data in the backend under the given handle.
 func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
-	return be.retry(ctx, fmt.Sprintf("Save(%v)", h), func() error {
+	return be.retry(ctx, "save", fmt.Sprintf("Save(%v)", h), func() error {
 		err := rd.Rewind()
 		if err != nil {
 			return err
@@ -212,7 +262,7 @@ func (be *Backend) Load(ctx context.Context, h backend.Handle, length int, offse
 		}
 	}
 
-	err = be.retry(ctx, fmt.Sprintf("Load(%v, %v, %v)", h, length, offset),
+	err = be.retry(ctx, "load", fmt.Sprintf("Load(%v, %v, %v)", h, length, offset),
 		func() error {
 			return be.Backend.Load(ctx, h, length, offset, consumer)
 		})
@@ -233,7 +283,7 @@ func (be *Backend) Stat(ctx context.Context, h backend.Handle) (fi backend.FileI
 	statCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	err = be.retry(statCtx, fmt.Sprintf("Stat(%v)", h),
+	err = be.retry(statCtx, "stat", fmt.Sprintf("Stat(%v)", h),
 		func() error {
 			var innerError error
 			fi, innerError = be.Backend.Stat(ctx, h)
@@ -252,7 +302,7 @@ func (be *Backend) Stat(ctx context.Context, h backend.Handle) (fi backend.FileI
 
 // Remove removes a File with type t and name.
 func (be *Backend) Remove(ctx context.Context, h backend.Handle) (err error) {
-	return be.retry(ctx, fmt.Sprintf("Remove(%v)", h), func() error {
+	return be.retry(ctx, "remove", fmt.Sprintf("Remove(%v)", h), func() error {
 		return be.Backend.Remove(ctx, h)
 	})
 }
@@ -270,7 +320,7 @@ func (be *Backend) List(ctx context.Context, t backend.FileType, fn func(backend
 	listed := make(map[string]struct{}) // remember for which files we already ran fn
 	var innerErr error                  // remember when fn returned an error, so we can return that to the caller
 
-	err := be.retry(listCtx, fmt.Sprintf("List(%v)", t), func() error {
+	err := be.retry(listCtx, "list", fmt.Sprintf("List(%v)", t), func() error {
 		return be.Backend.List(ctx, t, func(fi backend.FileInfo) error {
 			if _, ok := listed[fi.Name]; ok {
 				return nil
@@ -38,12 +38,14 @@ func TestBackendSaveRetry(t *testing.T) {
 
 	TestFastRetries(t)
 	retryBackend := New(be, 10, nil, nil)
+	retryBackend.Stats = &Stats{}
 
 	data := test.Random(23, 5*1024*1024+11241)
 	err := retryBackend.Save(context.TODO(), backend.Handle{}, backend.NewByteReader(data, be.Hasher()))
 	if err != nil {
 		t.Fatal(err)
 	}
+	test.Equals(t, map[string]OperationStats{"save": {Requests: 1, Retries: 1}}, retryBackend.Stats.Operations())
 
 	if len(data) != buf.Len() {
 		t.Errorf("wrong number of bytes written: want %d, got %d", len(data), buf.Len())
@@ -430,10 +432,13 @@ func TestBackendStatNotExists(t *testing.T) {
 	}, func(s string, i int) {
 		t.Fatalf("unexpected log output %v", s)
 	})
+	retryBackend.Stats = &Stats{}
 
 	_, err := retryBackend.Stat(context.TODO(), backend.Handle{})
 	test.Assert(t, be.IsNotExistFn(err), "unexpected error %v", err)
 	test.Equals(t, 1, attempt)
+	// a missing file is not a failure
+	test.Equals(t, map[string]OperationStats{"stat": {Requests: 1}}, retryBackend.Stats.Operations())
 }
 
 func TestBackendRetryPermanent(t *testing.T) {
@@ -448,7 +453,8 @@ func TestBackendRetryPermanent(t *testing.T) {
 
 	TestFastRetries(t)
 	retryBackend := New(be, 2, nil, nil)
-	err := retryBackend.retry(context.TODO(), "test", func() error {
+	retryBackend.Stats = &Stats{}
+	err := retryBackend.retry(context.TODO(), "test", "test", func() error {
 		attempt++
 		return notFound
 	})
@@ -457,12 +463,14 @@ func TestBackendRetryPermanent(t *testing.T) {
 	test.Equals(t, 1, attempt)
 
 	attempt = 0
-	err = retryBackend.retry(context.TODO(), "test", func() error {
+	err = retryBackend.retry(context.TODO(), "test", "test", func() error {
 		attempt++
 		return errors.New("something")
 	})
 	test.Assert(t, !be.IsPermanentErrorFn(err), "error unexpectedly considered permanent %v", err)
 	test.Equals(t, 2, attempt)
+	// only the second error counts as a failure
+	test.Equals(t, map[string]OperationStats{"test": {Requests: 2, Retries: 1, Failures: 1}}, retryBackend.Stats.Operations())
 
 }
 
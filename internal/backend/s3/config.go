@@ -29,6 +29,9 @@ type Config struct {
 	RestoreTimeout time.Duration `option:"restore-timeout" help:"maximum time to wait for objects transition (default: 24h)"`
 	RestoreTier    string        `option:"restore-tier" help:"Retrieval tier at which the restore will be processed. (Standard, Bulk or Expedited) (default: Standard)"`
 
+	ObjectLockMode      string        `option:"object-lock-mode" help:"set S3 object lock retention mode for pack and snapshot files (GOVERNANCE or COMPLIANCE)"`
+	ObjectLockRetention time.Duration `option:"object-lock-retention" help:"duration for which new files are locked, e.g. 720h (requires object-lock-mode)"`
+
 	Connections         uint   `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
 	MaxRetries          uint   `option:"retries" help:"set the number of retries attempted"`
 	Region              string `option:"region" help:"set region"`
@@ -0,0 +1,135 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/options"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// objectLockStub is a minimal S3 server which stores the object lock
+// retention of uploaded objects.
+type objectLockStub struct {
+	mu         sync.Mutex
+	bucketLock bool
+	retention  map[string]string
+	// retentionRequests counts the requests for the retention of objects
+	retentionRequests int
+}
+
+func (s *objectLockStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut:
+		_, _ = io.Copy(io.Discard, r.Body)
+		if mode := r.Header.Get("X-Amz-Object-Lock-Mode"); mode != "" {
+			s.retention[r.URL.Path] = fmt.Sprintf("<Retention><Mode>%s</Mode><RetainUntilDate>%s</RetainUntilDate></Retention>",
+				mode, r.Header.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	case r.Method == http.MethodGet && r.URL.Query().Has("object-lock"):
+		if !s.bucketLock {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<Error><Code>ObjectLockConfigurationNotFoundError</Code></Error>")
+			return
+		}
+		_, _ = io.WriteString(w, "<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>")
+	case r.Method == http.MethodGet && r.URL.Query().Has("retention"):
+		s.retentionRequests++
+		retention, ok := s.retention[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, "<Error><Code>NoSuchObjectLockConfiguration</Code></Error>")
+			return
+		}
+		_, _ = io.WriteString(w, retention)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func openObjectLockStub(t *testing.T, url string, mode string) backend.Backend {
+	cfg, err := s3.ParseConfig("s3:" + url + "/bucket/restic")
+	rtest.OK(t, err)
+	cfg.KeyID = "key"
+	cfg.Secret = options.NewSecretString("secret")
+	cfg.Region = "us-east-1"
+	cfg.BucketLookup = "path"
+	if mode != "" {
+		cfg.ObjectLockMode = mode
+		cfg.ObjectLockRetention = 24 * time.Hour
+	}
+
+	be, err := s3.Open(context.TODO(), *cfg, http.DefaultTransport)
+	rtest.OK(t, err)
+	return be
+}
+
+func TestObjectLock(t *testing.T) {
+	srv := httptest.NewServer(&objectLockStub{bucketLock: true, retention: make(map[string]string)})
+	defer srv.Close()
+
+	be := openObjectLockStub(t, srv.URL, "governance")
+	// a client without object lock mode must still respect the retention
+	other := openObjectLockStub(t, srv.URL, "")
+
+	start := time.Now().Truncate(time.Second)
+	for _, h := range []backend.Handle{
+		{Type: backend.PackFile, Name: strings.Repeat("a", 64)},
+		{Type: backend.SnapshotFile, Name: strings.Repeat("b", 64)},
+		{Type: backend.LockFile, Name: strings.Repeat("c", 64)},
+		{Type: backend.IndexFile, Name: strings.Repeat("d", 64)},
+	} {
+		rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader([]byte("data"), be.Hasher())))
+
+		for _, retainer := range []backend.Retainer{be.(backend.Retainer), other.(backend.Retainer)} {
+			until, err := retainer.RetainedUntil(context.TODO(), h)
+			rtest.OK(t, err)
+			if h.Type == backend.LockFile || h.Type == backend.IndexFile {
+				rtest.Assert(t, until.IsZero(), "%v must not be retained, got %v", h, until)
+				continue
+			}
+			rtest.Assert(t, !until.Before(start.Add(24*time.Hour)) && until.Before(time.Now().Add(25*time.Hour)),
+				"unexpected retention of %v: %v", h, until)
+		}
+	}
+}
+
+func TestObjectLockDisabledBucket(t *testing.T) {
+	stub := &objectLockStub{retention: make(map[string]string)}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	be := openObjectLockStub(t, srv.URL, "")
+	for i := 0; i < 3; i++ {
+		until, err := be.(backend.Retainer).RetainedUntil(context.TODO(), backend.Handle{Type: backend.PackFile, Name: strings.Repeat("a", 64)})
+		rtest.OK(t, err)
+		rtest.Assert(t, until.IsZero(), "unexpected retention %v", until)
+	}
+	rtest.Equals(t, 0, stub.retentionRequests)
+}
+
+func TestObjectLockConfig(t *testing.T) {
+	for _, cfg := range []s3.Config{
+		{ObjectLockMode: "invalid", ObjectLockRetention: time.Hour},
+		{ObjectLockMode: "COMPLIANCE"},
+		{ObjectLockRetention: time.Hour},
+	} {
+		cfg.Endpoint = "localhost"
+		cfg.Bucket = "bucket"
+		_, err := s3.Open(context.TODO(), cfg, http.DefaultTransport)
+		rtest.Assert(t, err != nil, "expected error for %+v", cfg)
+	}
+}
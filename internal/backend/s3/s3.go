@@ -10,6 +10,7 @@ import (
 	"path"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -30,10 +31,16 @@ type Backend struct {
 	client *minio.Client
 	cfg    Config
 	layout.Layout
+
+	// objectLockMu protects the cached object lock status of the bucket
+	objectLockMu      sync.Mutex
+	objectLockChecked bool
+	objectLockEnabled bool
 }
 
 // make sure that *Backend implements backend.Backend
 var _ backend.Backend = &Backend{}
+var _ backend.Retainer = &Backend{}
 
 var archiveClasses = []string{"GLACIER", "DEEP_ARCHIVE"}
 
@@ -57,6 +64,20 @@ func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 		return nil, fmt.Errorf("feature flag `s3-restore` is required to use `-o s3.enable-restore=true`")
 	}
 
+	switch strings.ToUpper(cfg.ObjectLockMode) {
+	case "":
+		if cfg.ObjectLockRetention != 0 {
+			return nil, errors.Fatal("unable to open S3 backend: -o s3.object-lock-retention requires -o s3.object-lock-mode")
+		}
+	case string(minio.Governance), string(minio.Compliance):
+		cfg.ObjectLockMode = strings.ToUpper(cfg.ObjectLockMode)
+		if cfg.ObjectLockRetention <= 0 {
+			return nil, errors.Fatal("unable to open S3 backend: -o s3.object-lock-mode requires a positive -o s3.object-lock-retention")
+		}
+	default:
+		return nil, errors.Fatalf("unable to open S3 backend: invalid object lock mode %q, must be GOVERNANCE or COMPLIANCE", cfg.ObjectLockMode)
+	}
+
 	if cfg.KeyID == "" && cfg.Secret.String() != "" {
 		return nil, errors.Fatalf("unable to open S3 backend: Key ID ($AWS_ACCESS_KEY_ID) is empty")
 	} else if cfg.KeyID != "" && cfg.Secret.String() == "" {
@@ -284,6 +305,17 @@ func (be *Backend) useStorageClass(h backend.Handle) bool {
 	return !isArchiveClass || isDataFile
 }
 
+// useObjectLock returns whether the file must be locked when it is saved. Lock
+// files and keys are never locked as they must remain removable. Index files
+// are replaced by prune and can be rebuilt from the pack files, thus they are
+// not locked either.
+func (be *Backend) useObjectLock(h backend.Handle) bool {
+	if be.cfg.ObjectLockMode == "" {
+		return false
+	}
+	return h.Type == backend.PackFile || h.Type == backend.SnapshotFile
+}
+
 // Save stores data in the backend at the handle.
 func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
 	objName := be.Filename(h)
@@ -298,6 +330,10 @@ func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.Rewind
 	if be.useStorageClass(h) {
 		opts.StorageClass = be.cfg.StorageClass
 	}
+	if be.useObjectLock(h) {
+		opts.Mode = minio.RetentionMode(be.cfg.ObjectLockMode)
+		opts.RetainUntilDate = time.Now().Add(be.cfg.ObjectLockRetention).UTC()
+	}
 
 	info, err := be.client.PutObject(ctx, be.cfg.Bucket, objName, io.NopCloser(rd), rd.Length(), opts)
 
@@ -390,6 +426,67 @@ func (be *Backend) Remove(ctx context.Context, h backend.Handle) error {
 	return errors.Wrap(err, "client.RemoveObject")
 }
 
+// RetainedUntil returns the time until which the object lock of the file
+// prevents its removal, or the zero time if it is not locked.
+func (be *Backend) RetainedUntil(ctx context.Context, h backend.Handle) (time.Time, error) {
+	enabled, err := be.bucketObjectLock(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !enabled {
+		return time.Time{}, nil
+	}
+
+	objName := be.Filename(h)
+	_, until, err := be.client.GetObjectRetention(ctx, be.cfg.Bucket, objName, "")
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchObjectLockConfiguration", "ObjectLockConfigurationNotFoundError":
+			// the file was saved without object lock
+			return time.Time{}, nil
+		}
+		if be.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, errors.Wrap(err, "client.GetObjectRetention")
+	}
+	if until == nil {
+		return time.Time{}, nil
+	}
+	return *until, nil
+}
+
+// bucketObjectLock returns whether object lock is enabled for the bucket. Files
+// may then be locked by other clients or a default retention of the bucket,
+// even if no object lock mode is configured for this client.
+func (be *Backend) bucketObjectLock(ctx context.Context) (bool, error) {
+	if be.cfg.ObjectLockMode != "" {
+		// locking files requires object lock for the bucket
+		return true, nil
+	}
+
+	be.objectLockMu.Lock()
+	defer be.objectLockMu.Unlock()
+	if be.objectLockChecked {
+		return be.objectLockEnabled, nil
+	}
+
+	status, _, _, _, err := be.client.GetObjectLockConfig(ctx, be.cfg.Bucket)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "ObjectLockConfigurationNotFoundError", "NoSuchObjectLockConfiguration":
+			status = ""
+		default:
+			return false, errors.Wrap(err, "client.GetObjectLockConfig")
+		}
+	}
+	debug.Log("object lock status of bucket %v: %q", be.cfg.Bucket, status)
+
+	be.objectLockChecked = true
+	be.objectLockEnabled = status == "Enabled"
+	return be.objectLockEnabled, nil
+}
+
 // List runs fn for each file in the backend which has the type t. When an
 // error occurs (or fn returns an error), List stops and returns it.
 func (be *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.FileInfo) error) error {
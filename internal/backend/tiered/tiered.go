@@ -0,0 +1,270 @@
+// Package tiered implements a backend which stores the pack files containing
+// data blobs in a separate cold storage tier.
+package tiered
+
+import (
+	"context"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Backend stores data pack files in the cold backend and all other files,
+// including the pack files containing tree blobs, in the hot backend. Thus,
+// listing snapshots and browsing directories only access the hot backend.
+//
+// Which backend stores a pack file is determined by Handle.IsMetadata when
+// saving. Many callers do not set IsMetadata when loading a pack file, the
+// location of a pack file is therefore remembered when the file is saved or
+// listed. For unknown pack files the hot backend is checked once, the result
+// is remembered as well.
+type Backend struct {
+	hot  backend.Backend
+	cold backend.Backend
+
+	// location maps the names of pack files to the backend storing them
+	location sync.Map
+}
+
+// make sure that Backend implements these interfaces
+var _ backend.Backend = &Backend{}
+var _ backend.TieredBackend = &Backend{}
+var _ backend.Retainer = &Backend{}
+var _ backend.AppendOnlyAnnouncer = &Backend{}
+
+// New returns a backend which stores the data pack files in cold and all
+// other files in hot.
+func New(hot, cold backend.Backend) *Backend {
+	debug.Log("created new tiered backend")
+	return &Backend{hot: hot, cold: cold}
+}
+
+// ColdBackend returns the backend which stores the data pack files.
+func (be *Backend) ColdBackend() backend.Backend {
+	return be.cold
+}
+
+// target returns the backend which stores a new file.
+func (be *Backend) target(h backend.Handle) backend.Backend {
+	if h.Type == backend.PackFile && !h.IsMetadata {
+		return be.cold
+	}
+	return be.hot
+}
+
+// locate returns the backend which stores the file h.
+func (be *Backend) locate(ctx context.Context, h backend.Handle) (backend.Backend, error) {
+	if h.Type != backend.PackFile {
+		return be.hot, nil
+	}
+	if loc, ok := be.location.Load(h.Name); ok {
+		return loc.(backend.Backend), nil
+	}
+	if h.IsMetadata {
+		return be.hot, nil
+	}
+
+	// checking the hot backend is cheap compared to accessing the cold one
+	_, err := be.hot.Stat(ctx, h)
+	if err == nil {
+		be.location.Store(h.Name, be.hot)
+		return be.hot, nil
+	}
+	if !be.hot.IsNotExist(err) {
+		return nil, err
+	}
+	be.location.Store(h.Name, be.cold)
+	return be.cold, nil
+}
+
+func (be *Backend) Properties() backend.Properties {
+	hot, cold := be.hot.Properties(), be.cold.Properties()
+	return backend.Properties{
+		Connections:      max(hot.Connections, cold.Connections),
+		HasAtomicReplace: hot.HasAtomicReplace && cold.HasAtomicReplace,
+		HasFlakyErrors:   hot.HasFlakyErrors || cold.HasFlakyErrors,
+	}
+}
+
+// Hasher returns nil, Save computes the hash required by the backend which
+// stores the file.
+func (be *Backend) Hasher() hash.Hash {
+	return nil
+}
+
+// Save stores the file in the hot or cold backend depending on its type.
+func (be *Backend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	target := be.target(h)
+
+	if hasher := target.Hasher(); hasher != nil {
+		if _, err := io.Copy(hasher, rd); err != nil {
+			return err
+		}
+		if err := rd.Rewind(); err != nil {
+			return err
+		}
+		rd = &hashedReader{RewindReader: rd, hash: hasher.Sum(nil)}
+	}
+
+	if err := target.Save(ctx, h, rd); err != nil {
+		return err
+	}
+	if h.Type == backend.PackFile {
+		be.location.Store(h.Name, target)
+	}
+	return nil
+}
+
+// hashedReader replaces the hash of a RewindReader.
+type hashedReader struct {
+	backend.RewindReader
+	hash []byte
+}
+
+func (rd *hashedReader) Hash() []byte {
+	return rd.hash
+}
+
+func (be *Backend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	loc, err := be.locate(ctx, h)
+	if err != nil {
+		return err
+	}
+	return loc.Load(ctx, h, length, offset, fn)
+}
+
+func (be *Backend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo, error) {
+	loc, err := be.locate(ctx, h)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+	return loc.Stat(ctx, h)
+}
+
+func (be *Backend) Remove(ctx context.Context, h backend.Handle) error {
+	loc, err := be.locate(ctx, h)
+	if err != nil {
+		return err
+	}
+	err = loc.Remove(ctx, h)
+	if err == nil && h.Type == backend.PackFile {
+		be.location.Delete(h.Name)
+	}
+	return err
+}
+
+// List lists the files of both backends for pack files, and the files of the
+// hot backend otherwise. A pack file stored in both backends is only reported
+// once.
+func (be *Backend) List(ctx context.Context, t backend.FileType, fn func(backend.FileInfo) error) error {
+	if t != backend.PackFile {
+		return be.hot.List(ctx, t, fn)
+	}
+
+	hotPacks := make(map[string]struct{})
+	err := be.hot.List(ctx, t, func(fi backend.FileInfo) error {
+		hotPacks[fi.Name] = struct{}{}
+		be.location.Store(fi.Name, be.hot)
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	return be.cold.List(ctx, t, func(fi backend.FileInfo) error {
+		if _, ok := hotPacks[fi.Name]; ok {
+			debug.Log("pack %v is stored in both backends", fi.Name)
+			return nil
+		}
+		be.location.Store(fi.Name, be.cold)
+		return fn(fi)
+	})
+}
+
+func (be *Backend) IsNotExist(err error) bool {
+	return be.hot.IsNotExist(err) || be.cold.IsNotExist(err)
+}
+
+func (be *Backend) IsPermanentError(err error) bool {
+	return be.hot.IsPermanentError(err) || be.cold.IsPermanentError(err)
+}
+
+func (be *Backend) Close() error {
+	return errors.Join(be.hot.Close(), be.cold.Close())
+}
+
+func (be *Backend) Delete(ctx context.Context) error {
+	be.location.Clear()
+	return errors.Join(be.hot.Delete(ctx), be.cold.Delete(ctx))
+}
+
+// coldHandles returns the handles of the files stored in the cold backend.
+func (be *Backend) coldHandles(ctx context.Context, handles []backend.Handle) ([]backend.Handle, error) {
+	var cold []backend.Handle
+	for _, h := range handles {
+		loc, err := be.locate(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		if loc == be.cold {
+			cold = append(cold, h)
+		}
+	}
+	return cold, nil
+}
+
+// Warmup warms up the files stored in the cold backend, the files of the hot
+// backend are always available.
+func (be *Backend) Warmup(ctx context.Context, handles []backend.Handle) ([]backend.Handle, error) {
+	cold, err := be.coldHandles(ctx, handles)
+	if err != nil || len(cold) == 0 {
+		return []backend.Handle{}, err
+	}
+	return be.cold.Warmup(ctx, cold)
+}
+
+// WarmupWait waits until the files stored in the cold backend are warm.
+func (be *Backend) WarmupWait(ctx context.Context, handles []backend.Handle) error {
+	cold, err := be.coldHandles(ctx, handles)
+	if err != nil || len(cold) == 0 {
+		return err
+	}
+	return be.cold.WarmupWait(ctx, cold)
+}
+
+// RetainedUntil returns the retention time of the file reported by the
+// backend which stores it. Files of backends which do not support retention
+// are not protected.
+func (be *Backend) RetainedUntil(ctx context.Context, h backend.Handle) (time.Time, error) {
+	hot := backend.AsBackend[backend.Retainer](be.hot)
+	cold := backend.AsBackend[backend.Retainer](be.cold)
+	if hot == nil && cold == nil {
+		return time.Time{}, nil
+	}
+
+	loc, err := be.locate(ctx, h)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if loc == be.hot && hot != nil {
+		return hot.RetainedUntil(ctx, h)
+	}
+	if loc == be.cold && cold != nil {
+		return cold.RetainedUntil(ctx, h)
+	}
+	return time.Time{}, nil
+}
+
+// AnnounceAppendOnly forwards the announcement to both backends.
+func (be *Backend) AnnounceAppendOnly() {
+	for _, b := range []backend.Backend{be.hot, be.cold} {
+		if a := backend.AsBackend[backend.AppendOnlyAnnouncer](b); a != nil {
+			a.AnnounceAppendOnly()
+		}
+	}
+}
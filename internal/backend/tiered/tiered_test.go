@@ -0,0 +1,135 @@
+package tiered_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/tiered"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func newTestSuite() *test.Suite[struct{}] {
+	hot, cold := mem.New(), mem.New()
+	newBackend := func(_ context.Context, _ struct{}, _ http.RoundTripper) (*tiered.Backend, error) {
+		return tiered.New(hot, cold), nil
+	}
+
+	return &test.Suite[struct{}]{
+		NewConfig: func() (*struct{}, error) {
+			return &struct{}{}, nil
+		},
+
+		Factory: location.NewHTTPBackendFactory[struct{}, *tiered.Backend](
+			"tiered",
+			func(_ string) (*struct{}, error) {
+				return &struct{}{}, nil
+			},
+			location.NoPassword,
+			newBackend,
+			newBackend,
+		),
+	}
+}
+
+func TestSuiteBackendTiered(t *testing.T) {
+	newTestSuite().RunTests(t)
+}
+
+// warmupBackend records the handles passed to Warmup.
+type warmupBackend struct {
+	backend.Backend
+	warmup []backend.Handle
+}
+
+func (be *warmupBackend) Warmup(_ context.Context, handles []backend.Handle) ([]backend.Handle, error) {
+	be.warmup = append(be.warmup, handles...)
+	return handles, nil
+}
+
+// statCountingBackend counts the calls to Stat.
+type statCountingBackend struct {
+	backend.Backend
+	stats int
+}
+
+func (be *statCountingBackend) Stat(ctx context.Context, h backend.Handle) (backend.FileInfo, error) {
+	be.stats++
+	return be.Backend.Stat(ctx, h)
+}
+
+func save(t *testing.T, be backend.Backend, h backend.Handle, data string) {
+	t.Helper()
+	rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader([]byte(data), be.Hasher())))
+}
+
+func exists(t *testing.T, be backend.Backend, h backend.Handle) bool {
+	t.Helper()
+	_, err := be.Stat(context.TODO(), h)
+	if be.IsNotExist(err) {
+		return false
+	}
+	rtest.OK(t, err)
+	return true
+}
+
+func TestPlacement(t *testing.T) {
+	hot, cold := mem.New(), &warmupBackend{Backend: mem.New()}
+	be := tiered.New(hot, cold)
+
+	snapshot := backend.Handle{Type: backend.SnapshotFile, Name: "snapshot"}
+	treePack := backend.Handle{Type: backend.PackFile, Name: "tree", IsMetadata: true}
+	dataPack := backend.Handle{Type: backend.PackFile, Name: "data"}
+	save(t, be, snapshot, "snapshot")
+	save(t, be, treePack, "tree")
+	save(t, be, dataPack, "data")
+
+	rtest.Assert(t, exists(t, hot, snapshot) && !exists(t, cold, snapshot), "snapshot not stored in hot backend")
+	rtest.Assert(t, exists(t, hot, treePack) && !exists(t, cold, treePack), "tree pack not stored in hot backend")
+	rtest.Assert(t, !exists(t, hot, dataPack) && exists(t, cold, dataPack), "data pack not stored in cold backend")
+
+	// a new instance must find the packs without IsMetadata being set
+	be = tiered.New(hot, cold)
+	for _, name := range []string{"tree", "data"} {
+		h := backend.Handle{Type: backend.PackFile, Name: name}
+		data, err := test.LoadAll(context.TODO(), be, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, name, string(data))
+	}
+
+	var packs []string
+	rtest.OK(t, be.List(context.TODO(), backend.PackFile, func(fi backend.FileInfo) error {
+		packs = append(packs, fi.Name)
+		return nil
+	}))
+	rtest.Equals(t, []string{"tree", "data"}, packs)
+
+	// only the data pack must be warmed up
+	warm, err := be.Warmup(context.TODO(), []backend.Handle{snapshot, {Type: backend.PackFile, Name: "tree"}, {Type: backend.PackFile, Name: "data"}})
+	rtest.OK(t, err)
+	rtest.Equals(t, []backend.Handle{{Type: backend.PackFile, Name: "data"}}, warm)
+	rtest.Equals(t, warm, cold.warmup)
+
+	rtest.OK(t, be.Remove(context.TODO(), dataPack))
+	rtest.Assert(t, !exists(t, cold, dataPack), "data pack was not removed")
+}
+
+func TestPlacementCached(t *testing.T) {
+	hot := &statCountingBackend{Backend: mem.New()}
+	cold := mem.New()
+	save(t, tiered.New(hot, cold), backend.Handle{Type: backend.PackFile, Name: "data"}, "data")
+
+	// the hot backend is only checked once for a pack of unknown location
+	be := tiered.New(hot, cold)
+	h := backend.Handle{Type: backend.PackFile, Name: "data"}
+	for i := 0; i < 3; i++ {
+		data, err := test.LoadAll(context.TODO(), be, h)
+		rtest.OK(t, err)
+		rtest.Equals(t, "data", string(data))
+	}
+	rtest.Equals(t, 1, hot.stats)
+}
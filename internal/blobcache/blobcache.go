@@ -0,0 +1,233 @@
+// Package blobcache implements a size-bounded cache of data blobs on disk. The
+// cache directory can be used by several restic processes at the same time,
+// such that blobs loaded by one mount or dump are available to the next one.
+package blobcache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+const dirMode = 0700
+const fileMode = 0600
+
+// tempPrefix is the prefix of files which are still being written. Temporary
+// files older than staleTempAge were left behind by an interrupted process.
+const tempPrefix = "tmp-"
+const staleTempAge = time.Hour
+
+// Cache stores blobs in a directory. Blobs are encrypted with the key of the
+// repository, the least recently used blobs are removed when the total size
+// exceeds the limit. The methods of a nil Cache do nothing.
+type Cache struct {
+	dir  string
+	key  *crypto.Key
+	size int64
+
+	m    sync.Mutex
+	used int64
+}
+
+// New returns a cache in dir which stores at most size bytes.
+func New(dir string, key *crypto.Key, size int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c := &Cache{dir: dir, key: key, size: size}
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		c.used += f.size
+	}
+	debug.Log("using blob cache in %v, %d of %d bytes used", dir, c.used, size)
+	return c, nil
+}
+
+func (c *Cache) filename(id restic.ID) string {
+	s := id.String()
+	return filepath.Join(c.dir, s[:2], s)
+}
+
+// Get returns the blob id if it is contained in the cache.
+func (c *Cache) Get(id restic.ID) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	filename := c.filename(id)
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+
+	if len(buf) < c.key.NonceSize() {
+		return nil, c.remove(filename)
+	}
+	nonce, ciphertext := buf[:c.key.NonceSize()], buf[c.key.NonceSize():]
+	plaintext, err := c.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil || !restic.Hash(plaintext).Equal(id) {
+		debug.Log("removing damaged blob %v from cache: %v", id, err)
+		return nil, c.remove(filename)
+	}
+
+	// the modification time is used to find the least recently used blobs
+	now := time.Now()
+	_ = os.Chtimes(filename, now, now)
+	return plaintext, true
+}
+
+func (c *Cache) remove(filename string) bool {
+	_ = os.Remove(filename)
+	return false
+}
+
+// Add stores the blob id in the cache.
+func (c *Cache) Add(id restic.ID, blob []byte) error {
+	if c == nil {
+		return nil
+	}
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, crypto.CiphertextLength(len(blob)))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = c.key.Seal(ciphertext, nonce, blob, nil)
+	if int64(len(ciphertext)) > c.size {
+		return nil
+	}
+
+	filename := c.filename(id)
+	if err := os.MkdirAll(filepath.Dir(filename), dirMode); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// write to a temporary file first, such that other processes never read
+	// a partial file
+	f, err := os.CreateTemp(filepath.Dir(filename), tempPrefix)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = f.Write(ciphertext)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	// the blob may already be cached, e.g. when it was added by another
+	// process in the meantime, in which case the old file is replaced
+	var oldSize int64
+	if fi, serr := os.Stat(filename); serr == nil {
+		oldSize = fi.Size()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.used += int64(len(ciphertext)) - oldSize
+	if c.used > c.size {
+		return c.evict()
+	}
+	return nil
+}
+
+// Load returns the blob id from the cache. If the blob is not cached, it is
+// loaded using load and added to the cache. For a nil Cache, load is always
+// called.
+func (c *Cache) Load(id restic.ID, load func() ([]byte, error)) ([]byte, error) {
+	if blob, ok := c.Get(id); ok {
+		return blob, nil
+	}
+
+	blob, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Add(id, blob); err != nil {
+		debug.Log("unable to add blob %v to cache: %v", id, err)
+	}
+	return blob, nil
+}
+
+type cacheFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *Cache) files() ([]cacheFile, error) {
+	var files []cacheFile
+	err := filepath.WalkDir(c.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// removed by another process
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		// files which are still being written are not part of the cache
+		if strings.HasPrefix(d.Name(), tempPrefix) {
+			if time.Since(fi.ModTime()) > staleTempAge {
+				_ = os.Remove(name)
+			}
+			return nil
+		}
+		files = append(files, cacheFile{name: name, size: fi.Size(), modTime: fi.ModTime()})
+		return nil
+	})
+	return files, errors.WithStack(err)
+}
+
+// evict removes the least recently used blobs until at most 90% of the cache
+// size are used. As other processes may use the cache, the files are listed
+// again instead of relying on the size tracked by this process.
+func (c *Cache) evict() error {
+	files, err := c.files()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	c.used = 0
+	for _, f := range files {
+		c.used += f.size
+	}
+
+	limit := c.size / 10 * 9
+	for _, f := range files {
+		if c.used <= limit {
+			break
+		}
+		if err := os.Remove(f.name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+		c.used -= f.size
+	}
+	debug.Log("evicted blobs from cache, %d bytes used", c.used)
+	return nil
+}
@@ -0,0 +1,149 @@
+package blobcache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testSeed = 23
+
+func testBlob(size int) (restic.ID, []byte) {
+	testSeed++
+	buf := rtest.Random(testSeed, size)
+	return restic.Hash(buf), buf
+}
+
+func TestCacheAddGet(t *testing.T) {
+	dir := t.TempDir()
+	key := crypto.NewRandomKey()
+	c, err := New(dir, key, 1<<20)
+	rtest.OK(t, err)
+
+	id, blob := testBlob(1000)
+	_, ok := c.Get(id)
+	rtest.Assert(t, !ok, "empty cache returned blob")
+
+	rtest.OK(t, c.Add(id, blob))
+	buf, ok := c.Get(id)
+	rtest.Assert(t, ok, "blob not found")
+	rtest.Equals(t, blob, buf)
+
+	// the blob is stored encrypted
+	stored, err := os.ReadFile(c.filename(id))
+	rtest.OK(t, err)
+	rtest.Assert(t, !bytes.Contains(stored, blob[:100]), "blob is stored as plaintext")
+
+	// a second cache in the same directory finds the blob
+	c2, err := New(dir, key, 1<<20)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(len(stored)), c2.used)
+	buf, ok = c2.Get(id)
+	rtest.Assert(t, ok, "blob not found by second cache")
+	rtest.Equals(t, blob, buf)
+
+	// damaged blobs are removed
+	stored[len(stored)-1] ^= 0xff
+	rtest.OK(t, os.WriteFile(c.filename(id), stored, 0600))
+	_, ok = c.Get(id)
+	rtest.Assert(t, !ok, "damaged blob was returned")
+	_, err = os.Stat(c.filename(id))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "damaged blob was not removed")
+}
+
+func TestCacheEvict(t *testing.T) {
+	c, err := New(t.TempDir(), crypto.NewRandomKey(), 10000)
+	rtest.OK(t, err)
+
+	var ids restic.IDs
+	for i := 0; i < 3; i++ {
+		id, blob := testBlob(3000)
+		rtest.OK(t, c.Add(id, blob))
+		// make sure that the order of the blobs is well-defined
+		ts := time.Now().Add(time.Duration(i-10) * time.Minute)
+		rtest.OK(t, os.Chtimes(c.filename(id), ts, ts))
+		ids = append(ids, id)
+	}
+
+	// reading the first blob marks it as recently used
+	_, ok := c.Get(ids[0])
+	rtest.Assert(t, ok, "blob not found")
+
+	id, blob := testBlob(3000)
+	rtest.OK(t, c.Add(id, blob))
+	ids = append(ids, id)
+
+	for i, want := range []bool{true, false, false, true} {
+		_, ok := c.Get(ids[i])
+		rtest.Assert(t, want == ok, "blob %d: want %v, got %v", i, want, ok)
+	}
+	rtest.Assert(t, c.used <= 9000, "cache uses %d bytes", c.used)
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*", "*"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(files))
+}
+
+func TestCacheLoad(t *testing.T) {
+	c, err := New(t.TempDir(), crypto.NewRandomKey(), 1<<20)
+	rtest.OK(t, err)
+	id, blob := testBlob(100)
+
+	// only the first load from the cache needs to call the load function
+	for i, test := range []struct {
+		cache *Cache
+		calls int
+	}{
+		{nil, 1},
+		{c, 1},
+		{c, 0},
+	} {
+		calls := 0
+		buf, err := test.cache.Load(id, func() ([]byte, error) {
+			calls++
+			return blob, nil
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, blob, buf)
+		rtest.Assert(t, test.calls == calls, "test %d: want %d calls, got %d", i, test.calls, calls)
+	}
+}
+
+func TestCacheUsed(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, crypto.NewRandomKey(), 1<<20)
+	rtest.OK(t, err)
+
+	id, blob := testBlob(1000)
+	rtest.OK(t, c.Add(id, blob))
+	used := c.used
+	rtest.Equals(t, int64(crypto.CiphertextLength(len(blob))), used)
+
+	// adding the same blob again replaces the file
+	rtest.OK(t, c.Add(id, blob))
+	rtest.Equals(t, used, c.used)
+
+	// files which are still being written are not counted
+	tempfile := filepath.Join(dir, tempPrefix+"123")
+	rtest.OK(t, os.WriteFile(tempfile, make([]byte, 500), 0600))
+	c2, err := New(dir, crypto.NewRandomKey(), 1<<20)
+	rtest.OK(t, err)
+	rtest.Equals(t, used, c2.used)
+	_, err = os.Stat(tempfile)
+	rtest.OK(t, err)
+
+	// stale temporary files are removed
+	ts := time.Now().Add(-2 * staleTempAge)
+	rtest.OK(t, os.Chtimes(tempfile, ts, ts))
+	_, err = New(dir, crypto.NewRandomKey(), 1<<20)
+	rtest.OK(t, err)
+	_, err = os.Stat(tempfile)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "stale temporary file was not removed")
+}
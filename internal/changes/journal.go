@@ -0,0 +1,378 @@
+// Package changes implements a journal of modified paths which allows the
+// archiver to skip directories that have not changed since the parent
+// snapshot.
+//
+// The journal is a text file which is written by `restic watch`. Each line
+// contains a record type, a timestamp in nanoseconds since the Unix epoch and
+// optionally a quoted path:
+//
+//	S <time> <root>...  the watcher started to observe the roots
+//	C <time> <path>     the path or an entry within it was modified
+//	R <time> <path>     the path was created or moved, its contents are unknown
+//	H <time>            all modifications before <time> have been recorded
+//
+// An S record resets all previous records, it is written whenever the watcher
+// is (re-)started or has lost events.
+package changes
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+const journalHeader = "restic change journal v1"
+
+type entry struct {
+	// changed and replaced are the times of the last records, zero if none
+	changed, replaced int64
+}
+
+// Journal is the state of a change journal.
+type Journal struct {
+	// Started is the time from which on modifications have been recorded.
+	Started time.Time
+	// Synced is the time of the latest heartbeat, all modifications before it
+	// have been recorded.
+	Synced time.Time
+	// Roots are the paths observed by the watcher.
+	Roots []string
+
+	entries map[string]*entry
+}
+
+func newJournal() *Journal {
+	return &Journal{entries: make(map[string]*entry)}
+}
+
+func (j *Journal) reset(t time.Time, roots []string) {
+	j.Started = t
+	j.Synced = time.Time{}
+	j.Roots = roots
+	j.entries = make(map[string]*entry)
+}
+
+func (j *Journal) record(path string, replaced bool, t int64) {
+	e, ok := j.entries[path]
+	if !ok {
+		e = &entry{}
+		j.entries[path] = e
+	}
+	if replaced {
+		e.replaced = max(e.replaced, t)
+	} else {
+		e.changed = max(e.changed, t)
+	}
+}
+
+// parseLine applies a single line of the journal.
+func (j *Journal) parseLine(line string) error {
+	typ, rest, _ := strings.Cut(line, " ")
+	ts, rest, _ := strings.Cut(rest, " ")
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid timestamp %q", ts)
+	}
+
+	var paths []string
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return errors.Errorf("invalid path %q", rest)
+		}
+		path, _ := strconv.Unquote(quoted)
+		paths = append(paths, path)
+		rest = strings.TrimPrefix(rest[len(quoted):], " ")
+	}
+
+	switch typ {
+	case "S":
+		j.reset(time.Unix(0, t), paths)
+	case "H":
+		j.Synced = time.Unix(0, t)
+	case "C", "R":
+		if len(paths) != 1 {
+			return errors.Errorf("expected one path, got %d", len(paths))
+		}
+		j.record(paths[0], typ == "R", t)
+	default:
+		return errors.Errorf("unknown record type %q", typ)
+	}
+	return nil
+}
+
+// Load reads the journal stored in filename.
+func Load(filename string) (*Journal, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parse(buf)
+}
+
+func parse(buf []byte) (*Journal, error) {
+	lines := strings.Split(string(buf), "\n")
+	if lines[0] != journalHeader {
+		return nil, errors.New("not a restic change journal")
+	}
+	// the last line is either empty or still being written by the watcher
+	lines = lines[1 : len(lines)-1]
+
+	j := newJournal()
+	for _, line := range lines {
+		if err := j.parseLine(line); err != nil {
+			return nil, errors.Errorf("invalid record %q: %v", line, err)
+		}
+	}
+	if j.Started.IsZero() {
+		return nil, errors.New("journal contains no start record")
+	}
+	return j, nil
+}
+
+// WaitSynced reads the journal stored in filename until it contains all
+// modifications up to t. An error is returned if the watcher does not confirm
+// this within timeout.
+func WaitSynced(ctx context.Context, filename string, t time.Time, timeout time.Duration) (*Journal, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		j, err := Load(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !j.Synced.Before(t) {
+			return j, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("journal was last synced at %v, is the watcher running?", j.Synced.Format(time.DateTime))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// ChangeSet contains the modifications recorded since a point in time.
+type ChangeSet struct {
+	roots []string
+	// dirty contains all modified paths and their parent directories
+	dirty map[string]struct{}
+	// replaced contains the paths whose content is completely unknown
+	replaced map[string]struct{}
+}
+
+// Since returns the modifications recorded since t. The journal must have
+// been started before t.
+func (j *Journal) Since(t time.Time) (*ChangeSet, error) {
+	if t.Before(j.Started) {
+		return nil, errors.Errorf("journal only contains changes since %v", j.Started.Format(time.DateTime))
+	}
+
+	cs := &ChangeSet{
+		roots:    j.Roots,
+		dirty:    make(map[string]struct{}),
+		replaced: make(map[string]struct{}),
+	}
+	limit := t.UnixNano()
+	for path, e := range j.entries {
+		if e.changed < limit && e.replaced < limit {
+			continue
+		}
+		if e.replaced >= limit {
+			cs.replaced[path] = struct{}{}
+		}
+		for p := path; ; p = filepath.Dir(p) {
+			if _, ok := cs.dirty[p]; ok {
+				break
+			}
+			cs.dirty[p] = struct{}{}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+	}
+	return cs, nil
+}
+
+func isBelow(path, root string) bool {
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
+}
+
+// Unchanged reports whether the directory path and everything below it is
+// known to be unchanged. path must be absolute and clean.
+func (cs *ChangeSet) Unchanged(path string) bool {
+	if _, ok := cs.dirty[path]; ok {
+		return false
+	}
+
+	observed := false
+	for _, root := range cs.roots {
+		if isBelow(path, root) {
+			observed = true
+			break
+		}
+	}
+	if !observed {
+		return false
+	}
+
+	// a directory which was moved into place is not covered by the records
+	// of its previous location
+	for p := path; ; p = filepath.Dir(p) {
+		if _, ok := cs.replaced[p]; ok {
+			return false
+		}
+		if filepath.Dir(p) == p {
+			return true
+		}
+	}
+}
+
+// Writer appends records to a journal.
+type Writer struct {
+	filename string
+	f        *os.File
+	wr       *bufio.Writer
+	journal  *Journal
+	// lines is the number of records in the file
+	lines int
+}
+
+// Create starts a new journal in filename which records the modifications
+// below roots.
+func Create(filename string, roots []string, t time.Time) (*Writer, error) {
+	w := &Writer{filename: filename, journal: newJournal()}
+	w.journal.reset(t, roots)
+	if err := w.rewrite(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func quotePaths(paths []string) string {
+	s := ""
+	for _, path := range paths {
+		s += " " + strconv.Quote(path)
+	}
+	return s
+}
+
+// rewrite replaces the file with the current state of the journal. This
+// removes duplicate records.
+func (w *Writer) rewrite() error {
+	tmp := w.filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	wr := bufio.NewWriter(f)
+
+	j := w.journal
+	_, _ = fmt.Fprintf(wr, "%s\nS %d%s\n", journalHeader, j.Started.UnixNano(), quotePaths(j.Roots))
+	w.lines = 1
+
+	paths := make([]string, 0, len(j.entries))
+	for path := range j.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		e := j.entries[path]
+		if e.changed != 0 {
+			_, _ = fmt.Fprintf(wr, "C %d %s\n", e.changed, strconv.Quote(path))
+			w.lines++
+		}
+		if e.replaced != 0 {
+			_, _ = fmt.Fprintf(wr, "R %d %s\n", e.replaced, strconv.Quote(path))
+			w.lines++
+		}
+	}
+	if !j.Synced.IsZero() {
+		_, _ = fmt.Fprintf(wr, "H %d\n", j.Synced.UnixNano())
+		w.lines++
+	}
+
+	if err := wr.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, w.filename); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if w.f != nil {
+		_ = w.f.Close()
+	}
+	w.f = f
+	w.wr = bufio.NewWriter(f)
+	return nil
+}
+
+func (w *Writer) append(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(w.wr, format, args...)
+	w.lines++
+	return err
+}
+
+// Changed records that path was modified at t. If replaced is set, the path
+// was created or moved and nothing is known about its contents.
+func (w *Writer) Changed(path string, replaced bool, t time.Time) error {
+	typ := "C"
+	if replaced {
+		typ = "R"
+	}
+	w.journal.record(path, replaced, t.UnixNano())
+	return w.append("%s %d %s\n", typ, t.UnixNano(), strconv.Quote(path))
+}
+
+// Restart discards all records, this is necessary if modifications could not
+// be recorded.
+func (w *Writer) Restart(t time.Time) error {
+	w.journal.reset(t, w.journal.Roots)
+	return w.rewrite()
+}
+
+// Sync records that all modifications before t have been recorded and writes
+// the buffered records to the file. Once the file contains much more records
+// than paths, it is compacted.
+func (w *Writer) Sync(t time.Time) error {
+	w.journal.Synced = t
+	if w.lines > 2*len(w.journal.entries)+1000 {
+		return w.rewrite()
+	}
+	if err := w.append("H %d\n", t.UnixNano()); err != nil {
+		return err
+	}
+	return w.wr.Flush()
+}
+
+// Close writes the buffered records and closes the file.
+func (w *Writer) Close() error {
+	err := w.wr.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
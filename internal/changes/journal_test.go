@@ -0,0 +1,117 @@
+package changes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestJournal(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal")
+	start := time.Unix(1000, 0)
+
+	w, err := Create(filename, []string{"/home", "/srv"}, start)
+	rtest.OK(t, err)
+	rtest.OK(t, w.Changed("/home/user/old/file", false, start.Add(time.Second)))
+	rtest.OK(t, w.Changed("/home/user/work/file", false, start.Add(10*time.Second)))
+	rtest.OK(t, w.Changed("/home/user/moved", true, start.Add(10*time.Second)))
+	rtest.OK(t, w.Sync(start.Add(20*time.Second)))
+	// records after the last heartbeat are not yet written
+	rtest.OK(t, w.Changed("/srv/data", false, start.Add(21*time.Second)))
+
+	j, err := Load(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, start, j.Started)
+	rtest.Equals(t, start.Add(20*time.Second), j.Synced)
+	rtest.Equals(t, []string{"/home", "/srv"}, j.Roots)
+
+	_, err = j.Since(start.Add(-time.Second))
+	rtest.Assert(t, err != nil, "journal must not be used for changes before it was started")
+
+	cs, err := j.Since(start.Add(5 * time.Second))
+	rtest.OK(t, err)
+	for _, test := range []struct {
+		path      string
+		unchanged bool
+	}{
+		{"/home/user/old", true},
+		{"/home/user/work", false},
+		{"/home/user", false},
+		{"/home", false},
+		{"/home/user/work/sub", true},
+		{"/home/user/moved", false},
+		{"/home/user/moved/sub", false},
+		{"/home/user/moved2", true},
+		{"/srv/data", true},
+		{"/var/lib", false},
+	} {
+		rtest.Equals(t, test.unchanged, cs.Unchanged(test.path), test.path)
+	}
+
+	rtest.OK(t, w.Close())
+	j, err = Load(filename)
+	rtest.OK(t, err)
+	cs, err = j.Since(start.Add(5 * time.Second))
+	rtest.OK(t, err)
+	rtest.Assert(t, !cs.Unchanged("/srv/data"), "record written by Close is missing")
+}
+
+func TestJournalRestart(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal")
+	start := time.Unix(1000, 0)
+
+	w, err := Create(filename, []string{"/"}, start)
+	rtest.OK(t, err)
+	rtest.OK(t, w.Changed("/a", false, start.Add(time.Second)))
+	rtest.OK(t, w.Restart(start.Add(2*time.Second)))
+	rtest.OK(t, w.Sync(start.Add(3*time.Second)))
+	rtest.OK(t, w.Close())
+
+	j, err := Load(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, start.Add(2*time.Second), j.Started)
+	_, err = j.Since(start)
+	rtest.Assert(t, err != nil, "restarted journal must not be used for earlier changes")
+
+	cs, err := j.Since(start.Add(2 * time.Second))
+	rtest.OK(t, err)
+	rtest.Assert(t, cs.Unchanged("/a"), "records before the restart must be discarded")
+}
+
+func TestJournalCompact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "journal")
+	start := time.Unix(1000, 0)
+
+	w, err := Create(filename, []string{"/"}, start)
+	rtest.OK(t, err)
+	for i := 0; i < 2000; i++ {
+		rtest.OK(t, w.Changed("/a/b", false, start.Add(time.Duration(i)*time.Millisecond)))
+	}
+	rtest.OK(t, w.Sync(start.Add(5*time.Second)))
+	rtest.OK(t, w.Close())
+
+	buf, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(buf) < 200, "journal was not compacted: %q", buf)
+
+	j, err := Load(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, start.Add(5*time.Second), j.Synced)
+	cs, err := j.Since(start.Add(time.Second))
+	rtest.OK(t, err)
+	rtest.Assert(t, !cs.Unchanged("/a/b"), "latest record was lost during compaction")
+}
+
+func TestJournalPartialLine(t *testing.T) {
+	j, err := parse([]byte(journalHeader + "\nS 1000 \"/\"\nH 2000\nC 3000 \"/a"))
+	rtest.OK(t, err)
+	rtest.Equals(t, time.Unix(0, 2000), j.Synced)
+
+	_, err = parse([]byte("foo\n"))
+	rtest.Assert(t, err != nil, "invalid header was accepted")
+	_, err = parse([]byte(journalHeader + "\nX 1000\n"))
+	rtest.Assert(t, err != nil, "invalid record was accepted")
+}
@@ -0,0 +1,290 @@
+package changes
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO |
+	unix.FAN_MODIFY | unix.FAN_ATTRIB | unix.FAN_ONDIR
+
+// syncInterval is the maximum delay between two heartbeats.
+const syncInterval = time.Second
+
+type watcher struct {
+	fd    int
+	roots []string
+	// mounts contains an open directory for each observed filesystem, which
+	// is required to resolve the file handles reported by fanotify
+	mounts map[unix.Fsid]int
+	w      *Writer
+	warn   func(format string, args ...interface{})
+}
+
+// Watch records the modifications below roots in w until ctx is cancelled.
+// All filesystems mounted below the roots are observed, filesystems mounted
+// later on are not. The roots must be absolute. Watching requires the
+// CAP_SYS_ADMIN and CAP_DAC_READ_SEARCH capabilities and Linux 5.9 or newer.
+func Watch(ctx context.Context, roots []string, w *Writer, warn func(format string, args ...interface{})) error {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|
+		unix.FAN_REPORT_DFID_NAME|unix.FAN_UNLIMITED_QUEUE, unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		return errors.Fatalf("unable to initialize fanotify: %v", err)
+	}
+
+	wt := &watcher{fd: fd, roots: roots, mounts: make(map[unix.Fsid]int), w: w, warn: warn}
+	defer wt.close()
+
+	mountpoints, err := mountpointsBelow(roots)
+	if err != nil {
+		return err
+	}
+	for _, path := range append(append([]string{}, roots...), mountpoints...) {
+		if err := wt.mark(path); err != nil {
+			return err
+		}
+	}
+
+	return wt.run(ctx)
+}
+
+func (wt *watcher) close() {
+	for _, fd := range wt.mounts {
+		_ = unix.Close(fd)
+	}
+	_ = unix.Close(wt.fd)
+}
+
+// mark adds the filesystem which contains path.
+func (wt *watcher) mark(path string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return errors.Fatalf("unable to watch %v: %v", path, err)
+	}
+	if _, ok := wt.mounts[st.Fsid]; ok {
+		return nil
+	}
+
+	err := unix.FanotifyMark(wt.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, watchMask, unix.AT_FDCWD, path)
+	if err != nil {
+		return errors.Fatalf("unable to watch %v: %v", path, err)
+	}
+	mountFd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Fatalf("unable to watch %v: %v", path, err)
+	}
+	debug.Log("watching filesystem of %v", path)
+	wt.mounts[st.Fsid] = mountFd
+	return nil
+}
+
+// mountpointsBelow returns the mount points below roots.
+func mountpointsBelow(roots []string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var mountpoints []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountpoint := unescapeMountinfo(fields[4])
+		for _, root := range roots {
+			if mountpoint != root && isBelow(mountpoint, root) {
+				mountpoints = append(mountpoints, mountpoint)
+				break
+			}
+		}
+	}
+	return mountpoints, sc.Err()
+}
+
+// unescapeMountinfo decodes the octal escapes used in /proc/self/mountinfo.
+func unescapeMountinfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func (wt *watcher) run(ctx context.Context) error {
+	buf := make([]byte, 64*1024)
+	lastSync := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return wt.w.Sync(time.Now())
+		}
+
+		// all events which occurred before start are returned by read
+		start := time.Now()
+		n, err := unix.Read(wt.fd, buf)
+		if err == unix.EAGAIN {
+			if start.Sub(lastSync) >= syncInterval {
+				if err := wt.w.Sync(start); err != nil {
+					return err
+				}
+				lastSync = start
+			}
+
+			fds := []unix.PollFd{{Fd: int32(wt.fd), Events: unix.POLLIN}}
+			_, err = unix.Poll(fds, int(syncInterval/time.Millisecond))
+			if err != nil && err != unix.EINTR {
+				return err
+			}
+			continue
+		}
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return errors.Fatalf("reading fanotify events failed: %v", err)
+		}
+
+		if err := wt.handleEvents(buf[:n], start); err != nil {
+			return err
+		}
+	}
+}
+
+func (wt *watcher) handleEvents(buf []byte, t time.Time) error {
+	const metaSize = 24 // sizeof(struct fanotify_event_metadata)
+	for len(buf) >= metaSize {
+		var meta unix.FanotifyEventMetadata
+		if _, err := binary.Decode(buf[:metaSize], binary.NativeEndian, &meta); err != nil {
+			return err
+		}
+		if meta.Vers != unix.FANOTIFY_METADATA_VERSION {
+			return errors.Fatalf("unsupported fanotify version %d", meta.Vers)
+		}
+		if int(meta.Event_len) > len(buf) || int(meta.Event_len) < metaSize {
+			return errors.Fatalf("invalid fanotify event length %d", meta.Event_len)
+		}
+		event := buf[:meta.Event_len]
+		buf = buf[meta.Event_len:]
+
+		if meta.Mask&unix.FAN_Q_OVERFLOW != 0 {
+			wt.warn("events were lost, the journal is restarted\n")
+			if err := wt.w.Restart(t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path, ok, err := wt.resolve(event[meta.Metadata_len:])
+		if err != nil {
+			// the modified path is unknown, the journal is incomplete
+			wt.warn("%v, the journal is restarted\n", err)
+			if err := wt.w.Restart(t); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		observed := false
+		for _, root := range wt.roots {
+			if isBelow(path, root) {
+				observed = true
+				break
+			}
+		}
+		if !observed {
+			continue
+		}
+
+		replaced := meta.Mask&(unix.FAN_CREATE|unix.FAN_MOVED_TO) != 0
+		debug.Log("%v modified (mask %x)", path, meta.Mask)
+		if err := wt.w.Changed(path, replaced, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the path contained in the info records of an event. If the
+// directory no longer exists, ok is false.
+func (wt *watcher) resolve(info []byte) (path string, ok bool, err error) {
+	// struct fanotify_event_info_header followed by __kernel_fsid_t and struct file_handle
+	const headerSize = 4 + 8 + 8
+	for len(info) >= headerSize {
+		infoType := info[0]
+		infoLen := int(binary.NativeEndian.Uint16(info[2:4]))
+		if infoLen < headerSize || infoLen > len(info) {
+			return "", false, errors.Errorf("invalid fanotify info length %d", infoLen)
+		}
+		record := info[:infoLen]
+		info = info[infoLen:]
+
+		if infoType != unix.FAN_EVENT_INFO_TYPE_DFID_NAME && infoType != unix.FAN_EVENT_INFO_TYPE_DFID {
+			continue
+		}
+
+		var fsid unix.Fsid
+		fsid.Val[0] = int32(binary.NativeEndian.Uint32(record[4:8]))
+		fsid.Val[1] = int32(binary.NativeEndian.Uint32(record[8:12]))
+		handleBytes := int(binary.NativeEndian.Uint32(record[12:16]))
+		handleType := int32(binary.NativeEndian.Uint32(record[16:20]))
+		if headerSize+handleBytes > len(record) {
+			return "", false, errors.Errorf("invalid fanotify file handle length %d", handleBytes)
+		}
+		handle := unix.NewFileHandle(handleType, record[headerSize:headerSize+handleBytes])
+
+		name := ""
+		if infoType == unix.FAN_EVENT_INFO_TYPE_DFID_NAME {
+			name = string(record[headerSize+handleBytes:])
+			if i := strings.IndexByte(name, 0); i >= 0 {
+				name = name[:i]
+			}
+		}
+
+		mountFd, found := wt.mounts[fsid]
+		if !found {
+			return "", false, errors.Errorf("event for unknown filesystem %v", fsid.Val)
+		}
+		fd, err := unix.OpenByHandleAt(mountFd, handle, unix.O_PATH|unix.O_CLOEXEC)
+		if err == unix.ESTALE || err == unix.ENOENT {
+			// the directory was removed, which is recorded for its parent
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, errors.Errorf("unable to resolve modified directory: %v", err)
+		}
+		dir, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+		_ = unix.Close(fd)
+		if err != nil {
+			return "", false, errors.Errorf("unable to resolve modified directory: %v", err)
+		}
+		if strings.HasSuffix(dir, " (deleted)") {
+			return "", false, nil
+		}
+		return filepath.Join(dir, name), true, nil
+	}
+	return "", false, errors.New("event contains no directory")
+}
@@ -0,0 +1,64 @@
+package changes
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+func TestWatch(t *testing.T) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY)
+	if err != nil {
+		t.Skipf("fanotify is not available: %v", err)
+	}
+	_ = unix.Close(fd)
+
+	root := t.TempDir()
+	for _, dir := range []string{"unchanged/sub", "modified", "moved"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	}
+	rtest.OK(t, os.WriteFile(filepath.Join(root, "modified", "file"), []byte("foo"), 0o644))
+	rtest.OK(t, os.MkdirAll(filepath.Join(root, "moved", "sub"), 0o755))
+
+	filename := filepath.Join(t.TempDir(), "journal")
+	start := time.Now()
+	w, err := Create(filename, []string{root}, start)
+	rtest.OK(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, []string{root}, w, t.Logf)
+	}()
+
+	// wait until the watcher is running
+	_, err = WaitSynced(context.Background(), filename, start, 10*time.Second)
+	if err != nil {
+		cancel()
+		<-done
+		t.Skipf("fanotify watch is not permitted: %v", err)
+	}
+
+	rtest.OK(t, os.WriteFile(filepath.Join(root, "modified", "file"), []byte("bar"), 0o644))
+	rtest.OK(t, os.Rename(filepath.Join(root, "moved"), filepath.Join(root, "new")))
+	modified := time.Now()
+
+	j, err := WaitSynced(context.Background(), filename, modified, 10*time.Second)
+	rtest.OK(t, err)
+	cancel()
+	rtest.OK(t, <-done)
+	rtest.OK(t, w.Close())
+
+	cs, err := j.Since(start)
+	rtest.OK(t, err)
+	rtest.Assert(t, cs.Unchanged(filepath.Join(root, "unchanged")), "unchanged directory reported as modified")
+	rtest.Assert(t, cs.Unchanged(filepath.Join(root, "unchanged", "sub")), "unchanged directory reported as modified")
+	rtest.Assert(t, !cs.Unchanged(filepath.Join(root, "modified")), "modified directory reported as unchanged")
+	rtest.Assert(t, !cs.Unchanged(filepath.Join(root, "new", "sub")), "moved directory reported as unchanged")
+	rtest.Assert(t, !cs.Unchanged(root), "root reported as unchanged")
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package changes
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Watch records the modifications below roots in w until ctx is cancelled.
+// It is only supported on Linux.
+func Watch(_ context.Context, _ []string, _ *Writer, _ func(format string, args ...interface{})) error {
+	return errors.Fatal("watching for changes is only supported on Linux")
+}
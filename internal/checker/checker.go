@@ -34,11 +34,19 @@ type Checker struct {
 	masterIndex *index.MasterIndex
 	snapshots   restic.Lister
 
-	repo restic.Repository
+	repo checkerRepository
+}
+
+// checkerRepository is the repository used by the checker. In addition to the
+// usual operations, it is able to verify the contents of pack files.
+type checkerRepository interface {
+	restic.Repository
+	NewZstdDecoder(opts ...zstd.DOption) (*zstd.Decoder, error)
+	CheckPack(ctx context.Context, id restic.ID, blobs []restic.Blob, size int64, bufRd *bufio.Reader, dec *zstd.Decoder) error
 }
 
 // New returns a new checker which runs on repo.
-func New(repo restic.Repository, trackUnused bool) *Checker {
+func New(repo checkerRepository, trackUnused bool) *Checker {
 	c := &Checker{
 		packs:       make(map[restic.ID]int64),
 		masterIndex: index.NewMasterIndex(),
@@ -293,6 +301,71 @@ func loadSnapshotTreeIDs(ctx context.Context, lister restic.Lister, repo restic.
 	return ids, errs
 }
 
+// SnapshotSignatureError is returned when the signature of a snapshot cannot
+// be verified.
+type SnapshotSignatureError struct {
+	ID  restic.ID
+	Err error
+}
+
+func (e *SnapshotSignatureError) Error() string {
+	return "snapshot " + e.ID.Str() + ": " + e.Err.Error()
+}
+
+// Signatures verifies the signatures of all snapshots. Invalid signatures are
+// always reported. If trusted is not empty, then unsigned snapshots and
+// snapshots signed by other keys are reported too. errChan is closed after all
+// snapshots have been checked.
+func (c *Checker) Signatures(ctx context.Context, trusted restic.TrustedKeys, errChan chan<- error) {
+	defer close(errChan)
+
+	err := restic.ForAllSnapshots(ctx, c.snapshots, c.repo, nil, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			// already reported by Structure
+			return nil
+		}
+		err = sn.VerifySignature(trusted)
+		if err == nil || (len(trusted) == 0 && errors.Is(err, restic.ErrSnapshotUnsigned)) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case errChan <- &SnapshotSignatureError{ID: id, Err: err}:
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		errChan <- err
+	}
+}
+
+// PolicyViolations returns the retention policy stored in the repository and
+// the snapshots which it does not keep. The policy is nil if none is stored.
+func (c *Checker) PolicyViolations(ctx context.Context) (*restic.RetentionPolicy, restic.Snapshots, error) {
+	policy, err := restic.LoadRetentionPolicy(ctx, c.repo)
+	if err != nil || policy == nil {
+		return nil, nil, err
+	}
+
+	var snapshots restic.Snapshots
+	err = restic.ForAllSnapshots(ctx, c.snapshots, c.repo, nil, func(_ restic.ID, sn *restic.Snapshot, err error) error {
+		// damaged snapshots are reported by Structure, checkpoints are
+		// not subject to the policy
+		if err == nil && !sn.IsCheckpoint() {
+			snapshots = append(snapshots, sn)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	violations, err := policy.Violations(snapshots)
+	return policy, violations, err
+}
+
 // Structure checks that for all snapshots all referenced data blobs and
 // subtrees are available in the index. errChan is closed after all trees have
 // been traversed.
@@ -464,7 +537,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 	for i := 0; i < workerCount; i++ {
 		g.Go(func() error {
 			bufRd := bufio.NewReaderSize(nil, maxStreamBufferSize)
-			dec, err := zstd.NewReader(nil)
+			dec, err := c.repo.NewZstdDecoder()
 			if err != nil {
 				panic(dec)
 			}
@@ -482,7 +555,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 					}
 				}
 
-				err := repository.CheckPack(ctx, c.repo.(*repository.Repository), ps.id, ps.blobs, ps.size, bufRd, dec)
+				err := c.repo.CheckPack(ctx, ps.id, ps.blobs, ps.size, bufRd, dec)
 				p.Add(1)
 				if err == nil {
 					continue
@@ -522,3 +595,37 @@ func (c *Checker) ReadPacks(ctx context.Context, packs map[restic.ID]int64, p *p
 		}
 	}
 }
+
+// ParityError describes an error with a specific parity file.
+type ParityError struct {
+	ID  restic.ID
+	Err error
+}
+
+func (e *ParityError) Error() string {
+	return "parity file " + e.ID.String() + ": " + e.Err.Error()
+}
+
+// ReadParity loads all parity files and checks their integrity. errChan is
+// closed after all parity files have been checked.
+func (c *Checker) ReadParity(ctx context.Context, p *progress.Counter, errChan chan<- error) {
+	defer close(errChan)
+
+	err := restic.ParallelList(ctx, c.repo, restic.ParityFile, c.repo.Connections(), func(ctx context.Context, id restic.ID, _ int64) error {
+		_, _, err := repository.LoadParityFile(ctx, c.repo, id)
+		p.Add(1)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case errChan <- &ParityError{ID: id, Err: err}:
+		}
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		errChan <- err
+	}
+}
@@ -9,7 +9,11 @@ import (
 
 // TestCheckRepo runs the checker on repo.
 func TestCheckRepo(t testing.TB, repo restic.Repository, skipStructure bool) {
-	chkr := New(repo, true)
+	checkRepo, ok := repo.(checkerRepository)
+	if !ok {
+		t.Fatalf("repository of type %T cannot be checked", repo)
+	}
+	chkr := New(checkRepo, true)
 
 	hints, errs := chkr.LoadIndex(context.TODO(), nil)
 	if len(errs) != 0 {
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Job is a task which is run according to a schedule.
+type Job struct {
+	Name string
+	// Repository is the name of the repository used by the job. Jobs using
+	// the same repository are never run concurrently.
+	Repository string
+	Schedule   Schedule
+	Run        func(ctx context.Context) error
+}
+
+// Run executes the jobs according to their schedules until ctx is cancelled.
+// After a job has finished, report is called with its result. Jobs of
+// different repositories run in parallel, jobs of the same repository are
+// run one after another in the order in which they are passed to Run. A job
+// which is due while another job of its repository is running is run
+// afterwards, missed runs are not repeated.
+func Run(ctx context.Context, jobs []*Job, report func(job *Job, err error)) {
+	forEachRepository(jobs, report, func(jobs []*Job, report func(job *Job, err error)) {
+		runScheduled(ctx, jobs, report)
+	})
+}
+
+// RunOnce runs each job exactly once, ignoring the schedules. Like for Run,
+// jobs of the same repository are run one after another.
+func RunOnce(ctx context.Context, jobs []*Job, report func(job *Job, err error)) {
+	forEachRepository(jobs, report, func(jobs []*Job, report func(job *Job, err error)) {
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			report(job, job.Run(ctx))
+		}
+	})
+}
+
+// forEachRepository calls fn concurrently for the jobs of each repository.
+// Calls to report are serialized.
+func forEachRepository(jobs []*Job, report func(job *Job, err error), fn func(jobs []*Job, report func(job *Job, err error))) {
+	byRepo := make(map[string][]*Job)
+	var repos []string
+	for _, job := range jobs {
+		if _, ok := byRepo[job.Repository]; !ok {
+			repos = append(repos, job.Repository)
+		}
+		byRepo[job.Repository] = append(byRepo[job.Repository], job)
+	}
+
+	var m sync.Mutex
+	syncReport := func(job *Job, err error) {
+		m.Lock()
+		defer m.Unlock()
+		report(job, err)
+	}
+
+	var wg sync.WaitGroup
+	for _, repo := range repos {
+		wg.Add(1)
+		go func(jobs []*Job) {
+			defer wg.Done()
+			fn(jobs, syncReport)
+		}(byRepo[repo])
+	}
+	wg.Wait()
+}
+
+func runScheduled(ctx context.Context, jobs []*Job, report func(job *Job, err error)) {
+	now := time.Now()
+	next := make([]time.Time, len(jobs))
+	for i, job := range jobs {
+		next[i] = job.Schedule.Next(now)
+	}
+
+	for {
+		// find the next job which is due, a zero time means never
+		var wakeup time.Time
+		for _, t := range next {
+			if !t.IsZero() && (wakeup.IsZero() || t.Before(wakeup)) {
+				wakeup = t
+			}
+		}
+		if wakeup.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(wakeup))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for i, job := range jobs {
+			if next[i].IsZero() || time.Now().Before(next[i]) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := job.Run(ctx)
+			report(job, err)
+			next[i] = job.Schedule.Next(time.Now())
+		}
+	}
+}
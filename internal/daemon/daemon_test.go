@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running sync.Map
+	var runs atomic.Int32
+	newJob := func(name, repo string) *Job {
+		return &Job{
+			Name:       name,
+			Repository: repo,
+			Schedule:   interval(5 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				if _, loaded := running.LoadOrStore(repo, true); loaded {
+					return errors.Errorf("concurrent job for repository %v", repo)
+				}
+				time.Sleep(2 * time.Millisecond)
+				running.Delete(repo)
+				if runs.Add(1) >= 20 {
+					cancel()
+				}
+				return nil
+			},
+		}
+	}
+
+	jobs := []*Job{newJob("a1", "a"), newJob("a2", "a"), newJob("b1", "b")}
+	Run(ctx, jobs, func(job *Job, err error) {
+		rtest.OK(t, err)
+	})
+	rtest.Assert(t, runs.Load() >= 20, "expected at least 20 runs, got %v", runs.Load())
+}
+
+func TestRunOnce(t *testing.T) {
+	var order []string
+	newJob := func(name string, err error) *Job {
+		return &Job{
+			Name:       name,
+			Repository: "repo",
+			Schedule:   interval(time.Hour),
+			Run: func(context.Context) error {
+				order = append(order, name)
+				return err
+			},
+		}
+	}
+
+	var failed []string
+	RunOnce(context.TODO(), []*Job{newJob("backup", nil), newJob("prune", errors.New("failed")), newJob("check", nil)}, func(job *Job, err error) {
+		if err != nil {
+			failed = append(failed, job.Name)
+		}
+	})
+	rtest.Equals(t, []string{"backup", "prune", "check"}, order)
+	rtest.Equals(t, []string{"prune"}, failed)
+}
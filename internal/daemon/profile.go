@@ -0,0 +1,248 @@
+// Package daemon implements loading profiles and running the scheduled jobs
+// of the `restic daemon` command.
+package daemon
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile describes the repositories and backup sets managed by the daemon.
+type Profile struct {
+	Repositories map[string]*Repository `yaml:"repositories"`
+	Backups      map[string]*Backup     `yaml:"backups"`
+}
+
+// Repository describes how to access a repository and which maintenance jobs
+// to run for it.
+type Repository struct {
+	Repository      string        `yaml:"repository"`
+	RepositoryFile  string        `yaml:"repository-file"`
+	PasswordFile    string        `yaml:"password-file"`
+	PasswordCommand string        `yaml:"password-command"`
+	KeyHint         string        `yaml:"key-hint"`
+	Options         []string      `yaml:"options"`
+	RetryLock       time.Duration `yaml:"retry-lock"`
+
+	Check *CheckJob `yaml:"check"`
+	Prune *PruneJob `yaml:"prune"`
+}
+
+// CheckJob periodically checks the repository.
+type CheckJob struct {
+	Schedule       string `yaml:"schedule"`
+	ReadDataSubset string `yaml:"read-data-subset"`
+}
+
+// PruneJob periodically removes unreferenced data from the repository.
+type PruneJob struct {
+	Schedule  string `yaml:"schedule"`
+	MaxUnused string `yaml:"max-unused"`
+}
+
+// Backup describes a backup set which is saved to a repository.
+type Backup struct {
+	Repository       string   `yaml:"repository"`
+	Schedule         string   `yaml:"schedule"`
+	Paths            []string `yaml:"paths"`
+	Excludes         []string `yaml:"exclude"`
+	IExcludes        []string `yaml:"iexclude"`
+	ExcludeFiles     []string `yaml:"exclude-file"`
+	ExcludeIfPresent []string `yaml:"exclude-if-present"`
+	ExcludeCaches    bool     `yaml:"exclude-caches"`
+	OneFileSystem    bool     `yaml:"one-file-system"`
+	Tags             []string `yaml:"tags"`
+	Host             string   `yaml:"host"`
+
+	// CheckpointInterval enables checkpoints which allow resuming an
+	// interrupted backup.
+	CheckpointInterval time.Duration `yaml:"checkpoint-interval"`
+
+	// Forget is applied to the snapshots of the backup set after each backup.
+	Forget *ForgetPolicy `yaml:"forget"`
+}
+
+// ForgetPolicy describes which snapshots of a backup set to keep.
+type ForgetPolicy struct {
+	Last            int      `yaml:"keep-last"`
+	Hourly          int      `yaml:"keep-hourly"`
+	Daily           int      `yaml:"keep-daily"`
+	Weekly          int      `yaml:"keep-weekly"`
+	Monthly         int      `yaml:"keep-monthly"`
+	Quarterly       int      `yaml:"keep-quarterly"`
+	Yearly          int      `yaml:"keep-yearly"`
+	Weekdays        []string `yaml:"keep-weekday"`
+	Within          string   `yaml:"keep-within"`
+	WithinHourly    string   `yaml:"keep-within-hourly"`
+	WithinDaily     string   `yaml:"keep-within-daily"`
+	WithinWeekly    string   `yaml:"keep-within-weekly"`
+	WithinMonthly   string   `yaml:"keep-within-monthly"`
+	WithinQuarterly string   `yaml:"keep-within-quarterly"`
+	WithinYearly    string   `yaml:"keep-within-yearly"`
+	Tags            []string `yaml:"keep-tag"`
+	FirstInPeriod   bool     `yaml:"keep-first-in-period"`
+	WithinFromNow   bool     `yaml:"keep-within-from-now"`
+
+	// Prune removes unreferenced data directly after forgetting snapshots.
+	Prune bool `yaml:"prune"`
+}
+
+// ExpirePolicy converts the policy into a restic.ExpirePolicy.
+func (p *ForgetPolicy) ExpirePolicy() (restic.ExpirePolicy, error) {
+	policy := restic.ExpirePolicy{
+		Last:          p.Last,
+		Hourly:        p.Hourly,
+		Daily:         p.Daily,
+		Weekly:        p.Weekly,
+		Monthly:       p.Monthly,
+		Quarterly:     p.Quarterly,
+		Yearly:        p.Yearly,
+		FirstInPeriod: p.FirstInPeriod,
+		WithinFromNow: p.WithinFromNow,
+	}
+
+	for _, d := range []struct {
+		s      string
+		target *restic.Duration
+	}{
+		{p.Within, &policy.Within},
+		{p.WithinHourly, &policy.WithinHourly},
+		{p.WithinDaily, &policy.WithinDaily},
+		{p.WithinWeekly, &policy.WithinWeekly},
+		{p.WithinMonthly, &policy.WithinMonthly},
+		{p.WithinQuarterly, &policy.WithinQuarterly},
+		{p.WithinYearly, &policy.WithinYearly},
+	} {
+		if d.s == "" {
+			continue
+		}
+		dur, err := restic.ParseDuration(d.s)
+		if err != nil {
+			return restic.ExpirePolicy{}, err
+		}
+		*d.target = dur
+	}
+
+	for _, day := range p.Weekdays {
+		if err := policy.Weekdays.Set(day); err != nil {
+			return restic.ExpirePolicy{}, err
+		}
+	}
+
+	for _, tags := range p.Tags {
+		var l restic.TagList
+		if err := l.Set(tags); err != nil {
+			return restic.ExpirePolicy{}, err
+		}
+		policy.Tags = append(policy.Tags, l)
+	}
+
+	if policy.Empty() {
+		return restic.ExpirePolicy{}, errors.New("no keep-* option is set")
+	}
+	return policy, nil
+}
+
+// LoadProfile reads and validates the profile stored in filename.
+func LoadProfile(filename string) (*Profile, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read profile: %v", err)
+	}
+
+	p, err := ParseProfile(buf)
+	if err != nil {
+		return nil, errors.Fatalf("invalid profile %v: %v", filename, err)
+	}
+	return p, nil
+}
+
+// ParseProfile parses and validates a YAML profile.
+func ParseProfile(buf []byte) (*Profile, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+
+	var p Profile
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func validateSchedule(s string) error {
+	if s == "" {
+		return errors.New("schedule is missing")
+	}
+	sched, err := ParseSchedule(s)
+	if err != nil {
+		return err
+	}
+	if sched.Next(time.Now()).IsZero() {
+		return errors.Errorf("schedule %q never runs", s)
+	}
+	return nil
+}
+
+func (p *Profile) validate() error {
+	if len(p.Backups) == 0 {
+		return errors.New("no backups defined")
+	}
+
+	for _, name := range sortedKeys(p.Repositories) {
+		repo := p.Repositories[name]
+		if repo == nil || (repo.Repository == "") == (repo.RepositoryFile == "") {
+			return errors.Errorf("repository %q: exactly one of repository and repository-file must be set", name)
+		}
+		if repo.Check != nil {
+			if err := validateSchedule(repo.Check.Schedule); err != nil {
+				return errors.Errorf("repository %q: check: %v", name, err)
+			}
+		}
+		if repo.Prune != nil {
+			if err := validateSchedule(repo.Prune.Schedule); err != nil {
+				return errors.Errorf("repository %q: prune: %v", name, err)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(p.Backups) {
+		backup := p.Backups[name]
+		if backup == nil {
+			return errors.Errorf("backup %q is empty", name)
+		}
+		if _, ok := p.Repositories[backup.Repository]; !ok {
+			return errors.Errorf("backup %q: unknown repository %q", name, backup.Repository)
+		}
+		if len(backup.Paths) == 0 {
+			return errors.Errorf("backup %q: no paths specified", name)
+		}
+		if err := validateSchedule(backup.Schedule); err != nil {
+			return errors.Errorf("backup %q: %v", name, err)
+		}
+		if backup.Forget != nil {
+			if _, err := backup.Forget.ExpirePolicy(); err != nil {
+				return errors.Errorf("backup %q: forget: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+const testProfile = `
+repositories:
+  local:
+    repository: /srv/restic-repo
+    password-file: /etc/restic/password
+    retry-lock: 5m
+    check:
+      schedule: "0 4 * * sun"
+      read-data-subset: 5%
+    prune:
+      schedule: "@weekly"
+      max-unused: 10%
+
+backups:
+  home:
+    repository: local
+    schedule: "30 2 * * *"
+    paths: [/home]
+    exclude: ["*.tmp"]
+    exclude-caches: true
+    tags: [home]
+    forget:
+      keep-daily: 7
+      keep-weekly: 4
+      keep-within: 2d
+      keep-tag: ["important"]
+`
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile([]byte(testProfile))
+	rtest.OK(t, err)
+
+	repo := p.Repositories["local"]
+	rtest.Equals(t, "/srv/restic-repo", repo.Repository)
+	rtest.Equals(t, 5*time.Minute, repo.RetryLock)
+	rtest.Equals(t, "5%", repo.Check.ReadDataSubset)
+	rtest.Equals(t, "10%", repo.Prune.MaxUnused)
+
+	backup := p.Backups["home"]
+	rtest.Equals(t, []string{"/home"}, backup.Paths)
+	rtest.Equals(t, []string{"*.tmp"}, backup.Excludes)
+	rtest.Assert(t, backup.ExcludeCaches, "exclude-caches not set")
+
+	policy, err := backup.Forget.ExpirePolicy()
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.ExpirePolicy{
+		Daily:  7,
+		Weekly: 4,
+		Within: restic.ParseDurationOrPanic("2d"),
+		Tags:   []restic.TagList{{"important"}},
+	}, policy)
+}
+
+func TestParseProfileInvalid(t *testing.T) {
+	for _, test := range []struct {
+		profile string
+		err     string
+	}{
+		{"repositories: {}", "no backups defined"},
+		{"foo: bar", "field foo not found"},
+		{`
+repositories:
+  local: {repository: /srv/repo}
+backups:
+  home: {repository: other, schedule: "@daily", paths: [/home]}
+`, `unknown repository "other"`},
+		{`
+repositories:
+  local: {repository: /srv/repo}
+backups:
+  home: {repository: local, paths: [/home]}
+`, "schedule is missing"},
+		{`
+repositories:
+  local: {repository: /srv/repo}
+backups:
+  home: {repository: local, schedule: "@daily", paths: [/home], forget: {prune: true}}
+`, "no keep-* option is set"},
+		{`
+repositories:
+  local: {repository: /srv/repo, repository-file: /etc/restic/repo}
+backups:
+  home: {repository: local, schedule: "@daily", paths: [/home]}
+`, "exactly one of repository and repository-file"},
+	} {
+		_, err := ParseProfile([]byte(test.profile))
+		rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err), "expected error containing %q, got %v", test.err, err)
+	}
+}
@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC) // a wednesday
+
+	for _, test := range []struct {
+		schedule string
+		next     time.Time
+	}{
+		{"@every 90m", start.Add(90 * time.Minute)},
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 1, 31, 10, 20, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 31, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month and day of week are combined like in cron
+		{"0 0 15 * mon", time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		t.Run(test.schedule, func(t *testing.T) {
+			s, err := ParseSchedule(test.schedule)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.next, s.Next(start))
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, schedule := range []string{
+		"",
+		"@every",
+		"@every -1h",
+		"@every foo",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+	} {
+		_, err := ParseSchedule(schedule)
+		rtest.Assert(t, err != nil, "missing error for schedule %q", schedule)
+	}
+}
@@ -3,8 +3,12 @@ package dump
 import (
 	"context"
 	"io"
+	"math"
+	"os"
 	"path"
+	"time"
 
+	"github.com/restic/restic/internal/blobcache"
 	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/walker"
@@ -14,10 +18,11 @@ import (
 // A Dumper writes trees and files from a repository to a Writer
 // in an archive format.
 type Dumper struct {
-	cache  *bloblru.Cache
-	format string
-	repo   restic.Loader
-	w      io.Writer
+	cache     *bloblru.Cache
+	diskCache *blobcache.Cache
+	format    string
+	repo      restic.Loader
+	w         io.Writer
 }
 
 func New(format string, repo restic.Loader, w io.Writer) *Dumper {
@@ -29,36 +34,51 @@ func New(format string, repo restic.Loader, w io.Writer) *Dumper {
 	}
 }
 
+// UseBlobCache stores the loaded data blobs in c in addition to the in-memory
+// cache.
+func (d *Dumper) UseBlobCache(c *blobcache.Cache) {
+	d.diskCache = c
+}
+
 func (d *Dumper) DumpTree(ctx context.Context, tree *restic.Tree, rootPath string) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// ch is buffered to deal with variable download/write speeds.
 	ch := make(chan *restic.Node, 10)
-	go sendTrees(ctx, d.repo, tree, rootPath, ch)
+	// only squashfs images can contain devices, fifos and sockets
+	go sendTrees(ctx, d.repo, tree, rootPath, d.format == "squashfs", ch)
 
 	switch d.format {
 	case "tar":
 		return d.dumpTar(ctx, ch)
 	case "zip":
 		return d.dumpZip(ctx, ch)
+	case "pax":
+		return d.dumpPax(ctx, ch)
+	case "cpio":
+		return d.dumpCpio(ctx, ch)
+	case "squashfs":
+		return d.dumpSquashfs(ctx, ch, rootPath)
 	default:
 		panic("unknown dump format")
 	}
 }
 
-func sendTrees(ctx context.Context, repo restic.BlobLoader, tree *restic.Tree, rootPath string, ch chan *restic.Node) {
+func sendTrees(ctx context.Context, repo restic.BlobLoader, tree *restic.Tree, rootPath string, special bool, ch chan *restic.Node) {
 	defer close(ch)
 
 	for _, root := range tree.Nodes {
 		root.Path = path.Join(rootPath, root.Name)
-		if sendNodes(ctx, repo, root, ch) != nil {
+		if sendNodes(ctx, repo, root, special, ch) != nil {
 			break
 		}
 	}
 }
 
-func sendNodes(ctx context.Context, repo restic.BlobLoader, root *restic.Node, ch chan *restic.Node) error {
+// sendNodes sends root and all nodes below it to ch. Devices, fifos and
+// sockets are only sent if special is true.
+func sendNodes(ctx context.Context, repo restic.BlobLoader, root *restic.Node, special bool, ch chan *restic.Node) error {
 	select {
 	case ch <- root:
 	case <-ctx.Done():
@@ -80,7 +100,13 @@ func sendNodes(ctx context.Context, repo restic.BlobLoader, root *restic.Node, c
 
 		node.Path = path.Join(root.Path, nodepath)
 
-		if node.Type != restic.NodeTypeFile && node.Type != restic.NodeTypeDir && node.Type != restic.NodeTypeSymlink {
+		switch node.Type {
+		case restic.NodeTypeFile, restic.NodeTypeDir, restic.NodeTypeSymlink:
+		case restic.NodeTypeDev, restic.NodeTypeCharDev, restic.NodeTypeFifo, restic.NodeTypeSocket:
+			if !special {
+				return nil
+			}
+		default:
 			return nil
 		}
 
@@ -131,7 +157,9 @@ loop:
 
 		wg.Go(func() error {
 			blob, err := d.cache.GetOrCompute(id, func() ([]byte, error) {
-				return d.repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+				return d.diskCache.Load(id, func() ([]byte, error) {
+					return d.repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+				})
 			})
 
 			if err == nil {
@@ -150,3 +178,58 @@ loop:
 	close(blobs)
 	return wg.Wait()
 }
+
+// hardlinkKey identifies a file which has more than one link.
+type hardlinkKey struct {
+	device, inode uint64
+}
+
+// hardlinkID returns the key which identifies the file behind node. ok is
+// false unless node is a file with more than one link.
+func hardlinkID(node *restic.Node) (key hardlinkKey, ok bool) {
+	if node.Type != restic.NodeTypeFile || node.Links < 2 {
+		return hardlinkKey{}, false
+	}
+	return hardlinkKey{node.DeviceID, node.Inode}, true
+}
+
+// unixPermissions returns the permission bits of node including the setuid,
+// setgid and sticky bits as used by Unix archive formats.
+func unixPermissions(node *restic.Node) uint32 {
+	perm := uint32(node.Mode.Perm())
+	if node.Mode&os.ModeSetuid != 0 {
+		perm |= cISUID
+	}
+	if node.Mode&os.ModeSetgid != 0 {
+		perm |= cISGID
+	}
+	if node.Mode&os.ModeSticky != 0 {
+		perm |= cISVTX
+	}
+	return perm
+}
+
+// unixTime returns t in seconds since the epoch, clamped to the range of an
+// unsigned 32 bit integer.
+func unixTime(t time.Time) uint32 {
+	sec := t.Unix()
+	if sec < 0 {
+		return 0
+	}
+	if sec > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(sec)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -3,6 +3,11 @@ package dump
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/archiver"
@@ -58,6 +63,24 @@ func WriteTest(t *testing.T, format string, cd CheckDump) {
 			},
 			target: "/",
 		},
+		{
+			name: "hardlinked files",
+			args: archiver.TestDir{
+				"dir": archiver.TestDir{
+					"file1": archiver.TestFile{Content: "string"},
+					"file2": archiver.TestHardlink{Target: "file1"},
+				},
+				"file3": archiver.TestFile{Content: "other"},
+			},
+			target: "/",
+		},
+		{
+			name: "file with zero blocks",
+			args: archiver.TestDir{
+				"file": archiver.TestFile{Content: strings.Repeat("\x00", 300*1024) + "string" + strings.Repeat("\x00", 100*1024)},
+			},
+			target: "/",
+		},
 		{
 			name: "file and symlink in root",
 			args: archiver.TestDir{
@@ -84,14 +107,69 @@ func WriteTest(t *testing.T, format string, cd CheckDump) {
 			tree, err := restic.LoadTree(ctx, repo, *sn.Tree)
 			rtest.OK(t, err)
 
-			dst := &bytes.Buffer{}
+			dst := &seekableBuffer{}
 			d := New(format, repo, dst)
 			if err := d.DumpTree(ctx, tree, tt.target); err != nil {
 				t.Fatalf("Dumper.Run error = %v", err)
 			}
-			if err := cd(t, tmpdir, dst); err != nil {
+			if err := cd(t, tmpdir, bytes.NewBuffer(dst.buf)); err != nil {
 				t.Errorf("WriteDump() = does not match: %v", err)
 			}
 		})
 	}
 }
+
+// seekableBuffer is an in-memory io.WriteSeeker.
+type seekableBuffer struct {
+	buf []byte
+	pos int64
+}
+
+func (b *seekableBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + int64(len(p)); end > int64(len(b.buf)) {
+		b.buf = append(b.buf, make([]byte, end-int64(len(b.buf)))...)
+	}
+	n := copy(b.buf[b.pos:], p)
+	b.pos += int64(n)
+	return n, nil
+}
+
+func (b *seekableBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+// linkCounts returns the number of links within testDir for each file in
+// testDir, keyed by the slash separated path relative to testDir.
+func linkCounts(testDir string) (map[string]int, error) {
+	var files []string
+	var infos []os.FileInfo
+	err := filepath.Walk(testDir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(testDir, name)
+		files = append(files, filepath.ToSlash(relPath))
+		infos = append(infos, info)
+		return err
+	})
+
+	counts := make(map[string]int)
+	for i, name := range files {
+		for _, other := range infos {
+			if os.SameFile(infos[i], other) {
+				counts[name]++
+			}
+		}
+	}
+	return counts, err
+}
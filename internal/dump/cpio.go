@@ -0,0 +1,128 @@
+package dump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// cpio "new ASCII" (newc) format as described in cpio(5). It is used for
+// example by the Linux kernel for initramfs images.
+const (
+	cpioMagic   = "070701"
+	cpioTrailer = "TRAILER!!!"
+
+	cpioTypeDir     = 0o040000
+	cpioTypeFile    = 0o100000
+	cpioTypeSymlink = 0o120000
+)
+
+type cpioHeader struct {
+	ino, mode, uid, gid, nlink, mtime, size uint32
+	name                                    string
+}
+
+func (h *cpioHeader) write(w io.Writer) error {
+	// the name is terminated by a NUL byte and padded such that header and
+	// name use a multiple of four bytes
+	namesize := len(h.name) + 1
+	buf := fmt.Sprintf("%s%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%s\x00",
+		cpioMagic, h.ino, h.mode, h.uid, h.gid, h.nlink, h.mtime, h.size,
+		0, 0, 0, 0, namesize, 0, h.name)
+	buf += string(make([]byte, cpioPadding(int64(len(buf)))))
+	_, err := io.WriteString(w, buf)
+	return err
+}
+
+// cpioPadding returns the number of bytes required to pad n bytes to a
+// multiple of four.
+func cpioPadding(n int64) int64 {
+	return (4 - n%4) % 4
+}
+
+func (d *Dumper) dumpCpio(ctx context.Context, ch <-chan *restic.Node) error {
+	w := &countingWriter{w: d.w}
+
+	// files with multiple links share the inode number, the content is only
+	// stored with the first link
+	links := make(map[hardlinkKey]uint32)
+	var ino uint32
+
+	for node := range ch {
+		relPath, err := filepath.Rel("/", node.Path)
+		if err != nil {
+			return err
+		}
+
+		h := cpioHeader{
+			mode:  unixPermissions(node),
+			uid:   node.UID,
+			gid:   node.GID,
+			nlink: 1,
+			mtime: unixTime(node.ModTime),
+			name:  filepath.ToSlash(relPath),
+		}
+
+		writeContent := false
+		switch node.Type {
+		case restic.NodeTypeDir:
+			h.mode |= cpioTypeDir
+			h.nlink = 2
+		case restic.NodeTypeSymlink:
+			h.mode |= cpioTypeSymlink
+			h.size = uint32(len(node.LinkTarget))
+		case restic.NodeTypeFile:
+			h.mode |= cpioTypeFile
+			if node.Size > math.MaxUint32 {
+				return fmt.Errorf("%q is too large for the cpio format", node.Path)
+			}
+			h.size = uint32(node.Size)
+			writeContent = true
+		}
+
+		key, isLink := hardlinkID(node)
+		if isLink {
+			h.nlink = uint32(node.Links)
+			if first, ok := links[key]; ok {
+				h.ino = first
+				h.size = 0
+				writeContent = false
+			}
+		}
+		if h.ino == 0 {
+			ino++
+			h.ino = ino
+			if isLink {
+				links[key] = ino
+			}
+		}
+
+		if err := h.write(w); err != nil {
+			return fmt.Errorf("writing header for %q: %w", node.Path, err)
+		}
+
+		start := w.n
+		switch {
+		case node.Type == restic.NodeTypeSymlink:
+			_, err = io.WriteString(w, node.LinkTarget)
+		case writeContent:
+			err = d.writeNode(ctx, w, node)
+			if err == nil && w.n-start != int64(h.size) {
+				err = fmt.Errorf("size of %q does not match, wrote %d bytes, expected %d", node.Path, w.n-start, h.size)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(make([]byte, cpioPadding(w.n-start))); err != nil {
+			return err
+		}
+	}
+
+	h := cpioHeader{nlink: 1, name: cpioTrailer}
+	return h.write(w)
+}
@@ -0,0 +1,164 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestWriteCpio(t *testing.T) {
+	WriteTest(t, "cpio", checkCpio)
+}
+
+type cpioEntry struct {
+	ino, mode, nlink, mtime uint32
+	name                    string
+	data                    []byte
+}
+
+func readCpio(r *bytes.Buffer) ([]cpioEntry, error) {
+	var entries []cpioEntry
+	offset := 0
+	read := func(n int) ([]byte, error) {
+		buf := r.Next(n)
+		offset += len(buf)
+		if len(buf) != n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return buf, nil
+	}
+	pad := func() error {
+		_, err := read(int(cpioPadding(int64(offset))))
+		return err
+	}
+
+	for {
+		header, err := read(110)
+		if err != nil {
+			return nil, err
+		}
+		if string(header[:6]) != cpioMagic {
+			return nil, fmt.Errorf("invalid magic %q", header[:6])
+		}
+		var fields [13]uint32
+		for i := range fields {
+			v, err := strconv.ParseUint(string(header[6+8*i:14+8*i]), 16, 32)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = uint32(v)
+		}
+
+		name, err := read(int(fields[11]))
+		if err != nil {
+			return nil, err
+		}
+		if err := pad(); err != nil {
+			return nil, err
+		}
+		e := cpioEntry{ino: fields[0], mode: fields[1], nlink: fields[4], mtime: fields[5], name: string(name[:len(name)-1])}
+		if e.name == cpioTrailer {
+			return entries, nil
+		}
+
+		data, err := read(int(fields[6]))
+		if err != nil {
+			return nil, err
+		}
+		e.data = bytes.Clone(data)
+		if err := pad(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func checkCpio(t *testing.T, testDir string, srcCpio *bytes.Buffer) error {
+	entries, err := readCpio(srcCpio)
+	if err != nil {
+		return err
+	}
+
+	fileNumber := 0
+	err = filepath.Walk(testDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() != filepath.Base(testDir) {
+			fileNumber++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(entries) != fileNumber {
+		return fmt.Errorf("not the same amount of files got %v want %v", len(entries), fileNumber)
+	}
+
+	links, err := linkCounts(testDir)
+	if err != nil {
+		return err
+	}
+
+	contents := make(map[uint32][]byte)
+	for _, e := range entries {
+		matchPath := filepath.Join(testDir, e.name)
+		match, err := os.Lstat(matchPath)
+		if err != nil {
+			return err
+		}
+
+		if int64(e.mtime) != match.ModTime().Unix() {
+			return fmt.Errorf("modTime of %v does not match, got: %v, want: %v", e.name, e.mtime, match.ModTime().Unix())
+		}
+		if os.FileMode(e.mode&0o777) != match.Mode().Perm() {
+			return fmt.Errorf("mode of %v does not match, got: %o, want: %v", e.name, e.mode, match.Mode())
+		}
+
+		switch e.mode &^ 0o7777 {
+		case cpioTypeDir:
+			if !match.IsDir() {
+				return fmt.Errorf("%v should be a directory", e.name)
+			}
+		case cpioTypeSymlink:
+			target, err := os.Readlink(matchPath)
+			if err != nil {
+				return err
+			}
+			if target != string(e.data) {
+				return fmt.Errorf("symlink target does not match, got %s want %s", e.data, target)
+			}
+		case cpioTypeFile:
+			want, err := os.ReadFile(matchPath)
+			if err != nil {
+				return err
+			}
+			data := e.data
+			if (e.nlink > 1) != (links[filepath.ToSlash(e.name)] > 1) {
+				return fmt.Errorf("link count of %v does not match, got %d, want %d", e.name, e.nlink, links[filepath.ToSlash(e.name)])
+			}
+			if e.nlink > 1 {
+				// the content of hardlinked files is only stored once
+				if first, ok := contents[e.ino]; ok {
+					if len(data) != 0 {
+						return fmt.Errorf("content of hardlink %v is stored twice", e.name)
+					}
+					data = first
+				}
+				contents[e.ino] = data
+			}
+			if !bytes.Equal(data, want) {
+				return fmt.Errorf("contents of %v does not match", e.name)
+			}
+		default:
+			return fmt.Errorf("unexpected mode %o of %v", e.mode, e.name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package dump
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// paxGenericPrefix is the prefix of the PAX records which store the generic
+// attributes of a node as JSON.
+const paxGenericPrefix = "RESTIC.generic."
+
+// dumpPax writes a POSIX.1-2001 (pax) tar archive. Unlike dumpTar, it keeps
+// sub-second timestamps, stores all extended and generic attributes and
+// writes files with multiple links as hardlinks.
+func (d *Dumper) dumpPax(ctx context.Context, ch <-chan *restic.Node) (err error) {
+	w := tar.NewWriter(d.w)
+
+	defer func() {
+		if err == nil {
+			err = w.Close()
+			err = errors.Wrap(err, "Close")
+		}
+	}()
+
+	links := make(map[hardlinkKey]string)
+	for node := range ch {
+		if err := d.dumpNodePax(ctx, node, w, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dumper) dumpNodePax(ctx context.Context, node *restic.Node, w *tar.Writer, links map[hardlinkKey]string) error {
+	header, err := tarHeader(node)
+	if err != nil {
+		return err
+	}
+	header.Format = tar.FormatPAX
+	header.PAXRecords = paxRecords(node)
+
+	key, isLink := hardlinkID(node)
+	if isLink {
+		if target, ok := links[key]; ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = target
+			header.Size = 0
+		} else {
+			links[key] = header.Name
+		}
+	}
+
+	err = w.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("writing header for %q: %w", node.Path, err)
+	}
+	if header.Typeflag == tar.TypeLink {
+		return nil
+	}
+	return d.writeNode(ctx, w, node)
+}
+
+// paxRecords returns the PAX records for the extended and generic attributes
+// of node. In addition to the textual form of POSIX ACLs, all extended
+// attributes are stored unmodified.
+func paxRecords(node *restic.Node) map[string]string {
+	records := parseXattrs(node.ExtendedAttributes)
+	for _, attr := range node.ExtendedAttributes {
+		records["SCHILY.xattr."+attr.Name] = string(attr.Value)
+	}
+	for name, value := range node.GenericAttributes {
+		records[paxGenericPrefix+string(name)] = string(value)
+	}
+	return records
+}
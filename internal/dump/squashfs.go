@@ -0,0 +1,577 @@
+package dump
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Constants of the squashfs 4.0 format, see fs/squashfs/squashfs_fs.h in the
+// Linux kernel sources.
+const (
+	sqMagic          = 0x73717368
+	sqSuperblockSize = 96
+	sqBlockLog       = 17
+	sqBlockSize      = 1 << sqBlockLog
+	sqMetadataSize   = 8192
+	sqDirCount       = 256
+	sqMaxName        = 256
+	sqPadding        = 4096
+
+	sqCompressionZlib = 1
+
+	sqFlagNoFragments = 1 << 4
+	sqFlagNoXattrs    = 1 << 9
+
+	sqMetadataUncompressed = 1 << 15
+	sqBlockUncompressed    = 1 << 24
+
+	sqInvalidFragment = math.MaxUint32
+	sqInvalidXattr    = math.MaxUint32
+	sqInvalidTable    = math.MaxUint64
+
+	sqTypeDir     = 1
+	sqTypeFile    = 2
+	sqTypeSymlink = 3
+	sqTypeBlkDev  = 4
+	sqTypeChrDev  = 5
+	sqTypeFifo    = 6
+	sqTypeSocket  = 7
+	sqTypeExtDir  = 8
+	sqTypeExtFile = 9
+)
+
+// sqInode is an inode of a squashfs image. Files with multiple links share
+// one inode.
+type sqInode struct {
+	number uint32
+	nlink  uint32
+
+	// start, blocks and sparse describe the data blocks of a file
+	start  uint64
+	blocks []uint32
+	sparse uint64
+
+	// ref is the position of the inode in the inode table, it is set once the
+	// inode has been written
+	ref     uint64
+	written bool
+}
+
+// sqEntry is a file, directory, symlink, device, fifo or socket in a squashfs
+// image.
+type sqEntry struct {
+	name string
+	// node is nil for the directories which contain the dumped tree
+	node     *restic.Node
+	inode    *sqInode
+	children []*sqEntry
+}
+
+func (e *sqEntry) isDir() bool {
+	return e.node == nil || e.node.Type == restic.NodeTypeDir
+}
+
+// sqTypes maps the node types other than directories to the basic squashfs
+// inode types, which are also used in directory listings.
+var sqTypes = map[restic.NodeType]uint16{
+	restic.NodeTypeFile:    sqTypeFile,
+	restic.NodeTypeSymlink: sqTypeSymlink,
+	restic.NodeTypeDev:     sqTypeBlkDev,
+	restic.NodeTypeCharDev: sqTypeChrDev,
+	restic.NodeTypeFifo:    sqTypeFifo,
+	restic.NodeTypeSocket:  sqTypeSocket,
+}
+
+// sqDevice converts a device number as returned by stat on Linux to the
+// encoding used by squashfs, which is new_encode_dev of the Linux kernel.
+func sqDevice(dev uint64) uint32 {
+	major := uint32((dev>>8)&0xfff | (dev>>32)&^0xfff)
+	minor := uint32(dev&0xff | (dev>>12)&^0xff)
+	return minor&0xff | major<<8 | (minor&^0xff)<<12
+}
+
+// sqMetadata collects the contents of a metadata table, which is stored as a
+// sequence of blocks of up to eight KiB.
+type sqMetadata struct {
+	out bytes.Buffer
+	buf []byte
+	// size is the number of bytes written to the table before compression
+	size int
+	zw   *sqCompressor
+}
+
+// ref returns the position of the next byte written to m as the start of the
+// current block in the table, shifted left by 16 bits, and the offset within
+// the uncompressed block.
+func (m *sqMetadata) ref() uint64 {
+	return uint64(m.out.Len())<<16 | uint64(len(m.buf))
+}
+
+func (m *sqMetadata) Write(p []byte) (int, error) {
+	n := len(p)
+	m.size += n
+	for len(p) > 0 {
+		c := min(len(p), sqMetadataSize-len(m.buf))
+		m.buf = append(m.buf, p[:c]...)
+		p = p[c:]
+		if len(m.buf) == sqMetadataSize {
+			m.flush()
+		}
+	}
+	return n, nil
+}
+
+func (m *sqMetadata) flush() {
+	if len(m.buf) == 0 {
+		return
+	}
+	data, compressed := m.zw.compress(m.buf)
+	header := uint16(len(data))
+	if !compressed {
+		header |= sqMetadataUncompressed
+	}
+	_ = binary.Write(&m.out, binary.LittleEndian, header)
+	m.out.Write(data)
+	m.buf = m.buf[:0]
+}
+
+// sqCompressor compresses blocks with zlib.
+type sqCompressor struct {
+	buf bytes.Buffer
+	zw  *zlib.Writer
+}
+
+// compress returns the compressed data and true if that is smaller than
+// data, and data and false otherwise.
+func (c *sqCompressor) compress(data []byte) ([]byte, bool) {
+	c.buf.Reset()
+	if c.zw == nil {
+		c.zw = zlib.NewWriter(&c.buf)
+	} else {
+		c.zw.Reset(&c.buf)
+	}
+	_, _ = c.zw.Write(data)
+	_ = c.zw.Close()
+	if c.buf.Len() >= len(data) {
+		return data, false
+	}
+	return c.buf.Bytes(), true
+}
+
+// squashfsWriter writes a squashfs image. The data blocks of the files are
+// written while the tree is received, all metadata is kept in memory and
+// written at the end.
+type squashfsWriter struct {
+	w     *countingWriter
+	zw    *sqCompressor
+	block []byte
+
+	root   *sqEntry
+	dirs   map[string]*sqEntry
+	links  map[hardlinkKey]*sqInode
+	inodes uint32
+
+	ids    []uint32
+	idIdx  map[uint32]uint16
+	mtime  time.Time
+	inode  *sqMetadata
+	dirTab *sqMetadata
+}
+
+func (d *Dumper) dumpSquashfs(ctx context.Context, ch <-chan *restic.Node, rootPath string) error {
+	seeker, ok := d.w.(io.WriteSeeker)
+	if !ok {
+		return errors.New("squashfs requires a seekable output")
+	}
+	base, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Errorf("squashfs requires a seekable output: %v", err)
+	}
+
+	zw := &sqCompressor{}
+	s := &squashfsWriter{
+		w:      &countingWriter{w: seeker},
+		zw:     zw,
+		block:  make([]byte, 0, sqBlockSize),
+		dirs:   make(map[string]*sqEntry),
+		links:  make(map[hardlinkKey]*sqInode),
+		idIdx:  make(map[uint32]uint16),
+		mtime:  time.Now(),
+		inode:  &sqMetadata{zw: zw},
+		dirTab: &sqMetadata{zw: zw},
+	}
+
+	// the superblock is written once the positions of all tables are known
+	if _, err := s.w.Write(make([]byte, sqSuperblockSize)); err != nil {
+		return err
+	}
+
+	s.root = s.newDir("")
+	s.dirs["/"] = s.root
+	if err := s.addParents(path.Clean(rootPath)); err != nil {
+		return err
+	}
+
+	for node := range ch {
+		if err := s.add(ctx, d, node); err != nil {
+			return err
+		}
+	}
+
+	superblock, err := s.writeTables()
+	if err != nil {
+		return err
+	}
+
+	// pad the image to a multiple of 4 KiB, which is required to use it as a
+	// loop device
+	size := s.w.n
+	if _, err := s.w.Write(make([]byte, (sqPadding-size%sqPadding)%sqPadding)); err != nil {
+		return err
+	}
+	if _, err := seeker.Seek(base, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(superblock); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(base+s.w.n, io.SeekStart)
+	return err
+}
+
+func (s *squashfsWriter) newDir(name string) *sqEntry {
+	s.inodes++
+	return &sqEntry{name: name, inode: &sqInode{number: s.inodes}}
+}
+
+// addParents adds the directories which contain the dumped tree.
+func (s *squashfsWriter) addParents(dir string) error {
+	if _, ok := s.dirs[dir]; ok {
+		return nil
+	}
+	if err := s.addParents(path.Dir(dir)); err != nil {
+		return err
+	}
+	entry := s.newDir(path.Base(dir))
+	return s.insert(dir, entry)
+}
+
+// insert adds entry at path p to the tree.
+func (s *squashfsWriter) insert(p string, entry *sqEntry) error {
+	if len(entry.name) == 0 || len(entry.name) > sqMaxName {
+		return errors.Errorf("invalid name %q for squashfs", entry.name)
+	}
+	parent, ok := s.dirs[path.Dir(p)]
+	if !ok {
+		return errors.Errorf("parent directory of %q is missing", p)
+	}
+	parent.children = append(parent.children, entry)
+	if entry.isDir() {
+		s.dirs[p] = entry
+	}
+	return nil
+}
+
+func (s *squashfsWriter) add(ctx context.Context, d *Dumper, node *restic.Node) error {
+	if _, ok := sqTypes[node.Type]; !ok && node.Type != restic.NodeTypeDir {
+		// squashfs cannot represent other types of nodes
+		return nil
+	}
+	entry := &sqEntry{name: node.Name, node: node}
+
+	key, isLink := hardlinkID(node)
+	if inode, ok := s.links[key]; isLink && ok {
+		// the content is only stored once for all links of a file
+		inode.nlink++
+		entry.inode = inode
+		return s.insert(node.Path, entry)
+	}
+
+	s.inodes++
+	entry.inode = &sqInode{number: s.inodes, nlink: 1}
+	if isLink {
+		s.links[key] = entry.inode
+	}
+	if err := s.insert(node.Path, entry); err != nil {
+		return err
+	}
+
+	if node.Type != restic.NodeTypeFile {
+		return nil
+	}
+	entry.inode.start = uint64(s.w.n)
+	dw := &sqDataWriter{s: s, inode: entry.inode}
+	if err := d.writeNode(ctx, dw, node); err != nil {
+		return err
+	}
+	if err := s.flushBlock(entry.inode); err != nil {
+		return err
+	}
+	if dw.n != node.Size {
+		return errors.Errorf("size of %q does not match, wrote %d bytes, expected %d", node.Path, dw.n, node.Size)
+	}
+	return nil
+}
+
+// sqDataWriter splits the data written to it into blocks.
+type sqDataWriter struct {
+	s     *squashfsWriter
+	inode *sqInode
+	n     uint64
+}
+
+func (w *sqDataWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.n += uint64(n)
+	for len(p) > 0 {
+		c := min(len(p), sqBlockSize-len(w.s.block))
+		w.s.block = append(w.s.block, p[:c]...)
+		p = p[c:]
+		if len(w.s.block) == sqBlockSize {
+			if err := w.s.flushBlock(w.inode); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flushBlock writes the current data block of inode. Blocks which only
+// contain zeros are stored as sparse blocks without data.
+func (s *squashfsWriter) flushBlock(inode *sqInode) error {
+	if len(s.block) == 0 {
+		return nil
+	}
+	defer func() {
+		s.block = s.block[:0]
+	}()
+
+	if isZero(s.block) {
+		inode.blocks = append(inode.blocks, 0)
+		inode.sparse += uint64(len(s.block))
+		return nil
+	}
+
+	data, compressed := s.zw.compress(s.block)
+	size := uint32(len(data))
+	if !compressed {
+		size |= sqBlockUncompressed
+	}
+	inode.blocks = append(inode.blocks, size)
+	_, err := s.w.Write(data)
+	return err
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// id returns the index of the user or group id in the id table.
+func (s *squashfsWriter) id(id uint32) (uint16, error) {
+	if idx, ok := s.idIdx[id]; ok {
+		return idx, nil
+	}
+	if len(s.ids) > math.MaxUint16 {
+		return 0, errors.New("too many user and group ids for squashfs")
+	}
+	idx := uint16(len(s.ids))
+	s.ids = append(s.ids, id)
+	s.idIdx[id] = idx
+	return idx, nil
+}
+
+// writeInodeHeader writes the header which is common to all inodes.
+func (s *squashfsWriter) writeInodeHeader(typ uint16, e *sqEntry) error {
+	var mode, uid, gid, mtime uint32 = 0o755, 0, 0, unixTime(s.mtime)
+	if e.node != nil {
+		mode, uid, gid, mtime = unixPermissions(e.node), e.node.UID, e.node.GID, unixTime(e.node.ModTime)
+	}
+	uidIdx, err := s.id(uid)
+	if err != nil {
+		return err
+	}
+	gidIdx, err := s.id(gid)
+	if err != nil {
+		return err
+	}
+	e.inode.ref = s.inode.ref()
+	e.inode.written = true
+	return binary.Write(s.inode, binary.LittleEndian, struct {
+		Type, Mode, UID, GID uint16
+		Mtime, Number        uint32
+	}{typ, uint16(mode), uidIdx, gidIdx, mtime, e.inode.number})
+}
+
+// writeFile writes the inode of a file, symlink, device, fifo or socket.
+func (s *squashfsWriter) writeFile(e *sqEntry) error {
+	switch typ := sqTypes[e.node.Type]; typ {
+	case sqTypeSymlink:
+		if err := s.writeInodeHeader(typ, e); err != nil {
+			return err
+		}
+		_ = binary.Write(s.inode, binary.LittleEndian, []uint32{e.inode.nlink, uint32(len(e.node.LinkTarget))})
+		_, _ = io.WriteString(s.inode, e.node.LinkTarget)
+		return nil
+	case sqTypeBlkDev, sqTypeChrDev:
+		if err := s.writeInodeHeader(typ, e); err != nil {
+			return err
+		}
+		return binary.Write(s.inode, binary.LittleEndian, []uint32{e.inode.nlink, sqDevice(e.node.Device)})
+	case sqTypeFifo, sqTypeSocket:
+		if err := s.writeInodeHeader(typ, e); err != nil {
+			return err
+		}
+		return binary.Write(s.inode, binary.LittleEndian, e.inode.nlink)
+	}
+
+	if err := s.writeInodeHeader(sqTypeExtFile, e); err != nil {
+		return err
+	}
+	_ = binary.Write(s.inode, binary.LittleEndian, struct {
+		Start, Size, Sparse                    uint64
+		Nlink, Fragment, FragmentOffset, Xattr uint32
+	}{e.inode.start, e.node.Size, e.inode.sparse, e.inode.nlink, sqInvalidFragment, 0, sqInvalidXattr})
+	return binary.Write(s.inode, binary.LittleEndian, e.inode.blocks)
+}
+
+// writeDir writes the inodes of all entries below dir, the directory listing
+// of dir and finally the inode of dir itself.
+func (s *squashfsWriter) writeDir(dir *sqEntry, parent uint32) error {
+	sort.Slice(dir.children, func(i, j int) bool {
+		return dir.children[i].name < dir.children[j].name
+	})
+
+	subdirs := uint32(0)
+	for _, e := range dir.children {
+		var err error
+		switch {
+		case e.isDir():
+			subdirs++
+			err = s.writeDir(e, dir.inode.number)
+		case !e.inode.written:
+			err = s.writeFile(e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	listing := s.dirTab.ref()
+	start := s.dirTab.size
+	s.writeListing(dir.children)
+	size := s.dirTab.size - start
+
+	if err := s.writeInodeHeader(sqTypeExtDir, dir); err != nil {
+		return err
+	}
+	// the size of a directory includes the entries "." and ".."
+	return binary.Write(s.inode, binary.LittleEndian, struct {
+		Nlink, Size, Start, Parent uint32
+		IndexCount, Offset         uint16
+		Xattr                      uint32
+	}{2 + subdirs, uint32(size + 3), uint32(listing >> 16), parent, 0, uint16(listing), sqInvalidXattr})
+}
+
+// writeListing writes the directory entries. Entries are grouped by the
+// metadata block of their inodes, each group starts with a header.
+func (s *squashfsWriter) writeListing(entries []*sqEntry) {
+	for len(entries) > 0 {
+		block := uint32(entries[0].inode.ref >> 16)
+		base := entries[0].inode.number
+
+		n := 1
+		for n < len(entries) && n < sqDirCount {
+			diff := int64(entries[n].inode.number) - int64(base)
+			if uint32(entries[n].inode.ref>>16) != block || diff < math.MinInt16 || diff > math.MaxInt16 {
+				break
+			}
+			n++
+		}
+
+		_ = binary.Write(s.dirTab, binary.LittleEndian, []uint32{uint32(n - 1), block, base})
+		for _, e := range entries[:n] {
+			typ := uint16(sqTypeDir)
+			if !e.isDir() {
+				typ = sqTypes[e.node.Type]
+			}
+			_ = binary.Write(s.dirTab, binary.LittleEndian, struct {
+				Offset uint16
+				Diff   int16
+				Type   uint16
+				Size   uint16
+			}{uint16(e.inode.ref), int16(int64(e.inode.number) - int64(base)), typ, uint16(len(e.name) - 1)})
+			_, _ = io.WriteString(s.dirTab, e.name)
+		}
+		entries = entries[n:]
+	}
+}
+
+// writeTables writes the inode, directory and id tables and returns the
+// superblock.
+func (s *squashfsWriter) writeTables() ([]byte, error) {
+	if err := s.writeDir(s.root, s.inodes+1); err != nil {
+		return nil, err
+	}
+	s.inode.flush()
+	s.dirTab.flush()
+
+	inodeStart := uint64(s.w.n)
+	if _, err := s.w.Write(s.inode.out.Bytes()); err != nil {
+		return nil, err
+	}
+	dirStart := uint64(s.w.n)
+	if _, err := s.w.Write(s.dirTab.out.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// the ids are stored in metadata blocks followed by the positions of
+	// these blocks
+	idTab := &sqMetadata{zw: s.zw}
+	var idIndex []uint64
+	for i, id := range s.ids {
+		if i%(sqMetadataSize/4) == 0 {
+			idIndex = append(idIndex, uint64(s.w.n)+uint64(idTab.out.Len()))
+		}
+		_ = binary.Write(idTab, binary.LittleEndian, id)
+		if (i+1)%(sqMetadataSize/4) == 0 {
+			idTab.flush()
+		}
+	}
+	idTab.flush()
+	if _, err := s.w.Write(idTab.out.Bytes()); err != nil {
+		return nil, err
+	}
+	idStart := uint64(s.w.n)
+	if err := binary.Write(s.w, binary.LittleEndian, idIndex); err != nil {
+		return nil, err
+	}
+
+	superblock := &bytes.Buffer{}
+	_ = binary.Write(superblock, binary.LittleEndian, struct {
+		Magic, Inodes, Mtime, BlockSize, Fragments      uint32
+		Compression, BlockLog, Flags, IDs, Major, Minor uint16
+		Root, BytesUsed, IDTable, XattrTable            uint64
+		InodeTable, DirTable, FragmentTable, Export     uint64
+	}{
+		sqMagic, s.inodes, unixTime(s.mtime), sqBlockSize, 0,
+		sqCompressionZlib, sqBlockLog, sqFlagNoFragments | sqFlagNoXattrs, uint16(len(s.ids)), 4, 0,
+		s.root.inode.ref, uint64(s.w.n), idStart, sqInvalidTable,
+		inodeStart, dirStart, sqInvalidTable, sqInvalidTable,
+	})
+	return superblock.Bytes(), nil
+}
@@ -0,0 +1,475 @@
+package dump
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestWriteSquashfs(t *testing.T) {
+	WriteTest(t, "squashfs", checkSquashfs)
+}
+
+func TestSquashfsNotSeekable(t *testing.T) {
+	ch := make(chan *restic.Node)
+	close(ch)
+
+	d := New("squashfs", repository.TestRepository(t), &bytes.Buffer{})
+	err := d.dumpSquashfs(context.Background(), ch, "/")
+	rtest.Assert(t, err != nil, "expected error for unseekable output")
+}
+
+type sqTestSuperblock struct {
+	Magic, Inodes, Mtime, BlockSize, Fragments      uint32
+	Compression, BlockLog, Flags, IDs, Major, Minor uint16
+	Root, BytesUsed, IDTable, XattrTable            uint64
+	InodeTable, DirTable, FragmentTable, Export     uint64
+}
+
+type sqTestChild struct {
+	name string
+	ref  uint64
+}
+
+type sqTestEntry struct {
+	typ, mode         uint16
+	uid, gid          uint32
+	mtime, number     uint32
+	nlink             uint32
+	rdev              uint32
+	target            string
+	content           []byte
+	sparse            uint64
+	children          []sqTestChild
+	parent, dirLength uint32
+}
+
+// sqTestReader reads a squashfs image written by dumpSquashfs.
+type sqTestReader struct {
+	image  []byte
+	sb     sqTestSuperblock
+	inodes sqTestTable
+	dirs   sqTestTable
+	ids    []uint32
+}
+
+// sqTestTable is an uncompressed metadata table. blocks maps the position of
+// each block in the image to the position in data.
+type sqTestTable struct {
+	data   []byte
+	blocks map[uint64]int
+}
+
+func (r *sqTestReader) readMetadata(start, end uint64) (sqTestTable, error) {
+	table := sqTestTable{blocks: make(map[uint64]int)}
+	for pos := start; pos < end; {
+		header := binary.LittleEndian.Uint16(r.image[pos:])
+		size := uint64(header &^ sqMetadataUncompressed)
+		data := r.image[pos+2 : pos+2+size]
+		if header&sqMetadataUncompressed == 0 {
+			var err error
+			data, err = sqTestDecompress(data)
+			if err != nil {
+				return table, err
+			}
+		}
+		if len(data) > sqMetadataSize {
+			return table, fmt.Errorf("metadata block at %d too large", pos)
+		}
+		table.blocks[pos-start] = len(table.data)
+		table.data = append(table.data, data...)
+		pos += 2 + size
+	}
+	return table, nil
+}
+
+func sqTestDecompress(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+func (t sqTestTable) at(ref uint64) ([]byte, error) {
+	pos, ok := t.blocks[ref>>16]
+	if !ok {
+		return nil, fmt.Errorf("invalid reference %x", ref)
+	}
+	return t.data[pos+int(ref&0xffff):], nil
+}
+
+func newSqTestReader(image []byte) (*sqTestReader, error) {
+	r := &sqTestReader{image: image}
+	if err := binary.Read(bytes.NewReader(image), binary.LittleEndian, &r.sb); err != nil {
+		return nil, err
+	}
+	sb := r.sb
+	if sb.Magic != sqMagic || sb.Major != 4 || sb.Minor != 0 || sb.BlockSize != 1<<sb.BlockLog {
+		return nil, fmt.Errorf("invalid superblock %+v", sb)
+	}
+	if len(image)%sqPadding != 0 || sb.BytesUsed > uint64(len(image)) {
+		return nil, fmt.Errorf("invalid image size %d", len(image))
+	}
+	if !(sb.InodeTable < sb.DirTable && sb.DirTable <= sb.IDTable && sb.IDTable < sb.BytesUsed) {
+		return nil, fmt.Errorf("invalid table positions %+v", sb)
+	}
+
+	var err error
+	if r.inodes, err = r.readMetadata(sb.InodeTable, sb.DirTable); err != nil {
+		return nil, err
+	}
+
+	idBlocks := (uint64(sb.IDs)*4 + sqMetadataSize - 1) / sqMetadataSize
+	if sb.IDTable+idBlocks*8 != sb.BytesUsed {
+		return nil, fmt.Errorf("invalid id table size")
+	}
+	idStart := binary.LittleEndian.Uint64(image[sb.IDTable:])
+	if r.dirs, err = r.readMetadata(sb.DirTable, idStart); err != nil {
+		return nil, err
+	}
+	ids, err := r.readMetadata(idStart, sb.IDTable)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(sb.IDs); i++ {
+		r.ids = append(r.ids, binary.LittleEndian.Uint32(ids.data[4*i:]))
+	}
+	return r, nil
+}
+
+func (r *sqTestReader) readInode(ref uint64) (*sqTestEntry, error) {
+	data, err := r.inodes.at(ref)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	e := &sqTestEntry{
+		typ:    le.Uint16(data),
+		mode:   le.Uint16(data[2:]),
+		uid:    r.ids[le.Uint16(data[4:])],
+		gid:    r.ids[le.Uint16(data[6:])],
+		mtime:  le.Uint32(data[8:]),
+		number: le.Uint32(data[12:]),
+	}
+	data = data[16:]
+
+	switch e.typ {
+	case sqTypeExtDir:
+		e.nlink = le.Uint32(data)
+		e.dirLength = le.Uint32(data[4:]) - 3
+		start, parent, offset := le.Uint32(data[8:]), le.Uint32(data[12:]), le.Uint16(data[18:])
+		e.parent = parent
+		if e.dirLength == 0 {
+			return e, nil
+		}
+		listing, err := r.dirs.at(uint64(start)<<16 | uint64(offset))
+		if err != nil {
+			return nil, err
+		}
+		for listing = listing[:e.dirLength]; len(listing) > 0; {
+			count, block, base := le.Uint32(listing)+1, le.Uint32(listing[4:]), le.Uint32(listing[8:])
+			listing = listing[12:]
+			for i := uint32(0); i < count; i++ {
+				size := int(le.Uint16(listing[6:])) + 1
+				name := string(listing[8 : 8+size])
+				ref := uint64(block)<<16 | uint64(le.Uint16(listing))
+				number := uint32(int64(base) + int64(int16(le.Uint16(listing[2:]))))
+				child, err := r.readInode(ref)
+				if err != nil {
+					return nil, err
+				}
+				if child.number != number {
+					return nil, fmt.Errorf("inode number of %v does not match", name)
+				}
+				e.children = append(e.children, sqTestChild{name, ref})
+				listing = listing[8+size:]
+			}
+		}
+	case sqTypeSymlink:
+		e.nlink = le.Uint32(data)
+		e.target = string(data[8 : 8+le.Uint32(data[4:])])
+	case sqTypeBlkDev, sqTypeChrDev:
+		e.nlink = le.Uint32(data)
+		e.rdev = le.Uint32(data[4:])
+	case sqTypeFifo, sqTypeSocket:
+		e.nlink = le.Uint32(data)
+	case sqTypeExtFile:
+		start, size, sparse := le.Uint64(data), le.Uint64(data[8:]), le.Uint64(data[16:])
+		e.nlink = le.Uint32(data[24:])
+		e.sparse = sparse
+		if le.Uint32(data[28:]) != sqInvalidFragment {
+			return nil, fmt.Errorf("unexpected fragment")
+		}
+		blocks := (size + uint64(r.sb.BlockSize) - 1) / uint64(r.sb.BlockSize)
+		pos := start
+		for i := uint64(0); i < blocks; i++ {
+			blockSize := le.Uint32(data[40+4*i:])
+			length := min(uint64(r.sb.BlockSize), size-uint64(len(e.content)))
+			if blockSize == 0 {
+				e.content = append(e.content, make([]byte, length)...)
+				sparse -= length
+				continue
+			}
+			block := r.image[pos : pos+uint64(blockSize&^sqBlockUncompressed)]
+			pos += uint64(len(block))
+			if blockSize&sqBlockUncompressed == 0 {
+				var err error
+				if block, err = sqTestDecompress(block); err != nil {
+					return nil, err
+				}
+			}
+			if uint64(len(block)) != length {
+				return nil, fmt.Errorf("block %d has length %d, want %d", i, len(block), length)
+			}
+			e.content = append(e.content, block...)
+		}
+		if sparse != 0 {
+			return nil, fmt.Errorf("sparse size of inode %d does not match the blocks", e.number)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected inode type %d", e.typ)
+	}
+	return e, nil
+}
+
+// entries reads all entries of the image.
+func (r *sqTestReader) entries() (map[string]*sqTestEntry, error) {
+	entries := make(map[string]*sqTestEntry)
+	var walk func(dir string, ref uint64, parent uint32) error
+	walk = func(dir string, ref uint64, parent uint32) error {
+		e, err := r.readInode(ref)
+		if err != nil {
+			return err
+		}
+		if e.typ == sqTypeExtDir && e.parent != parent {
+			return fmt.Errorf("parent of %v does not match, got %d, want %d", dir, e.parent, parent)
+		}
+		entries[dir] = e
+		for i, child := range e.children {
+			if i > 0 && e.children[i-1].name >= child.name {
+				return fmt.Errorf("entries of %v are not sorted", dir)
+			}
+			if err := walk(path.Join(dir, child.name), child.ref, e.number); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("/", r.sb.Root, r.sb.Inodes+1); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func checkSquashfs(t *testing.T, testDir string, srcImage *bytes.Buffer) error {
+	r, err := newSqTestReader(srcImage.Bytes())
+	if err != nil {
+		return err
+	}
+
+	entries, err := r.entries()
+	if err != nil {
+		return err
+	}
+
+	inodes := make(map[uint32]int)
+	for _, e := range entries {
+		inodes[e.number]++
+	}
+	if len(inodes) != int(r.sb.Inodes) {
+		return fmt.Errorf("number of inodes does not match, got %d, want %d", len(inodes), r.sb.Inodes)
+	}
+
+	links, err := linkCounts(testDir)
+	if err != nil {
+		return err
+	}
+
+	files := 0
+	err = filepath.Walk(testDir, func(name string, match os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == testDir {
+			return nil
+		}
+		files++
+
+		relPath, err := filepath.Rel(testDir, name)
+		if err != nil {
+			return err
+		}
+		e, ok := entries[path.Join("/", filepath.ToSlash(relPath))]
+		if !ok {
+			return fmt.Errorf("%v is missing", relPath)
+		}
+
+		if int64(e.mtime) != match.ModTime().Unix() {
+			return fmt.Errorf("modTime of %v does not match, got: %v, want: %v", relPath, e.mtime, match.ModTime().Unix())
+		}
+		if os.FileMode(e.mode) != match.Mode().Perm() {
+			return fmt.Errorf("mode of %v does not match, got: %o, want: %v", relPath, e.mode, match.Mode())
+		}
+
+		switch {
+		case match.IsDir():
+			if e.typ != sqTypeExtDir {
+				return fmt.Errorf("%v should be a directory", relPath)
+			}
+		case match.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			if e.typ != sqTypeSymlink || e.target != target {
+				return fmt.Errorf("symlink target does not match, got %s want %s", e.target, target)
+			}
+		default:
+			want, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			if e.typ != sqTypeExtFile || !bytes.Equal(e.content, want) {
+				return fmt.Errorf("contents of %v does not match", relPath)
+			}
+			if int(e.nlink) != inodes[e.number] || int(e.nlink) != links[filepath.ToSlash(relPath)] {
+				return fmt.Errorf("link count of %v does not match, got %d, want %d", relPath, e.nlink, links[filepath.ToSlash(relPath)])
+			}
+
+			// blocks which only contain zeros are stored as sparse blocks
+			sparse := uint64(0)
+			for i := 0; i < len(want); i += sqBlockSize {
+				block := want[i:min(i+sqBlockSize, len(want))]
+				if isZero(block) {
+					sparse += uint64(len(block))
+				}
+			}
+			if e.sparse != sparse {
+				return fmt.Errorf("%v has %d sparse bytes, want %d", relPath, e.sparse, sparse)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the image additionally contains the root directory
+	if len(entries) != files+1 {
+		return fmt.Errorf("not the same amount of files got %v want %v", len(entries)-1, files)
+	}
+	return nil
+}
+
+// dumpSpecialFiles returns a squashfs image of a tree which contains devices,
+// a fifo and a socket.
+func dumpSpecialFiles(t *testing.T) []byte {
+	ctx := context.Background()
+	repo := repository.TestRepository(t)
+	mtime := time.Unix(1700000000, 0)
+
+	var wg errgroup.Group
+	repo.StartPackUploader(ctx, &wg)
+	dev := restic.NewTree(2)
+	rtest.OK(t, dev.Insert(&restic.Node{Name: "null", Type: restic.NodeTypeCharDev, Mode: os.ModeDevice | os.ModeCharDevice | 0o666, ModTime: mtime, Device: 1<<8 | 3}))
+	rtest.OK(t, dev.Insert(&restic.Node{Name: "sda", Type: restic.NodeTypeDev, Mode: os.ModeDevice | 0o660, ModTime: mtime, GID: 6, Device: 8 << 8}))
+	devID, err := restic.SaveTree(ctx, repo, dev)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(ctx))
+
+	tree := restic.NewTree(3)
+	rtest.OK(t, tree.Insert(&restic.Node{Name: "dev", Type: restic.NodeTypeDir, Mode: os.ModeDir | 0o755, ModTime: mtime, Subtree: &devID}))
+	rtest.OK(t, tree.Insert(&restic.Node{Name: "fifo", Type: restic.NodeTypeFifo, Mode: os.ModeNamedPipe | 0o644, ModTime: mtime}))
+	rtest.OK(t, tree.Insert(&restic.Node{Name: "socket", Type: restic.NodeTypeSocket, Mode: os.ModeSocket | 0o755, ModTime: mtime}))
+
+	dst := &seekableBuffer{}
+	rtest.OK(t, New("squashfs", repo, dst).DumpTree(ctx, tree, "/"))
+	return dst.buf
+}
+
+func TestSquashfsSpecialFiles(t *testing.T) {
+	r, err := newSqTestReader(dumpSpecialFiles(t))
+	rtest.OK(t, err)
+	entries, err := r.entries()
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		path string
+		typ  uint16
+		mode uint16
+		gid  uint32
+		rdev uint32
+	}{
+		{"/dev/null", sqTypeChrDev, 0o666, 0, 1<<8 | 3},
+		{"/dev/sda", sqTypeBlkDev, 0o660, 6, 8 << 8},
+		{"/fifo", sqTypeFifo, 0o644, 0, 0},
+		{"/socket", sqTypeSocket, 0o755, 0, 0},
+	} {
+		e, ok := entries[test.path]
+		rtest.Assert(t, ok, "%v is missing", test.path)
+		rtest.Equals(t, test.typ, e.typ)
+		rtest.Equals(t, test.mode, e.mode)
+		rtest.Equals(t, test.gid, e.gid)
+		rtest.Equals(t, test.rdev, e.rdev)
+		rtest.Equals(t, uint32(1), e.nlink)
+	}
+}
+
+func TestSqDevice(t *testing.T) {
+	// major 0x123 and minor 0x45678
+	rtest.Equals(t, uint32(0x45612378), sqDevice(0x45612378))
+	// the kernel encoding has no room for the upper bits of the major number
+	rtest.Equals(t, uint32(0x0103), sqDevice(0x1000000103))
+	rtest.Equals(t, uint32(0x0103), sqDevice(0x0103))
+}
+
+// TestSquashfsUnsquashfs checks the image against the reference implementation
+// if it is installed.
+func TestSquashfsUnsquashfs(t *testing.T) {
+	unsquashfs, err := exec.LookPath("unsquashfs")
+	if err != nil {
+		t.Skip("unsquashfs is not available")
+	}
+
+	image := filepath.Join(t.TempDir(), "image.sqfs")
+	rtest.OK(t, os.WriteFile(image, dumpSpecialFiles(t), 0o600))
+
+	out, err := exec.Command(unsquashfs, "-lls", "-n", image).CombinedOutput()
+	rtest.OK(t, err)
+
+	lines := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[len(fields)-1], "squashfs-root/") {
+			lines[strings.TrimPrefix(fields[len(fields)-1], "squashfs-root")] = line
+		}
+	}
+	for name, want := range map[string]string{
+		"/dev":      "drwxr-xr-x",
+		"/dev/null": "crw-rw-rw-",
+		"/dev/sda":  "brw-rw----",
+		"/fifo":     "prw-r--r--",
+		"/socket":   "srwxr-xr-x",
+	} {
+		line, ok := lines[name]
+		rtest.Assert(t, ok, "%v is missing in output %q", name, out)
+		rtest.Assert(t, strings.HasPrefix(line, want), "unexpected entry for %v: %q", name, line)
+	}
+	rtest.Assert(t, strings.Contains(lines["/dev/null"], "1,  3") || strings.Contains(lines["/dev/null"], "1, 3"),
+		"unexpected device number for /dev/null: %q", lines["/dev/null"])
+}
@@ -4,7 +4,6 @@ import (
 	"archive/tar"
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/restic/restic/internal/debug"
@@ -49,15 +48,30 @@ func tarIdentifier(id uint32) int {
 }
 
 func (d *Dumper) dumpNodeTar(ctx context.Context, node *restic.Node, w *tar.Writer) error {
-	relPath, err := filepath.Rel("/", node.Path)
+	header, err := tarHeader(node)
 	if err != nil {
 		return err
 	}
+	header.PAXRecords = parseXattrs(node.ExtendedAttributes)
+
+	err = w.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("writing header for %q: %w", node.Path, err)
+	}
+	return d.writeNode(ctx, w, node)
+}
+
+// tarHeader returns the tar header for node without extended attributes.
+func tarHeader(node *restic.Node) (*tar.Header, error) {
+	relPath, err := filepath.Rel("/", node.Path)
+	if err != nil {
+		return nil, err
+	}
 
 	header := &tar.Header{
 		Name:       filepath.ToSlash(relPath),
 		Size:       int64(node.Size),
-		Mode:       int64(node.Mode.Perm()), // cIS* constants are added later
+		Mode:       int64(unixPermissions(node)),
 		Uid:        tarIdentifier(node.UID),
 		Gid:        tarIdentifier(node.GID),
 		Uname:      node.User,
@@ -65,18 +79,6 @@ func (d *Dumper) dumpNodeTar(ctx context.Context, node *restic.Node, w *tar.Writ
 		ModTime:    node.ModTime,
 		AccessTime: node.AccessTime,
 		ChangeTime: node.ChangeTime,
-		PAXRecords: parseXattrs(node.ExtendedAttributes),
-	}
-
-	// adapted from archive/tar.FileInfoHeader
-	if node.Mode&os.ModeSetuid != 0 {
-		header.Mode |= cISUID
-	}
-	if node.Mode&os.ModeSetgid != 0 {
-		header.Mode |= cISGID
-	}
-	if node.Mode&os.ModeSticky != 0 {
-		header.Mode |= cISVTX
 	}
 
 	if node.Type == restic.NodeTypeFile {
@@ -93,11 +95,7 @@ func (d *Dumper) dumpNodeTar(ctx context.Context, node *restic.Node, w *tar.Writ
 		header.Name += "/"
 	}
 
-	err = w.WriteHeader(header)
-	if err != nil {
-		return fmt.Errorf("writing header for %q: %w", node.Path, err)
-	}
-	return d.writeNode(ctx, w, node)
+	return header, nil
 }
 
 func parseXattrs(xattrs []restic.ExtendedAttribute) map[string]string {
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -21,7 +23,21 @@ func TestWriteTar(t *testing.T) {
 	WriteTest(t, "tar", checkTar)
 }
 
+func TestWritePax(t *testing.T) {
+	WriteTest(t, "pax", checkPax)
+}
+
 func checkTar(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
+	return checkTarArchive(t, testDir, srcTar, false)
+}
+
+func checkPax(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
+	return checkTarArchive(t, testDir, srcTar, true)
+}
+
+// checkTarArchive compares the archive with the files in testDir. A pax
+// archive stores exact timestamps and hardlinks.
+func checkTarArchive(t *testing.T, testDir string, srcTar *bytes.Buffer, pax bool) error {
 	tr := tar.NewReader(srcTar)
 
 	fileNumber := 0
@@ -57,6 +73,9 @@ func checkTar(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
 
 		// check metadata, tar header contains time rounded to seconds
 		fileTime := match.ModTime().Round(time.Second)
+		if pax {
+			fileTime = match.ModTime()
+		}
 		tarTime := hdr.ModTime
 		if !fileTime.Equal(tarTime) {
 			return fmt.Errorf("modTime does not match, got: %s, want: %s", fileTime, tarTime)
@@ -81,6 +100,17 @@ func checkTar(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
 			if !strings.HasSuffix(hdr.Name, "/") {
 				return fmt.Errorf("foldernames must end with separator got %v", hdr.Name)
 			}
+		case tar.TypeLink:
+			if !pax {
+				return fmt.Errorf("unexpected hardlink %v", hdr.Name)
+			}
+			target, err := os.Lstat(filepath.Join(testDir, hdr.Linkname))
+			if err != nil {
+				return err
+			}
+			if !os.SameFile(target, match) {
+				return fmt.Errorf("hardlink %v does not point to the same file as %v", hdr.Name, hdr.Linkname)
+			}
 		case tar.TypeSymlink:
 			target, err := os.Readlink(matchPath)
 			if err != nil {
@@ -141,3 +171,59 @@ func TestFieldTooLong(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), node.Path),
 		"no filename in %q", err)
 }
+
+func TestPaxAttributes(t *testing.T) {
+	nodes := []*restic.Node{
+		{
+			Name: "file",
+			Path: "/file",
+			Type: restic.NodeTypeFile,
+			Mode: 0644,
+			ExtendedAttributes: []restic.ExtendedAttribute{
+				{Name: "user.binary", Value: []byte{0, 1, 2, 0xff}},
+				{Name: "system.posix_acl_access", Value: []byte{2, 0, 0, 0, 1, 0, 6, 0, 0xff, 0xff, 0xff, 0xff}},
+			},
+			GenericAttributes: map[restic.GenericAttributeType]json.RawMessage{
+				restic.TypeCreationTime: json.RawMessage(`"AQIDBAUGBwg="`),
+			},
+			Links: 2,
+			Inode: 42,
+		},
+		{
+			Name:  "link",
+			Path:  "/link",
+			Type:  restic.NodeTypeFile,
+			Mode:  0644,
+			Links: 2,
+			Inode: 42,
+		},
+	}
+
+	ch := make(chan *restic.Node, len(nodes))
+	for _, node := range nodes {
+		ch <- node
+	}
+	close(ch)
+
+	buf := &bytes.Buffer{}
+	d := New("pax", repository.TestRepository(t), buf)
+	rtest.OK(t, d.dumpPax(context.Background(), ch))
+
+	tr := tar.NewReader(buf)
+	hdr, err := tr.Next()
+	rtest.OK(t, err)
+	rtest.Equals(t, "file", hdr.Name)
+	rtest.Equals(t, "\x00\x01\x02\xff", hdr.PAXRecords["SCHILY.xattr.user.binary"])
+	rtest.Equals(t, "\x02\x00\x00\x00\x01\x00\x06\x00\xff\xff\xff\xff", hdr.PAXRecords["SCHILY.xattr.system.posix_acl_access"])
+	rtest.Equals(t, "user::rw-\n", hdr.PAXRecords["SCHILY.acl.access"])
+	rtest.Equals(t, `"AQIDBAUGBwg="`, hdr.PAXRecords["RESTIC.generic.windows.creation_time"])
+
+	hdr, err = tr.Next()
+	rtest.OK(t, err)
+	rtest.Equals(t, "link", hdr.Name)
+	rtest.Equals(t, byte(tar.TypeLink), hdr.Typeflag)
+	rtest.Equals(t, "file", hdr.Linkname)
+
+	_, err = tr.Next()
+	rtest.Equals(t, io.EOF, err)
+}
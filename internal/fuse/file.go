@@ -6,6 +6,7 @@ package fuse
 import (
 	"context"
 	"sort"
+	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -20,6 +21,7 @@ const blockSize = 512
 
 // Statically ensure that *file and *openFile implement the given interfaces
 var _ = fs.HandleReader(&openFile{})
+var _ = fs.HandleReleaser(&openFile{})
 var _ = fs.NodeForgetter(&file{})
 var _ = fs.NodeGetxattrer(&file{})
 var _ = fs.NodeListxattrer(&file{})
@@ -36,6 +38,19 @@ type openFile struct {
 	file
 	// cumsize[i] holds the cumulative size of blobs[:i].
 	cumsize []uint64
+
+	// ctx is cancelled when the file is released, it stops the read-ahead.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	m sync.Mutex
+	// next is the offset following the previous read.
+	next uint64
+	// blobs before index prefetched are loaded or being loaded by readAhead.
+	prefetched int
+	// inflight contains a channel for each blob loaded by readAhead, it is
+	// closed once the blob is available.
+	inflight map[restic.ID]chan struct{}
 }
 
 func newFile(root *Root, forget forgetFn, inode uint64, node *restic.Node) (fusefile *file, err error) {
@@ -88,7 +103,8 @@ func (f *file) Open(ctx context.Context, _ *fuse.OpenRequest, _ *fuse.OpenRespon
 		cumsize[i+1] = bytes
 	}
 
-	var of = openFile{file: *f}
+	var of = openFile{file: *f, inflight: make(map[restic.ID]chan struct{})}
+	of.ctx, of.cancel = context.WithCancel(context.Background())
 
 	if bytes != f.node.Size {
 		debug.Log("sizes do not match: node.Size %v != size %v, using real size", f.node.Size, bytes)
@@ -103,8 +119,24 @@ func (f *file) Open(ctx context.Context, _ *fuse.OpenRequest, _ *fuse.OpenRespon
 }
 
 func (f *openFile) getBlobAt(ctx context.Context, i int) (blob []byte, err error) {
-	blob, err = f.root.blobCache.GetOrCompute(f.node.Content[i], func() ([]byte, error) {
-		return f.root.repo.LoadBlob(ctx, restic.DataBlob, f.node.Content[i], nil)
+	id := f.node.Content[i]
+
+	// wait for the read-ahead instead of loading the blob a second time
+	f.m.Lock()
+	ch := f.inflight[id]
+	f.m.Unlock()
+	if ch != nil {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return nil, unwrapCtxCanceled(ctx.Err())
+		}
+	}
+
+	blob, err = f.root.blobCache.GetOrCompute(id, func() ([]byte, error) {
+		return f.root.cfg.BlobCache.Load(id, func() ([]byte, error) {
+			return f.root.repo.LoadBlob(ctx, restic.DataBlob, id, nil)
+		})
 	})
 	if err != nil {
 		debug.Log("LoadBlob(%v, %v) failed: %v", f.node.Name, f.node.Content[i], err)
@@ -133,6 +165,8 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	})
 	offset -= f.cumsize[startContent]
 
+	f.readAhead(uint64(req.Offset), uint64(req.Offset)+uint64(req.Size))
+
 	dst := resp.Data[0:req.Size]
 	readBytes := 0
 	remainingBytes := req.Size
@@ -167,6 +201,126 @@ func (f *openFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.R
 	return nil
 }
 
+// readAhead is called for each read of the range [start, end). Once the file
+// is read sequentially, it loads the blobs within the next cfg.ReadAhead bytes
+// in the background. The blobs are loaded in batches, such that blobs stored
+// in the same pack file are downloaded with a single request.
+func (f *openFile) readAhead(start, end uint64) {
+	size := uint64(f.root.cfg.ReadAhead)
+	if size == 0 {
+		return
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	// the kernel may issue several reads at once which then arrive slightly
+	// out of order
+	sequential := start <= f.next && f.next <= start+size
+	if !sequential {
+		f.next = end
+		f.prefetched = 0
+		return
+	}
+	if end > f.next {
+		f.next = end
+	}
+	end = f.next
+
+	// skip blobs which are loaded by the reads themselves
+	first := sort.Search(len(f.node.Content), func(i int) bool {
+		return f.cumsize[i] >= end
+	})
+	if f.prefetched < first {
+		f.prefetched = first
+	}
+	// only start a new batch once half of the previous one was read
+	if f.cumsize[f.prefetched] >= end+size/2 {
+		return
+	}
+
+	var ids restic.IDs
+	for ; f.prefetched < len(f.node.Content) && f.cumsize[f.prefetched] < end+size; f.prefetched++ {
+		id := f.node.Content[f.prefetched]
+		if _, ok := f.inflight[id]; ok {
+			continue
+		}
+		if _, ok := f.root.blobCache.Get(id); ok {
+			continue
+		}
+		f.inflight[id] = make(chan struct{})
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		go f.prefetch(ids)
+	}
+}
+
+// prefetch loads the blobs ids into the blob caches.
+func (f *openFile) prefetch(ids restic.IDs) {
+	defer func() {
+		// the remaining blobs could not be loaded, let Read try again
+		for _, id := range ids {
+			f.finishPrefetch(id)
+		}
+	}()
+
+	packs := make(map[restic.ID][]restic.Blob)
+	for _, id := range ids {
+		if blob, ok := f.root.cfg.BlobCache.Get(id); ok {
+			f.root.blobCache.Add(id, blob)
+			f.finishPrefetch(id)
+			continue
+		}
+
+		pbs := f.root.repo.LookupBlob(restic.DataBlob, id)
+		if len(pbs) == 0 {
+			continue
+		}
+		pb := pbs[0]
+		packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+	}
+
+	for packID, blobs := range packs {
+		err := f.root.repo.LoadBlobsFromPack(f.ctx, packID, blobs, func(h restic.BlobHandle, buf []byte, err error) error {
+			if err != nil {
+				debug.Log("read-ahead of blob %v failed: %v", h.ID, err)
+				return nil
+			}
+
+			// buf is reused by LoadBlobsFromPack
+			blob := append([]byte(nil), buf...)
+			f.root.blobCache.Add(h.ID, blob)
+			if err := f.root.cfg.BlobCache.Add(h.ID, blob); err != nil {
+				debug.Log("unable to add blob %v to cache: %v", h.ID, err)
+			}
+			f.finishPrefetch(h.ID)
+			return nil
+		})
+		if err != nil {
+			debug.Log("read-ahead from pack %v failed: %v", packID, err)
+		}
+		if f.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// finishPrefetch wakes up the reads waiting for blob id.
+func (f *openFile) finishPrefetch(id restic.ID) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if ch, ok := f.inflight[id]; ok {
+		close(ch)
+		delete(f.inflight, id)
+	}
+}
+
+func (f *openFile) Release(_ context.Context, _ *fuse.ReleaseRequest) error {
+	f.cancel()
+	return nil
+}
+
 func (f *file) Listxattr(_ context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
 	nodeToXattrList(f.node, req, resp)
 	return nil
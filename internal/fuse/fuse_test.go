@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/blobcache"
 	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -147,6 +148,57 @@ func TestFuseFile(t *testing.T) {
 	}
 }
 
+func TestFuseFileReadAhead(t *testing.T) {
+	repo := repository.TestRepository(t)
+
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	restic.TestCreateSnapshot(t, repo, timestamp, 2)
+
+	sn := loadFirstSnapshot(t, repo)
+	tree := loadTree(t, repo, *sn.Tree)
+
+	node := &restic.Node{Name: "foo", Mode: 0644}
+	for _, n := range tree.Nodes {
+		node.Content = append(node.Content, n.Content...)
+		node.Size += n.Size
+	}
+
+	diskCache, err := blobcache.New(t.TempDir(), repo.Key(), 1<<30)
+	rtest.OK(t, err)
+	cfg := Config{BlobCache: diskCache, ReadAhead: int64(node.Size)}
+	root := &Root{repo: repo, cfg: cfg, blobCache: bloblru.New(blobCacheSize)}
+
+	f, err := newFile(root, func() {}, inodeFromNode(1, node), node)
+	rtest.OK(t, err)
+	h, err := f.Open(context.TODO(), nil, nil)
+	rtest.OK(t, err)
+	of := h.(*openFile)
+
+	// the first read loads the remaining blobs in the background
+	testRead(t, of, 0, 1, make([]byte, 1))
+	for i := 0; ; i++ {
+		of.m.Lock()
+		n := len(of.inflight)
+		of.m.Unlock()
+		if n == 0 {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("read-ahead did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, id := range node.Content {
+		_, ok := root.blobCache.Get(id)
+		rtest.Assert(t, ok, "blob %v was not loaded", id.Str())
+		_, ok = diskCache.Get(id)
+		rtest.Assert(t, ok, "blob %v was not added to the blob cache", id.Str())
+	}
+	rtest.OK(t, of.Release(context.TODO(), nil))
+}
+
 func TestFuseDir(t *testing.T) {
 	repo := repository.TestRepository(t)
 
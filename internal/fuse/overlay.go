@@ -0,0 +1,892 @@
+package fuse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Overlay records changes to a snapshot in a local scratch directory. New
+// and modified files are stored in the subdirectory "upper" of the scratch
+// directory, entries of the snapshot which were removed are recorded as
+// whiteouts. Everything else is read from the repository.
+//
+// Paths within the overlay are relative to the root of the snapshot and use
+// slashes as separator, the root directory itself is "".
+type Overlay struct {
+	repo restic.Repository
+	dir  string
+
+	m       sync.Mutex
+	sn      *restic.Snapshot
+	deleted map[string]struct{}
+	trees   map[restic.ID]*restic.Tree
+}
+
+// overlayState is saved in the scratch directory, such that changes can be
+// committed after restic was interrupted.
+type overlayState struct {
+	Parent  restic.ID `json:"parent"`
+	Deleted []string  `json:"deleted,omitempty"`
+}
+
+const overlayStateFile = "overlay.json"
+
+// downloadPrefix is the prefix of the temporary files used while copying a
+// file of the snapshot to the scratch directory.
+const downloadPrefix = "download-"
+
+// NewOverlay returns an overlay for sn which stores changes in the scratch
+// directory dir. Changes left in dir by an earlier run for the same snapshot
+// are kept.
+func NewOverlay(repo restic.Repository, sn *restic.Snapshot, dir string) (*Overlay, error) {
+	o := &Overlay{
+		repo:    repo,
+		dir:     dir,
+		sn:      sn,
+		deleted: make(map[string]struct{}),
+		trees:   make(map[restic.ID]*restic.Tree),
+	}
+
+	buf, err := os.ReadFile(filepath.Join(dir, overlayStateFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		entries, err := os.ReadDir(o.upperPath(""))
+		if err == nil && len(entries) > 0 {
+			return nil, errors.Errorf("scratch directory %v contains changes of an unknown snapshot", dir)
+		}
+	case err != nil:
+		return nil, errors.WithStack(err)
+	default:
+		var state overlayState
+		if err := json.Unmarshal(buf, &state); err != nil {
+			return nil, errors.Wrap(err, "Unmarshal")
+		}
+		if !state.Parent.Equal(*sn.ID()) {
+			return nil, errors.Errorf("scratch directory %v contains changes of snapshot %v", dir, state.Parent.Str())
+		}
+		for _, p := range state.Deleted {
+			o.deleted[p] = struct{}{}
+		}
+	}
+
+	if err := os.MkdirAll(o.upperPath(""), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// remove incomplete downloads of an interrupted run
+	downloads, _ := filepath.Glob(filepath.Join(dir, downloadPrefix+"*"))
+	for _, name := range downloads {
+		_ = os.Remove(name)
+	}
+	return o, o.saveState()
+}
+
+// Snapshot returns the snapshot the changes are based on.
+func (o *Overlay) Snapshot() *restic.Snapshot {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.sn
+}
+
+func (o *Overlay) saveState() error {
+	state := overlayState{Parent: *o.sn.ID()}
+	for p := range o.deleted {
+		state.Deleted = append(state.Deleted, p)
+	}
+	sort.Strings(state.Deleted)
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+	return errors.WithStack(os.WriteFile(filepath.Join(o.dir, overlayStateFile), buf, 0600))
+}
+
+func (o *Overlay) upperPath(p string) string {
+	return filepath.Join(o.dir, "upper", filepath.FromSlash(p))
+}
+
+func parentPath(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// hidden reports whether the entry p of the snapshot, or one of its parent
+// directories, was removed.
+func (o *Overlay) hidden(p string) bool {
+	for ; p != ""; p = parentPath(p) {
+		if _, ok := o.deleted[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWhiteoutBelow reports whether an entry within the directory p was
+// removed.
+func (o *Overlay) hasWhiteoutBelow(p string) bool {
+	for q := range o.deleted {
+		if p == "" || strings.HasPrefix(q, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Overlay) loadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	if tree, ok := o.trees[id]; ok {
+		return tree, nil
+	}
+	tree, err := restic.LoadTree(ctx, o.repo, id)
+	if err != nil {
+		return nil, err
+	}
+	o.trees[id] = tree
+	return tree, nil
+}
+
+// baseNode returns the node for p in the snapshot, or nil if it does not
+// exist or was removed.
+func (o *Overlay) baseNode(ctx context.Context, p string) (*restic.Node, error) {
+	node := &restic.Node{
+		Type:       restic.NodeTypeDir,
+		Mode:       os.ModeDir | 0755,
+		AccessTime: o.sn.Time,
+		ModTime:    o.sn.Time,
+		ChangeTime: o.sn.Time,
+		Subtree:    o.sn.Tree,
+	}
+	if p == "" {
+		return node, nil
+	}
+	if o.hidden(p) {
+		return nil, nil
+	}
+
+	for _, name := range strings.Split(p, "/") {
+		if node.Type != restic.NodeTypeDir || node.Subtree == nil {
+			return nil, nil
+		}
+		tree, err := o.loadTree(ctx, *node.Subtree)
+		if err != nil {
+			return nil, err
+		}
+		node = tree.Find(name)
+		if node == nil {
+			return nil, nil
+		}
+	}
+	return node, nil
+}
+
+// upperNode returns the node for p in the scratch directory, or nil if it
+// does not exist. Ownership and extended attributes cannot be changed in the
+// overlay, they are taken from the snapshot.
+func (o *Overlay) upperNode(ctx context.Context, p string) (*restic.Node, error) {
+	filename := o.upperPath(p)
+	if _, err := os.Lstat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	f, err := fs.Local{}.OpenFile(filename, fs.O_NOFOLLOW, true)
+	if err != nil {
+		return nil, err
+	}
+	node, err := f.ToNode(true)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	node.Path = ""
+	// like backup without --with-atime
+	node.AccessTime = node.ModTime
+
+	base, err := o.baseNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	node.ExtendedAttributes = nil
+	if base != nil && base.Type == node.Type {
+		node.UID, node.GID = base.UID, base.GID
+		node.User, node.Group = base.User, base.Group
+		node.ExtendedAttributes = base.ExtendedAttributes
+		node.GenericAttributes = base.GenericAttributes
+	}
+	return node, nil
+}
+
+func (o *Overlay) lookup(ctx context.Context, p string) (node *restic.Node, upper bool, err error) {
+	if p != "" {
+		node, err = o.upperNode(ctx, p)
+		if err != nil || node != nil {
+			return node, node != nil, err
+		}
+	}
+	node, err = o.baseNode(ctx, p)
+	return node, false, err
+}
+
+// Lookup returns the node for p, or nil if it does not exist. upper is true
+// if the node is stored in the scratch directory.
+func (o *Overlay) Lookup(ctx context.Context, p string) (node *restic.Node, upper bool, err error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.lookup(ctx, p)
+}
+
+type overlayEntry struct {
+	node  *restic.Node
+	upper bool
+}
+
+// readDir returns the entries of the directory p sorted by name. Entries in
+// the scratch directory replace those of the snapshot.
+func (o *Overlay) readDir(ctx context.Context, p string) ([]overlayEntry, error) {
+	entries := make(map[string]overlayEntry)
+
+	upperDir := true
+	if fi, err := os.Lstat(o.upperPath(p)); err == nil {
+		upperDir = fi.IsDir()
+	}
+
+	base, err := o.baseNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if upperDir && base != nil && base.Type == restic.NodeTypeDir && base.Subtree != nil {
+		tree, err := o.loadTree(ctx, *base.Subtree)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range tree.Nodes {
+			if _, ok := o.deleted[path.Join(p, node.Name)]; ok {
+				continue
+			}
+			entries[node.Name] = overlayEntry{node: node}
+		}
+	}
+
+	f, err := os.Open(o.upperPath(p))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		names, err := f.Readdirnames(-1)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			node, err := o.upperNode(ctx, path.Join(p, name))
+			if err != nil {
+				return nil, err
+			}
+			if node != nil {
+				entries[name] = overlayEntry{node: node, upper: true}
+			}
+		}
+	}
+
+	result := make([]overlayEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].node.Name < result[j].node.Name
+	})
+	return result, nil
+}
+
+// ReadDir returns the nodes in the directory p sorted by name.
+func (o *Overlay) ReadDir(ctx context.Context, p string) ([]*restic.Node, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	entries, err := o.readDir(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*restic.Node, 0, len(entries))
+	for _, e := range entries {
+		nodes = append(nodes, e.node)
+	}
+	return nodes, nil
+}
+
+// withinUpperDir runs fn, which creates an entry in the directory dir of the
+// scratch directory, without modifying the permissions and timestamps of dir.
+func withinUpperDir(dir string, fn func() error) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0700 != 0700 {
+		if err := os.Chmod(dir, fi.Mode()|0700); err != nil {
+			return err
+		}
+	}
+
+	err = fn()
+
+	if fi.Mode().Perm()&0700 != 0700 {
+		err = errors.Join(err, os.Chmod(dir, fi.Mode()))
+	}
+	return errors.Join(err, os.Chtimes(dir, fi.ModTime(), fi.ModTime()))
+}
+
+func nodePerm(node *restic.Node) os.FileMode {
+	return node.Mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// ensureUpperDir creates the directory p and its parents in the scratch
+// directory, using the metadata from the snapshot.
+func (o *Overlay) ensureUpperDir(ctx context.Context, p string) error {
+	filename := o.upperPath(p)
+	fi, err := os.Lstat(filename)
+	if err == nil {
+		if !fi.IsDir() {
+			return syscall.ENOTDIR
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if p == "" {
+		return os.MkdirAll(filename, 0700)
+	}
+
+	node, err := o.baseNode(ctx, p)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return syscall.ENOENT
+	}
+	if node.Type != restic.NodeTypeDir {
+		return syscall.ENOTDIR
+	}
+
+	parent := parentPath(p)
+	if err := o.ensureUpperDir(ctx, parent); err != nil {
+		return err
+	}
+	return withinUpperDir(o.upperPath(parent), func() error {
+		if err := os.Mkdir(filename, 0700); err != nil {
+			return err
+		}
+		if err := os.Chmod(filename, nodePerm(node)); err != nil {
+			return err
+		}
+		return os.Chtimes(filename, node.ModTime, node.ModTime)
+	})
+}
+
+// copyUp copies the entry p from the snapshot to the scratch directory, unless
+// it is already stored there, and returns the name of the local copy. It must
+// be called with o.m held. The lock is released while the content of a file
+// is downloaded, callers must not rely on state read before calling copyUp.
+func (o *Overlay) copyUp(ctx context.Context, p string) (string, error) {
+	filename := o.upperPath(p)
+	if _, err := os.Lstat(filename); err == nil {
+		return filename, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	node, err := o.baseNode(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	if node == nil {
+		return "", syscall.ENOENT
+	}
+	if node.Type == restic.NodeTypeDir {
+		return filename, o.ensureUpperDir(ctx, p)
+	}
+
+	debug.Log("copy up %v", p)
+	var tempname string
+	if node.Type == restic.NodeTypeFile {
+		tempname, err = o.downloadFile(ctx, node)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			// only exists if it was not moved to the scratch directory
+			_ = os.Remove(tempname)
+		}()
+
+		// the entry may have been copied up or removed in the meantime
+		if _, err := os.Lstat(filename); err == nil {
+			return filename, nil
+		}
+		node, err = o.baseNode(ctx, p)
+		if err != nil {
+			return "", err
+		}
+		if node == nil {
+			return "", syscall.ENOENT
+		}
+	}
+
+	parent := parentPath(p)
+	if err := o.ensureUpperDir(ctx, parent); err != nil {
+		return "", err
+	}
+	err = withinUpperDir(o.upperPath(parent), func() error {
+		switch node.Type {
+		case restic.NodeTypeFile:
+			return os.Rename(tempname, filename)
+		case restic.NodeTypeSymlink:
+			return os.Symlink(node.LinkTarget, filename)
+		default:
+			return syscall.EPERM
+		}
+	})
+	return filename, err
+}
+
+// downloadFile stores the content of node in a temporary file within the
+// scratch directory and returns its name. o.m is released during the
+// download, such that other operations are not blocked.
+func (o *Overlay) downloadFile(ctx context.Context, node *restic.Node) (string, error) {
+	o.m.Unlock()
+	defer o.m.Lock()
+
+	f, err := os.CreateTemp(o.dir, downloadPrefix)
+	if err != nil {
+		return "", err
+	}
+	filename := f.Name()
+
+	var buf []byte
+	for _, id := range node.Content {
+		buf, err = o.repo.LoadBlob(ctx, restic.DataBlob, id, buf)
+		if err != nil {
+			break
+		}
+		if _, err = f.Write(buf); err != nil {
+			break
+		}
+	}
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Chmod(filename, nodePerm(node))
+	}
+	if err == nil {
+		err = os.Chtimes(filename, node.ModTime, node.ModTime)
+	}
+	if err != nil {
+		_ = os.Remove(filename)
+		return "", err
+	}
+	return filename, nil
+}
+
+// OpenFile opens the file p with the flags of os.OpenFile. The file is copied
+// to the scratch directory first, if necessary.
+func (o *Overlay) OpenFile(ctx context.Context, p string, flag int) (*os.File, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	filename, err := o.copyUp(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, flag&^(os.O_CREATE|os.O_EXCL), 0)
+}
+
+// Create creates and opens the file p with the flags of os.OpenFile.
+func (o *Overlay) Create(ctx context.Context, p string, flag int, mode os.FileMode) (*os.File, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	node, upper, err := o.lookup(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if node != nil && !upper {
+		if flag&os.O_EXCL != 0 {
+			return nil, syscall.EEXIST
+		}
+		if _, err := o.copyUp(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.ensureUpperDir(ctx, parentPath(p)); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(o.upperPath(p), flag|os.O_CREATE, mode)
+}
+
+// Mkdir creates the directory p.
+func (o *Overlay) Mkdir(ctx context.Context, p string, mode os.FileMode) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if err := o.checkNotExists(ctx, p); err != nil {
+		return err
+	}
+	return os.Mkdir(o.upperPath(p), mode)
+}
+
+// Symlink creates the symlink p pointing to target.
+func (o *Overlay) Symlink(ctx context.Context, p string, target string) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if err := o.checkNotExists(ctx, p); err != nil {
+		return err
+	}
+	return os.Symlink(target, o.upperPath(p))
+}
+
+// checkNotExists returns an error if p exists, and prepares the parent
+// directory of p in the scratch directory otherwise.
+func (o *Overlay) checkNotExists(ctx context.Context, p string) error {
+	node, _, err := o.lookup(ctx, p)
+	if err != nil {
+		return err
+	}
+	if node != nil {
+		return syscall.EEXIST
+	}
+	return o.ensureUpperDir(ctx, parentPath(p))
+}
+
+// Remove removes the file or empty directory p.
+func (o *Overlay) Remove(ctx context.Context, p string, dir bool) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.remove(ctx, p, dir)
+}
+
+func (o *Overlay) remove(ctx context.Context, p string, dir bool) error {
+	node, upper, err := o.lookup(ctx, p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case node == nil:
+		return syscall.ENOENT
+	case dir && node.Type != restic.NodeTypeDir:
+		return syscall.ENOTDIR
+	case !dir && node.Type == restic.NodeTypeDir:
+		return syscall.EISDIR
+	}
+
+	if dir {
+		entries, err := o.readDir(ctx, p)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+
+	base, err := o.baseNode(ctx, p)
+	if err != nil {
+		return err
+	}
+	parent := parentPath(p)
+	if base != nil {
+		// record the modification in the parent directory
+		if err := o.ensureUpperDir(ctx, parent); err != nil {
+			return err
+		}
+	}
+
+	if upper {
+		if err := os.Remove(o.upperPath(p)); err != nil {
+			return err
+		}
+	} else {
+		now := time.Now()
+		if err := os.Chtimes(o.upperPath(parent), now, now); err != nil {
+			return err
+		}
+	}
+
+	if base == nil {
+		return nil
+	}
+	for q := range o.deleted {
+		if strings.HasPrefix(q, p+"/") {
+			delete(o.deleted, q)
+		}
+	}
+	o.deleted[p] = struct{}{}
+	return o.saveState()
+}
+
+// Rename renames oldpath to newpath, replacing newpath if it exists.
+// Directories which contain entries of the snapshot cannot be renamed, like
+// with overlayfs, syscall.EXDEV is returned such that programs fall back to
+// copying.
+func (o *Overlay) Rename(ctx context.Context, oldpath, newpath string) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if oldpath == newpath {
+		return nil
+	}
+
+	node, _, err := o.lookup(ctx, oldpath)
+	if err != nil {
+		return err
+	}
+	if node == nil {
+		return syscall.ENOENT
+	}
+	base, err := o.baseNode(ctx, oldpath)
+	if err != nil {
+		return err
+	}
+	if base != nil && node.Type == restic.NodeTypeDir {
+		return syscall.EXDEV
+	}
+
+	// copyUp releases the lock while downloading, newpath is only checked
+	// afterwards
+	filename, err := o.copyUp(ctx, oldpath)
+	if err != nil {
+		return err
+	}
+
+	target, _, err := o.lookup(ctx, newpath)
+	if err != nil {
+		return err
+	}
+	if target != nil {
+		switch {
+		case target.Type == restic.NodeTypeDir && node.Type != restic.NodeTypeDir:
+			return syscall.EISDIR
+		case target.Type != restic.NodeTypeDir && node.Type == restic.NodeTypeDir:
+			return syscall.ENOTDIR
+		}
+		if err := o.remove(ctx, newpath, target.Type == restic.NodeTypeDir); err != nil {
+			return err
+		}
+	}
+
+	if err := o.ensureUpperDir(ctx, parentPath(newpath)); err != nil {
+		return err
+	}
+	if err := os.Rename(filename, o.upperPath(newpath)); err != nil {
+		return err
+	}
+
+	if base == nil {
+		return nil
+	}
+	o.deleted[oldpath] = struct{}{}
+	return o.saveState()
+}
+
+// Chmod changes the mode of p.
+func (o *Overlay) Chmod(ctx context.Context, p string, mode os.FileMode) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	filename, err := o.copyUp(ctx, p)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(filename); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		// the mode of symlinks cannot be changed
+		return nil
+	}
+	return os.Chmod(filename, mode)
+}
+
+// Truncate changes the size of the file p.
+func (o *Overlay) Truncate(ctx context.Context, p string, size int64) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	filename, err := o.copyUp(ctx, p)
+	if err != nil {
+		return err
+	}
+	return os.Truncate(filename, size)
+}
+
+// Chtimes changes the access and modification time of p. A zero time is left
+// unchanged.
+func (o *Overlay) Chtimes(ctx context.Context, p string, atime, mtime time.Time) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	filename, err := o.copyUp(ctx, p)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(filename); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		// os.Chtimes follows symlinks
+		return nil
+	}
+	return os.Chtimes(filename, atime, mtime)
+}
+
+// Commit saves the snapshot with all changes as a new snapshot, whose parent
+// is the current snapshot. Directories without changes reuse the trees of the
+// current snapshot. If nothing was changed, no snapshot is created and the
+// null ID is returned. Afterwards, the overlay is based on the new snapshot.
+// The scratch directory still contains the changes, Clear removes them.
+func (o *Overlay) Commit(ctx context.Context) (restic.ID, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	o.repo.StartPackUploader(wgCtx, wg)
+
+	var treeID restic.ID
+	wg.Go(func() error {
+		var err error
+		treeID, err = o.saveDir(wgCtx, "")
+		if err != nil {
+			return err
+		}
+		return o.repo.Flush(wgCtx)
+	})
+	if err := wg.Wait(); err != nil {
+		return restic.ID{}, err
+	}
+
+	if treeID.Equal(*o.sn.Tree) {
+		debug.Log("no changes to snapshot %v", o.sn.ID())
+		return restic.ID{}, nil
+	}
+
+	// the new snapshot describes the same backup as the current one
+	sn := &restic.Snapshot{
+		Time:           time.Now(),
+		Parent:         o.sn.ID(),
+		Tree:           &treeID,
+		Paths:          o.sn.Paths,
+		Hostname:       o.sn.Hostname,
+		Username:       o.sn.Username,
+		UID:            o.sn.UID,
+		GID:            o.sn.GID,
+		Excludes:       o.sn.Excludes,
+		Tags:           o.sn.Tags,
+		Labels:         o.sn.Labels,
+		ProgramVersion: o.sn.ProgramVersion,
+	}
+
+	id, err := restic.SaveSnapshot(ctx, o.repo, sn)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	debug.Log("saved changes of snapshot %v as %v", o.sn.ID(), id)
+
+	o.sn, err = restic.LoadSnapshot(ctx, o.repo, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	return id, o.saveState()
+}
+
+// saveDir saves the tree for the directory p.
+func (o *Overlay) saveDir(ctx context.Context, p string) (restic.ID, error) {
+	entries, err := o.readDir(ctx, p)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	tree := restic.NewTree(len(entries))
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return restic.ID{}, ctx.Err()
+		}
+
+		node := *e.node
+		child := path.Join(p, node.Name)
+		switch {
+		case node.Type == restic.NodeTypeDir && (e.upper || o.hasWhiteoutBelow(child)):
+			id, err := o.saveDir(ctx, child)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			node.Subtree = &id
+		case node.Type == restic.NodeTypeFile && e.upper:
+			node.Content, node.Size, err = o.saveFile(ctx, o.upperPath(child))
+			if err != nil {
+				return restic.ID{}, err
+			}
+		}
+
+		if err := tree.Insert(&node); err != nil {
+			return restic.ID{}, err
+		}
+	}
+	return restic.SaveTree(ctx, o.repo, tree)
+}
+
+// saveFile splits the file filename into blobs and saves them.
+func (o *Overlay) saveFile(ctx context.Context, filename string) (restic.IDs, uint64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	params := o.repo.Config().ChunkerParams()
+	chnkr := params.NewChunker(f)
+	buf := make([]byte, params.MaxSize)
+
+	content := restic.IDs{}
+	var size uint64
+	for {
+		chunk, err := chnkr.Next(buf)
+		if err == io.EOF {
+			return content, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		id, _, _, err := o.repo.SaveBlob(ctx, restic.DataBlob, chunk.Data, restic.ID{}, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		content = append(content, id)
+		size += uint64(chunk.Length)
+	}
+}
+
+// Clear removes all changes from the scratch directory. It must only be
+// called after the changes were committed.
+func (o *Overlay) Clear() error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(o.dir, "upper")); err != nil {
+		return errors.WithStack(err)
+	}
+	o.deleted = make(map[string]struct{})
+	return errors.WithStack(os.Remove(filepath.Join(o.dir, overlayStateFile)))
+}
@@ -0,0 +1,456 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anacrolix/fuse"
+	"github.com/anacrolix/fuse/fs"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Statically ensure that the overlay nodes implement these interfaces
+var _ = fs.HandleReadDirAller(&overlayDir{})
+var _ = fs.NodeCreater(&overlayDir{})
+var _ = fs.NodeForgetter(&overlayDir{})
+var _ = fs.NodeMkdirer(&overlayDir{})
+var _ = fs.NodeRemover(&overlayDir{})
+var _ = fs.NodeRenamer(&overlayDir{})
+var _ = fs.NodeSetattrer(&overlayDir{})
+var _ = fs.NodeStringLookuper(&overlayDir{})
+var _ = fs.NodeSymlinker(&overlayDir{})
+var _ = fs.NodeFsyncer(&overlayFile{})
+var _ = fs.NodeOpener(&overlayFile{})
+var _ = fs.NodeSetattrer(&overlayFile{})
+var _ = fs.NodeReadlinker(&overlayLink{})
+var _ = fs.HandleReader(&overlayHandle{})
+var _ = fs.HandleReleaser(&overlayHandle{})
+var _ = fs.HandleWriter(&overlayHandle{})
+
+// overlayNode is a node of a writable mount. Nodes are identified by their
+// path in the overlay, which changes when the node is renamed.
+type overlayNode struct {
+	root  *Root
+	inode uint64
+	typ   restic.NodeType
+	path  string // protected by root.overlayMu
+}
+
+type overlayDir struct{ overlayNode }
+type overlayFile struct{ overlayNode }
+type overlayLink struct{ overlayNode }
+
+type overlayHandle struct {
+	f *os.File
+}
+
+type overlayNoder interface {
+	fs.Node
+	getOverlayNode() *overlayNode
+}
+
+func (n *overlayNode) getOverlayNode() *overlayNode {
+	return n
+}
+
+// toErrno returns the error number wrapped in err, as the fuse library only
+// handles plain error numbers.
+func toErrno(err error) error {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	return unwrapCtxCanceled(err)
+}
+
+// inodeFromPath generates an inode number for an entry of a writable mount.
+func inodeFromPath(p string) uint64 {
+	inode := uint64(rootInode)
+	if p == "" {
+		return inode
+	}
+	for _, name := range strings.Split(p, "/") {
+		inode = inodeFromName(inode, name)
+	}
+	return inode
+}
+
+// overlayNodeFor returns the node for the path p, whose current content is
+// described by node.
+func (r *Root) overlayNodeFor(p string, node *restic.Node) fs.Node {
+	r.overlayMu.Lock()
+	defer r.overlayMu.Unlock()
+
+	if n, ok := r.overlayNodes[p]; ok && n.getOverlayNode().typ == node.Type {
+		return n
+	}
+
+	on := overlayNode{root: r, inode: inodeFromPath(p), typ: node.Type, path: p}
+	var n overlayNoder
+	switch node.Type {
+	case restic.NodeTypeDir:
+		n = &overlayDir{on}
+	case restic.NodeTypeSymlink:
+		n = &overlayLink{on}
+	default:
+		// other types are only listed
+		n = &overlayFile{on}
+	}
+	r.overlayNodes[p] = n
+	return n
+}
+
+// renameOverlayNodes updates the paths of the nodes below oldpath after a
+// rename.
+func (r *Root) renameOverlayNodes(oldpath, newpath string) {
+	r.overlayMu.Lock()
+	defer r.overlayMu.Unlock()
+
+	delete(r.overlayNodes, newpath)
+	for p, n := range r.overlayNodes {
+		if p != oldpath && !strings.HasPrefix(p, oldpath+"/") {
+			continue
+		}
+		on := n.getOverlayNode()
+		on.path = newpath + strings.TrimPrefix(p, oldpath)
+		delete(r.overlayNodes, p)
+		r.overlayNodes[on.path] = n
+	}
+}
+
+func (r *Root) removeOverlayNode(p string) {
+	r.overlayMu.Lock()
+	defer r.overlayMu.Unlock()
+	delete(r.overlayNodes, p)
+}
+
+func (n *overlayNode) getPath() string {
+	n.root.overlayMu.Lock()
+	defer n.root.overlayMu.Unlock()
+	return n.path
+}
+
+func (n *overlayNode) childPath(name string) string {
+	return path.Join(n.getPath(), name)
+}
+
+func (n *overlayNode) lookup(ctx context.Context) (*restic.Node, error) {
+	node, _, err := n.root.overlay.Lookup(ctx, n.getPath())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	if node == nil {
+		return nil, syscall.ENOENT
+	}
+	return node, nil
+}
+
+func (n *overlayNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	node, err := n.lookup(ctx)
+	if err != nil {
+		return err
+	}
+	debug.Log("Attr(%v)", n.getPath())
+
+	a.Inode = n.inode
+	a.Mode = node.Mode
+	a.Nlink = uint32(node.Links)
+	switch node.Type {
+	case restic.NodeTypeDir:
+		a.Mode |= os.ModeDir
+		a.Nlink = 2
+	case restic.NodeTypeFile:
+		a.Size = node.Size
+	case restic.NodeTypeSymlink:
+		a.Size = uint64(len(node.LinkTarget))
+	}
+	if a.Nlink == 0 {
+		a.Nlink = 1
+	}
+	a.Blocks = (a.Size + blockSize - 1) / blockSize
+	a.BlockSize = blockSize
+
+	if !n.root.cfg.OwnerIsRoot {
+		a.Uid = node.UID
+		a.Gid = node.GID
+		if n.inode == rootInode {
+			a.Uid = n.root.uid
+			a.Gid = n.root.gid
+		}
+	}
+	a.Atime = node.AccessTime
+	a.Ctime = node.ChangeTime
+	a.Mtime = node.ModTime
+
+	return nil
+}
+
+func (n *overlayNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	debug.Log("Setattr(%v, %v)", n.getPath(), req)
+	p := n.getPath()
+	o := n.root.overlay
+
+	if req.Valid.Uid() || req.Valid.Gid() {
+		return syscall.EPERM
+	}
+	if req.Valid.Size() {
+		if err := o.Truncate(ctx, p, int64(req.Size)); err != nil {
+			return toErrno(err)
+		}
+	}
+	if req.Valid.Mode() {
+		if err := o.Chmod(ctx, p, req.Mode); err != nil {
+			return toErrno(err)
+		}
+	}
+	if req.Valid.Atime() || req.Valid.Mtime() {
+		var atime, mtime time.Time
+		if req.Valid.Atime() {
+			atime = req.Atime
+		}
+		if req.Valid.AtimeNow() {
+			atime = time.Now()
+		}
+		if req.Valid.Mtime() {
+			mtime = req.Mtime
+		}
+		if req.Valid.MtimeNow() {
+			mtime = time.Now()
+		}
+		if err := o.Chtimes(ctx, p, atime, mtime); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	return n.Attr(ctx, &resp.Attr)
+}
+
+func (n *overlayNode) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	node, err := n.lookup(ctx)
+	if err != nil {
+		return err
+	}
+	nodeToXattrList(node, req, resp)
+	return nil
+}
+
+func (n *overlayNode) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	node, err := n.lookup(ctx)
+	if err != nil {
+		return err
+	}
+	return nodeGetXattr(node, req, resp)
+}
+
+func (n *overlayNode) Fsync(_ context.Context, _ *fuse.FsyncRequest) error {
+	// changes are only persisted by committing them
+	return nil
+}
+
+func (n *overlayNode) Forget() {
+	n.root.overlayMu.Lock()
+	defer n.root.overlayMu.Unlock()
+
+	if on, ok := n.root.overlayNodes[n.path]; ok && on.getOverlayNode() == n {
+		delete(n.root.overlayNodes, n.path)
+	}
+}
+
+func (d *overlayDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	p := d.getPath()
+	debug.Log("ReadDirAll(%v)", p)
+
+	nodes, err := d.root.overlay.ReadDir(ctx, p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	ret := make([]fuse.Dirent, 0, len(nodes)+2)
+	ret = append(ret, fuse.Dirent{
+		Inode: d.inode,
+		Name:  ".",
+		Type:  fuse.DT_Dir,
+	})
+	ret = append(ret, fuse.Dirent{
+		Inode: inodeFromPath(parentPath(p)),
+		Name:  "..",
+		Type:  fuse.DT_Dir,
+	})
+
+	for _, node := range nodes {
+		var typ fuse.DirentType
+		switch node.Type {
+		case restic.NodeTypeDir:
+			typ = fuse.DT_Dir
+		case restic.NodeTypeFile:
+			typ = fuse.DT_File
+		case restic.NodeTypeSymlink:
+			typ = fuse.DT_Link
+		}
+
+		ret = append(ret, fuse.Dirent{
+			Inode: inodeFromPath(path.Join(p, node.Name)),
+			Type:  typ,
+			Name:  node.Name,
+		})
+	}
+	return ret, nil
+}
+
+func (d *overlayDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	p := d.childPath(name)
+	debug.Log("Lookup(%v)", p)
+
+	node, _, err := d.root.overlay.Lookup(ctx, p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	if node == nil {
+		return nil, syscall.ENOENT
+	}
+	return d.root.overlayNodeFor(p, node), nil
+}
+
+// openFlags converts the flags of an open request to flags for os.OpenFile.
+func openFlags(flags fuse.OpenFlags) int {
+	// the kernel passes the offset for writes to files opened with O_APPEND
+	return int(flags & (fuse.OpenAccessModeMask | fuse.OpenExclusive | fuse.OpenTruncate))
+}
+
+func (d *overlayDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	p := d.childPath(req.Name)
+	debug.Log("Create(%v)", p)
+
+	f, err := d.root.overlay.Create(ctx, p, openFlags(req.Flags), req.Mode)
+	if err != nil {
+		return nil, nil, toErrno(err)
+	}
+	node, _, err := d.root.overlay.Lookup(ctx, p)
+	if err == nil && node == nil {
+		err = syscall.ENOENT
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, toErrno(err)
+	}
+
+	n := d.root.overlayNodeFor(p, node)
+	if err := n.Attr(ctx, &resp.Attr); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return n, &overlayHandle{f: f}, nil
+}
+
+func (d *overlayDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	p := d.childPath(req.Name)
+	debug.Log("Mkdir(%v)", p)
+
+	if err := d.root.overlay.Mkdir(ctx, p, req.Mode.Perm()); err != nil {
+		return nil, toErrno(err)
+	}
+	return d.Lookup(ctx, req.Name)
+}
+
+func (d *overlayDir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	p := d.childPath(req.NewName)
+	debug.Log("Symlink(%v, %v)", p, req.Target)
+
+	if err := d.root.overlay.Symlink(ctx, p, req.Target); err != nil {
+		return nil, toErrno(err)
+	}
+	return d.Lookup(ctx, req.NewName)
+}
+
+func (d *overlayDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	p := d.childPath(req.Name)
+	debug.Log("Remove(%v)", p)
+
+	if err := d.root.overlay.Remove(ctx, p, req.Dir); err != nil {
+		return toErrno(err)
+	}
+	d.root.removeOverlayNode(p)
+	return nil
+}
+
+func (d *overlayDir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	nd, ok := newDir.(*overlayDir)
+	if !ok {
+		return syscall.EXDEV
+	}
+	oldpath, newpath := d.childPath(req.OldName), nd.childPath(req.NewName)
+	debug.Log("Rename(%v, %v)", oldpath, newpath)
+
+	if err := d.root.overlay.Rename(ctx, oldpath, newpath); err != nil {
+		return toErrno(err)
+	}
+	d.root.renameOverlayNodes(oldpath, newpath)
+	return nil
+}
+
+func (f *overlayFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	p := f.getPath()
+	debug.Log("Open(%v, %v)", p, req.Flags)
+
+	if req.Flags.IsReadOnly() {
+		node, upper, err := f.root.overlay.Lookup(ctx, p)
+		if err != nil {
+			return nil, toErrno(err)
+		}
+		if node == nil {
+			return nil, syscall.ENOENT
+		}
+		if !upper {
+			// read unmodified files directly from the repository
+			base := &file{root: f.root, forget: func() {}, node: node, inode: f.inode}
+			return base.Open(ctx, req, resp)
+		}
+	}
+
+	h, err := f.root.overlay.OpenFile(ctx, p, openFlags(req.Flags))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return &overlayHandle{f: h}, nil
+}
+
+func (l *overlayLink) Readlink(ctx context.Context, _ *fuse.ReadlinkRequest) (string, error) {
+	node, err := l.lookup(ctx)
+	if err != nil {
+		return "", err
+	}
+	return node.LinkTarget, nil
+}
+
+func (h *overlayHandle) Read(_ context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	n, err := h.f.ReadAt(resp.Data[:req.Size], req.Offset)
+	if err != nil && err != io.EOF {
+		return toErrno(err)
+	}
+	resp.Data = resp.Data[:n]
+	return nil
+}
+
+func (h *overlayHandle) Write(_ context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	n, err := h.f.WriteAt(req.Data, req.Offset)
+	resp.Size = n
+	if err != nil {
+		return toErrno(err)
+	}
+	return nil
+}
+
+func (h *overlayHandle) Release(_ context.Context, _ *fuse.ReleaseRequest) error {
+	return toErrno(h.f.Close())
+}
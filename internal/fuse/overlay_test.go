@@ -0,0 +1,240 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testOverlaySnapshot(t *testing.T, files archiver.TestDir) (restic.Repository, *restic.Snapshot) {
+	repo := repository.TestRepository(t)
+	src := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, src, files)
+
+	back := rtest.Chdir(t, src)
+	defer back()
+	sn := archiver.TestSnapshot(t, repo, ".", nil)
+
+	var id restic.ID
+	rtest.OK(t, repo.List(context.TODO(), restic.SnapshotFile, func(snID restic.ID, _ int64) error {
+		id = snID
+		return nil
+	}))
+	sn, err := restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	return repo, sn
+}
+
+func testOverlayWriteFile(t *testing.T, o *Overlay, p string, flag int, content string) {
+	f, err := o.OpenFile(context.TODO(), p, flag)
+	rtest.OK(t, err)
+	_, err = f.Write([]byte(content))
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+}
+
+func testOverlayNames(t *testing.T, o *Overlay, p string) []string {
+	nodes, err := o.ReadDir(context.TODO(), p)
+	rtest.OK(t, err)
+	names := []string{}
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+func TestOverlayCommit(t *testing.T) {
+	repo, sn := testOverlaySnapshot(t, archiver.TestDir{
+		"etc": archiver.TestDir{
+			"app.conf": archiver.TestFile{Content: "old config"},
+			"hosts":    archiver.TestFile{Content: "127.0.0.1 localhost"},
+		},
+		"data": archiver.TestDir{
+			"sub": archiver.TestDir{
+				"file": archiver.TestFile{Content: "removed"},
+			},
+			"keep": archiver.TestFile{Content: "keep"},
+		},
+		"unchanged": archiver.TestDir{
+			"file": archiver.TestFile{Content: "unchanged"},
+		},
+	})
+	ctx := context.TODO()
+	sn.Excludes = []string{"*.tmp"}
+	sn.Labels = map[string]string{"env": "prod"}
+	sn.Username, sn.UID, sn.GID = "backup", 1000, 1001
+	sn.ProgramVersion = "restic 0.1.2"
+
+	o, err := NewOverlay(repo, sn, rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	testOverlayWriteFile(t, o, "etc/app.conf", os.O_WRONLY|os.O_TRUNC, "new config")
+	testOverlayWriteFile(t, o, "etc/hosts", os.O_WRONLY|os.O_APPEND, "\n::1 localhost")
+
+	f, err := o.Create(ctx, "etc/new.conf", os.O_WRONLY|os.O_EXCL, 0644)
+	rtest.OK(t, err)
+	_, err = f.Write([]byte("created"))
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	for _, p := range []string{"etc/app.conf", "etc/hosts", "unchanged/file"} {
+		_, err = o.Create(ctx, p, os.O_WRONLY|os.O_EXCL, 0644)
+		rtest.Assert(t, errors.Is(err, syscall.EEXIST), "unexpected error for %v: %v", p, err)
+	}
+
+	rtest.Equals(t, syscall.ENOTEMPTY, o.Remove(ctx, "data/sub", true))
+	rtest.OK(t, o.Remove(ctx, "data/sub/file", false))
+	rtest.OK(t, o.Remove(ctx, "data/sub", true))
+	rtest.OK(t, o.Mkdir(ctx, "data/new", 0755))
+	rtest.OK(t, o.Rename(ctx, "data/keep", "data/new/kept"))
+	rtest.Equals(t, syscall.EXDEV, o.Rename(ctx, "etc", "config"))
+
+	rtest.Equals(t, []string{"app.conf", "hosts", "new.conf"}, testOverlayNames(t, o, "etc"))
+	rtest.Equals(t, []string{"new"}, testOverlayNames(t, o, "data"))
+
+	// unmodified files are read from the repository
+	node, upper, err := o.Lookup(ctx, "unchanged/file")
+	rtest.OK(t, err)
+	rtest.Assert(t, node != nil && !upper, "unexpected node for unmodified file: %v, %v", node, upper)
+
+	id, err := o.Commit(ctx)
+	rtest.OK(t, err)
+	rtest.Assert(t, !id.IsNull(), "no snapshot was created")
+
+	archiver.TestEnsureSnapshot(t, repo, id, archiver.TestDir{
+		"etc": archiver.TestDir{
+			"app.conf": archiver.TestFile{Content: "new config"},
+			"hosts":    archiver.TestFile{Content: "127.0.0.1 localhost\n::1 localhost"},
+			"new.conf": archiver.TestFile{Content: "created"},
+		},
+		"data": archiver.TestDir{
+			"new": archiver.TestDir{
+				"kept": archiver.TestFile{Content: "keep"},
+			},
+		},
+		"unchanged": archiver.TestDir{
+			"file": archiver.TestFile{Content: "unchanged"},
+		},
+	})
+
+	newSn := o.Snapshot()
+	rtest.Equals(t, id, *newSn.ID())
+	rtest.Equals(t, sn.ID(), newSn.Parent)
+	rtest.Equals(t, sn.Paths, newSn.Paths)
+	rtest.Equals(t, sn.Hostname, newSn.Hostname)
+	rtest.Equals(t, sn.Excludes, newSn.Excludes)
+	rtest.Equals(t, sn.Labels, newSn.Labels)
+	rtest.Equals(t, sn.ProgramVersion, newSn.ProgramVersion)
+	rtest.Equals(t, "backup", newSn.Username)
+	rtest.Equals(t, uint32(1000), newSn.UID)
+	rtest.Equals(t, uint32(1001), newSn.GID)
+
+	oldTree, err := restic.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+	newTree, err := restic.LoadTree(ctx, repo, *newSn.Tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, oldTree.Find("unchanged").Subtree, newTree.Find("unchanged").Subtree)
+
+	// committing again without further changes does not create a snapshot
+	id, err = o.Commit(ctx)
+	rtest.OK(t, err)
+	rtest.Assert(t, id.IsNull(), "unexpected snapshot %v", id)
+}
+
+func TestOverlayResume(t *testing.T) {
+	repo, sn := testOverlaySnapshot(t, archiver.TestDir{
+		"file":  archiver.TestFile{Content: "content"},
+		"other": archiver.TestFile{Content: "other"},
+	})
+	ctx := context.TODO()
+	scratch := rtest.TempDir(t)
+
+	o, err := NewOverlay(repo, sn, scratch)
+	rtest.OK(t, err)
+	rtest.OK(t, o.Remove(ctx, "other", false))
+	testOverlayWriteFile(t, o, "file", os.O_WRONLY, "modified")
+
+	o, err = NewOverlay(repo, sn, scratch)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"file"}, testOverlayNames(t, o, ""))
+
+	f, err := o.OpenFile(ctx, "file", os.O_RDONLY)
+	rtest.OK(t, err)
+	buf, err := io.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	rtest.Equals(t, "modified", string(buf))
+
+	// the scratch directory cannot be used for a different snapshot
+	other := *sn
+	restic.TestSetSnapshotID(t, &other, restic.NewRandomID())
+	_, err = NewOverlay(repo, &other, scratch)
+	rtest.Assert(t, err != nil, "scratch directory of a different snapshot was accepted")
+
+	_, err = o.Commit(ctx)
+	rtest.OK(t, err)
+	rtest.OK(t, o.Clear())
+	_, err = NewOverlay(repo, &other, scratch)
+	rtest.OK(t, err)
+}
+
+// blockingRepository blocks loading data blobs until unblock is closed.
+type blockingRepository struct {
+	restic.Repository
+	loading chan struct{}
+	unblock chan struct{}
+}
+
+func (r *blockingRepository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	if t == restic.DataBlob {
+		r.loading <- struct{}{}
+		<-r.unblock
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+func TestOverlayCopyUpUnlocked(t *testing.T) {
+	repo, sn := testOverlaySnapshot(t, archiver.TestDir{
+		"file":  archiver.TestFile{Content: "content"},
+		"other": archiver.TestFile{Content: "other"},
+	})
+	ctx := context.TODO()
+	blocking := &blockingRepository{Repository: repo, loading: make(chan struct{}), unblock: make(chan struct{})}
+
+	o, err := NewOverlay(blocking, sn, rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		f, err := o.OpenFile(ctx, "file", os.O_WRONLY|os.O_APPEND)
+		if err == nil {
+			_, err = f.Write([]byte(" appended"))
+			err = errors.Join(err, f.Close())
+		}
+		done <- err
+	}()
+
+	// other operations are possible while the file is downloaded
+	<-blocking.loading
+	rtest.OK(t, o.Remove(ctx, "other", false))
+	node, _, err := o.Lookup(ctx, "file")
+	rtest.OK(t, err)
+	rtest.Assert(t, node != nil, "file is missing")
+	close(blocking.unblock)
+	rtest.OK(t, <-done)
+
+	f, err := o.OpenFile(ctx, "file", os.O_RDONLY)
+	rtest.OK(t, err)
+	buf, err := io.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	rtest.Equals(t, "content appended", string(buf))
+	rtest.Equals(t, []string{"file"}, testOverlayNames(t, o, ""))
+}
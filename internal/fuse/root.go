@@ -5,7 +5,9 @@ package fuse
 
 import (
 	"os"
+	"sync"
 
+	"github.com/restic/restic/internal/blobcache"
 	"github.com/restic/restic/internal/bloblru"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/restic"
@@ -19,6 +21,12 @@ type Config struct {
 	Filter        restic.SnapshotFilter
 	TimeTemplate  string
 	PathTemplates []string
+
+	// BlobCache optionally stores the loaded data blobs on disk.
+	BlobCache *blobcache.Cache
+	// ReadAhead is the number of bytes which are loaded in advance while a
+	// file is read sequentially, zero disables read-ahead.
+	ReadAhead int64
 }
 
 // Root is the root node of the fuse mount of a repository.
@@ -29,6 +37,11 @@ type Root struct {
 
 	*SnapshotsDir
 
+	// set for writable mounts of a single snapshot
+	overlay      *Overlay
+	overlayMu    sync.Mutex
+	overlayNodes map[string]overlayNoder
+
 	uid, gid uint32
 }
 
@@ -58,21 +71,41 @@ func NewRoot(repo restic.Repository, cfg Config) *Root {
 
 	// set defaults, if PathTemplates is not set
 	if len(cfg.PathTemplates) == 0 {
-		cfg.PathTemplates = []string{
-			"ids/%i",
-			"snapshots/%T",
-			"hosts/%h/%T",
-			"tags/%t/%T",
-		}
+		cfg.PathTemplates = DefaultPathTemplates
 	}
 
-	root.SnapshotsDir = NewSnapshotsDir(root, func() {}, rootInode, rootInode, NewSnapshotsDirStructure(root, cfg.PathTemplates, cfg.TimeTemplate), "")
+	root.SnapshotsDir = NewSnapshotsDir(root, func() {}, rootInode, rootInode, NewSnapshotsDirStructure(repo, cfg.Filter, cfg.PathTemplates, cfg.TimeTemplate), "")
 
 	return root
 }
 
-// Root is just there to satisfy fs.Root, it returns itself.
+// NewOverlayRoot initializes a new root node for a writable mount of the
+// snapshot of overlay.
+func NewOverlayRoot(repo restic.Repository, cfg Config, overlay *Overlay) *Root {
+	debug.Log("NewOverlayRoot(), config %v", cfg)
+
+	root := &Root{
+		repo:         repo,
+		cfg:          cfg,
+		blobCache:    bloblru.New(blobCacheSize),
+		overlay:      overlay,
+		overlayNodes: make(map[string]overlayNoder),
+	}
+
+	if !cfg.OwnerIsRoot {
+		root.uid = uint32(os.Getuid())
+		root.gid = uint32(os.Getgid())
+	}
+
+	return root
+}
+
+// Root is just there to satisfy fs.Root, it returns itself. For writable
+// mounts, it returns the root directory of the snapshot.
 func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
+	if r.overlay != nil {
+		return &overlayDir{overlayNode{root: r, inode: rootInode, typ: restic.NodeTypeDir}}, nil
+	}
 	return r, nil
 }
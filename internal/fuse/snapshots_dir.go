@@ -119,7 +119,9 @@ func (d *SnapshotsDir) Lookup(ctx context.Context, name string) (fs.Node, error)
 		}
 
 		inode := inodeFromName(d.inode, name)
-		if entry.linkTarget != "" {
+		if entry.view != nil {
+			return newViewDir(d.root, forget, inode, d.inode, entry.view), nil
+		} else if entry.linkTarget != "" {
 			return newSnapshotLink(d.root, forget, inode, entry.linkTarget, entry.snapshot)
 		} else if entry.snapshot != nil {
 			return newDirFromSnapshot(d.root, forget, inode, entry.snapshot)
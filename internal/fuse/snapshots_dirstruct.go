@@ -1,6 +1,3 @@
-//go:build darwin || freebsd || linux
-// +build darwin freebsd linux
-
 package fuse
 
 import (
@@ -22,16 +19,49 @@ type MetaDirData struct {
 	// set if this is a symlink or a snapshot mount point
 	linkTarget string
 	snapshot   *restic.Snapshot
+	// set if this is a merged or history directory
+	view *View
 	// names is set if this is a pseudo directory
 	names map[string]*MetaDirData
 }
 
+// Snapshot returns the snapshot if this is a snapshot mount point or a link
+// to one.
+func (m *MetaDirData) Snapshot() *restic.Snapshot {
+	return m.snapshot
+}
+
+// LinkTarget returns the link target if this is a link to a snapshot.
+func (m *MetaDirData) LinkTarget() string {
+	return m.linkTarget
+}
+
+// View returns the view if this is a merged or history directory.
+func (m *MetaDirData) View() *View {
+	return m.view
+}
+
+// Names returns the entries if this is a pseudo directory.
+func (m *MetaDirData) Names() map[string]*MetaDirData {
+	return m.names
+}
+
+// DefaultPathTemplates are used if no path templates are configured.
+var DefaultPathTemplates = []string{
+	"ids/%i",
+	"snapshots/%T",
+	"hosts/%h/%T",
+	"tags/%t/%T",
+}
+
 // SnapshotsDirStructure contains the directory structure for snapshots.
 // It uses a paths and time template to generate a map of pathnames
 // pointing to the actual snapshots. For templates that end with a time,
-// also "latest" links are generated.
+// also "latest" links are generated. Templates that end with "%m" or "%f"
+// generate views which combine all snapshots with the same path.
 type SnapshotsDirStructure struct {
-	root          *Root
+	repo          restic.Repository
+	filter        restic.SnapshotFilter
 	pathTemplates []string
 	timeTemplate  string
 
@@ -46,9 +76,10 @@ type SnapshotsDirStructure struct {
 }
 
 // NewSnapshotsDirStructure returns a new directory structure for snapshots.
-func NewSnapshotsDirStructure(root *Root, pathTemplates []string, timeTemplate string) *SnapshotsDirStructure {
+func NewSnapshotsDirStructure(repo restic.Repository, filter restic.SnapshotFilter, pathTemplates []string, timeTemplate string) *SnapshotsDirStructure {
 	return &SnapshotsDirStructure{
-		root:          root,
+		repo:          repo,
+		filter:        filter,
 		pathTemplates: pathTemplates,
 		timeTemplate:  timeTemplate,
 	}
@@ -108,6 +139,21 @@ func pathsFromSn(pathTemplate string, timeTemplate string, sn *restic.Snapshot)
 			}
 			repl = sn.Tags[0]
 
+		case 'p':
+			if len(sn.Paths) == 0 {
+				return nil, ""
+			}
+			// like tags, but the paths contain subdirectories
+			newout := make([]strings.Builder, len(out)*len(sn.Paths))
+			for i, p := range sn.Paths {
+				p = dirnameFromPath(p)
+				for j := range out {
+					newout[i*len(out)+j].WriteString(out[j].String() + p)
+				}
+			}
+			out = newout
+			continue
+
 		case 'i':
 			repl = sn.ID().Str()
 
@@ -159,6 +205,29 @@ func filenameFromTag(tag string) string {
 	return strings.ReplaceAll(tag, "/", "_")
 }
 
+// dirnameFromPath returns the snapshot path p as a relative path, which is
+// also the location of p within the snapshot. For Windows paths, the colon of
+// the volume name is removed.
+func dirnameFromPath(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = p[:1] + p[2:]
+	}
+	return path.Clean("/" + p)[1:]
+}
+
+// viewPrefix returns the path template without the trailing "%m" or "%f"
+// verb, ok is false if templ does not generate a view.
+func viewPrefix(templ string) (prefix string, history bool, ok bool) {
+	if prefix, ok := strings.CutSuffix(templ, "%m"); ok {
+		return prefix, false, true
+	}
+	if prefix, ok := strings.CutSuffix(templ, "%f"); ok {
+		return prefix, true, true
+	}
+	return "", false, false
+}
+
 // determine static path prefix
 func staticPrefix(pathTemplate string) (prefix string) {
 	inVerb := false
@@ -173,7 +242,7 @@ outer:
 		}
 		inVerb = false
 		switch c {
-		case 'i', 'I', 'u', 'h', 't', 'T':
+		case 'i', 'I', 'u', 'h', 't', 'p', 'T', 'm', 'f':
 			patternStart = i
 			break outer
 		}
@@ -213,6 +282,7 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 	type mountData struct {
 		sn         *restic.Snapshot
 		linkTarget string // if linkTarget!= "", this is a symlink
+		view       *View
 		childFn    string
 		child      *MetaDirData
 	}
@@ -224,7 +294,9 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 		if e == nil {
 			e = &MetaDirData{}
 		}
-		if data.sn != nil {
+		if data.view != nil {
+			e.view = data.view
+		} else if data.sn != nil {
 			e.snapshot = data.sn
 			e.linkTarget = data.linkTarget
 		} else {
@@ -258,8 +330,14 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 	}
 
 	latestTime := make(map[string]time.Time)
+	views := make(map[string]*viewData)
 	for _, sn := range snapshots {
 		for _, templ := range d.pathTemplates {
+			if prefix, history, ok := viewPrefix(templ); ok {
+				d.addToViews(views, prefix, history, sn)
+				continue
+			}
+
 			paths, timeSuffix := pathsFromSn(templ, d.timeTemplate, sn)
 			for _, p := range paths {
 				if p != "" {
@@ -280,9 +358,73 @@ func (d *SnapshotsDirStructure) makeDirs(snapshots restic.Snapshots) {
 		}
 	}
 
+	for p, v := range views {
+		mount(p, mountData{view: v.view(d.timeTemplate)})
+	}
+
 	d.entries = entries
 }
 
+// viewData collects the snapshots of a view.
+type viewData struct {
+	history bool
+	sources []viewSource
+}
+
+// addToViews adds sn to the views generated by the path template prefix. If
+// the template contains "%p", a separate view is generated for each path of
+// sn, which then contains the directory at that path within the snapshots.
+func (d *SnapshotsDirStructure) addToViews(views map[string]*viewData, prefix string, history bool, sn *restic.Snapshot) {
+	add := func(sn *restic.Snapshot, src viewSource) {
+		paths, timeSuffix := pathsFromSn(prefix, d.timeTemplate, sn)
+		for _, p := range paths {
+			p = path.Clean("/" + p + timeSuffix)
+			if p == "/" {
+				p = ""
+			}
+			v := views[p]
+			if v == nil {
+				v = &viewData{history: history}
+				views[p] = v
+			}
+			v.sources = append(v.sources, src)
+		}
+	}
+
+	if !strings.Contains(prefix, "%p") {
+		add(sn, viewSource{sn: sn})
+		return
+	}
+	for _, snPath := range sn.Paths {
+		single := *sn
+		single.Paths = []string{snPath}
+		add(&single, viewSource{sn: sn, path: dirnameFromPath(snPath)})
+	}
+}
+
+// view returns the view for the collected snapshots. Merged views only contain
+// the latest snapshot of each host.
+func (v *viewData) view(timeTemplate string) *View {
+	sources := v.sources
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].sn.Time.Before(sources[j].sn.Time)
+	})
+	if v.history {
+		return newHistoryView(sources, timeTemplate)
+	}
+
+	var latest []viewSource
+	hosts := make(map[string]struct{})
+	for i := len(sources) - 1; i >= 0; i-- {
+		if _, ok := hosts[sources[i].sn.Hostname]; ok {
+			continue
+		}
+		hosts[sources[i].sn.Hostname] = struct{}{}
+		latest = append(latest, sources[i])
+	}
+	return newMergedView(latest)
+}
+
 const minSnapshotsReloadTime = 60 * time.Second
 
 // update snapshots if repository has changed
@@ -294,7 +436,7 @@ func (d *SnapshotsDirStructure) updateSnapshots(ctx context.Context) error {
 	}
 
 	var snapshots restic.Snapshots
-	err := d.root.cfg.Filter.FindAll(ctx, d.root.repo, d.root.repo, nil, func(_ string, sn *restic.Snapshot, _ error) error {
+	err := d.filter.FindAll(ctx, d.repo, d.repo, nil, func(_ string, sn *restic.Snapshot, _ error) error {
 		if sn != nil {
 			snapshots = append(snapshots, sn)
 		}
@@ -327,7 +469,7 @@ func (d *SnapshotsDirStructure) updateSnapshots(ctx context.Context) error {
 		return nil
 	}
 
-	err = d.root.repo.LoadIndex(ctx, nil)
+	err = d.repo.LoadIndex(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,3 @@
-//go:build darwin || freebsd || linux
-// +build darwin freebsd linux
-
 package fuse
 
 import (
@@ -52,6 +49,15 @@ func TestPathsFromSn(t *testing.T) {
 	p, s = pathsFromSn("%T/%i", "2006/01", sn1)
 	test.Equals(t, []string{"2021/01/12345678"}, p)
 	test.Equals(t, "", s)
+
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", sn1)
+	test.Equals(t, []string(nil), p)
+	test.Equals(t, "", s)
+
+	sn2 := &restic.Snapshot{Hostname: "host", Paths: []string{"/home/user", "/", `C:\Users`}, Time: time1}
+	p, s = pathsFromSn("paths/%p/%T", "2006-01-02T15:04:05", sn2)
+	test.Equals(t, []string{"paths/home/user/", "paths//", "paths/C/Users/"}, p)
+	test.Equals(t, "2021-01-01T00:00:01", s)
 }
 
 func TestMakeDirs(t *testing.T) {
@@ -274,6 +280,30 @@ func TestMakeEmptyDirs(t *testing.T) {
 	verifyEntries(t, expNames, expLatest, sds.entries)
 }
 
+func TestMakeViews(t *testing.T) {
+	sds := &SnapshotsDirStructure{
+		pathTemplates: []string{"merged/%p/%m", "hosts/%h/history/%f"},
+		timeTemplate:  "2006-01-02",
+	}
+
+	time0, _ := time.Parse("2006-01-02", "2021-01-01")
+	sn0 := &restic.Snapshot{Hostname: "a", Paths: []string{"/etc"}, Time: time0}
+	sn1 := &restic.Snapshot{Hostname: "b", Paths: []string{"/etc", "/home"}, Time: time0.Add(time.Hour)}
+	sn2 := &restic.Snapshot{Hostname: "a", Paths: []string{"/etc"}, Time: time0.Add(2 * time.Hour)}
+	sds.makeDirs(restic.Snapshots{sn2, sn0, sn1})
+
+	// merged views contain the latest snapshot of each host, newest first
+	test.Equals(t, []viewSource{{sn: sn2, path: "etc"}, {sn: sn1, path: "etc"}}, sds.entries["/merged/etc"].view.sources)
+	test.Equals(t, []viewSource{{sn: sn1, path: "home"}}, sds.entries["/merged/home"].view.sources)
+	test.Equals(t, sds.entries["/merged/etc"], sds.entries["/merged"].names["etc"])
+
+	// history views contain all snapshots, oldest first
+	history := sds.entries["/hosts/a/history"].view
+	test.Assert(t, history.history, "history view expected")
+	test.Equals(t, []viewSource{{sn: sn0}, {sn: sn2}}, history.sources)
+	test.Equals(t, []viewSource{{sn: sn1}}, sds.entries["/hosts/b/history"].view.sources)
+}
+
 func TestFilenameFromTag(t *testing.T) {
 	for _, c := range []struct {
 		tag, filename string
@@ -0,0 +1,221 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// View is a directory which combines the same directory of several snapshots.
+// A merged view contains the newest version of each entry, nested directories
+// are merged as well. A history view contains a directory for each entry,
+// where the directory of a file lists all distinct versions of the file.
+type View struct {
+	history      bool
+	timeTemplate string
+	// sources are sorted by time, oldest first for history views and newest
+	// first for merged views
+	sources []viewSource
+	// files holds the versions of a file for history views, oldest first
+	files []viewFile
+
+	// entries caches the result of Entries, the sources of a view do not
+	// change once it is listed
+	m       sync.Mutex
+	entries []ViewEntry
+}
+
+type viewSource struct {
+	sn *restic.Snapshot
+	// path within the snapshot, only used before the tree is known
+	path string
+	tree restic.ID
+}
+
+type viewFile struct {
+	sn   *restic.Snapshot
+	node *restic.Node
+}
+
+// ViewEntry is an entry of a View, either Node or View is set.
+type ViewEntry struct {
+	Name string
+	Node *restic.Node
+	View *View
+}
+
+// newMergedView returns a view which merges the latest snapshot of each host.
+// sources must be sorted by time, newest first.
+func newMergedView(sources []viewSource) *View {
+	return &View{sources: sources}
+}
+
+// newHistoryView returns a view of all versions of the files contained in the
+// snapshots. sources must be sorted by time, oldest first.
+func newHistoryView(sources []viewSource, timeTemplate string) *View {
+	return &View{history: true, sources: sources, timeTemplate: timeTemplate}
+}
+
+// trees returns the trees of the sources. Sources which do not contain their
+// path are skipped. Sources with the same tree are only returned once, the
+// first one is kept.
+func (v *View) trees(ctx context.Context, repo restic.BlobLoader) ([]viewSource, error) {
+	var sources []viewSource
+	seen := restic.NewIDSet()
+	for _, src := range v.sources {
+		if src.tree.IsNull() {
+			id, err := restic.FindTreeDirectory(ctx, repo, src.sn.Tree, src.path)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				debug.Log("path %v not found in snapshot %v: %v", src.path, src.sn.ID().Str(), err)
+				continue
+			}
+			src.tree = *id
+		}
+
+		if seen.Has(src.tree) {
+			continue
+		}
+		seen.Insert(src.tree)
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// Entries returns the entries of v sorted by name. The entries are computed
+// once, later calls return the same entries.
+func (v *View) Entries(ctx context.Context, repo restic.BlobLoader) ([]ViewEntry, error) {
+	v.m.Lock()
+	defer v.m.Unlock()
+	if v.entries != nil {
+		return v.entries, nil
+	}
+
+	sources, err := v.trees(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*ViewEntry)
+	for _, src := range sources {
+		tree, err := restic.LoadTree(ctx, repo, src.tree)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range tree.Nodes {
+			if v.history {
+				v.addHistory(entries, src.sn, node)
+			} else {
+				addMerged(entries, src.sn, node)
+			}
+		}
+	}
+
+	if v.history {
+		v.addVersions(entries)
+	}
+
+	result := make([]ViewEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	v.entries = result
+	return result, nil
+}
+
+// Lookup returns the entry name of v, ok is false if it does not exist.
+func (v *View) Lookup(ctx context.Context, repo restic.BlobLoader, name string) (e ViewEntry, ok bool, err error) {
+	entries, err := v.Entries(ctx, repo)
+	if err != nil {
+		return ViewEntry{}, false, err
+	}
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Name >= name
+	})
+	if i == len(entries) || entries[i].Name != name {
+		return ViewEntry{}, false, nil
+	}
+	return entries[i], true, nil
+}
+
+// addMerged adds node to entries unless a newer snapshot contains an entry
+// with the same name. Directories of all snapshots are merged.
+func addMerged(entries map[string]*ViewEntry, sn *restic.Snapshot, node *restic.Node) {
+	e, ok := entries[node.Name]
+	if !ok {
+		e = &ViewEntry{Name: node.Name}
+		if node.Type == restic.NodeTypeDir && node.Subtree != nil {
+			e.View = newMergedView(nil)
+		} else {
+			e.Node = node
+		}
+		entries[node.Name] = e
+	}
+
+	if e.View != nil && node.Type == restic.NodeTypeDir && node.Subtree != nil {
+		e.View.sources = append(e.View.sources, viewSource{sn: sn, tree: *node.Subtree})
+	}
+}
+
+// addHistory adds node to the history directory of its name. Entries other
+// than files and directories are ignored.
+func (v *View) addHistory(entries map[string]*ViewEntry, sn *restic.Snapshot, node *restic.Node) {
+	isDir := node.Type == restic.NodeTypeDir && node.Subtree != nil
+	if !isDir && node.Type != restic.NodeTypeFile {
+		return
+	}
+
+	e, ok := entries[node.Name]
+	if !ok {
+		e = &ViewEntry{Name: node.Name, View: newHistoryView(nil, v.timeTemplate)}
+		entries[node.Name] = e
+	}
+	if isDir {
+		e.View.sources = append(e.View.sources, viewSource{sn: sn, tree: *node.Subtree})
+	} else {
+		e.View.files = append(e.View.files, viewFile{sn: sn, node: node})
+	}
+}
+
+// addVersions adds the distinct versions of the file v to entries. A version
+// is named after the first snapshot which contains it.
+func (v *View) addVersions(entries map[string]*ViewEntry) {
+	seen := restic.NewIDSet()
+	for _, f := range v.files {
+		id := contentID(f.node)
+		if seen.Has(id) {
+			continue
+		}
+		seen.Insert(id)
+
+		name := strings.ReplaceAll(f.sn.Time.Format(v.timeTemplate), "/", "_")
+		base := name
+		for i := 1; entries[name] != nil; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		node := *f.node
+		node.Name = name
+		entries[name] = &ViewEntry{Name: name, Node: &node}
+	}
+}
+
+// contentID identifies the content of the file node.
+func contentID(node *restic.Node) restic.ID {
+	buf := make([]byte, 0, len(node.Content)*len(restic.ID{}))
+	for _, id := range node.Content {
+		buf = append(buf, id[:]...)
+	}
+	return restic.Hash(buf)
+}
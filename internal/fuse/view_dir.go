@@ -0,0 +1,128 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package fuse
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/anacrolix/fuse"
+	"github.com/anacrolix/fuse/fs"
+)
+
+// viewDir is the fuse directory of a View.
+type viewDir struct {
+	root        *Root
+	forget      forgetFn
+	inode       uint64
+	parentInode uint64
+	view        *View
+	cache       treeCache
+}
+
+// ensure that *viewDir implements these interfaces
+var _ = fs.HandleReadDirAller(&viewDir{})
+var _ = fs.NodeForgetter(&viewDir{})
+var _ = fs.NodeStringLookuper(&viewDir{})
+
+func newViewDir(root *Root, forget forgetFn, inode, parentInode uint64, view *View) *viewDir {
+	debug.Log("create view dir, inode %d", inode)
+	return &viewDir{
+		root:        root,
+		forget:      forget,
+		inode:       inode,
+		parentInode: parentInode,
+		view:        view,
+		cache:       *newTreeCache(),
+	}
+}
+
+func (d *viewDir) Attr(_ context.Context, attr *fuse.Attr) error {
+	attr.Inode = d.inode
+	attr.Mode = os.ModeDir | 0555
+	attr.Uid = d.root.uid
+	attr.Gid = d.root.gid
+	return nil
+}
+
+func (d *viewDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	debug.Log("ReadDirAll()")
+	entries, err := d.view.Entries(ctx, d.root.repo)
+	if err != nil {
+		return nil, unwrapCtxCanceled(err)
+	}
+
+	items := []fuse.Dirent{
+		{
+			Inode: d.inode,
+			Name:  ".",
+			Type:  fuse.DT_Dir,
+		},
+		{
+			Inode: d.parentInode,
+			Name:  "..",
+			Type:  fuse.DT_Dir,
+		},
+	}
+
+	for _, e := range entries {
+		typ := fuse.DT_Dir
+		if e.Node != nil {
+			switch e.Node.Type {
+			case restic.NodeTypeFile:
+				typ = fuse.DT_File
+			case restic.NodeTypeSymlink:
+				typ = fuse.DT_Link
+			default:
+				typ = fuse.DT_Unknown
+			}
+		}
+		items = append(items, fuse.Dirent{
+			Inode: inodeFromName(d.inode, e.Name),
+			Name:  e.Name,
+			Type:  typ,
+		})
+	}
+	return items, nil
+}
+
+func (d *viewDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	debug.Log("Lookup(%v)", name)
+
+	return d.cache.lookupOrCreate(name, func(forget forgetFn) (fs.Node, error) {
+		e, ok, err := d.view.Lookup(ctx, d.root.repo, name)
+		if err != nil {
+			return nil, unwrapCtxCanceled(err)
+		}
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+
+		// all versions of a file carry the same hard link information, thus
+		// always derive the inode from the name within the view
+		inode := inodeFromName(d.inode, name)
+		if e.View != nil {
+			return newViewDir(d.root, forget, inode, d.inode, e.View), nil
+		}
+		switch e.Node.Type {
+		case restic.NodeTypeFile:
+			return newFile(d.root, forget, inode, e.Node)
+		case restic.NodeTypeSymlink:
+			return newLink(d.root, forget, inode, e.Node)
+		case restic.NodeTypeDev, restic.NodeTypeCharDev, restic.NodeTypeFifo, restic.NodeTypeSocket:
+			return newOther(d.root, forget, inode, e.Node)
+		default:
+			debug.Log("  node %v has unknown type %v", name, e.Node.Type)
+			return nil, syscall.ENOENT
+		}
+	})
+}
+
+func (d *viewDir) Forget() {
+	d.forget()
+}
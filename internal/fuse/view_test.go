@@ -0,0 +1,163 @@
+package fuse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testViewSnapshot(t *testing.T, repo restic.Repository, files archiver.TestDir, ts string) *restic.Snapshot {
+	src := rtest.TempDir(t)
+	archiver.TestCreateFiles(t, src, files)
+
+	back := rtest.Chdir(t, src)
+	defer back()
+	sn := archiver.TestSnapshot(t, repo, ".", nil)
+
+	var err error
+	sn.Time, err = time.Parse("2006-01-02", ts)
+	rtest.OK(t, err)
+	return sn
+}
+
+func testViewEntries(t *testing.T, repo restic.Repository, v *View) map[string]ViewEntry {
+	entries, err := v.Entries(context.TODO(), repo)
+	rtest.OK(t, err)
+	m := make(map[string]ViewEntry)
+	for _, e := range entries {
+		m[e.Name] = e
+	}
+	return m
+}
+
+func testViewNames(entries map[string]ViewEntry) map[string]bool {
+	names := make(map[string]bool)
+	for name, e := range entries {
+		names[name] = e.View != nil
+	}
+	return names
+}
+
+func TestViewMerged(t *testing.T) {
+	repo := repository.TestRepository(t)
+	older := testViewSnapshot(t, repo, archiver.TestDir{
+		"etc": archiver.TestDir{
+			"app.conf":  archiver.TestFile{Content: "old"},
+			"old.conf":  archiver.TestFile{Content: "old"},
+			"both.conf": archiver.TestFile{Content: "file"},
+		},
+		"only-older": archiver.TestFile{Content: "older"},
+	}, "2024-01-01")
+	newer := testViewSnapshot(t, repo, archiver.TestDir{
+		"etc": archiver.TestDir{
+			"app.conf":  archiver.TestFile{Content: "newer"},
+			"new.conf":  archiver.TestFile{Content: "new"},
+			"both.conf": archiver.TestDir{},
+		},
+	}, "2024-02-01")
+
+	v := newMergedView([]viewSource{{sn: newer}, {sn: older}})
+	root := testViewEntries(t, repo, v)
+	rtest.Equals(t, map[string]bool{"etc": true, "only-older": false}, testViewNames(root))
+
+	etc := testViewEntries(t, repo, root["etc"].View)
+	rtest.Equals(t, map[string]bool{
+		"app.conf":  false,
+		"old.conf":  false,
+		"new.conf":  false,
+		"both.conf": true,
+	}, testViewNames(etc))
+	// the newest version is used
+	rtest.Equals(t, uint64(len("newer")), etc["app.conf"].Node.Size)
+
+	// snapshots which do not contain the path are skipped
+	v = newMergedView([]viewSource{{sn: newer, path: "etc"}, {sn: older, path: "missing"}})
+	rtest.Equals(t, map[string]bool{
+		"app.conf":  false,
+		"new.conf":  false,
+		"both.conf": true,
+	}, testViewNames(testViewEntries(t, repo, v)))
+}
+
+func TestViewHistory(t *testing.T) {
+	repo := repository.TestRepository(t)
+	var sources []viewSource
+	for _, test := range []struct {
+		ts      string
+		content string
+	}{
+		{"2024-01-01", "first"},
+		{"2024-01-02", "first"},
+		{"2024-01-03", "second"},
+		{"2024-01-04", "first"},
+	} {
+		sn := testViewSnapshot(t, repo, archiver.TestDir{
+			"dir": archiver.TestDir{
+				"file": archiver.TestFile{Content: test.content},
+			},
+		}, test.ts)
+		sources = append(sources, viewSource{sn: sn})
+	}
+
+	v := newHistoryView(sources, "2006-01-02")
+	root := testViewEntries(t, repo, v)
+	rtest.Equals(t, map[string]bool{"dir": true}, testViewNames(root))
+	dir := testViewEntries(t, repo, root["dir"].View)
+	rtest.Equals(t, map[string]bool{"file": true}, testViewNames(dir))
+
+	// each distinct version is listed once, named after its first snapshot
+	versions := testViewEntries(t, repo, dir["file"].View)
+	rtest.Equals(t, map[string]bool{
+		"2024-01-01": false,
+		"2024-01-03": false,
+	}, testViewNames(versions))
+	rtest.Equals(t, uint64(len("second")), versions["2024-01-03"].Node.Size)
+
+	e, ok, err := dir["file"].View.Lookup(context.TODO(), repo, "2024-01-01")
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "version not found")
+	rtest.Equals(t, "2024-01-01", e.Node.Name)
+
+	_, ok, err = dir["file"].View.Lookup(context.TODO(), repo, "2024-01-02")
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "duplicate version found")
+}
+
+type countingBlobLoader struct {
+	restic.BlobLoader
+	loads int
+}
+
+func (l *countingBlobLoader) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) ([]byte, error) {
+	l.loads++
+	return l.BlobLoader.LoadBlob(ctx, t, id, buf)
+}
+
+func TestViewEntriesCached(t *testing.T) {
+	repo := repository.TestRepository(t)
+	var sources []viewSource
+	for _, ts := range []string{"2024-01-02", "2024-01-01"} {
+		sn := testViewSnapshot(t, repo, archiver.TestDir{
+			ts: archiver.TestFile{Content: ts},
+		}, ts)
+		sources = append(sources, viewSource{sn: sn})
+	}
+
+	loader := &countingBlobLoader{BlobLoader: repo}
+	v := newMergedView(sources)
+	_, err := v.Entries(context.TODO(), loader)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, loader.loads)
+
+	// looking up entries does not load the trees again
+	for _, name := range []string{"2024-01-01", "2024-01-02", "missing"} {
+		_, _, err := v.Lookup(context.TODO(), loader, name)
+		rtest.OK(t, err)
+	}
+	rtest.Equals(t, 2, loader.loads)
+}
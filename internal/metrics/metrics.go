@@ -0,0 +1,211 @@
+// Package metrics collects values about a restic run and exports them in the
+// Prometheus text exposition format, either as a file for the textfile
+// collector of the node_exporter or via HTTP.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Type is the type of a metric.
+type Type string
+
+const (
+	// Gauge is a value which can go up and down.
+	Gauge Type = "gauge"
+	// Counter is a value which only increases.
+	Counter Type = "counter"
+)
+
+// Registry holds the current value of all metrics. The methods of a nil
+// Registry do nothing, so callers need not check whether metrics are enabled.
+type Registry struct {
+	mu          sync.Mutex
+	constLabels []string
+	families    map[string]*family
+	collectors  []func(r *Registry)
+}
+
+type family struct {
+	help   string
+	typ    Type
+	values map[string]float64 // indexed by the formatted labels
+}
+
+// NewRegistry returns a new Registry. The constant labels, given as pairs of
+// label name and value, are added to all metrics.
+func NewRegistry(constLabels ...string) *Registry {
+	if len(constLabels)%2 != 0 {
+		panic("labels must be pairs of name and value")
+	}
+	return &Registry{
+		constLabels: constLabels,
+		families:    make(map[string]*family),
+	}
+}
+
+// Set sets the value of the metric name with the given labels, which are
+// pairs of label name and value.
+func (r *Registry) Set(name string, typ Type, help string, value float64, labels ...string) {
+	if r == nil {
+		return
+	}
+	if len(labels)%2 != 0 {
+		panic("labels must be pairs of name and value")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{help: help, typ: typ, values: make(map[string]float64)}
+		r.families[name] = f
+	}
+	f.values[formatLabels(append(slices.Clone(r.constLabels), labels...))] = value
+}
+
+// Gauge sets the value of a gauge.
+func (r *Registry) Gauge(name, help string, value float64, labels ...string) {
+	r.Set(name, Gauge, help, value, labels...)
+}
+
+// OnCollect registers fn, which is called to update the metrics before they
+// are written.
+func (r *Registry) OnCollect(fn func(r *Registry)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := 0; i < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteTo writes all metrics in the Prometheus text format to w.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	for _, fn := range collectors {
+		fn(r)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		f := r.families[name]
+		_, _ = fmt.Fprintf(bw, "# HELP %s %s\n", name, helpReplacer.Replace(f.help))
+		_, _ = fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.typ)
+
+		labels := make([]string, 0, len(f.values))
+		for l := range f.values {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			_, _ = fmt.Fprintf(bw, "%s%s %s\n", name, l, formatValue(f.values[l]))
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// WriteFile writes all metrics to filename. The file is replaced atomically,
+// such that the textfile collector never reads a partially written file.
+func (r *Registry) WriteFile(filename string) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmpname := f.Name()
+
+	_, err = r.WriteTo(f)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpname, filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmpname)
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
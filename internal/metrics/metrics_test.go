@@ -0,0 +1,79 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/metrics"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+const wantMetrics = `# HELP restic_backend_requests_total Number of backend requests.
+# TYPE restic_backend_requests_total counter
+restic_backend_requests_total{command="backup",operation="load"} 12
+restic_backend_requests_total{command="backup",operation="save"} 3
+# HELP restic_backup_data_added_bytes Bytes added to the repository.
+# TYPE restic_backup_data_added_bytes gauge
+restic_backup_data_added_bytes{command="backup"} 1.5e+10
+# HELP restic_check_errors Errors found by "check",\nsee the output.
+# TYPE restic_check_errors gauge
+restic_check_errors{command="backup",path="a\"b\\c\nd"} 0
+`
+
+func newTestRegistry() *metrics.Registry {
+	r := metrics.NewRegistry("command", "backup")
+	r.Gauge("restic_backup_data_added_bytes", "Bytes added to the repository.", 15e9)
+	r.Gauge("restic_check_errors", "Errors found by \"check\",\nsee the output.", 0, "path", "a\"b\\c\nd")
+	requests := 0
+	r.OnCollect(func(r *metrics.Registry) {
+		requests++
+		r.Set("restic_backend_requests_total", metrics.Counter, "Number of backend requests.", float64(12*requests), "operation", "load")
+	})
+	r.Set("restic_backend_requests_total", metrics.Counter, "Number of backend requests.", 3, "operation", "save")
+	return r
+}
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := newTestRegistry()
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(buf.Len()), n)
+	rtest.Equals(t, wantMetrics, buf.String())
+}
+
+func TestRegistryWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "restic.prom")
+	rtest.OK(t, os.WriteFile(filename, []byte("old"), 0600))
+
+	r := newTestRegistry()
+	rtest.OK(t, r.WriteFile(filename))
+
+	buf, err := os.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, wantMetrics, string(buf))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := newTestRegistry()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	rtest.Equals(t, 200, rec.Code)
+	rtest.Equals(t, wantMetrics, rec.Body.String())
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *metrics.Registry
+	r.Gauge("restic_test", "test", 1)
+	r.OnCollect(func(*metrics.Registry) {})
+}
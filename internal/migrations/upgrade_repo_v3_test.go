@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUpgradeRepoV3(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 2)
+
+	m := &UpgradeRepoV3{}
+	ok, _, err := m.Check(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false")
+
+	rtest.OK(t, m.Apply(context.Background(), repo))
+
+	repo2 := repository.TestOpenBackend(t, be)
+	rtest.Equals(t, uint(3), repo2.Config().Version)
+
+	ok, _, err = m.Check(context.Background(), repo2)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "migration check returned true for upgraded repository")
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// CanCopyPacks reports whether pack files can be copied from repo to dstRepo
+// without decrypting them. This requires that both repositories use the same
+// master key and chunker parameters, and that dstRepo supports all blob
+// formats used by repo.
+func CanCopyPacks(repo *Repository, dstRepo *Repository) bool {
+	return *repo.Key() == *dstRepo.Key() &&
+		repo.Config().ChunkerParams() == dstRepo.Config().ChunkerParams() &&
+		repo.Config().Version <= dstRepo.Config().Version
+}
+
+// CopyPacks copies pack files from repo to dstRepo as they are, which is only
+// possible if CanCopyPacks returns true. Only packs of which all blobs are
+// contained in keepBlobs are copied, the other packs must be repacked instead.
+// The blobs of the copied packs are removed from keepBlobs and added to the
+// index of dstRepo, which is flushed afterwards. Returned is the list of
+// copied packs.
+//
+// The dictionaries of repo which are missing in dstRepo are saved to dstRepo
+// first, such that blobs compressed using them can be decompressed.
+func CopyPacks(
+	ctx context.Context,
+	repo *Repository,
+	dstRepo *Repository,
+	packs restic.IDSet,
+	keepBlobs repackBlobSet,
+	p *progress.Counter,
+) (copiedPacks restic.IDSet, err error) {
+	debug.Log("copying up to %d packs", len(packs))
+
+	if err := copyDictionaries(ctx, repo, dstRepo); err != nil {
+		return nil, err
+	}
+
+	copiedPacks = restic.NewIDSet()
+	var keepMutex sync.Mutex
+
+	wg, wgCtx := errgroup.WithContext(ctx)
+	queue := make(chan restic.PackBlobs)
+	wg.Go(func() error {
+		defer close(queue)
+		for pbs := range repo.ListPacksFromIndex(wgCtx, packs) {
+			keepMutex.Lock()
+			complete := true
+			for _, entry := range pbs.Blobs {
+				if !keepBlobs.Has(entry.BlobHandle) {
+					complete = false
+					break
+				}
+			}
+			if complete {
+				// claim the blobs, such that no other pack which contains
+				// one of them is copied
+				for _, entry := range pbs.Blobs {
+					keepBlobs.Delete(entry.BlobHandle)
+				}
+				copiedPacks.Insert(pbs.PackID)
+			}
+			keepMutex.Unlock()
+
+			if !complete {
+				debug.Log("  pack %v contains unneeded blobs, skipping", pbs.PackID.Str())
+				continue
+			}
+
+			select {
+			case queue <- pbs:
+			case <-wgCtx.Done():
+				return wgCtx.Err()
+			}
+		}
+		return wgCtx.Err()
+	})
+
+	worker := func() error {
+		for pbs := range queue {
+			if err := copyPack(wgCtx, repo, dstRepo, pbs); err != nil {
+				return err
+			}
+			p.Add(1)
+		}
+		return nil
+	}
+
+	for i := 0; i < int(repo.Connections()); i++ {
+		wg.Go(worker)
+	}
+
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := dstRepo.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return copiedPacks, nil
+}
+
+// copyPack uploads the pack to dstRepo and adds its blobs to the index. A pack
+// which already exists in dstRepo, for example as a leftover of an interrupted
+// copy, is not uploaded again.
+func copyPack(ctx context.Context, repo *Repository, dstRepo *Repository, pbs restic.PackBlobs) error {
+	isMetadata := len(pbs.Blobs) > 0 && pbs.Blobs[0].Type.IsMetadata()
+	h := backend.Handle{Type: restic.PackFile, Name: pbs.PackID.String(), IsMetadata: isMetadata}
+
+	buf, err := repo.LoadRaw(ctx, restic.PackFile, pbs.PackID)
+	if err != nil {
+		return err
+	}
+
+	fi, err := dstRepo.be.Stat(ctx, h)
+	if err != nil || fi.Size != int64(len(buf)) {
+		err = dstRepo.be.Save(ctx, h, backend.NewByteReader(buf, dstRepo.be.Hasher()))
+		if err != nil {
+			debug.Log("Save(%v) error: %v", h, err)
+			return err
+		}
+	} else {
+		debug.Log("  pack %v already exists", pbs.PackID.Str())
+	}
+
+	debug.Log("  copied pack %v", pbs.PackID.Str())
+	return dstRepo.idx.StorePack(ctx, pbs.PackID, pbs.Blobs, &internalRepository{dstRepo})
+}
+
+// copyDictionaries saves the dictionaries of repo which are missing in
+// dstRepo to dstRepo.
+func copyDictionaries(ctx context.Context, repo *Repository, dstRepo *Repository) error {
+	known := make(map[uint32]struct{})
+	for _, d := range dstRepo.Dictionaries() {
+		known[d.ID()] = struct{}{}
+	}
+
+	for _, d := range repo.Dictionaries() {
+		if _, ok := known[d.ID()]; ok {
+			continue
+		}
+		debug.Log("copying dictionary %v for %v blobs", d.ID(), d.BlobType)
+		if _, err := dstRepo.SaveDictionary(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repository_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCopyPacks(t *testing.T) {
+	repository.TestAllVersions(t, testCopyPacks)
+}
+
+func testCopyPacks(t *testing.T, version uint) {
+	random := rand.New(rand.NewSource(23))
+	repo, _, _ := repository.TestRepositoryWithVersion(t, version)
+	createRandomBlobs(t, random, repo, 100, 0.7, true)
+
+	other, _, _ := repository.TestRepositoryWithVersion(t, version)
+	rtest.Assert(t, !repository.CanCopyPacks(repo, other), "packs can be copied to a repository with a different key")
+
+	dstRepo, err := repository.New(mem.New(), repository.Options{})
+	rtest.OK(t, err)
+	params := repo.Config().ChunkerParams()
+	rtest.OK(t, dstRepo.Init(context.TODO(), version, rtest.TestPassword, &params, false, repo.Key()))
+	rtest.Assert(t, repository.CanCopyPacks(repo, dstRepo), "packs cannot be copied to a repository with the same key")
+
+	// one blob is not needed, its pack must not be copied
+	keepBlobs, _ := selectBlobs(t, random, repo, 1)
+	var skipped restic.PackedBlob
+	err = repo.ListBlobs(context.TODO(), func(pb restic.PackedBlob) {
+		skipped = pb
+	})
+	rtest.OK(t, err)
+	keepBlobs.Delete(skipped.BlobHandle)
+
+	packs := listPacks(t, repo)
+	copied, err := repository.CopyPacks(context.TODO(), repo, dstRepo, packs, keepBlobs, nil)
+	rtest.OK(t, err)
+
+	packs.Delete(skipped.PackID)
+	rtest.Equals(t, packs, copied)
+	rtest.Equals(t, packs, listPacks(t, dstRepo))
+
+	// only the other blobs of the skipped pack remain
+	remaining := restic.NewBlobSet()
+	for pbs := range repo.ListPacksFromIndex(context.TODO(), restic.NewIDSet(skipped.PackID)) {
+		for _, blob := range pbs.Blobs {
+			if blob.BlobHandle != skipped.BlobHandle {
+				remaining.Insert(blob.BlobHandle)
+			}
+		}
+	}
+	rtest.Equals(t, remaining, keepBlobs)
+
+	// the copied blobs can be loaded from the destination repository
+	var copiedBlobs []restic.BlobHandle
+	err = repo.ListBlobs(context.TODO(), func(pb restic.PackedBlob) {
+		if pb.PackID != skipped.PackID {
+			copiedBlobs = append(copiedBlobs, pb.BlobHandle)
+		}
+	})
+	rtest.OK(t, err)
+	for _, h := range copiedBlobs {
+		buf, err := dstRepo.LoadBlob(context.TODO(), h.Type, h.ID, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, h.ID, restic.Hash(buf))
+	}
+
+	// copying again does not upload anything
+	copied, err = repository.CopyPacks(context.TODO(), repo, dstRepo, packs, restic.NewBlobSet(), nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(copied))
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxDictionaryBlobSize is the size up to which blobs are compressed using a
+// dictionary. Larger blobs contain enough data to compress well on their own.
+const maxDictionaryBlobSize = 64 * 1024
+
+// Dictionary is a zstd dictionary which improves the compression of small
+// blobs of one type. A blob compressed using a dictionary references it by the
+// dictionary ID contained in the header of its zstd frame.
+type Dictionary struct {
+	Time     time.Time       `json:"time"`
+	BlobType restic.BlobType `json:"blob_type"`
+	Data     []byte          `json:"data"`
+
+	id uint32
+}
+
+// ID returns the zstd dictionary ID.
+func (d *Dictionary) ID() uint32 {
+	return d.id
+}
+
+func parseDictionary(buf []byte) (*Dictionary, error) {
+	d := &Dictionary{}
+	if err := json.Unmarshal(buf, d); err != nil {
+		return nil, err
+	}
+	if d.BlobType != restic.DataBlob && d.BlobType != restic.TreeBlob {
+		return nil, errors.Errorf("invalid blob type %v", d.BlobType)
+	}
+
+	info, err := zstd.InspectDictionary(d.Data)
+	if err != nil {
+		return nil, err
+	}
+	d.id = info.ID()
+	return d, nil
+}
+
+// latestDictionary returns the newest dictionary for blobs of type t or nil.
+func latestDictionary(dicts []*Dictionary, t restic.BlobType) *Dictionary {
+	var latest *Dictionary
+	for _, d := range dicts {
+		if d.BlobType == t && (latest == nil || d.Time.After(latest.Time)) {
+			latest = d
+		}
+	}
+	return latest
+}
+
+// loadDictionaries loads all dictionaries stored in the repository.
+func (r *Repository) loadDictionaries(ctx context.Context) error {
+	var dicts []*Dictionary
+	err := r.List(ctx, restic.DictionaryFile, func(id restic.ID, _ int64) error {
+		buf, err := r.LoadUnpacked(ctx, restic.DictionaryFile, id)
+		if err != nil {
+			return fmt.Errorf("load dictionary %v: %w", id.Str(), err)
+		}
+		d, err := parseDictionary(buf)
+		if err != nil {
+			return fmt.Errorf("invalid dictionary %v: %w", id.Str(), err)
+		}
+		debug.Log("loaded dictionary %v with ID %v for %v blobs", id.Str(), d.id, d.BlobType)
+		dicts = append(dicts, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sortDictionaries(dicts)
+	r.setDictionaries(dicts)
+	return nil
+}
+
+func (r *Repository) setDictionaries(dicts []*Dictionary) {
+	r.dictMu.Lock()
+	defer r.dictMu.Unlock()
+
+	r.dicts = dicts
+	// the encoders and the decoder are recreated on demand, users of the
+	// previous ones can continue to use them. The previous decoder is closed
+	// once it is no longer used.
+	r.dictEnc = [restic.NumBlobTypes]*zstd.Encoder{}
+	if r.dec != nil {
+		r.dec.retired = true
+		r.dec.closeIfUnused()
+		r.dec = nil
+	}
+}
+
+// Dictionaries returns the dictionaries stored in the repository.
+func (r *Repository) Dictionaries() []*Dictionary {
+	r.dictMu.Lock()
+	defer r.dictMu.Unlock()
+
+	return append([]*Dictionary(nil), r.dicts...)
+}
+
+// SaveDictionary stores d in the repository. Small blobs of the same type
+// which are saved afterwards are compressed using d.
+func (r *Repository) SaveDictionary(ctx context.Context, d *Dictionary) (restic.ID, error) {
+	if r.cfg.Version < 3 {
+		return restic.ID{}, errors.New("dictionaries require repository version 3")
+	}
+
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	id, err := r.saveUnpacked(ctx, restic.DictionaryFile, buf)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	r.setDictionaries(append(r.Dictionaries(), d))
+	return id, nil
+}
+
+// TrainOptions configure how a dictionary is trained.
+type TrainOptions struct {
+	// Size is the maximum size of the dictionary.
+	Size int
+	// MaxSamples is the maximum number of blobs used for training.
+	MaxSamples int
+}
+
+// TrainStats describe how well a dictionary compresses blobs which were not
+// used for training it.
+type TrainStats struct {
+	// Blobs is the number of candidate blobs in the repository.
+	Blobs int
+	// Samples is the number of blobs which were loaded.
+	Samples int
+	// Uncompressed is the size of the blobs used for evaluation.
+	Uncompressed uint64
+	// Compressed is their size when compressed without a dictionary.
+	Compressed uint64
+	// CompressedDict is their size when compressed with the dictionary.
+	CompressedDict uint64
+}
+
+// minTrainSamples is the minimum number of blobs required for training.
+const minTrainSamples = 100
+
+// TrainDictionary builds a dictionary for small blobs of type t from a random
+// sample of the blobs in the repository. A fifth of the samples is not used for
+// training but to evaluate the dictionary. The index must already be loaded.
+func TrainDictionary(ctx context.Context, r *Repository, t restic.BlobType, opts TrainOptions) (*Dictionary, TrainStats, error) {
+	var stats TrainStats
+
+	// reservoir sampling of the small blobs
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var selected []restic.PackedBlob
+	err := r.ListBlobs(ctx, func(pb restic.PackedBlob) {
+		if pb.Type != t || pb.DataLength() > maxDictionaryBlobSize {
+			return
+		}
+		stats.Blobs++
+		if len(selected) < opts.MaxSamples {
+			selected = append(selected, pb)
+		} else if i := rnd.Intn(stats.Blobs); i < opts.MaxSamples {
+			selected[i] = pb
+		}
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+	if len(selected) < minTrainSamples {
+		return nil, stats, errors.Errorf("only %d small %v blobs found, at least %d are required", len(selected), t, minTrainSamples)
+	}
+
+	packs := make(map[restic.ID][]restic.Blob)
+	for _, pb := range selected {
+		packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+	}
+	samples := make([][]byte, 0, len(selected))
+	for packID, blobs := range packs {
+		err := r.LoadBlobsFromPack(ctx, packID, blobs, func(_ restic.BlobHandle, buf []byte, err error) error {
+			if err != nil {
+				return err
+			}
+			samples = append(samples, append([]byte(nil), buf...))
+			return nil
+		})
+		if err != nil {
+			return nil, stats, err
+		}
+	}
+	stats.Samples = len(samples)
+	rnd.Shuffle(len(samples), func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+	eval, train := samples[:len(samples)/5], samples[len(samples)/5:]
+
+	dictID := newDictionaryID(rnd, r.Dictionaries())
+	data, err := dict.BuildZstdDict(train, dict.Options{
+		MaxDictSize: opts.Size,
+		HashBytes:   6,
+		ZstdDictID:  dictID,
+		ZstdLevel:   r.zstdLevel(),
+	})
+	if err != nil {
+		return nil, stats, fmt.Errorf("building dictionary failed: %w", err)
+	}
+	d := &Dictionary{Time: time.Now(), BlobType: t, Data: data, id: dictID}
+
+	enc, err := zstd.NewWriter(nil, append(r.zstdEncoderOptions(), zstd.WithEncoderDict(data))...)
+	if err != nil {
+		return nil, stats, err
+	}
+	defer func() {
+		_ = enc.Close()
+	}()
+	for _, buf := range eval {
+		stats.Uncompressed += uint64(len(buf))
+		stats.Compressed += uint64(len(r.getZstdEncoder().EncodeAll(buf, nil)))
+		stats.CompressedDict += uint64(len(enc.EncodeAll(buf, nil)))
+	}
+
+	return d, stats, nil
+}
+
+// newDictionaryID returns a random dictionary ID which is not used by
+// existing dictionaries. It avoids the ranges reserved by the zstd format.
+func newDictionaryID(rnd *rand.Rand, existing []*Dictionary) uint32 {
+	used := make(map[uint32]struct{}, len(existing))
+	for _, d := range existing {
+		used[d.id] = struct{}{}
+	}
+	for {
+		id := uint32(32768 + rnd.Int63n(1<<31-32768))
+		if _, ok := used[id]; !ok {
+			return id
+		}
+	}
+}
+
+// sortDictionaries sorts dictionaries by creation time.
+func sortDictionaries(dicts []*Dictionary) {
+	sort.Slice(dicts, func(i, j int) bool {
+		return dicts[i].Time.Before(dicts[j].Time)
+	})
+}
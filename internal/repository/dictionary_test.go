@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+// testTree returns JSON data which resembles a small tree blob.
+func testTree(rnd *rand.Rand) []byte {
+	buf := []byte(`{"nodes":[`)
+	for i := 0; i < 1+rnd.Intn(3); i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = fmt.Appendf(buf, `{"name":"file-%d.txt","type":"file","mode":420,"mtime":"2024-%02d-%02dT10:%02d:00.000000000+02:00",`+
+			`"atime":"2024-01-01T00:00:00+02:00","uid":1000,"gid":100,"user":"user","group":"users","inode":%d,`+
+			`"device_id":2049,"size":%d,"links":1,"content":["%v"]}`,
+			rnd.Intn(1000), 1+rnd.Intn(12), 1+rnd.Intn(28), rnd.Intn(60), rnd.Int63(), rnd.Intn(100000), restic.NewRandomID())
+	}
+	return append(buf, "]}\n"...)
+}
+
+func saveTestTrees(t *testing.T, repo *repository.Repository, rnd *rand.Rand, n int) (ids restic.IDs) {
+	var wg errgroup.Group
+	repo.StartPackUploader(context.TODO(), &wg)
+	for i := 0; i < n; i++ {
+		id, _, _, err := repo.SaveBlob(context.TODO(), restic.TreeBlob, testTree(rnd), restic.ID{}, false)
+		rtest.OK(t, err)
+		ids = append(ids, id)
+	}
+	rtest.OK(t, repo.Flush(context.Background()))
+	return ids
+}
+
+func TestDictionary(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 3)
+	rnd := rand.New(rand.NewSource(42))
+	saveTestTrees(t, repo, rnd, 500)
+
+	d, stats, err := repository.TrainDictionary(context.TODO(), repo, restic.TreeBlob, repository.TrainOptions{Size: 16 * 1024, MaxSamples: 400})
+	rtest.OK(t, err)
+	rtest.Equals(t, 500, stats.Blobs)
+	rtest.Equals(t, 400, stats.Samples)
+	rtest.Assert(t, stats.CompressedDict < stats.Compressed*3/4,
+		"dictionary did not improve compression: %d bytes without, %d bytes with dictionary", stats.Compressed, stats.CompressedDict)
+
+	_, err = repo.SaveDictionary(context.TODO(), d)
+	rtest.OK(t, err)
+
+	// blobs saved after storing the dictionary are compressed using it
+	ids := saveTestTrees(t, repo, rnd, 100)
+	var compressed, uncompressed uint
+	for _, id := range ids {
+		pbs := repo.LookupBlob(restic.TreeBlob, id)
+		rtest.Equals(t, 1, len(pbs))
+		compressed += pbs[0].Length
+		uncompressed += pbs[0].DataLength()
+	}
+	avgDict := float64(compressed) / float64(uncompressed)
+	avgPlain := float64(stats.Compressed) / float64(stats.Uncompressed)
+	rtest.Assert(t, avgDict < avgPlain, "blobs were not compressed using the dictionary: ratio %.2f, without dictionary %.2f", avgDict, avgPlain)
+
+	// a newly opened repository loads the dictionary to decompress the blobs
+	repo2 := repository.TestOpenBackend(t, be)
+	rtest.Equals(t, 1, len(repo2.Dictionaries()))
+	rtest.Equals(t, d.ID(), repo2.Dictionaries()[0].ID())
+	rtest.OK(t, repo2.LoadIndex(context.TODO(), nil))
+	for _, id := range ids {
+		buf, err := repo2.LoadBlob(context.TODO(), restic.TreeBlob, id, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, id, restic.Hash(buf))
+	}
+}
+
+func TestDictionaryRequiresV3(t *testing.T) {
+	repo, _, _ := repository.TestRepositoryWithVersion(t, 2)
+	rnd := rand.New(rand.NewSource(42))
+	saveTestTrees(t, repo, rnd, 200)
+
+	d, _, err := repository.TrainDictionary(context.TODO(), repo, restic.TreeBlob, repository.TrainOptions{Size: 16 * 1024, MaxSamples: 200})
+	rtest.OK(t, err)
+	_, err = repo.SaveDictionary(context.TODO(), d)
+	rtest.Assert(t, err != nil, "saving a dictionary in a version 2 repository must fail")
+
+	_, _, err = repository.TrainDictionary(context.TODO(), repo, restic.DataBlob, repository.TrainOptions{Size: 16 * 1024, MaxSamples: 200})
+	rtest.Assert(t, err != nil, "training without samples must fail")
+}
@@ -22,13 +22,88 @@ var (
 
 	// ErrMaxKeysReached is returned when the maximum number of keys was checked and no key could be found.
 	ErrMaxKeysReached = errors.New("maximum number of keys reached")
+
+	// ErrAppendOnly is returned when removing files from an append-only
+	// repository without using an admin key.
+	ErrAppendOnly = errors.New("repository is in append-only mode, removing data requires an admin key")
+
+	// ErrKeyRoleMismatch is returned when the role stored in plaintext in a
+	// key file differs from the role stored in its encrypted data.
+	ErrKeyRoleMismatch = errors.New("role of the key does not match its encrypted data, the key file was modified")
+)
+
+// KeyRole describes the permissions granted by a key. The role is advisory
+// only: it is enforced by restic itself, but all keys unlock the same master
+// key. A modified client can therefore use any key to read and modify all data
+// in the repository.
+type KeyRole string
+
+const (
+	// KeyRoleDefault is the role of keys without an explicit role. These keys
+	// have full access, except for removing data from append-only repositories.
+	KeyRoleDefault KeyRole = ""
+	// KeyRoleAdmin keys may also remove data from append-only repositories.
+	KeyRoleAdmin KeyRole = "admin"
+	// KeyRoleBackupOnly keys may add data and snapshots, but may neither list
+	// nor load existing snapshots.
+	KeyRoleBackupOnly KeyRole = "backup-only"
+	// KeyRoleReadOnly keys may not modify the repository.
+	KeyRoleReadOnly KeyRole = "read-only"
 )
 
+// ParseKeyRole parses the string representation of a key role.
+func ParseKeyRole(s string) (KeyRole, error) {
+	switch KeyRole(s) {
+	case KeyRoleDefault, KeyRoleAdmin, KeyRoleBackupOnly, KeyRoleReadOnly:
+		return KeyRole(s), nil
+	case "default":
+		return KeyRoleDefault, nil
+	default:
+		return "", errors.Errorf("invalid key role %q, must be one of (default|admin|backup-only|read-only)", s)
+	}
+}
+
+func (r KeyRole) String() string {
+	if r == KeyRoleDefault {
+		return "default"
+	}
+	return string(r)
+}
+
+// CanRead returns whether the role permits listing and loading snapshots.
+func (r KeyRole) CanRead() bool {
+	return r != KeyRoleBackupOnly
+}
+
+// CanWrite returns whether the role permits adding data to the repository.
+func (r KeyRole) CanWrite() bool {
+	return r != KeyRoleReadOnly
+}
+
+// CanRemove returns whether the role permits removing data and managing keys.
+func (r KeyRole) CanRemove() bool {
+	return r == KeyRoleDefault || r == KeyRoleAdmin
+}
+
+// KeyRoleError is returned when the role of the current key does not permit
+// an operation.
+type KeyRoleError struct {
+	Role KeyRole
+	Op   string
+}
+
+func (e *KeyRoleError) Error() string {
+	return fmt.Sprintf("%v key does not permit to %v", e.Role, e.Op)
+}
+
 // Key represents an encrypted master key for a repository.
 type Key struct {
 	Created  time.Time `json:"created"`
 	Username string    `json:"username"`
 	Hostname string    `json:"hostname"`
+	// Role is only informational, such that the role of a key can be shown
+	// without its password. The authenticated role is stored in Data.
+	Role KeyRole `json:"role,omitempty"`
 
 	KDF  string `json:"kdf"`
 	N    int    `json:"N"`
@@ -43,6 +118,14 @@ type Key struct {
 	id restic.ID
 }
 
+// keyData is the content of the encrypted Data field of a key. The role is
+// stored along with the master key, such that it cannot be changed without
+// the password.
+type keyData struct {
+	crypto.Key
+	Role KeyRole `json:"role,omitempty"`
+}
+
 // params tracks the parameters used for the KDF. If not set, it will be
 // calibrated on the first run of AddKey().
 var params *crypto.Params
@@ -57,8 +140,8 @@ const (
 
 // createMasterKey creates a new master key in the given backend and encrypts
 // it with the password.
-func createMasterKey(ctx context.Context, s *Repository, password string) (*Key, error) {
-	return AddKey(ctx, s, password, "", "", nil)
+func createMasterKey(ctx context.Context, s *Repository, password string, role KeyRole, template *crypto.Key) (*Key, error) {
+	return AddKey(ctx, s, password, "", "", role, template)
 }
 
 // OpenKey tries do decrypt the key specified by name with the given password.
@@ -93,12 +176,17 @@ func OpenKey(ctx context.Context, s *Repository, id restic.ID, password string)
 	}
 
 	// restore json
-	k.master = &crypto.Key{}
-	err = json.Unmarshal(buf, k.master)
+	var data keyData
+	err = json.Unmarshal(buf, &data)
 	if err != nil {
 		debug.Log("Unmarshal() returned error %v", err)
 		return nil, errors.Wrap(err, "Unmarshal")
 	}
+	if data.Role != k.Role {
+		debug.Log("key %v has role %q, but encrypted role %q", id, k.Role, data.Role)
+		return nil, ErrKeyRoleMismatch
+	}
+	k.master = &data.Key
 	k.id = id
 
 	if !k.Valid() {
@@ -193,7 +281,15 @@ func LoadKey(ctx context.Context, s *Repository, id restic.ID) (k *Key, err erro
 }
 
 // AddKey adds a new key to an already existing repository.
-func AddKey(ctx context.Context, s *Repository, password, username, hostname string, template *crypto.Key) (*Key, error) {
+func AddKey(ctx context.Context, s *Repository, password, username, hostname string, role KeyRole, template *crypto.Key) (*Key, error) {
+	if !s.keyRole.CanRemove() {
+		return nil, &KeyRoleError{Role: s.keyRole, Op: "add keys"}
+	}
+	// otherwise any key could be used to circumvent the append-only mode
+	if role == KeyRoleAdmin && s.AppendOnly() {
+		return nil, &KeyRoleError{Role: s.keyRole, Op: "add admin keys to an append-only repository"}
+	}
+
 	// make sure we have valid KDF parameters
 	if params == nil {
 		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
@@ -210,6 +306,7 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 		Created:  time.Now(),
 		Username: username,
 		Hostname: hostname,
+		Role:     role,
 
 		KDF: "scrypt",
 		N:   params.N,
@@ -249,8 +346,8 @@ func AddKey(ctx context.Context, s *Repository, password, username, hostname str
 		newkey.master = template
 	}
 
-	// encrypt master keys (as json) with user key
-	buf, err := json.Marshal(newkey.master)
+	// encrypt master keys and role (as json) with user key
+	buf, err := json.Marshal(keyData{Key: *newkey.master, Role: role})
 	if err != nil {
 		return nil, errors.Wrap(err, "Marshal")
 	}
@@ -288,6 +385,12 @@ func RemoveKey(ctx context.Context, repo *Repository, id restic.ID) error {
 	if id == repo.KeyID() {
 		return errors.New("refusing to remove key currently used to access repository")
 	}
+	if !repo.keyRole.CanRemove() {
+		return &KeyRoleError{Role: repo.keyRole, Op: "remove keys"}
+	}
+	if repo.AppendOnly() {
+		return ErrAppendOnly
+	}
 
 	h := backend.Handle{Type: restic.KeyFile, Name: id.String()}
 	return repo.be.Remove(ctx, h)
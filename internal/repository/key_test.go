@@ -0,0 +1,39 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAddKeyAppendOnly(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	be := repository.TestBackend(t)
+
+	admin, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	pol := chunker.Pol(0x3DA3358B4DC173)
+	rtest.OK(t, admin.Init(context.TODO(), restic.MinFeatureRepoVersion, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, true, nil))
+
+	key, err := repository.AddKey(context.TODO(), admin, "other", "", "", repository.KeyRoleDefault, admin.Key())
+	rtest.OK(t, err)
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.SearchKey(context.TODO(), "other", 0, key.ID().String()))
+
+	// a regular key must not be able to create an admin key
+	_, err = repository.AddKey(context.TODO(), repo, "admin", "", "", repository.KeyRoleAdmin, repo.Key())
+	var roleErr *repository.KeyRoleError
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+	_, err = repository.AddKey(context.TODO(), repo, "regular", "", "", repository.KeyRoleDefault, repo.Key())
+	rtest.OK(t, err)
+
+	_, err = repository.AddKey(context.TODO(), admin, "admin", "", "", repository.KeyRoleAdmin, admin.Key())
+	rtest.OK(t, err)
+}
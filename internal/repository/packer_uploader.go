@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"sync"
 
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
@@ -19,11 +20,17 @@ type uploadTask struct {
 
 type packerUploader struct {
 	uploadQueue chan uploadTask
+
+	// inFlight contains a channel for each queued packer, which is closed
+	// once the packer has been uploaded
+	inFlightMu sync.Mutex
+	inFlight   map[*packer]chan struct{}
 }
 
 func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker, connections uint) *packerUploader {
 	pu := &packerUploader{
 		uploadQueue: make(chan uploadTask),
+		inFlight:    make(map[*packer]chan struct{}),
 	}
 
 	for i := 0; i < int(connections); i++ {
@@ -38,6 +45,10 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker,
 					if err != nil {
 						return err
 					}
+					pu.inFlightMu.Lock()
+					close(pu.inFlight[t.packer])
+					delete(pu.inFlight, t.packer)
+					pu.inFlightMu.Unlock()
 				case <-ctx.Done():
 					return ctx.Err()
 				}
@@ -49,6 +60,10 @@ func newPackerUploader(ctx context.Context, wg *errgroup.Group, repo savePacker,
 }
 
 func (pu *packerUploader) QueuePacker(ctx context.Context, t restic.BlobType, p *packer) (err error) {
+	pu.inFlightMu.Lock()
+	pu.inFlight[p] = make(chan struct{})
+	pu.inFlightMu.Unlock()
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -58,6 +73,25 @@ func (pu *packerUploader) QueuePacker(ctx context.Context, t restic.BlobType, p
 	return nil
 }
 
+// WaitUploaded waits until all packers queued so far have been uploaded.
+func (pu *packerUploader) WaitUploaded(ctx context.Context) error {
+	pu.inFlightMu.Lock()
+	pending := make([]chan struct{}, 0, len(pu.inFlight))
+	for _, ch := range pu.inFlight {
+		pending = append(pending, ch)
+	}
+	pu.inFlightMu.Unlock()
+
+	for _, ch := range pending {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 func (pu *packerUploader) TriggerShutdown() {
 	close(pu.uploadQueue)
 }
@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository/parity"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// ParityOptions configures the creation of parity files.
+type ParityOptions struct {
+	// GroupSize is the maximum number of pack files protected by one parity
+	// file.
+	GroupSize int
+	// ParityShards is the number of pack files of a group which can be
+	// damaged at the same position and still be reconstructed.
+	ParityShards int
+}
+
+// LoadParity returns the headers of all parity files. Parity files whose
+// header cannot be read are passed to report and skipped.
+func LoadParity(ctx context.Context, repo *Repository, report func(id restic.ID, err error)) (map[restic.ID]*parity.Header, error) {
+	var m sync.Mutex
+	headers := make(map[restic.ID]*parity.Header)
+
+	err := restic.ParallelList(ctx, repo, restic.ParityFile, repo.Connections(), func(ctx context.Context, id restic.ID, size int64) error {
+		h := backend.Handle{Type: restic.ParityFile, Name: id.String()}
+		hdr, err := parity.ReadHeader(repo.Key(), backend.ReaderAt(ctx, repo.be, h), size)
+
+		m.Lock()
+		defer m.Unlock()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			debug.Log("parity file %v: %v", id.Str(), err)
+			if report != nil {
+				report(id, err)
+			}
+			return nil
+		}
+		headers[id] = hdr
+		return nil
+	})
+	return headers, err
+}
+
+// LoadParityFile loads and verifies the parity file with the given ID. The
+// content of a damaged parity file is returned along with the error, it may
+// still be partially usable.
+func LoadParityFile(ctx context.Context, repo restic.Repository, id restic.ID) (*parity.Header, []byte, error) {
+	buf, err := repo.LoadRaw(ctx, restic.ParityFile, id)
+	if buf == nil {
+		return nil, nil, err
+	}
+	h, herr := parity.ReadHeader(repo.Key(), bytes.NewReader(buf), int64(len(buf)))
+	if herr != nil {
+		return nil, buf, herr
+	}
+	return h, buf, err
+}
+
+// CreateParity creates parity files for all pack files which are not yet
+// protected by one. The pack files are split into groups of at most
+// opts.GroupSize files. Parity files which reference removed pack files or
+// which are damaged, as well as those listed in recreate, are replaced if the
+// repository allows removing files.
+func CreateParity(ctx context.Context, repo *Repository, opts ParityOptions, recreate restic.IDSet, printer progress.Printer) error {
+	if opts.GroupSize < 1 || opts.ParityShards < 1 || opts.GroupSize+opts.ParityShards > parity.MaxShards {
+		return errors.Fatalf("invalid parity parameters, the group size and the number of parity shards must be positive and at most %d in total", parity.MaxShards)
+	}
+	if !repo.keyRole.CanWrite() {
+		return &KeyRoleError{Role: repo.keyRole, Op: "save files"}
+	}
+	removeAllowed := repo.keyRole.CanRemove() && !repo.AppendOnly()
+
+	obsolete := restic.NewIDSet()
+	headers, err := LoadParity(ctx, repo, func(id restic.ID, err error) {
+		printer.E("parity file %v is damaged: %v\n", id, err)
+		obsolete.Insert(id)
+	})
+	if err != nil {
+		return err
+	}
+	for id := range recreate {
+		if _, ok := headers[id]; !ok && !obsolete.Has(id) {
+			return errors.Fatalf("parity file %v does not exist", id)
+		}
+	}
+
+	packs := make(map[restic.ID]int64)
+	err = repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		packs[id] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	covered := restic.NewIDSet()
+	for id, h := range headers {
+		replace := recreate.Has(id)
+		for _, p := range h.Packs {
+			if _, ok := packs[p.ID]; !ok {
+				replace = true
+			}
+		}
+		if replace && removeAllowed {
+			obsolete.Insert(id)
+			continue
+		}
+		for _, p := range h.Packs {
+			covered.Insert(p.ID)
+		}
+	}
+
+	type packInfo struct {
+		id   restic.ID
+		size int64
+	}
+	var todo []packInfo
+	for id, size := range packs {
+		if !covered.Has(id) {
+			todo = append(todo, packInfo{id, size})
+		}
+	}
+	// group pack files of similar size to reduce the padding
+	sort.Slice(todo, func(i, j int) bool {
+		if todo[i].size != todo[j].size {
+			return todo[i].size > todo[j].size
+		}
+		return todo[i].id.String() < todo[j].id.String()
+	})
+
+	printer.P("creating parity files for %d pack files\n", len(todo))
+	bar := printer.NewCounter("packs processed")
+	bar.SetMax(uint64(len(todo)))
+	for start := 0; start < len(todo); start += opts.GroupSize {
+		group := todo[start:min(start+opts.GroupSize, len(todo))]
+
+		enc := parity.NewEncoder(opts.ParityShards, parity.DefaultBlockSize, group[0].size)
+		for _, p := range group {
+			buf, err := repo.LoadRaw(ctx, restic.PackFile, p.id)
+			if errors.Is(err, restic.ErrInvalidData) {
+				printer.E("pack %v is damaged and cannot be protected, run `restic check --read-data` for details\n", p.id)
+				bar.Add(1)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := enc.Add(p.id, buf); err != nil {
+				return err
+			}
+			bar.Add(1)
+		}
+		if enc.Len() == 0 {
+			continue
+		}
+
+		if err := saveParityFile(ctx, repo, enc); err != nil {
+			return err
+		}
+	}
+	bar.Done()
+
+	if len(obsolete) == 0 {
+		return nil
+	}
+	if !removeAllowed {
+		printer.E("damaged parity files cannot be removed from this repository\n")
+		return nil
+	}
+
+	// only remove the old parity files after the replacements are saved
+	printer.P("removing %d obsolete parity files\n", len(obsolete))
+	bar = printer.NewCounter("files deleted")
+	err = restic.ParallelRemove(ctx, &internalRepository{repo}, obsolete, restic.ParityFile, nil, bar)
+	bar.Done()
+	return err
+}
+
+func saveParityFile(ctx context.Context, repo *Repository, enc *parity.Encoder) error {
+	buf, err := enc.Finalize(repo.Key())
+	if err != nil {
+		return err
+	}
+
+	h := backend.Handle{Type: restic.ParityFile, Name: restic.Hash(buf).String()}
+	err = repo.be.Save(ctx, h, backend.NewByteReader(buf, repo.be.Hasher()))
+	if err != nil {
+		debug.Log("Save(%v) error: %v", h, err)
+		return err
+	}
+	debug.Log("saved parity file %v", h)
+	return nil
+}
+
+// ReconstructPacks rebuilds the given pack files from the other pack files of
+// their group and the parity file of the group. The rebuilt pack files replace
+// the damaged ones. Returned are the pack files which were rebuilt.
+func ReconstructPacks(ctx context.Context, repo *Repository, ids restic.IDSet, printer progress.Printer) (restic.IDSet, error) {
+	headers, err := LoadParity(ctx, repo, func(id restic.ID, err error) {
+		printer.E("parity file %v is damaged: %v\n", id, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rebuilt := restic.NewIDSet()
+	for parityID, h := range headers {
+		var indexes []int
+		for i, p := range h.Packs {
+			if ids.Has(p.ID) && !rebuilt.Has(p.ID) {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			continue
+		}
+
+		data, err := reconstructGroup(ctx, repo, parityID, h, indexes)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			printer.E("unable to rebuild pack files using parity file %v: %v\n", parityID, err)
+			continue
+		}
+
+		for n, i := range indexes {
+			id := h.Packs[i].ID
+			if err := replacePack(ctx, repo, id, data[n]); err != nil {
+				return nil, err
+			}
+			printer.P("rebuilt pack %v using parity file %v\n", id, parityID.Str())
+			rebuilt.Insert(id)
+		}
+	}
+	return rebuilt, nil
+}
+
+func reconstructGroup(ctx context.Context, repo *Repository, parityID restic.ID, h *parity.Header, indexes []int) ([][]byte, error) {
+	packs := make([][]byte, len(h.Packs))
+	for i, p := range h.Packs {
+		// damaged pack files may still contain intact blocks
+		buf, err := repo.LoadRaw(ctx, restic.PackFile, p.ID)
+		if err != nil {
+			debug.Log("loading pack %v failed: %v", p.ID.Str(), err)
+		}
+		packs[i] = buf
+	}
+
+	_, parityData, err := LoadParityFile(ctx, repo, parityID)
+	if err != nil {
+		debug.Log("loading parity file %v failed: %v", parityID.Str(), err)
+	}
+	return parity.Reconstruct(h, packs, parityData, indexes)
+}
+
+// replacePack replaces the pack file id with buf, which has already been
+// verified to match the ID. Backends which cannot atomically replace files
+// require removing the damaged pack file first. If saving buf fails
+// afterwards, buf is stored in a local temporary directory.
+func replacePack(ctx context.Context, repo *Repository, id restic.ID, buf []byte) error {
+	isMetadata := false
+	for pbs := range repo.ListPacksFromIndex(ctx, restic.NewIDSet(id)) {
+		isMetadata = len(pbs.Blobs) > 0 && pbs.Blobs[0].Type.IsMetadata()
+	}
+	h := backend.Handle{Type: restic.PackFile, Name: id.String(), IsMetadata: isMetadata}
+
+	if repo.be.Properties().HasAtomicReplace {
+		return repo.be.Save(ctx, h, backend.NewByteReader(buf, repo.be.Hasher()))
+	}
+
+	err := repo.be.Remove(ctx, h)
+	if err != nil && !repo.be.IsNotExist(err) {
+		return fmt.Errorf("removing damaged pack %v failed: %w", id.Str(), err)
+	}
+	err = repo.be.Save(ctx, h, backend.NewByteReader(buf, repo.be.Hasher()))
+	if err == nil {
+		return nil
+	}
+
+	tempdir, terr := os.MkdirTemp("", "restic-rebuilt-pack-")
+	if terr == nil {
+		terr = os.WriteFile(filepath.Join(tempdir, id.String()), buf, 0o600)
+	}
+	if terr != nil {
+		return fmt.Errorf("saving rebuilt pack %v failed: %w, storing a local copy failed as well: %v", id.Str(), err, terr)
+	}
+	return fmt.Errorf("saving rebuilt pack %v failed: %w, a copy of the pack file is stored in %v", id.Str(), err, tempdir)
+}
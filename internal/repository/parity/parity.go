@@ -0,0 +1,267 @@
+// Package parity computes Reed-Solomon parity data for groups of pack files
+// and implements the format of the parity files which store it.
+package parity
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// DefaultBlockSize is the size of the blocks into which pack files are split.
+// Damage is detected and repaired per block, thus a damaged sector only
+// affects the block containing it.
+const DefaultBlockSize = 256 * 1024
+
+const headerLengthSize = 4
+
+// maxHeaderSize limits the size of the header of a parity file.
+const maxHeaderSize = 64 * 1024 * 1024
+
+// Header describes the contents of a parity file. The file starts with the
+// parity shards, each of which consists of Blocks() blocks, followed by the
+// encrypted header and its length as an uint32 in little endian encoding.
+type Header struct {
+	BlockSize int `json:"block_size"`
+	// Packs lists the data shards.
+	Packs []Pack `json:"packs"`
+	// Parity contains the hashes of the blocks of each parity shard.
+	Parity []restic.IDs `json:"parity"`
+}
+
+// Pack is a pack file protected by a parity file.
+type Pack struct {
+	ID   restic.ID `json:"id"`
+	Size int64     `json:"size"`
+	// Blocks contains the hashes of the blocks of the pack file. The last
+	// block may be shorter than the block size.
+	Blocks restic.IDs `json:"blocks"`
+}
+
+// Blocks returns the number of blocks per shard.
+func (h *Header) Blocks() int {
+	blocks := 0
+	for _, p := range h.Packs {
+		blocks = max(blocks, len(p.Blocks))
+	}
+	return blocks
+}
+
+// Contains returns the index of the pack file id in the group or -1.
+func (h *Header) Contains(id restic.ID) int {
+	for i, p := range h.Packs {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Encoder computes the parity data for a group of pack files.
+type Encoder struct {
+	header Header
+	buf    []byte
+	parity [][]byte
+}
+
+// NewEncoder returns an encoder which computes the given number of parity
+// shards for pack files of at most maxSize bytes.
+func NewEncoder(parityShards int, blockSize int, maxSize int64) *Encoder {
+	blocks := int((maxSize + int64(blockSize) - 1) / int64(blockSize))
+	shardSize := blocks * blockSize
+
+	e := &Encoder{
+		header: Header{BlockSize: blockSize},
+		buf:    make([]byte, parityShards*shardSize),
+	}
+	for j := 0; j < parityShards; j++ {
+		e.parity = append(e.parity, e.buf[j*shardSize:(j+1)*shardSize])
+	}
+	return e
+}
+
+// Add adds the pack file with the given content to the group.
+func (e *Encoder) Add(id restic.ID, data []byte) error {
+	if len(data) > len(e.buf)/max(len(e.parity), 1) {
+		return errors.Errorf("pack %v is larger than expected", id.Str())
+	}
+	if len(e.header.Packs)+len(e.parity) >= MaxShards {
+		return errors.New("too many pack files")
+	}
+
+	p := Pack{ID: id, Size: int64(len(data))}
+	for off := 0; off < len(data); off += e.header.BlockSize {
+		p.Blocks = append(p.Blocks, restic.Hash(data[off:min(off+e.header.BlockSize, len(data))]))
+	}
+	encode(e.parity, len(e.header.Packs), data)
+	e.header.Packs = append(e.header.Packs, p)
+	return nil
+}
+
+// Len returns the number of pack files added to the group.
+func (e *Encoder) Len() int {
+	return len(e.header.Packs)
+}
+
+// Finalize returns the content of the parity file. The encoder must not be
+// used afterwards.
+func (e *Encoder) Finalize(k *crypto.Key) ([]byte, error) {
+	// parity shards only need as many blocks as the largest pack file
+	blocks := e.header.Blocks()
+	buf := e.buf[:0]
+	for _, shard := range e.parity {
+		shard = shard[:blocks*e.header.BlockSize]
+		hashes := make(restic.IDs, 0, blocks)
+		for off := 0; off < len(shard); off += e.header.BlockSize {
+			hashes = append(hashes, restic.Hash(shard[off:off+e.header.BlockSize]))
+		}
+		e.header.Parity = append(e.header.Parity, hashes)
+		// the shards are stored consecutively in e.buf, thus this only moves
+		// the data if the last blocks are unused
+		buf = append(buf, shard...)
+	}
+
+	header, err := json.Marshal(e.header)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := crypto.NewRandomNonce()
+	buf = append(buf, nonce...)
+	buf = k.Seal(buf, nonce, header, nil)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(crypto.CiphertextLength(len(header))))
+	return buf, nil
+}
+
+// ReadHeader reads and decrypts the header of the parity file accessible via
+// rd, size is the size of the file.
+func ReadHeader(k *crypto.Key, rd io.ReaderAt, size int64) (*Header, error) {
+	if size < headerLengthSize+int64(crypto.CiphertextLength(0)) {
+		return nil, errors.New("parity file is too short")
+	}
+
+	var lenBuf [headerLengthSize]byte
+	if _, err := rd.ReadAt(lenBuf[:], size-headerLengthSize); err != nil {
+		return nil, err
+	}
+	hlen := int64(binary.LittleEndian.Uint32(lenBuf[:]))
+	if hlen < int64(crypto.CiphertextLength(0)) || hlen > size-headerLengthSize || hlen > maxHeaderSize {
+		return nil, errors.Errorf("invalid parity header length %d", hlen)
+	}
+
+	buf := make([]byte, hlen)
+	if _, err := rd.ReadAt(buf, size-headerLengthSize-hlen); err != nil {
+		return nil, err
+	}
+	return decodeHeader(k, buf, size-headerLengthSize-hlen)
+}
+
+func decodeHeader(k *crypto.Key, buf []byte, dataSize int64) (*Header, error) {
+	nonce, ciphertext := buf[:k.NonceSize()], buf[k.NonceSize():]
+	plaintext, err := k.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting parity header failed: %w", err)
+	}
+
+	h := &Header{}
+	if err := json.Unmarshal(plaintext, h); err != nil {
+		return nil, fmt.Errorf("invalid parity header: %w", err)
+	}
+
+	blocks := h.Blocks()
+	if h.BlockSize <= 0 || len(h.Packs) == 0 || len(h.Packs)+len(h.Parity) > MaxShards {
+		return nil, errors.New("invalid parity header")
+	}
+	for _, p := range h.Packs {
+		if int64(len(p.Blocks)) != (p.Size+int64(h.BlockSize)-1)/int64(h.BlockSize) {
+			return nil, errors.Errorf("invalid number of blocks for pack %v", p.ID.Str())
+		}
+	}
+	for _, hashes := range h.Parity {
+		if len(hashes) != blocks {
+			return nil, errors.New("invalid number of parity blocks")
+		}
+	}
+	if dataSize != int64(len(h.Parity)*blocks*h.BlockSize) {
+		return nil, errors.Errorf("parity data has size %d, expected %d", dataSize, len(h.Parity)*blocks*h.BlockSize)
+	}
+	return h, nil
+}
+
+// Reconstruct rebuilds the pack files of the group with the given indexes.
+// packs contains the data of the pack files in the order of h.Packs, missing
+// pack files are nil. parity is the content of the parity file and may also be
+// nil. The data of all files may be damaged, only blocks which match their
+// hash are used.
+func Reconstruct(h *Header, packs [][]byte, parity []byte, indexes []int) ([][]byte, error) {
+	dataShards := len(h.Packs)
+	if len(packs) != dataShards {
+		return nil, errors.Errorf("expected %d pack files, got %d", dataShards, len(packs))
+	}
+
+	result := make([][]byte, len(indexes))
+	for n, i := range indexes {
+		result[n] = make([]byte, h.Packs[i].Size)
+	}
+
+	bs := h.BlockSize
+	blocks := h.Blocks()
+	shards := make([][]byte, dataShards+len(h.Parity))
+	for b := 0; b < blocks; b++ {
+		for i, p := range h.Packs {
+			shards[i] = dataBlock(p, packs[i], b, bs)
+		}
+		for j, hashes := range h.Parity {
+			shards[dataShards+j] = nil
+			off := (j*blocks + b) * bs
+			if off+bs <= len(parity) && restic.Hash(parity[off:off+bs]) == hashes[b] {
+				shards[dataShards+j] = parity[off : off+bs]
+			}
+		}
+
+		if err := reconstruct(shards, dataShards); err != nil {
+			return nil, fmt.Errorf("block %d: %w", b, err)
+		}
+
+		for n, i := range indexes {
+			if b < len(h.Packs[i].Blocks) {
+				copy(result[n][b*bs:], shards[i])
+			}
+		}
+	}
+
+	for n, i := range indexes {
+		if restic.Hash(result[n]) != h.Packs[i].ID {
+			return nil, errors.Errorf("reconstructed pack %v does not match its ID", h.Packs[i].ID.Str())
+		}
+		debug.Log("reconstructed pack %v", h.Packs[i].ID.Str())
+	}
+	return result, nil
+}
+
+// dataBlock returns block b of the pack file padded to the block size, or nil
+// if the block is damaged.
+func dataBlock(p Pack, data []byte, b int, bs int) []byte {
+	if b >= len(p.Blocks) {
+		// the pack file is padded with zeros
+		return make([]byte, bs)
+	}
+
+	start := b * bs
+	end := min(start+bs, int(p.Size))
+	if end > len(data) || restic.Hash(data[start:end]) != p.Blocks[b] {
+		return nil
+	}
+	if end-start == bs {
+		return data[start:end]
+	}
+	block := make([]byte, bs)
+	copy(block, data[start:end])
+	return block
+}
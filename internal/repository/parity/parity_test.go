@@ -0,0 +1,105 @@
+package parity_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/repository/parity"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+const blockSize = 1024
+
+func newGroup(t *testing.T, random *rand.Rand, parityShards int, sizes []int) (*parity.Header, [][]byte, []byte, *crypto.Key) {
+	k := crypto.NewRandomKey()
+
+	maxSize := 0
+	for _, size := range sizes {
+		maxSize = max(maxSize, size)
+	}
+
+	var packs [][]byte
+	enc := parity.NewEncoder(parityShards, blockSize, int64(maxSize))
+	for _, size := range sizes {
+		data := make([]byte, size)
+		_, _ = random.Read(data)
+		rtest.OK(t, enc.Add(restic.Hash(data), data))
+		packs = append(packs, data)
+	}
+	rtest.Equals(t, len(sizes), enc.Len())
+
+	buf, err := enc.Finalize(k)
+	rtest.OK(t, err)
+
+	h, err := parity.ReadHeader(k, bytes.NewReader(buf), int64(len(buf)))
+	rtest.OK(t, err)
+	rtest.Equals(t, len(sizes), len(h.Packs))
+	rtest.Equals(t, parityShards, len(h.Parity))
+	return h, packs, buf, k
+}
+
+func damage(data []byte, off int) []byte {
+	damaged := append([]byte{}, data...)
+	damaged[off] ^= 0xff
+	return damaged
+}
+
+func TestReconstruct(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	h, packs, parityData, _ := newGroup(t, random, 2, []int{5000, 3 * blockSize, 100, 4500})
+
+	// a missing pack and a damaged block in the same row, and damaged blocks
+	// in other rows
+	damaged := [][]byte{
+		damage(packs[0], 10),
+		damage(damage(packs[1], blockSize+20), 2*blockSize+5),
+		nil,
+		damage(packs[3], 4*blockSize),
+	}
+
+	rebuilt, err := parity.Reconstruct(h, damaged, parityData, []int{0, 1, 2, 3})
+	rtest.OK(t, err)
+	for i := range packs {
+		rtest.Assert(t, bytes.Equal(packs[i], rebuilt[i]), "pack %d was not reconstructed correctly", i)
+	}
+
+	// damaged parity blocks are not used
+	parityData = damage(parityData, 0)
+	_, err = parity.Reconstruct(h, damaged, parityData, []int{0})
+	rtest.Assert(t, errors.Is(err, parity.ErrTooManyMissing), "expected too many missing error, got %v", err)
+
+	rebuilt, err = parity.Reconstruct(h, [][]byte{packs[0], packs[1], nil, packs[3]}, parityData, []int{2})
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(packs[2], rebuilt[0]), "pack was not reconstructed correctly")
+}
+
+func TestReconstructWithoutParity(t *testing.T) {
+	random := rand.New(rand.NewSource(23))
+	h, packs, _, _ := newGroup(t, random, 1, []int{2000, 2000})
+
+	rebuilt, err := parity.Reconstruct(h, packs, nil, []int{1})
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(packs[1], rebuilt[0]), "intact pack was not returned")
+
+	_, err = parity.Reconstruct(h, [][]byte{packs[0], nil}, nil, []int{1})
+	rtest.Assert(t, errors.Is(err, parity.ErrTooManyMissing), "expected too many missing error, got %v", err)
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	_, _, buf, k := newGroup(t, random, 1, []int{100})
+
+	_, err := parity.ReadHeader(crypto.NewRandomKey(), bytes.NewReader(buf), int64(len(buf)))
+	rtest.Assert(t, err != nil, "header decrypted with wrong key")
+
+	damaged := damage(buf, len(buf)-10)
+	_, err = parity.ReadHeader(k, bytes.NewReader(damaged), int64(len(damaged)))
+	rtest.Assert(t, err != nil, "damaged header was accepted")
+
+	_, err = parity.ReadHeader(k, bytes.NewReader(buf[1:]), int64(len(buf)-1))
+	rtest.Assert(t, err != nil, "truncated parity file was accepted")
+}
@@ -0,0 +1,180 @@
+package parity
+
+import (
+	"github.com/restic/restic/internal/errors"
+)
+
+// MaxShards is the maximum number of data and parity shards of a code.
+const MaxShards = 256
+
+// ErrTooManyMissing is returned if fewer shards than data shards are
+// available, such that the missing shards cannot be reconstructed.
+var ErrTooManyMissing = errors.New("too many shards are missing")
+
+// Arithmetic in GF(2^8) uses the polynomial x^8+x^4+x^3+x^2+1, the same as
+// most other Reed-Solomon implementations.
+var (
+	expTable [2 * 255]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+// gfInv returns the multiplicative inverse of a, which must not be zero.
+func gfInv(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// mulAdd computes dst ^= c * src. dst must be at least as long as src.
+func mulAdd(dst, src []byte, c byte) {
+	switch c {
+	case 0:
+		return
+	case 1:
+		for i, v := range src {
+			dst[i] ^= v
+		}
+		return
+	}
+
+	lc := int(logTable[c])
+	for i, v := range src {
+		if v != 0 {
+			dst[i] ^= expTable[lc+int(logTable[v])]
+		}
+	}
+}
+
+// coefficient returns the factor with which data shard i contributes to
+// parity shard j. The coefficients form a Cauchy matrix, every square
+// submatrix of which is invertible. As the coefficients do not depend on the
+// number of data shards, parity can be computed by adding one data shard
+// after the other.
+func coefficient(j, i int) byte {
+	return gfInv(byte(MaxShards-1-j) ^ byte(i))
+}
+
+// encode adds the data shard with index i to the parity shards.
+func encode(parity [][]byte, i int, data []byte) {
+	for j := range parity {
+		mulAdd(parity[j], data, coefficient(j, i))
+	}
+}
+
+// reconstruct fills in the missing data shards, which are nil, using the
+// available data and parity shards. The first dataShards entries of shards
+// are the data shards, all present shards must have the same length. Missing
+// parity shards are not recomputed.
+func reconstruct(shards [][]byte, dataShards int) error {
+	var missing []int
+	for i := 0; i < dataShards; i++ {
+		if shards[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// select dataShards available shards and the rows of the generator
+	// matrix that produced them
+	var rows []int
+	for i, shard := range shards {
+		if shard != nil {
+			rows = append(rows, i)
+		}
+		if len(rows) == dataShards {
+			break
+		}
+	}
+	if len(rows) < dataShards {
+		return ErrTooManyMissing
+	}
+
+	m := make([][]byte, dataShards)
+	for r, row := range rows {
+		m[r] = make([]byte, dataShards)
+		if row < dataShards {
+			m[r][row] = 1
+		} else {
+			for i := range m[r] {
+				m[r][i] = coefficient(row-dataShards, i)
+			}
+		}
+	}
+
+	inv, err := invert(m)
+	if err != nil {
+		return err
+	}
+
+	size := len(shards[rows[0]])
+	for _, i := range missing {
+		shard := make([]byte, size)
+		for r, row := range rows {
+			mulAdd(shard, shards[row], inv[i][r])
+		}
+		shards[i] = shard
+	}
+	return nil
+}
+
+// invert returns the inverse of the square matrix m using Gauss-Jordan
+// elimination. m is modified.
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = make([]byte, n)
+		inv[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if m[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("matrix is singular")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		scale := gfInv(m[col][col])
+		for i := 0; i < n; i++ {
+			m[col][i] = gfMul(m[col][i], scale)
+			inv[col][i] = gfMul(inv[col][i], scale)
+		}
+
+		for r := 0; r < n; r++ {
+			if r == col || m[r][col] == 0 {
+				continue
+			}
+			f := m[r][col]
+			mulAdd(m[r], m[col], f)
+			mulAdd(inv[r], inv[col], f)
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,141 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+func listParityGroups(t *testing.T, repo *repository.Repository) map[restic.ID]restic.ID {
+	headers, err := repository.LoadParity(context.TODO(), repo, func(id restic.ID, err error) {
+		t.Errorf("parity file %v: %v", id, err)
+	})
+	rtest.OK(t, err)
+
+	groups := make(map[restic.ID]restic.ID)
+	for parityID, h := range headers {
+		for _, p := range h.Packs {
+			_, ok := groups[p.ID]
+			rtest.Assert(t, !ok, "pack %v is contained in several parity files", p.ID)
+			groups[p.ID] = parityID
+		}
+	}
+	return groups
+}
+
+func TestParity(t *testing.T) {
+	repository.TestAllVersions(t, testParity)
+}
+
+func testParity(t *testing.T, version uint) {
+	random := rand.New(rand.NewSource(42))
+	repo, _, be := repository.TestRepositoryWithVersion(t, version)
+	createRandomBlobs(t, random, repo, 200, 0.7, true)
+	packs := listPacks(t, repo)
+	rtest.Assert(t, len(packs) > 4, "expected more pack files, got %v", len(packs))
+
+	opts := repository.ParityOptions{GroupSize: 3, ParityShards: 1}
+	rtest.OK(t, repository.CreateParity(context.TODO(), repo, opts, nil, &progress.NoopPrinter{}))
+	groups := listParityGroups(t, repo)
+	rtest.Equals(t, len(packs), len(groups))
+	parityFiles := listFiles(t, repo, restic.ParityFile)
+	rtest.Equals(t, (len(packs)+2)/3, len(parityFiles))
+
+	// all pack files are already protected
+	rtest.OK(t, repository.CreateParity(context.TODO(), repo, opts, nil, &progress.NoopPrinter{}))
+	rtest.Equals(t, parityFiles, listFiles(t, repo, restic.ParityFile))
+
+	// damage a pack file and remove another one of a different group
+	damaged := restic.NewIDSet()
+	for id := range packs {
+		if len(damaged) == 0 || groups[id] != groups[damaged.List()[0]] {
+			damaged.Insert(id)
+		}
+		if len(damaged) == 2 {
+			break
+		}
+	}
+	ids := damaged.List()
+	replaceFile(t, be, backend.Handle{Type: backend.PackFile, Name: ids[0].String()}, func(buf []byte) []byte {
+		buf[len(buf)/2] ^= 0xff
+		return buf
+	})
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: backend.PackFile, Name: ids[1].String()}))
+
+	rebuilt, err := repository.ReconstructPacks(context.TODO(), repo, damaged, &progress.NoopPrinter{})
+	rtest.OK(t, err)
+	rtest.Equals(t, damaged, rebuilt)
+	for id := range damaged {
+		_, err := repo.LoadRaw(context.TODO(), restic.PackFile, id)
+		rtest.OK(t, err)
+	}
+
+	// the parity file of a removed pack file is replaced
+	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: backend.PackFile, Name: ids[0].String()}))
+	packs.Delete(ids[0])
+	rtest.OK(t, repository.CreateParity(context.TODO(), repo, opts, nil, &progress.NoopPrinter{}))
+	newGroups := listParityGroups(t, repo)
+	rtest.Equals(t, len(packs), len(newGroups))
+	for id := range packs {
+		if groups[id] == groups[ids[0]] {
+			rtest.Assert(t, newGroups[id] != groups[id], "pack %v still uses the obsolete parity file", id)
+		} else {
+			rtest.Equals(t, groups[id], newGroups[id])
+		}
+	}
+	rtest.Assert(t, !listFiles(t, repo, restic.ParityFile).Has(groups[ids[0]]), "obsolete parity file was not removed")
+}
+
+// failingPackSaveBackend fails to save pack files once fail is set.
+type failingPackSaveBackend struct {
+	backend.Backend
+	fail bool
+}
+
+func (be *failingPackSaveBackend) Save(ctx context.Context, h backend.Handle, rd backend.RewindReader) error {
+	if be.fail && h.Type == backend.PackFile {
+		return errors.New("save failed")
+	}
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func TestParityReplaceFailed(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	be := &failingPackSaveBackend{Backend: mem.New()}
+	repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+	createRandomBlobs(t, random, repo, 20, 0.7, true)
+	opts := repository.ParityOptions{GroupSize: 3, ParityShards: 1}
+	rtest.OK(t, repository.CreateParity(context.TODO(), repo, opts, nil, &progress.NoopPrinter{}))
+
+	id := listPacks(t, repo).List()[0]
+	replaceFile(t, be, backend.Handle{Type: backend.PackFile, Name: id.String()}, func(buf []byte) []byte {
+		buf[len(buf)/2] ^= 0xff
+		return buf
+	})
+
+	// the memory backend cannot replace files, a local copy of the rebuilt
+	// pack file must be kept if saving it fails
+	be.fail = true
+	_, err := repository.ReconstructPacks(context.TODO(), repo, restic.NewIDSet(id), &progress.NoopPrinter{})
+	rtest.Assert(t, err != nil, "expected saving the rebuilt pack to fail")
+	match := regexp.MustCompile(`stored in (.*)$`).FindStringSubmatch(err.Error())
+	rtest.Assert(t, match != nil, "missing local copy in error %v", err)
+	defer func() {
+		_ = os.RemoveAll(match[1])
+	}()
+
+	buf, err := os.ReadFile(filepath.Join(match[1], id.String()))
+	rtest.OK(t, err)
+	rtest.Equals(t, id, restic.Hash(buf))
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"slices"
 	"sort"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository/index"
@@ -49,6 +51,7 @@ type PruneStats struct {
 		Repackrm     uint64
 		Unref        uint64
 		Uncompressed uint64
+		Retained     uint64
 	}
 	Packs struct {
 		Used       uint
@@ -58,6 +61,7 @@ type PruneStats struct {
 		Keep       uint
 		Repack     uint
 		Remove     uint
+		Retained   uint
 	}
 }
 
@@ -108,6 +112,12 @@ func PlanPrune(ctx context.Context, opts PruneOptions, repo *Repository, getUsed
 	if opts.SmallPackBytes > uint64(repo.packSize()) {
 		return nil, fmt.Errorf("repack-smaller-than exceeds repository packsize")
 	}
+	if !opts.DryRun && !repo.keyRole.CanRemove() {
+		return nil, &KeyRoleError{Role: repo.keyRole, Op: "prune"}
+	}
+	if !opts.DryRun && repo.AppendOnly() {
+		return nil, ErrAppendOnly
+	}
 
 	usedBlobs := index.NewAssociatedSet[uint8](repo.idx)
 	err := getUsedBlobs(ctx, repo, usedBlobs)
@@ -325,6 +335,8 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 	removePacks := restic.NewIDSet()
 	repackPacks := restic.NewIDSet()
 
+	unrefPacks := make(map[restic.ID]int64)
+	var removeCandidates []packInfoWithID
 	var repackCandidates []packInfoWithID
 	var repackSmallCandidates []packInfoWithID
 	repoVersion := repo.Config().Version
@@ -344,9 +356,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 		p, ok := indexPack[id]
 		if !ok {
 			// Pack was not referenced in index and is not used  => immediately remove!
-			printer.V("will remove pack %v as it is unused and not indexed\n", id.Str())
-			removePacksFirst.Insert(id)
-			stats.Size.Unref += uint64(packSize)
+			unrefPacks[id] = packSize
 			return nil
 		}
 
@@ -383,9 +393,7 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 		switch {
 		case p.usedBlobs == 0:
 			// All blobs in pack are no longer used => remove pack!
-			removePacks.Insert(id)
-			stats.Blobs.Remove += p.unusedBlobs
-			stats.Size.Remove += p.unusedSize
+			removeCandidates = append(removeCandidates, packInfoWithID{ID: id, packInfo: p})
 
 		case opts.RepackCacheableOnly && p.tpe == restic.DataBlob:
 			// if this is a data pack and --repack-cacheable-only is set => keep pack!
@@ -441,6 +449,57 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 		}
 	}
 
+	// packs which the backend protects from removal can neither be removed nor
+	// repacked until their retention period has expired
+	candidates := restic.NewIDSet()
+	for id := range unrefPacks {
+		candidates.Insert(id)
+	}
+	for _, list := range [][]packInfoWithID{removeCandidates, repackCandidates, repackSmallCandidates} {
+		for _, p := range list {
+			candidates.Insert(p.ID)
+		}
+	}
+	retained, err := repo.RetainedFiles(ctx, restic.PackFile, candidates)
+	if err != nil {
+		return PrunePlan{}, err
+	}
+	isRetained := func(id restic.ID) bool {
+		until, ok := retained[id]
+		if ok {
+			printer.V("will keep pack %v as it is retained until %v\n", id.Str(), until.Format(time.RFC3339))
+			stats.Packs.Retained++
+		}
+		return ok
+	}
+	keepRetained := func(p packInfoWithID) bool {
+		if !isRetained(p.ID) {
+			return false
+		}
+		stats.Packs.Keep++
+		stats.Size.Retained += p.unusedSize
+		return true
+	}
+
+	for id, packSize := range unrefPacks {
+		if isRetained(id) {
+			continue
+		}
+		printer.V("will remove pack %v as it is unused and not indexed\n", id.Str())
+		removePacksFirst.Insert(id)
+		stats.Size.Unref += uint64(packSize)
+	}
+	for _, p := range removeCandidates {
+		if keepRetained(p) {
+			continue
+		}
+		removePacks.Insert(p.ID)
+		stats.Blobs.Remove += p.unusedBlobs
+		stats.Size.Remove += p.unusedSize
+	}
+	repackCandidates = slices.DeleteFunc(repackCandidates, keepRetained)
+	repackSmallCandidates = slices.DeleteFunc(repackSmallCandidates, keepRetained)
+
 	if len(repackSmallCandidates) < 10 {
 		// too few small files to be worth the trouble, this also prevents endlessly repacking
 		// if there is just a single pack file below the target size
@@ -485,7 +544,8 @@ func decidePackAction(ctx context.Context, opts PruneOptions, repo *Repository,
 	maxUnusedSizeAfter := opts.MaxUnusedBytes(stats.Size.Used)
 
 	for _, p := range repackCandidates {
-		remainingUnusedSize := stats.Size.Duplicate + stats.Size.Unused - stats.Size.Remove - stats.Size.Repackrm
+		// unused data in retained packs cannot be removed yet and is therefore tolerated
+		remainingUnusedSize := stats.Size.Duplicate + stats.Size.Unused - stats.Size.Remove - stats.Size.Repackrm - stats.Size.Retained
 		reachedUnusedSizeAfter := remainingUnusedSize < maxUnusedSizeAfter
 		reachedRepackSize := stats.Size.Repack+p.unusedSize+p.usedSize >= opts.MaxRepackBytes
 		packIsLargeEnough := p.unusedSize+p.usedSize >= uint64(targetPackSize)
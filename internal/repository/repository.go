@@ -33,12 +33,13 @@ const MaxPackSize = 128 * 1024 * 1024
 
 // Repository is used to access a repository in a backend.
 type Repository struct {
-	be    backend.Backend
-	cfg   restic.Config
-	key   *crypto.Key
-	keyID restic.ID
-	idx   *index.MasterIndex
-	cache *cache.Cache
+	be      backend.Backend
+	cfg     restic.Config
+	key     *crypto.Key
+	keyID   restic.ID
+	keyRole KeyRole
+	idx     *index.MasterIndex
+	cache   *cache.Cache
 
 	opts Options
 
@@ -49,9 +50,30 @@ type Repository struct {
 	packerCount int
 
 	allocEnc sync.Once
-	allocDec sync.Once
 	enc      *zstd.Encoder
-	dec      *zstd.Decoder
+
+	// dictMu protects the dictionaries and the encoders and decoder which
+	// depend on them
+	dictMu  sync.Mutex
+	dicts   []*Dictionary
+	dictEnc [restic.NumBlobTypes]*zstd.Encoder
+	dec     *sharedDecoder
+}
+
+// sharedDecoder is a decoder which is used concurrently. Once it is replaced,
+// it is closed as soon as all its users have released it. The fields are
+// protected by Repository.dictMu.
+type sharedDecoder struct {
+	dec     *zstd.Decoder
+	users   int
+	retired bool
+}
+
+// closeIfUnused closes the decoder if it was replaced and is no longer used.
+func (d *sharedDecoder) closeIfUnused() {
+	if d.retired && d.users == 0 {
+		d.dec.Close()
+	}
 }
 
 // internalRepository allows using SaveUnpacked and RemoveUnpacked with all FileTypes
@@ -148,6 +170,13 @@ func New(be backend.Backend, opts Options) (*Repository, error) {
 // setConfig assigns the given config and updates the repository parameters accordingly
 func (r *Repository) setConfig(cfg restic.Config) {
 	r.cfg = cfg
+
+	if cfg.HasFeature(restic.FeatureAppendOnly) {
+		// let the storage server know that it should not expect deletions
+		if be := backend.AsBackend[backend.AppendOnlyAnnouncer](r.be); be != nil {
+			be.AnnounceAppendOnly()
+		}
+	}
 }
 
 // Config returns the repository configuration.
@@ -183,6 +212,10 @@ func (r *Repository) SetDryRun() {
 func (r *Repository) LoadUnpacked(ctx context.Context, t restic.FileType, id restic.ID) ([]byte, error) {
 	debug.Log("load %v with id %v", t, id)
 
+	if t == restic.SnapshotFile && !r.keyRole.CanRead() {
+		return nil, &KeyRoleError{Role: r.keyRole, Op: "load snapshots"}
+	}
+
 	if t == restic.ConfigFile {
 		id = restic.ID{}
 	}
@@ -284,8 +317,10 @@ func (r *Repository) loadBlob(ctx context.Context, blobs []restic.PackedBlob, bu
 			continue
 		}
 
-		it := newPackBlobIterator(blob.PackID, newByteReader(buf), blob.Offset, []restic.Blob{blob.Blob}, r.key, r.getZstdDecoder())
+		dec, release := r.getZstdDecoder()
+		it := newPackBlobIterator(blob.PackID, newByteReader(buf), blob.Offset, []restic.Blob{blob.Blob}, r.key, dec)
 		pbv, err := it.Next()
+		release()
 
 		if err == nil {
 			err = pbv.Err
@@ -313,33 +348,35 @@ func (r *Repository) loadBlob(ctx context.Context, blobs []restic.PackedBlob, bu
 	return nil, errors.Errorf("loading %v from %v packs failed", blobs[0].BlobHandle, len(blobs))
 }
 
-func (r *Repository) getZstdEncoder() *zstd.Encoder {
-	r.allocEnc.Do(func() {
-
-		var level zstd.EncoderLevel
-		switch r.opts.Compression {
-		case CompressionFastest:
-			level = zstd.SpeedFastest
-		case CompressionBetter:
-			level = zstd.SpeedBetterCompression
-		case CompressionMax:
-			level = zstd.SpeedBestCompression
-		default:
-			level = zstd.SpeedDefault
-		}
+func (r *Repository) zstdLevel() zstd.EncoderLevel {
+	switch r.opts.Compression {
+	case CompressionFastest:
+		return zstd.SpeedFastest
+	case CompressionBetter:
+		return zstd.SpeedBetterCompression
+	case CompressionMax:
+		return zstd.SpeedBestCompression
+	default:
+		return zstd.SpeedDefault
+	}
+}
 
-		opts := []zstd.EOption{
-			// Set the compression level configured.
-			zstd.WithEncoderLevel(level),
-			// Disable CRC, we have enough checks in place, makes the
-			// compressed data four bytes shorter.
-			zstd.WithEncoderCRC(false),
-			// Set a window of 512kbyte, so we have good lookbehind for usual
-			// blob sizes.
-			zstd.WithWindowSize(512 * 1024),
-		}
+func (r *Repository) zstdEncoderOptions() []zstd.EOption {
+	return []zstd.EOption{
+		// Set the compression level configured.
+		zstd.WithEncoderLevel(r.zstdLevel()),
+		// Disable CRC, we have enough checks in place, makes the
+		// compressed data four bytes shorter.
+		zstd.WithEncoderCRC(false),
+		// Set a window of 512kbyte, so we have good lookbehind for usual
+		// blob sizes.
+		zstd.WithWindowSize(512 * 1024),
+	}
+}
 
-		enc, err := zstd.NewWriter(nil, opts...)
+func (r *Repository) getZstdEncoder() *zstd.Encoder {
+	r.allocEnc.Do(func() {
+		enc, err := zstd.NewWriter(nil, r.zstdEncoderOptions()...)
 		if err != nil {
 			panic(err)
 		}
@@ -348,23 +385,76 @@ func (r *Repository) getZstdEncoder() *zstd.Encoder {
 	return r.enc
 }
 
-func (r *Repository) getZstdDecoder() *zstd.Decoder {
-	r.allocDec.Do(func() {
-		opts := []zstd.DOption{
+// getBlobEncoder returns the encoder for a blob of type t which is length
+// bytes large. Small blobs are compressed using the latest dictionary for
+// their type, if there is one.
+func (r *Repository) getBlobEncoder(t restic.BlobType, length int) *zstd.Encoder {
+	if length > maxDictionaryBlobSize {
+		return r.getZstdEncoder()
+	}
+
+	r.dictMu.Lock()
+	defer r.dictMu.Unlock()
+
+	if r.dictEnc[t] == nil {
+		d := latestDictionary(r.dicts, t)
+		if d == nil {
+			return r.getZstdEncoder()
+		}
+		enc, err := zstd.NewWriter(nil, append(r.zstdEncoderOptions(), zstd.WithEncoderDict(d.Data))...)
+		if err != nil {
+			panic(err)
+		}
+		r.dictEnc[t] = enc
+	}
+	return r.dictEnc[t]
+}
+
+// getZstdDecoder returns the decoder for blobs and a function which must be
+// called once the decoder is no longer used.
+func (r *Repository) getZstdDecoder() (*zstd.Decoder, func()) {
+	r.dictMu.Lock()
+	defer r.dictMu.Unlock()
+
+	if r.dec == nil {
+		dec, err := r.newZstdDecoder(
 			// Use all available cores.
 			zstd.WithDecoderConcurrency(0),
 			// Limit the maximum decompressed memory. Set to a very high,
 			// conservative value.
-			zstd.WithDecoderMaxMemory(16 * 1024 * 1024 * 1024),
-		}
-
-		dec, err := zstd.NewReader(nil, opts...)
+			zstd.WithDecoderMaxMemory(16*1024*1024*1024),
+		)
 		if err != nil {
 			panic(err)
 		}
-		r.dec = dec
-	})
-	return r.dec
+		r.dec = &sharedDecoder{dec: dec}
+	}
+
+	d := r.dec
+	d.users++
+	return d.dec, func() {
+		r.dictMu.Lock()
+		defer r.dictMu.Unlock()
+
+		d.users--
+		d.closeIfUnused()
+	}
+}
+
+// NewZstdDecoder returns a new decoder which is able to decompress all blobs
+// in the repository, including those compressed using a dictionary.
+func (r *Repository) NewZstdDecoder(opts ...zstd.DOption) (*zstd.Decoder, error) {
+	r.dictMu.Lock()
+	defer r.dictMu.Unlock()
+
+	return r.newZstdDecoder(opts...)
+}
+
+func (r *Repository) newZstdDecoder(opts ...zstd.DOption) (*zstd.Decoder, error) {
+	for _, d := range r.dicts {
+		opts = append(opts, zstd.WithDecoderDicts(d.Data))
+	}
+	return zstd.NewReader(nil, opts...)
 }
 
 // saveAndEncrypt encrypts data and stores it to the backend as type t. If data
@@ -382,7 +472,7 @@ func (r *Repository) saveAndEncrypt(ctx context.Context, t restic.BlobType, data
 		// compressed.
 		if r.opts.Compression != CompressionOff || t != restic.DataBlob {
 			uncompressedLength = len(data)
-			data = r.getZstdEncoder().EncodeAll(data, nil)
+			data = r.getBlobEncoder(t, len(data)).EncodeAll(data, nil)
 		}
 	}
 
@@ -427,7 +517,9 @@ func (r *Repository) verifyCiphertext(buf []byte, uncompressedLength int, id res
 	if uncompressedLength != 0 {
 		// DecodeAll will allocate a slice if it is not large enough since it
 		// knows the decompressed size (because we're using EncodeAll)
-		plaintext, err = r.getZstdDecoder().DecodeAll(plaintext, nil)
+		dec, release := r.getZstdDecoder()
+		plaintext, err = dec.DecodeAll(plaintext, nil)
+		release()
 		if err != nil {
 			return fmt.Errorf("decompression failed: %w", err)
 		}
@@ -470,7 +562,9 @@ func (r *Repository) decompressUnpacked(p []byte) ([]byte, error) {
 		return nil, errors.New("not supported encoding format")
 	}
 
-	return r.getZstdDecoder().DecodeAll(p[1:], nil)
+	dec, release := r.getZstdDecoder()
+	defer release()
+	return dec.DecodeAll(p[1:], nil)
 }
 
 // SaveUnpacked encrypts data and stores it in the backend. Returned is the
@@ -484,6 +578,11 @@ func (r *internalRepository) SaveUnpacked(ctx context.Context, t restic.FileType
 }
 
 func (r *Repository) saveUnpacked(ctx context.Context, t restic.FileType, buf []byte) (id restic.ID, err error) {
+	// read-only keys must still be able to lock the repository
+	if t != restic.LockFile && !r.keyRole.CanWrite() {
+		return restic.ID{}, &KeyRoleError{Role: r.keyRole, Op: "save files"}
+	}
+
 	p := buf
 	if t != restic.ConfigFile {
 		p, err = r.compressUnpacked(p)
@@ -553,9 +652,28 @@ func (r *internalRepository) RemoveUnpacked(ctx context.Context, t restic.FileTy
 }
 
 func (r *Repository) removeUnpacked(ctx context.Context, t restic.FileType, id restic.ID) error {
+	if err := r.checkRemove(t); err != nil {
+		return err
+	}
 	return r.be.Remove(ctx, backend.Handle{Type: t, Name: id.String()})
 }
 
+// checkRemove returns an error if files of type t must not be removed with
+// the current key.
+func (r *Repository) checkRemove(t restic.FileType) error {
+	// lock files must remain removable, otherwise the repository is locked forever
+	if t == restic.LockFile {
+		return nil
+	}
+	if !r.keyRole.CanRemove() {
+		return &KeyRoleError{Role: r.keyRole, Op: "remove files"}
+	}
+	if r.AppendOnly() {
+		return ErrAppendOnly
+	}
+	return nil
+}
+
 // Flush saves all remaining packs and the index
 func (r *Repository) Flush(ctx context.Context) error {
 	if err := r.flushPacks(ctx); err != nil {
@@ -565,6 +683,28 @@ func (r *Repository) Flush(ctx context.Context) error {
 	return r.idx.Flush(ctx, &internalRepository{r})
 }
 
+// Checkpoint uploads all blobs saved so far and writes the index, such that
+// the blobs can be referenced by a snapshot. Unlike Flush, the pack uploader
+// keeps running and blobs can be saved concurrently. Blobs which are saved
+// while Checkpoint is running may or may not be included.
+func (r *Repository) Checkpoint(ctx context.Context) error {
+	if r.packerWg == nil {
+		return errors.New("pack uploader is not running")
+	}
+
+	if err := r.treePM.Flush(ctx); err != nil {
+		return err
+	}
+	if err := r.dataPM.Flush(ctx); err != nil {
+		return err
+	}
+	if err := r.uploader.WaitUploaded(ctx); err != nil {
+		return err
+	}
+
+	return r.idx.Flush(ctx, &internalRepository{r})
+}
+
 func (r *Repository) StartPackUploader(ctx context.Context, wg *errgroup.Group) {
 	if r.packerWg != nil {
 		panic("uploader already started")
@@ -625,6 +765,11 @@ func (r *Repository) ListBlobs(ctx context.Context, fn func(restic.PackedBlob))
 	return r.idx.Each(ctx, fn)
 }
 
+// IndexIDs returns the IDs of all index files which were loaded or saved.
+func (r *Repository) IndexIDs() restic.IDSet {
+	return r.idx.IDs()
+}
+
 func (r *Repository) ListPacksFromIndex(ctx context.Context, packs restic.IDSet) <-chan restic.PackBlobs {
 	return r.idx.ListPacks(ctx, packs)
 }
@@ -773,13 +918,16 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 
 	oldKey := r.key
 	oldKeyID := r.keyID
+	oldKeyRole := r.keyRole
 
 	r.key = key.master
 	r.keyID = key.ID()
+	r.keyRole = key.Role
 	cfg, err := restic.LoadConfig(ctx, r)
 	if err != nil {
 		r.key = oldKey
 		r.keyID = oldKeyID
+		r.keyRole = oldKeyRole
 
 		if err == crypto.ErrUnauthenticated {
 			return fmt.Errorf("config or key %v is damaged: %w", key.ID(), err)
@@ -788,12 +936,19 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	}
 
 	r.setConfig(cfg)
+
+	if cfg.Version >= 3 {
+		if err := r.loadDictionaries(ctx); err != nil {
+			return fmt.Errorf("dictionaries cannot be loaded: %w", err)
+		}
+	}
 	return nil
 }
 
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol) error {
+// saves the repository config. If masterKey is not nil, it is used as the
+// master key instead of a new random one.
+func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerParams *restic.ChunkerParams, appendOnly bool, masterKey *crypto.Key) error {
 	if version > restic.MaxRepoVersion {
 		return fmt.Errorf("repository version %v too high", version)
 	}
@@ -831,23 +986,52 @@ func (r *Repository) Init(ctx context.Context, version uint, password string, ch
 	if err != nil {
 		return err
 	}
-	if chunkerPolynomial != nil {
-		cfg.ChunkerPolynomial = *chunkerPolynomial
+	if chunkerParams != nil {
+		if chunkerParams.Polynomial != 0 {
+			cfg.ChunkerPolynomial = chunkerParams.Polynomial
+		}
+		cfg.ChunkerMinSize = chunkerParams.MinSize
+		cfg.ChunkerAvgSize = chunkerParams.AvgSize
+		cfg.ChunkerMaxSize = chunkerParams.MaxSize
+		if err := cfg.ChunkerParams().Validate(); err != nil {
+			return errors.Fatalf("invalid chunker parameters: %v", err)
+		}
+		if chunkerParams.CustomSizes() {
+			if err := cfg.RequireFeature(restic.FeatureChunkerSizes); err != nil {
+				return errors.Fatalf("custom chunk sizes are not supported: %v", err)
+			}
+		}
+	}
+	if appendOnly {
+		if err := cfg.RequireFeature(restic.FeatureAppendOnly); err != nil {
+			return errors.Fatalf("the append-only mode is not supported: %v", err)
+		}
+	}
+	if backend.AsBackend[backend.TieredBackend](r.be) != nil {
+		if err := cfg.RequireFeature(restic.FeatureColdTier); err != nil {
+			return errors.Fatalf("a cold tier is not supported: %v", err)
+		}
 	}
 
-	return r.init(ctx, password, cfg)
+	return r.init(ctx, password, cfg, masterKey)
 }
 
 // init creates a new master key with the supplied password and uses it to save
-// the config into the repo.
-func (r *Repository) init(ctx context.Context, password string, cfg restic.Config) error {
-	key, err := createMasterKey(ctx, r, password)
+// the config into the repo. The key of an append-only repository is an admin key.
+func (r *Repository) init(ctx context.Context, password string, cfg restic.Config, masterKey *crypto.Key) error {
+	role := KeyRoleDefault
+	if cfg.HasFeature(restic.FeatureAppendOnly) {
+		role = KeyRoleAdmin
+	}
+
+	key, err := createMasterKey(ctx, r, password, role, masterKey)
 	if err != nil {
 		return err
 	}
 
 	r.key = key.master
 	r.keyID = key.ID()
+	r.keyRole = key.Role
 	r.setConfig(cfg)
 	return restic.SaveConfig(ctx, &internalRepository{r}, cfg)
 }
@@ -862,8 +1046,22 @@ func (r *Repository) KeyID() restic.ID {
 	return r.keyID
 }
 
+// KeyRole returns the role of the current key.
+func (r *Repository) KeyRole() KeyRole {
+	return r.keyRole
+}
+
+// AppendOnly returns whether removing files from the repository is forbidden
+// with the current key.
+func (r *Repository) AppendOnly() bool {
+	return r.cfg.HasFeature(restic.FeatureAppendOnly) && r.keyRole != KeyRoleAdmin
+}
+
 // List runs fn for all files of type t in the repo.
 func (r *Repository) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
+	if t == restic.SnapshotFile && !r.keyRole.CanRead() {
+		return &KeyRoleError{Role: r.keyRole, Op: "list snapshots"}
+	}
 	return r.be.List(ctx, t, func(fi backend.FileInfo) error {
 		id, err := restic.ParseID(fi.Name)
 		if err != nil {
@@ -915,6 +1113,9 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 	if int64(len(buf)) > math.MaxUint32 {
 		return restic.ID{}, false, 0, fmt.Errorf("blob is larger than 4GB")
 	}
+	if !r.keyRole.CanWrite() {
+		return restic.ID{}, false, 0, &KeyRoleError{Role: r.keyRole, Op: "save blobs"}
+	}
 
 	// compute plaintext hash if not already set
 	if id.IsNull() {
@@ -953,7 +1154,9 @@ const maxUnusedRange = 1 * 1024 * 1024
 // then LoadBlobsFromPack will abort and not retry it. The buf passed to the callback is only valid within
 // this specific call. The callback must not keep a reference to buf.
 func (r *Repository) LoadBlobsFromPack(ctx context.Context, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
-	return streamPack(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, packID, blobs, handleBlobFn)
+	dec, release := r.getZstdDecoder()
+	defer release()
+	return streamPack(ctx, r.be.Load, r.LoadBlob, dec, r.key, packID, blobs, handleBlobFn)
 }
 
 func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, packID restic.ID, blobs []restic.Blob, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
@@ -224,7 +224,7 @@ func testStreamPack(t *testing.T, version uint) {
 	switch version {
 	case 1:
 		compress = false
-	case 2:
+	case 2, 3:
 		compress = true
 	default:
 		t.Fatal("test does not support repository version", version)
@@ -577,3 +577,26 @@ func TestStreamPackFallback(t *testing.T) {
 		test(t, true)
 	})
 }
+
+func TestZstdDecoderReplaced(t *testing.T) {
+	repo, _, _ := TestRepositoryWithVersion(t, 2)
+	compressed := repo.getZstdEncoder().EncodeAll([]byte("foobar"), nil)
+
+	dec, release := repo.getZstdDecoder()
+	// the decoder must remain usable until it is released
+	repo.setDictionaries(nil)
+	buf, err := dec.DecodeAll(compressed, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+
+	release()
+	_, err = dec.DecodeAll(compressed, nil)
+	rtest.Assert(t, errors.Is(err, zstd.ErrDecoderClosed), "expected closed decoder, got %v", err)
+
+	// a new decoder is created on demand
+	dec, release = repo.getZstdDecoder()
+	defer release()
+	buf, err = dec.DecodeAll(compressed, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, "foobar", string(buf))
+}
@@ -12,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/backend/cache"
 	"github.com/restic/restic/internal/backend/local"
@@ -475,12 +476,12 @@ func TestNoDoubleInit(t *testing.T) {
 	rtest.OK(t, err)
 
 	pol := r.Config().ChunkerPolynomial
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, false, nil)
 	rtest.Assert(t, strings.Contains(err.Error(), "repository master key and config already initialized"), "expected config exist error, got %q", err)
 
 	// must also prevent init if only keys exist
 	rtest.OK(t, be.Remove(context.TODO(), backend.Handle{Type: backend.ConfigFile}))
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, false, nil)
 	rtest.Assert(t, strings.Contains(err.Error(), "repository already contains keys"), "expected already contains keys error, got %q", err)
 
 	// must also prevent init if a snapshot exists and keys were deleted
@@ -490,6 +491,119 @@ func TestNoDoubleInit(t *testing.T) {
 	rtest.OK(t, be.List(context.TODO(), restic.KeyFile, func(fi backend.FileInfo) error {
 		return be.Remove(context.TODO(), backend.Handle{Type: restic.KeyFile, Name: fi.Name})
 	}))
-	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &pol)
+	err = repo.Init(context.TODO(), r.Config().Version, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, false, nil)
 	rtest.Assert(t, strings.Contains(err.Error(), "repository already contains snapshots"), "expected already contains snapshots error, got %q", err)
 }
+
+func TestAppendOnly(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	be := repository.TestBackend(t)
+
+	admin, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	pol := chunker.Pol(0x3DA3358B4DC173)
+	// older versions of restic must refuse to open an append-only repository
+	err = admin.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, true, nil)
+	rtest.Assert(t, err != nil, "append-only mode must require repository version 3")
+	rtest.OK(t, admin.Init(context.TODO(), restic.MinFeatureRepoVersion, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, true, nil))
+	rtest.Assert(t, admin.Config().HasFeature(restic.FeatureAppendOnly), "append-only feature not required")
+	rtest.Equals(t, repository.KeyRoleAdmin, admin.KeyRole())
+	rtest.Assert(t, !admin.AppendOnly(), "admin key must be allowed to remove data")
+
+	key, err := repository.AddKey(context.TODO(), admin, "other", "", "", repository.KeyRoleDefault, admin.Key())
+	rtest.OK(t, err)
+
+	repo, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.SearchKey(context.TODO(), "other", 0, key.ID().String()))
+	rtest.Assert(t, repo.AppendOnly(), "regular key must not be allowed to remove data")
+
+	id, err := repo.SaveUnpacked(context.TODO(), restic.WriteableSnapshotFile, []byte("{}"))
+	rtest.OK(t, err)
+	err = repo.RemoveUnpacked(context.TODO(), restic.WriteableSnapshotFile, id)
+	rtest.Assert(t, errors.Is(err, repository.ErrAppendOnly), "expected append-only error, got %v", err)
+	err = repository.RemoveKey(context.TODO(), repo, admin.KeyID())
+	rtest.Assert(t, errors.Is(err, repository.ErrAppendOnly), "expected append-only error, got %v", err)
+
+	rtest.OK(t, admin.RemoveUnpacked(context.TODO(), restic.WriteableSnapshotFile, id))
+	rtest.OK(t, repository.RemoveKey(context.TODO(), admin, key.ID()))
+}
+
+func TestKeyRoles(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	be := repository.TestBackend(t)
+
+	admin, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	pol := chunker.Pol(0x3DA3358B4DC173)
+	rtest.OK(t, admin.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, false, nil))
+
+	openWithRole := func(role repository.KeyRole) *repository.Repository {
+		key, err := repository.AddKey(context.TODO(), admin, role.String(), "", "", role, admin.Key())
+		rtest.OK(t, err)
+		repo, err := repository.New(be, repository.Options{})
+		rtest.OK(t, err)
+		rtest.OK(t, repo.SearchKey(context.TODO(), role.String(), 0, key.ID().String()))
+		rtest.Equals(t, role, repo.KeyRole())
+		return repo
+	}
+
+	id, err := admin.SaveUnpacked(context.TODO(), restic.WriteableSnapshotFile, []byte("{}"))
+	rtest.OK(t, err)
+
+	var roleErr *repository.KeyRoleError
+
+	backupOnly := openWithRole(repository.KeyRoleBackupOnly)
+	_, err = backupOnly.SaveUnpacked(context.TODO(), restic.WriteableSnapshotFile, []byte("{}"))
+	rtest.OK(t, err)
+	_, err = backupOnly.LoadUnpacked(context.TODO(), restic.SnapshotFile, id)
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+	err = backupOnly.List(context.TODO(), restic.SnapshotFile, func(restic.ID, int64) error { return nil })
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+	err = backupOnly.RemoveUnpacked(context.TODO(), restic.WriteableSnapshotFile, id)
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+	_, err = repository.AddKey(context.TODO(), backupOnly, "foo", "", "", repository.KeyRoleDefault, backupOnly.Key())
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+
+	readOnly := openWithRole(repository.KeyRoleReadOnly)
+	_, err = readOnly.LoadUnpacked(context.TODO(), restic.SnapshotFile, id)
+	rtest.OK(t, err)
+	_, err = readOnly.SaveUnpacked(context.TODO(), restic.WriteableSnapshotFile, []byte("{}"))
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+	err = readOnly.RemoveUnpacked(context.TODO(), restic.WriteableSnapshotFile, id)
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+
+	rtest.OK(t, admin.RemoveUnpacked(context.TODO(), restic.WriteableSnapshotFile, id))
+}
+
+func TestKeyRoleModified(t *testing.T) {
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	be := repository.TestBackend(t)
+
+	admin, err := repository.New(be, repository.Options{})
+	rtest.OK(t, err)
+	pol := chunker.Pol(0x3DA3358B4DC173)
+	rtest.OK(t, admin.Init(context.TODO(), restic.StableRepoVersion, rtest.TestPassword, &restic.ChunkerParams{Polynomial: pol}, false, nil))
+
+	key, err := repository.AddKey(context.TODO(), admin, "backup", "", "", repository.KeyRoleBackupOnly, admin.Key())
+	rtest.OK(t, err)
+
+	// raise the plaintext role of the key and store it as a new key file
+	buf, err := admin.LoadRaw(context.TODO(), restic.KeyFile, key.ID())
+	rtest.OK(t, err)
+	modified := bytes.Replace(buf, []byte(`"role":"backup-only"`), []byte(`"role":"admin"`), 1)
+	rtest.Assert(t, !bytes.Equal(buf, modified), "role not found in key file %s", buf)
+	id := restic.Hash(modified)
+	h := backend.Handle{Type: restic.KeyFile, Name: id.String()}
+	rtest.OK(t, be.Save(context.TODO(), h, backend.NewByteReader(modified, be.Hasher())))
+
+	_, err = repository.OpenKey(context.TODO(), admin, id, "backup")
+	rtest.Assert(t, errors.Is(err, repository.ErrKeyRoleMismatch), "expected role mismatch error, got %v", err)
+
+	k, err := repository.OpenKey(context.TODO(), admin, key.ID(), "backup")
+	rtest.OK(t, err)
+	rtest.Equals(t, repository.KeyRoleBackupOnly, k.Role)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/sync/errgroup"
+)
+
+// RetainedFiles returns the files of type t in ids which the backend protects
+// from removal, for example using S3 object lock, together with the time until
+// which they are retained.
+func (r *Repository) RetainedFiles(ctx context.Context, t restic.FileType, ids restic.IDSet) (map[restic.ID]time.Time, error) {
+	retained := make(map[restic.ID]time.Time)
+	be := backend.AsBackend[backend.Retainer](r.be)
+	if be == nil || len(ids) == 0 {
+		return retained, nil
+	}
+
+	now := time.Now()
+	var mu sync.Mutex
+	ch := make(chan restic.ID)
+	wg, ctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		defer close(ch)
+		for id := range ids {
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < int(r.Connections()); i++ {
+		wg.Go(func() error {
+			for id := range ch {
+				until, err := be.RetainedUntil(ctx, backend.Handle{Type: t, Name: id.String()})
+				if err != nil {
+					return err
+				}
+				if until.After(now) {
+					mu.Lock()
+					retained[id] = until
+					mu.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+
+	return retained, wg.Wait()
+}
@@ -0,0 +1,98 @@
+package repository_test
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui/progress"
+)
+
+// retainingBackend protects the files in retained from removal.
+type retainingBackend struct {
+	backend.Backend
+	retained map[backend.Handle]time.Time
+}
+
+func (be *retainingBackend) RetainedUntil(_ context.Context, h backend.Handle) (time.Time, error) {
+	return be.retained[h], nil
+}
+
+func TestRetainedFiles(t *testing.T) {
+	be := &retainingBackend{Backend: repository.TestBackend(t), retained: make(map[backend.Handle]time.Time)}
+	repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+
+	ids := restic.NewIDSet()
+	for i := 0; i < 5; i++ {
+		ids.Insert(restic.NewRandomID())
+	}
+	until := time.Now().Add(time.Hour)
+	var expired, locked restic.ID
+	for id := range ids {
+		if expired.IsNull() {
+			expired = id
+			be.retained[backend.Handle{Type: restic.SnapshotFile, Name: id.String()}] = time.Now().Add(-time.Hour)
+		} else if locked.IsNull() {
+			locked = id
+			be.retained[backend.Handle{Type: restic.SnapshotFile, Name: id.String()}] = until
+		}
+	}
+
+	retained, err := repo.RetainedFiles(context.TODO(), restic.SnapshotFile, ids)
+	rtest.OK(t, err)
+	rtest.Equals(t, map[restic.ID]time.Time{locked: until}, retained)
+
+	retained, err = repo.RetainedFiles(context.TODO(), restic.IndexFile, ids)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(retained))
+}
+
+func TestPruneRetained(t *testing.T) {
+	seed := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(seed))
+	t.Logf("rand initialized with seed %d", seed)
+
+	be := &retainingBackend{Backend: repository.TestBackend(t), retained: make(map[backend.Handle]time.Time)}
+	repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	createRandomBlobs(t, random, repo, 5, 0.5, true)
+	keep, _ := selectBlobs(t, random, repo, 0.5)
+
+	// protect half of the packs from removal
+	retained := restic.NewIDSet()
+	for id := range listPacks(t, repo) {
+		if len(retained) == 0 || random.Intn(2) == 0 {
+			retained.Insert(id)
+			be.retained[backend.Handle{Type: restic.PackFile, Name: id.String()}] = time.Now().Add(time.Hour)
+		}
+	}
+
+	plan, err := repository.PlanPrune(context.TODO(), repository.PruneOptions{
+		MaxRepackBytes: math.MaxUint64,
+		MaxUnusedBytes: func(used uint64) (unused uint64) { return 0 },
+	}, repo, func(ctx context.Context, repo restic.Repository, usedBlobs restic.FindBlobSet) error {
+		for blob := range keep {
+			usedBlobs.Insert(blob)
+		}
+		return nil
+	}, &progress.NoopPrinter{})
+	rtest.OK(t, err)
+	rtest.Assert(t, plan.Stats().Packs.Retained > 0, "expected retained packs, got %+v", plan.Stats().Packs)
+	rtest.OK(t, plan.Execute(context.TODO(), &progress.NoopPrinter{}))
+
+	// retained packs are neither removed nor repacked
+	packs := listPacks(t, repo)
+	for id := range retained {
+		rtest.Assert(t, packs.Has(id), "retained pack %v was removed", id.Str())
+	}
+
+	repo = repository.TestOpenBackend(t, be)
+	checker.TestCheckRepo(t, repo, true)
+}
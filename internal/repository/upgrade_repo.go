@@ -10,14 +10,14 @@ import (
 	"github.com/restic/restic/internal/restic"
 )
 
-type upgradeRepoV2Error struct {
+type upgradeRepoError struct {
 	UploadNewConfigError   error
 	ReuploadOldConfigError error
 
 	BackupFilePath string
 }
 
-func (err *upgradeRepoV2Error) Error() string {
+func (err *upgradeRepoError) Error() string {
 	if err.ReuploadOldConfigError != nil {
 		return fmt.Sprintf("error uploading config (%v), re-uploading old config filed failed as well (%v), but there is a backup of the config file in %v", err.UploadNewConfigError, err.ReuploadOldConfigError, err.BackupFilePath)
 	}
@@ -25,13 +25,17 @@ func (err *upgradeRepoV2Error) Error() string {
 	return fmt.Sprintf("error uploading config (%v), re-uploaded old config was successful, there is a backup of the config file in %v", err.UploadNewConfigError, err.BackupFilePath)
 }
 
-func (err *upgradeRepoV2Error) Unwrap() error {
+func (err *upgradeRepoError) Unwrap() error {
 	// consider the original upload error as the primary cause
 	return err.UploadNewConfigError
 }
 
-func upgradeRepository(ctx context.Context, repo *Repository) error {
+func upgradeRepository(ctx context.Context, repo *Repository, version uint) error {
 	h := backend.Handle{Type: backend.ConfigFile}
+	// replacing the config file removes the previous one
+	if err := repo.checkRemove(restic.ConfigFile); err != nil {
+		return err
+	}
 
 	if !repo.be.Properties().HasAtomicReplace {
 		// remove the original file for backends which do not support atomic overwriting
@@ -43,7 +47,7 @@ func upgradeRepository(ctx context.Context, repo *Repository) error {
 
 	// upgrade config
 	cfg := repo.Config()
-	cfg.Version = 2
+	cfg.Version = version
 
 	err := restic.SaveConfig(ctx, &internalRepository{repo}, cfg)
 	if err != nil {
@@ -53,12 +57,18 @@ func upgradeRepository(ctx context.Context, repo *Repository) error {
 	return nil
 }
 
+// UpgradeRepo upgrades the repository to the next version. A backup of the
+// previous config file is kept in a temporary directory if the upgrade fails.
 func UpgradeRepo(ctx context.Context, repo *Repository) error {
-	if repo.Config().Version != 1 {
-		return fmt.Errorf("repository has version %v, only upgrades from version 1 are supported", repo.Config().Version)
+	version := repo.Config().Version + 1
+	if version > restic.MaxRepoVersion {
+		return fmt.Errorf("repository has version %v, which is already the latest version", repo.Config().Version)
+	}
+	if err := repo.checkRemove(restic.ConfigFile); err != nil {
+		return err
 	}
 
-	tempdir, err := os.MkdirTemp("", "restic-migrate-upgrade-repo-v2-")
+	tempdir, err := os.MkdirTemp("", fmt.Sprintf("restic-migrate-upgrade-repo-v%d-", version))
 	if err != nil {
 		return fmt.Errorf("create temp dir failed: %w", err)
 	}
@@ -78,11 +88,11 @@ func UpgradeRepo(ctx context.Context, repo *Repository) error {
 	}
 
 	// run the upgrade
-	err = upgradeRepository(ctx, repo)
+	err = upgradeRepository(ctx, repo, version)
 	if err != nil {
 
 		// build an error we can return to the caller
-		repoError := &upgradeRepoV2Error{
+		repoError := &upgradeRepoError{
 			UploadNewConfigError: err,
 			BackupFilePath:       backupFileName,
 		}
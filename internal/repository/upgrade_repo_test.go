@@ -9,6 +9,7 @@ import (
 
 	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -65,7 +66,7 @@ func TestUpgradeRepoV2Failure(t *testing.T) {
 		t.Fatal("expected error returned from Apply(), got nil")
 	}
 
-	upgradeErr := err.(*upgradeRepoV2Error)
+	upgradeErr := err.(*upgradeRepoError)
 	if upgradeErr.UploadNewConfigError == nil {
 		t.Fatal("expected upload error, got nil")
 	}
@@ -80,3 +81,17 @@ func TestUpgradeRepoV2Failure(t *testing.T) {
 	rtest.OK(t, os.Remove(upgradeErr.BackupFilePath))
 	rtest.OK(t, os.Remove(filepath.Dir(upgradeErr.BackupFilePath)))
 }
+
+func TestUpgradeRepoRemoveNotAllowed(t *testing.T) {
+	repo, _, _ := TestRepositoryWithVersion(t, 1)
+	repo.keyRole = KeyRoleBackupOnly
+
+	// replacing the config file requires a key which may remove files
+	err := UpgradeRepo(context.Background(), repo)
+	var roleErr *KeyRoleError
+	rtest.Assert(t, errors.As(err, &roleErr), "expected key role error, got %v", err)
+
+	cfg, err := restic.LoadConfig(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(1), cfg.Version)
+}
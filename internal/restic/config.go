@@ -2,6 +2,9 @@ package restic
 
 import (
 	"context"
+	"io"
+	"math/bits"
+	"slices"
 	"sync"
 	"testing"
 
@@ -17,15 +20,147 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// The chunk size bounds used for content-defined chunking. Zero values
+	// select the defaults of the chunker.
+	ChunkerMinSize uint `json:"chunker_min_size,omitempty"`
+	ChunkerAvgSize uint `json:"chunker_avg_size,omitempty"`
+	ChunkerMaxSize uint `json:"chunker_max_size,omitempty"`
+
+	// RequiredFeatures lists the features a client must support to access
+	// the repository. Clients refuse to open repositories which require
+	// unknown features. Features are only used starting with repository
+	// version 3, older versions of restic refuse to open such repositories.
+	RequiredFeatures []string `json:"required_features,omitempty"`
+}
+
+// FeatureChunkerSizes is required by repositories with custom chunk size
+// bounds. Clients which ignore the bounds would not deduplicate data.
+const FeatureChunkerSizes = "chunker-sizes"
+
+// FeatureColdTier is required by repositories which store the data pack
+// files in a separate cold storage backend. Clients which are unaware of the
+// cold backend would consider these pack files to be missing.
+const FeatureColdTier = "cold-tier"
+
+// FeatureAppendOnly is required by append-only repositories. Files other than
+// locks may then only be removed when the repository was opened with an admin
+// key. Clients which are unaware of the mode would remove data.
+const FeatureAppendOnly = "append-only"
+
+// MinFeatureRepoVersion is the minimum repository version for features.
+const MinFeatureRepoVersion = 3
+
+// knownFeatures lists the features supported by this version of restic.
+var knownFeatures = map[string]bool{
+	FeatureChunkerSizes: true,
+	FeatureColdTier:     true,
+	FeatureAppendOnly:   true,
+}
+
+// HasFeature returns whether the repository requires the feature.
+func (cfg Config) HasFeature(feature string) bool {
+	return slices.Contains(cfg.RequiredFeatures, feature)
+}
+
+// RequireFeature adds the feature to the features required by the
+// repository. It returns an error if the repository version does not
+// support features.
+func (cfg *Config) RequireFeature(feature string) error {
+	if cfg.Version < MinFeatureRepoVersion {
+		return errors.Errorf("feature %v requires repository version %v", feature, MinFeatureRepoVersion)
+	}
+	if !cfg.HasFeature(feature) {
+		cfg.RequiredFeatures = append(cfg.RequiredFeatures, feature)
+	}
+	return nil
 }
 
 const MinRepoVersion = 1
-const MaxRepoVersion = 2
+const MaxRepoVersion = 3
 
 // StableRepoVersion is the version that is written to the config when a repository
 // is newly created with Init().
 const StableRepoVersion = 2
 
+const (
+	// DefaultChunkerAvgSize is the average chunk size used if none is configured.
+	DefaultChunkerAvgSize = 1 << 20
+	// MinChunkerMinSize is the smallest allowed minimum chunk size.
+	MinChunkerMinSize = 4 * 1024
+	// MaxChunkerMaxSize is the largest allowed maximum chunk size.
+	MaxChunkerMaxSize = 64 * 1024 * 1024
+)
+
+// ChunkerParams are the parameters used to split files into chunks. Files
+// are only deduplicated against each other if they were split using the same
+// parameters.
+type ChunkerParams struct {
+	Polynomial chunker.Pol
+	MinSize    uint
+	AvgSize    uint
+	MaxSize    uint
+}
+
+// CustomSizes returns whether chunk size bounds other than the defaults of
+// the chunker are set. Zero values select the defaults.
+func (p ChunkerParams) CustomSizes() bool {
+	return (p.MinSize != 0 && p.MinSize != chunker.MinSize) ||
+		(p.AvgSize != 0 && p.AvgSize != DefaultChunkerAvgSize) ||
+		(p.MaxSize != 0 && p.MaxSize != chunker.MaxSize)
+}
+
+// ChunkerParams returns the chunker parameters of the repository with the
+// defaults filled in.
+func (cfg Config) ChunkerParams() ChunkerParams {
+	p := ChunkerParams{
+		Polynomial: cfg.ChunkerPolynomial,
+		MinSize:    cfg.ChunkerMinSize,
+		AvgSize:    cfg.ChunkerAvgSize,
+		MaxSize:    cfg.ChunkerMaxSize,
+	}
+	if p.MinSize == 0 {
+		p.MinSize = chunker.MinSize
+	}
+	if p.AvgSize == 0 {
+		p.AvgSize = DefaultChunkerAvgSize
+	}
+	if p.MaxSize == 0 {
+		p.MaxSize = chunker.MaxSize
+	}
+	return p
+}
+
+// Validate checks that the chunk size bounds are usable.
+func (p ChunkerParams) Validate() error {
+	if p.AvgSize == 0 || p.AvgSize&(p.AvgSize-1) != 0 {
+		return errors.Errorf("average chunk size %d is not a power of two", p.AvgSize)
+	}
+	if p.MinSize < MinChunkerMinSize {
+		return errors.Errorf("minimum chunk size %d is smaller than %d", p.MinSize, MinChunkerMinSize)
+	}
+	if p.MaxSize > MaxChunkerMaxSize {
+		return errors.Errorf("maximum chunk size %d is larger than %d", p.MaxSize, MaxChunkerMaxSize)
+	}
+	if p.MinSize >= p.AvgSize || p.AvgSize >= p.MaxSize {
+		return errors.Errorf("chunk sizes must satisfy min < avg < max, got %d, %d, %d", p.MinSize, p.AvgSize, p.MaxSize)
+	}
+	return nil
+}
+
+// NewChunker returns a chunker which splits rd using the parameters.
+func (p ChunkerParams) NewChunker(rd io.Reader) *chunker.Chunker {
+	c := chunker.NewWithBoundaries(rd, p.Polynomial, p.MinSize, p.MaxSize)
+	c.SetAverageBits(bits.TrailingZeros(p.AvgSize))
+	return c
+}
+
+// ResetChunker reinitializes c to split rd using the parameters.
+func (p ChunkerParams) ResetChunker(c *chunker.Chunker, rd io.Reader) {
+	c.ResetWithBoundaries(rd, p.Polynomial, p.MinSize, p.MaxSize)
+	c.SetAverageBits(bits.TrailingZeros(p.AvgSize))
+}
+
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
 	LoadJSONUnpacked(context.Context, FileType, ID, interface{}) error
@@ -78,12 +213,22 @@ func LoadConfig(ctx context.Context, r LoaderUnpacked) (Config, error) {
 		return Config{}, errors.Errorf("unsupported repository version %v", cfg.Version)
 	}
 
+	for _, feature := range cfg.RequiredFeatures {
+		if !knownFeatures[feature] {
+			return Config{}, errors.Errorf("repository requires feature %q, which is not supported by this version of restic", feature)
+		}
+	}
+
 	if checkPolynomial {
 		if !cfg.ChunkerPolynomial.Irreducible() {
 			return Config{}, errors.New("invalid chunker polynomial")
 		}
 	}
 
+	if err := cfg.ChunkerParams().Validate(); err != nil {
+		return Config{}, errors.Errorf("invalid chunker parameters: %v", err)
+	}
+
 	return cfg, nil
 }
 
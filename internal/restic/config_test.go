@@ -1,7 +1,11 @@
 package restic_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
@@ -60,6 +64,103 @@ func TestConfig(t *testing.T) {
 	cfg2, err := restic.LoadConfig(context.TODO(), loader{load})
 	rtest.OK(t, err)
 
-	rtest.Assert(t, cfg1 == cfg2,
-		"configs aren't equal: %v != %v", cfg1, cfg2)
+	rtest.Equals(t, cfg1, cfg2)
+}
+
+func TestChunkerParams(t *testing.T) {
+	cfg := restic.Config{ChunkerPolynomial: 0x3DA3358B4DC173}
+	rtest.Equals(t, restic.ChunkerParams{
+		Polynomial: cfg.ChunkerPolynomial,
+		MinSize:    512 * 1024,
+		AvgSize:    1024 * 1024,
+		MaxSize:    8 * 1024 * 1024,
+	}, cfg.ChunkerParams())
+	rtest.OK(t, cfg.ChunkerParams().Validate())
+
+	for _, test := range []struct {
+		min, avg, max uint
+		valid         bool
+	}{
+		{64 * 1024, 256 * 1024, 2 * 1024 * 1024, true},
+		{0, 2 * 1024 * 1024, 0, true},
+		{64 * 1024, 300 * 1024, 2 * 1024 * 1024, false},
+		{1024, 256 * 1024, 2 * 1024 * 1024, false},
+		{64 * 1024, 256 * 1024, 128 * 1024 * 1024, false},
+		{512 * 1024, 256 * 1024, 2 * 1024 * 1024, false},
+		{0, 16 * 1024 * 1024, 0, false},
+	} {
+		cfg := restic.Config{ChunkerMinSize: test.min, ChunkerAvgSize: test.avg, ChunkerMaxSize: test.max}
+		err := cfg.ChunkerParams().Validate()
+		rtest.Equals(t, test.valid, err == nil, fmt.Sprintf("%v/%v/%v: %v", test.min, test.avg, test.max, err))
+	}
+}
+
+func TestChunkerParamsSizes(t *testing.T) {
+	cfg := restic.Config{
+		ChunkerPolynomial: 0x3DA3358B4DC173,
+		ChunkerMinSize:    16 * 1024,
+		ChunkerAvgSize:    64 * 1024,
+		ChunkerMaxSize:    256 * 1024,
+	}
+	params := cfg.ChunkerParams()
+
+	data := rtest.Random(23, 8*1024*1024)
+	c := params.NewChunker(bytes.NewReader(data))
+	buf := make([]byte, params.MaxSize)
+	var chunks, total int
+	for {
+		chunk, err := c.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		if total+int(chunk.Length) < len(data) {
+			rtest.Assert(t, chunk.Length >= params.MinSize, "chunk of %d bytes is smaller than the minimum", chunk.Length)
+		}
+		rtest.Assert(t, chunk.Length <= params.MaxSize, "chunk of %d bytes is larger than the maximum", chunk.Length)
+		chunks++
+		total += int(chunk.Length)
+	}
+	rtest.Equals(t, len(data), total)
+	// about 8MiB / (16KiB + 64KiB) chunks are expected
+	rtest.Assert(t, chunks > 50 && chunks < 200, "unexpected number of chunks %d", chunks)
+}
+
+func TestConfigRequiredFeatures(t *testing.T) {
+	cfg, err := restic.CreateConfig(restic.StableRepoVersion)
+	rtest.OK(t, err)
+	rtest.Assert(t, cfg.RequireFeature(restic.FeatureChunkerSizes) != nil, "expected features to require a newer repository version")
+
+	cfg, err = restic.CreateConfig(restic.MaxRepoVersion)
+	rtest.OK(t, err)
+	rtest.OK(t, cfg.RequireFeature(restic.FeatureChunkerSizes))
+	rtest.OK(t, cfg.RequireFeature(restic.FeatureChunkerSizes))
+	rtest.Equals(t, []string{restic.FeatureChunkerSizes}, cfg.RequiredFeatures)
+
+	var buf []byte
+	rtest.OK(t, restic.SaveConfig(context.TODO(), saver{func(_ restic.FileType, data []byte) (restic.ID, error) {
+		buf = data
+		return restic.ID{}, nil
+	}}, cfg))
+	load := loader{func(restic.FileType, restic.ID) ([]byte, error) { return buf, nil }}
+
+	cfg2, err := restic.LoadConfig(context.TODO(), load)
+	rtest.OK(t, err)
+	rtest.Assert(t, cfg2.HasFeature(restic.FeatureChunkerSizes), "feature missing from loaded config")
+
+	cfg.RequiredFeatures = append(cfg.RequiredFeatures, "unknown-feature")
+	rtest.OK(t, restic.SaveConfig(context.TODO(), saver{func(_ restic.FileType, data []byte) (restic.ID, error) {
+		buf = data
+		return restic.ID{}, nil
+	}}, cfg))
+	_, err = restic.LoadConfig(context.TODO(), load)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "unknown-feature"), "expected unknown feature to be rejected, got %v", err)
+}
+
+func TestChunkerParamsCustomSizes(t *testing.T) {
+	cfg, err := restic.CreateConfig(restic.StableRepoVersion)
+	rtest.OK(t, err)
+	rtest.Assert(t, !cfg.ChunkerParams().CustomSizes(), "default chunk sizes reported as custom")
+	rtest.Assert(t, !(restic.ChunkerParams{}).CustomSizes(), "zero chunk sizes reported as custom")
+	rtest.Assert(t, (restic.ChunkerParams{AvgSize: 256 * 1024}).CustomSizes(), "custom average chunk size not detected")
 }
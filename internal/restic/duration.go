@@ -132,6 +132,16 @@ func (d Duration) Type() string {
 	return "duration"
 }
 
+// MarshalText returns the duration in the format accepted by ParseDuration.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText parses a duration using ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
 // Zero returns true if the duration is empty (all values are set to zero).
 func (d Duration) Zero() bool {
 	return d.Years == 0 && d.Months == 0 && d.Days == 0 && d.Hours == 0
@@ -0,0 +1,89 @@
+package restic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// LabelList is a list of label selectors. The selector "key=value" matches
+// snapshots whose label key has the given value, the selector "key" matches
+// snapshots which have the label key with any value and the selector "!key"
+// matches snapshots without the label key.
+type LabelList []string
+
+// splitLabelList splits a string into a list of label selectors. The
+// selectors in the string need to be separated by commas. Whitespace is
+// stripped around the individual selectors.
+func splitLabelList(s string) (l LabelList) {
+	for _, t := range strings.Split(s, ",") {
+		l = append(l, strings.TrimSpace(t))
+	}
+	return l
+}
+
+func (l LabelList) String() string {
+	return "[" + strings.Join(l, ", ") + "]"
+}
+
+// Set updates the LabelList's value.
+func (l *LabelList) Set(s string) error {
+	*l = splitLabelList(s)
+	return nil
+}
+
+// Type returns a description of the type.
+func (LabelList) Type() string {
+	return "LabelList"
+}
+
+// LabelLists consists of several LabelList.
+type LabelLists []LabelList
+
+func (l LabelLists) String() string {
+	return fmt.Sprint([]LabelList(l))
+}
+
+// Set updates the LabelLists's value.
+func (l *LabelLists) Set(s string) error {
+	*l = append(*l, splitLabelList(s))
+	return nil
+}
+
+// Type returns a description of the type.
+func (LabelLists) Type() string {
+	return "LabelLists"
+}
+
+// ParseLabels parses labels in the format "key=value". The key must neither
+// be empty nor contain a comma, and must not start with an exclamation mark.
+func ParseLabels(list []string) (map[string]string, error) {
+	labels := make(map[string]string, len(list))
+	for _, s := range list {
+		key, value, ok := strings.Cut(s, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, errors.Errorf("invalid label %q, expected the format key=value", s)
+		}
+		if strings.Contains(key, ",") {
+			return nil, errors.Errorf("invalid label %q, the key must not contain a comma", s)
+		}
+		if strings.HasPrefix(key, "!") {
+			return nil, errors.Errorf("invalid label %q, the key must not start with an exclamation mark", s)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// FormatLabels returns the labels in the format "key=value", sorted by key.
+func FormatLabels(labels map[string]string) []string {
+	list := make([]string, 0, len(labels))
+	for key, value := range labels {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
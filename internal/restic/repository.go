@@ -44,6 +44,9 @@ type Repository interface {
 	StartPackUploader(ctx context.Context, wg *errgroup.Group)
 	SaveBlob(ctx context.Context, t BlobType, buf []byte, id ID, storeDuplicate bool) (newID ID, known bool, size int, err error)
 	Flush(ctx context.Context) error
+	// Checkpoint uploads all blobs saved so far and writes the index without
+	// stopping the pack uploader.
+	Checkpoint(ctx context.Context) error
 
 	// List calls the function fn for each file of type t in the repository.
 	// When an error is returned by fn, processing stops and List() returns the
@@ -71,12 +74,15 @@ type FileType = backend.FileType
 // in the `WriteableFileType` subset can be modified via the Repository interface.
 // All other filetypes are considered internal datastructures of the Repository.
 const (
-	PackFile     = backend.PackFile
-	KeyFile      = backend.KeyFile
-	LockFile     = backend.LockFile
-	SnapshotFile = backend.SnapshotFile
-	IndexFile    = backend.IndexFile
-	ConfigFile   = backend.ConfigFile
+	PackFile       = backend.PackFile
+	KeyFile        = backend.KeyFile
+	LockFile       = backend.LockFile
+	SnapshotFile   = backend.SnapshotFile
+	IndexFile      = backend.IndexFile
+	ConfigFile     = backend.ConfigFile
+	DictionaryFile = backend.DictionaryFile
+	ParityFile     = backend.ParityFile
+	PolicyFile     = backend.PolicyFile
 )
 
 // WriteableFileType defines the different data types that can be modified via SaveUnpacked or RemoveUnpacked.
@@ -85,12 +91,16 @@ type WriteableFileType backend.FileType
 const (
 	// WriteableSnapshotFile is the WriteableFileType for snapshots.
 	WriteableSnapshotFile = WriteableFileType(SnapshotFile)
+	// WriteablePolicyFile is the WriteableFileType for retention policies.
+	WriteablePolicyFile = WriteableFileType(PolicyFile)
 )
 
 func (w *WriteableFileType) ToFileType() FileType {
 	switch *w {
 	case WriteableSnapshotFile:
 		return SnapshotFile
+	case WriteablePolicyFile:
+		return PolicyFile
 	default:
 		panic("invalid WriteableFileType")
 	}
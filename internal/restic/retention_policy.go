@@ -0,0 +1,254 @@
+package restic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// RetentionPolicy is the forget policy stored in the repository. Each change
+// stores a new version of the policy, the one with the highest version is
+// used.
+type RetentionPolicy struct {
+	Version  int       `json:"version"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname,omitempty"`
+	Username string    `json:"username,omitempty"`
+
+	// GroupBy specifies how the snapshots matched by a rule are grouped,
+	// using the syntax of the --group-by option.
+	GroupBy string       `json:"group_by"`
+	Rules   []PolicyRule `json:"rules"`
+
+	id *ID
+}
+
+// PolicyRule is the ExpirePolicy for all snapshots matching the selection.
+// A rule without selection matches all snapshots.
+type PolicyRule struct {
+	Hosts []string     `json:"hosts,omitempty"`
+	Paths []string     `json:"paths,omitempty"`
+	Tags  TagLists     `json:"tags,omitempty"`
+	Keep  ExpirePolicy `json:"keep"`
+}
+
+// PolicyGroup is a group of snapshots and the ExpirePolicy to apply to it.
+type PolicyGroup struct {
+	// Key is the group key as returned by GroupSnapshots.
+	Key       string
+	Policy    ExpirePolicy
+	Snapshots Snapshots
+}
+
+// NewRetentionPolicy returns the next version of p, which may be nil. The
+// rules are copied from p.
+func NewRetentionPolicy(p *RetentionPolicy) *RetentionPolicy {
+	next := &RetentionPolicy{
+		Version: 1,
+		Time:    time.Now(),
+		GroupBy: SnapshotGroupByOptions{Host: true, Path: true}.String(),
+	}
+	if p != nil {
+		next.Version = p.Version + 1
+		next.GroupBy = p.GroupBy
+		next.Rules = slices.Clone(p.Rules)
+	}
+
+	next.Hostname, _ = os.Hostname()
+	if usr, err := user.Current(); err == nil {
+		next.Username = usr.Username
+	}
+	return next
+}
+
+// ID returns the ID of the policy, which is nil if it has not been saved yet.
+func (p *RetentionPolicy) ID() *ID {
+	return p.id
+}
+
+// Selection returns a description of the snapshots the rule applies to.
+func (r PolicyRule) Selection() string {
+	var parts []string
+	if len(r.Hosts) > 0 {
+		parts = append(parts, fmt.Sprintf("hosts %v", r.Hosts))
+	}
+	if len(r.Paths) > 0 {
+		parts = append(parts, fmt.Sprintf("paths %v", r.Paths))
+	}
+	if len(r.Tags) > 0 {
+		parts = append(parts, fmt.Sprintf("tags %v", r.Tags))
+	}
+	if len(parts) == 0 {
+		return "all snapshots"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (r PolicyRule) matchesAll() bool {
+	return len(r.Hosts)+len(r.Paths)+len(r.Tags) == 0
+}
+
+func (r PolicyRule) matches(sn *Snapshot) bool {
+	return sn.HasHostname(r.Hosts) && sn.HasPaths(r.Paths) && sn.HasTagList(r.Tags)
+}
+
+func (r PolicyRule) sameSelection(other PolicyRule) bool {
+	return r.Selection() == other.Selection()
+}
+
+// SetRule adds the rule to the policy or replaces the rule with the same
+// selection. New rules are inserted before the rule which matches all
+// snapshots, such that it only applies to otherwise unmatched snapshots.
+func (p *RetentionPolicy) SetRule(rule PolicyRule) {
+	sort.Strings(rule.Hosts)
+	sort.Strings(rule.Paths)
+
+	for i, r := range p.Rules {
+		if r.sameSelection(rule) {
+			p.Rules[i] = rule
+			return
+		}
+	}
+
+	pos := len(p.Rules)
+	for i, r := range p.Rules {
+		if r.matchesAll() {
+			pos = i
+			break
+		}
+	}
+	p.Rules = slices.Insert(p.Rules, pos, rule)
+}
+
+// RemoveRule removes the rule with the same selection as rule. It returns
+// false if no such rule exists.
+func (p *RetentionPolicy) RemoveRule(rule PolicyRule) bool {
+	sort.Strings(rule.Hosts)
+	sort.Strings(rule.Paths)
+
+	for i, r := range p.Rules {
+		if r.sameSelection(rule) {
+			p.Rules = slices.Delete(p.Rules, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error if the policy cannot be applied.
+func (p *RetentionPolicy) Validate() error {
+	var groupBy SnapshotGroupByOptions
+	if err := groupBy.Set(p.GroupBy); err != nil {
+		return err
+	}
+	for _, r := range p.Rules {
+		if r.Keep.Empty() {
+			return errors.Errorf("the rule for %v does not keep any snapshots", r.Selection())
+		}
+	}
+	return nil
+}
+
+// Groups assigns each snapshot to the first rule matching it and then groups
+// the snapshots of each rule according to GroupBy. Snapshots which do not
+// match any rule are not included.
+func (p *RetentionPolicy) Groups(snapshots Snapshots) ([]PolicyGroup, error) {
+	var groupBy SnapshotGroupByOptions
+	if err := groupBy.Set(p.GroupBy); err != nil {
+		return nil, err
+	}
+
+	perRule := make([]Snapshots, len(p.Rules))
+	for _, sn := range snapshots {
+		for i, r := range p.Rules {
+			if r.matches(sn) {
+				perRule[i] = append(perRule[i], sn)
+				break
+			}
+		}
+	}
+
+	var groups []PolicyGroup
+	for i, list := range perRule {
+		snapshotGroups, _, err := GroupSnapshots(list, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(snapshotGroups))
+		for k := range snapshotGroups {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			groups = append(groups, PolicyGroup{Key: k, Policy: p.Rules[i].Keep, Snapshots: snapshotGroups[k]})
+		}
+	}
+	return groups, nil
+}
+
+// Violations returns the snapshots which are not kept by the policy.
+func (p *RetentionPolicy) Violations(snapshots Snapshots) (Snapshots, error) {
+	groups, err := p.Groups(snapshots)
+	if err != nil {
+		return nil, err
+	}
+
+	var remove Snapshots
+	for _, g := range groups {
+		_, r, _ := ApplyPolicy(g.Snapshots, g.Policy)
+		remove = append(remove, r...)
+	}
+	return remove, nil
+}
+
+// LoadRetentionPolicy loads the newest version of the retention policy. It
+// returns nil if no policy is stored in the repository.
+func LoadRetentionPolicy(ctx context.Context, repo ListerLoaderUnpacked) (*RetentionPolicy, error) {
+	var newest *RetentionPolicy
+	err := repo.List(ctx, PolicyFile, func(id ID, _ int64) error {
+		buf, err := repo.LoadUnpacked(ctx, PolicyFile, id)
+		if err != nil {
+			return fmt.Errorf("failed to load retention policy %v: %w", id.Str(), err)
+		}
+		p := &RetentionPolicy{id: &id}
+		if err := json.Unmarshal(buf, p); err != nil {
+			return fmt.Errorf("invalid retention policy %v: %w", id.Str(), err)
+		}
+
+		// concurrently saved versions are ordered by time
+		if newest == nil || p.Version > newest.Version ||
+			(p.Version == newest.Version && p.Time.After(newest.Time)) {
+			newest = p
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if newest != nil {
+		debug.Log("using retention policy %v version %d", newest.id.Str(), newest.Version)
+	}
+	return newest, nil
+}
+
+// SaveRetentionPolicy saves the policy as a new version and returns its ID.
+func SaveRetentionPolicy(ctx context.Context, repo SaverUnpacked[WriteableFileType], p *RetentionPolicy) (ID, error) {
+	if err := p.Validate(); err != nil {
+		return ID{}, err
+	}
+	id, err := SaveJSONUnpacked(ctx, repo, WriteablePolicyFile, p)
+	if err != nil {
+		return ID{}, err
+	}
+	p.id = &id
+	return id, nil
+}
@@ -0,0 +1,90 @@
+package restic_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRetentionPolicyRules(t *testing.T) {
+	p := restic.NewRetentionPolicy(nil)
+	rtest.Equals(t, 1, p.Version)
+	rtest.Equals(t, "host,paths", p.GroupBy)
+
+	p.SetRule(restic.PolicyRule{Keep: restic.ExpirePolicy{Daily: 7}})
+	p.SetRule(restic.PolicyRule{Hosts: []string{"b", "a"}, Keep: restic.ExpirePolicy{Last: 3}})
+	p.SetRule(restic.PolicyRule{Tags: restic.TagLists{{"db"}}, Keep: restic.ExpirePolicy{Last: 1}})
+	// replaces the existing rule for the same hosts
+	p.SetRule(restic.PolicyRule{Hosts: []string{"a", "b"}, Keep: restic.ExpirePolicy{Last: 2}})
+
+	var selections []string
+	for _, r := range p.Rules {
+		selections = append(selections, r.Selection())
+	}
+	rtest.Equals(t, []string{"hosts [a b]", "tags [[db]]", "all snapshots"}, selections)
+	rtest.Equals(t, 2, p.Rules[0].Keep.Last)
+
+	next := restic.NewRetentionPolicy(p)
+	rtest.Equals(t, 2, next.Version)
+	rtest.Assert(t, next.RemoveRule(restic.PolicyRule{Tags: restic.TagLists{{"db"}}}), "rule was not removed")
+	rtest.Assert(t, !next.RemoveRule(restic.PolicyRule{Paths: []string{"/home"}}), "non-existing rule was removed")
+	rtest.Equals(t, 2, len(next.Rules))
+	rtest.Equals(t, 3, len(p.Rules))
+
+	p.GroupBy = "invalid"
+	rtest.Assert(t, p.Validate() != nil, "invalid group by was accepted")
+}
+
+func TestRetentionPolicyViolations(t *testing.T) {
+	p := restic.NewRetentionPolicy(nil)
+	p.SetRule(restic.PolicyRule{Keep: restic.ExpirePolicy{Last: 1}})
+	p.SetRule(restic.PolicyRule{Hosts: []string{"a"}, Keep: restic.ExpirePolicy{Last: 2}})
+
+	var snapshots restic.Snapshots
+	for i, host := range []string{"a", "a", "a", "b", "b", "c"} {
+		snapshots = append(snapshots, &restic.Snapshot{
+			Time:     parseTimeUTC("2024-01-01 12:00:00").AddDate(0, 0, i),
+			Hostname: host,
+			Paths:    []string{"/home"},
+		})
+	}
+
+	groups, err := p.Groups(snapshots)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(groups))
+
+	violations, err := p.Violations(snapshots)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(violations))
+	for _, sn := range violations {
+		rtest.Assert(t, sn.Time.Day() == 1 || sn.Time.Day() == 4, "unexpected violation %v", sn)
+	}
+
+	// without a rule matching all snapshots, other hosts are not affected
+	rtest.Assert(t, p.RemoveRule(restic.PolicyRule{}), "rule was not removed")
+	violations, err = p.Violations(snapshots)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(violations))
+}
+
+func TestRetentionPolicyJSON(t *testing.T) {
+	p := restic.NewRetentionPolicy(nil)
+	p.SetRule(restic.PolicyRule{
+		Paths: []string{"/srv"},
+		Keep: restic.ExpirePolicy{
+			Daily:        7,
+			Monthly:      -1,
+			WithinHourly: restic.ParseDurationOrPanic("2d12h"),
+			Tags:         []restic.TagList{{"keep"}},
+		},
+	})
+
+	buf, err := json.Marshal(p)
+	rtest.OK(t, err)
+	var p2 restic.RetentionPolicy
+	rtest.OK(t, json.Unmarshal(buf, &p2))
+	rtest.Equals(t, p.Rules, p2.Rules)
+	rtest.Equals(t, p.GroupBy, p2.GroupBy)
+}
@@ -2,9 +2,11 @@ package restic
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,10 +27,16 @@ type Snapshot struct {
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
 
-	ProgramVersion string           `json:"program_version,omitempty"`
-	Summary        *SnapshotSummary `json:"summary,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	ProgramVersion string             `json:"program_version,omitempty"`
+	Summary        *SnapshotSummary   `json:"summary,omitempty"`
+	Signature      *SnapshotSignature `json:"signature,omitempty"`
 
 	id *ID // plaintext ID, used during restore
+	// raw is the stored JSON of a signed snapshot, the signature covers it
+	// including fields unknown to this version of restic
+	raw []byte
 }
 
 type SnapshotSummary struct {
@@ -81,10 +89,16 @@ func NewSnapshot(paths []string, tags []string, hostname string, time time.Time)
 // LoadSnapshot loads the snapshot with the id and returns it.
 func LoadSnapshot(ctx context.Context, loader LoaderUnpacked, id ID) (*Snapshot, error) {
 	sn := &Snapshot{id: &id}
-	err := LoadJSONUnpacked(ctx, loader, SnapshotFile, id, sn)
+	buf, err := loader.LoadUnpacked(ctx, SnapshotFile, id)
+	if err == nil {
+		err = json.Unmarshal(buf, sn)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load snapshot %v: %w", id.Str(), err)
 	}
+	if sn.Signature != nil {
+		sn.raw = buf
+	}
 
 	return sn, nil
 }
@@ -172,6 +186,37 @@ func (sn *Snapshot) RemoveTags(removeTags []string) (changed bool) {
 	return
 }
 
+// SetLabels sets the given labels, replacing existing labels with the same
+// key. It returns true if any changes were made.
+func (sn *Snapshot) SetLabels(labels map[string]string) (changed bool) {
+	for key, value := range labels {
+		if old, ok := sn.Labels[key]; ok && old == value {
+			continue
+		}
+		if sn.Labels == nil {
+			sn.Labels = make(map[string]string)
+		}
+		sn.Labels[key] = value
+		changed = true
+	}
+	return
+}
+
+// RemoveLabels removes the labels with the given keys and returns true if any
+// changes were made.
+func (sn *Snapshot) RemoveLabels(keys []string) (changed bool) {
+	for _, key := range keys {
+		if _, ok := sn.Labels[key]; ok {
+			delete(sn.Labels, key)
+			changed = true
+		}
+	}
+	if len(sn.Labels) == 0 {
+		sn.Labels = nil
+	}
+	return
+}
+
 func (sn *Snapshot) hasTag(tag string) bool {
 	for _, snTag := range sn.Tags {
 		if tag == snTag {
@@ -181,6 +226,16 @@ func (sn *Snapshot) hasTag(tag string) bool {
 	return false
 }
 
+// CheckpointTag marks partial snapshots which are written while a backup is
+// still running. They allow a later backup to resume an interrupted one.
+const CheckpointTag = "restic:checkpoint"
+
+// IsCheckpoint returns true if the snapshot is a checkpoint of an unfinished
+// backup.
+func (sn *Snapshot) IsCheckpoint() bool {
+	return sn.HasTags([]string{CheckpointTag})
+}
+
 // HasTags returns true if the snapshot has all the tags in l.
 func (sn *Snapshot) HasTags(l []string) bool {
 	for _, tag := range l {
@@ -216,6 +271,51 @@ func (sn *Snapshot) HasTagList(l []TagList) bool {
 	return false
 }
 
+// HasLabels returns true if the snapshot matches all label selectors in l. An
+// empty selector matches snapshots without labels.
+func (sn *Snapshot) HasLabels(l []string) bool {
+	for _, selector := range l {
+		if selector == "" {
+			return len(sn.Labels) == 0
+		}
+		if key, ok := strings.CutPrefix(selector, "!"); ok {
+			if _, ok := sn.Labels[key]; ok {
+				return false
+			}
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(selector, "=")
+		v, ok := sn.Labels[key]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HasLabelList returns true if either
+//   - the snapshot satisfies at least one LabelList, so there is a LabelList
+//     in l for which all label selectors match sn, or
+//   - l is empty
+func (sn *Snapshot) HasLabelList(l []LabelList) bool {
+	debug.Log("testing snapshot with labels %v against list: %v", sn.Labels, l)
+
+	if len(l) == 0 {
+		return true
+	}
+
+	for _, labels := range l {
+		if sn.HasLabels(labels) {
+			debug.Log("  snapshot satisfies %v %v", labels, l)
+			return true
+		}
+	}
+
+	return false
+}
+
 // HasPaths returns true if the snapshot has all of the paths.
 func (sn *Snapshot) HasPaths(paths []string) bool {
 	m := make(map[string]struct{}, len(sn.Paths))
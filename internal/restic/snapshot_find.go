@@ -13,23 +13,28 @@ import (
 // ErrNoSnapshotFound is returned when no snapshot for the given criteria could be found.
 var ErrNoSnapshotFound = errors.New("no snapshot found")
 
-// A SnapshotFilter denotes a set of snapshots based on hosts, tags and paths.
+// A SnapshotFilter denotes a set of snapshots based on hosts, tags, labels and
+// paths.
 type SnapshotFilter struct {
 	_ struct{} // Force naming fields in literals.
 
-	Hosts []string
-	Tags  TagLists
-	Paths []string
+	Hosts  []string
+	Tags   TagLists
+	Labels LabelLists
+	Paths  []string
 	// Match snapshots from before this timestamp. Zero for no limit.
 	TimestampLimit time.Time
+	// Also match checkpoint snapshots of unfinished backups.
+	IncludeCheckpoints bool
 }
 
 func (f *SnapshotFilter) Empty() bool {
-	return len(f.Hosts)+len(f.Tags)+len(f.Paths) == 0
+	return len(f.Hosts)+len(f.Tags)+len(f.Labels)+len(f.Paths) == 0
 }
 
 func (f *SnapshotFilter) matches(sn *Snapshot) bool {
-	return sn.HasHostname(f.Hosts) && sn.HasTagList(f.Tags) && sn.HasPaths(f.Paths)
+	return sn.HasHostname(f.Hosts) && sn.HasTagList(f.Tags) && sn.HasLabelList(f.Labels) && sn.HasPaths(f.Paths) &&
+		(f.IncludeCheckpoints || !sn.IsCheckpoint())
 }
 
 // findLatest finds the latest snapshot with optional target/directory,
@@ -113,8 +118,8 @@ func (f *SnapshotFilter) FindLatest(ctx context.Context, be Lister, loader Loade
 	if id == "latest" {
 		sn, err := f.findLatest(ctx, be, loader)
 		if err == ErrNoSnapshotFound {
-			err = fmt.Errorf("snapshot filter (Paths:%v Tags:%v Hosts:%v): %w",
-				f.Paths, f.Tags, f.Hosts, err)
+			err = fmt.Errorf("snapshot filter (Paths:%v Tags:%v Labels:%v Hosts:%v): %w",
+				f.Paths, f.Tags, f.Labels, f.Hosts, err)
 		}
 		return sn, subfolder, err
 	}
@@ -148,8 +153,8 @@ func (f *SnapshotFilter) FindAll(ctx context.Context, be Lister, loader LoaderUn
 
 				sn, err = f.findLatest(ctx, be, loader)
 				if err == ErrNoSnapshotFound {
-					err = errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Hosts:%v)",
-						f.Paths, f.Tags, f.Hosts)
+					err = errors.Errorf("no snapshot matched given filter (Paths:%v Tags:%v Labels:%v Hosts:%v)",
+						f.Paths, f.Tags, f.Labels, f.Hosts)
 				}
 				if sn != nil {
 					ids.Insert(*sn.ID())
@@ -3,6 +3,7 @@ package restic
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -11,6 +12,8 @@ type SnapshotGroupByOptions struct {
 	Tag  bool
 	Host bool
 	Path bool
+	// Labels contains the keys of the labels to group by.
+	Labels []string
 }
 
 func splitSnapshotGroupBy(s string) (SnapshotGroupByOptions, error) {
@@ -25,6 +28,12 @@ func splitSnapshotGroupBy(s string) (SnapshotGroupByOptions, error) {
 			l.Tag = true
 		case "":
 		default:
+			if key, ok := strings.CutPrefix(option, "label:"); ok && key != "" {
+				if !slices.Contains(l.Labels, key) {
+					l.Labels = append(l.Labels, key)
+				}
+				continue
+			}
 			return SnapshotGroupByOptions{}, fmt.Errorf("unknown grouping option: %q", option)
 		}
 	}
@@ -42,6 +51,9 @@ func (l SnapshotGroupByOptions) String() string {
 	if l.Tag {
 		parts = append(parts, "tags")
 	}
+	for _, key := range l.Labels {
+		parts = append(parts, "label:"+key)
+	}
 	return strings.Join(parts, ",")
 }
 
@@ -64,6 +76,8 @@ type SnapshotGroupKey struct {
 	Hostname string   `json:"hostname"`
 	Paths    []string `json:"paths"`
 	Tags     []string `json:"tags"`
+	// Labels only contains the labels used for grouping which are set
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 func (s *SnapshotGroupKey) String() string {
@@ -77,6 +91,9 @@ func (s *SnapshotGroupKey) String() string {
 	if len(s.Tags) != 0 {
 		parts = append(parts, fmt.Sprintf("tags %v", s.Tags))
 	}
+	if len(s.Labels) != 0 {
+		parts = append(parts, fmt.Sprintf("labels %v", FormatLabels(s.Labels)))
+	}
 	return strings.Join(parts, ", ")
 }
 
@@ -91,6 +108,7 @@ func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[st
 		var tags []string
 		var hostname string
 		var paths []string
+		var labels map[string]string
 
 		if groupBy.Tag {
 			tags = sn.Tags
@@ -102,12 +120,20 @@ func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[st
 		if groupBy.Path {
 			paths = sn.Paths
 		}
+		for _, key := range groupBy.Labels {
+			if value, ok := sn.Labels[key]; ok {
+				if labels == nil {
+					labels = make(map[string]string)
+				}
+				labels[key] = value
+			}
+		}
 
 		sort.Strings(sn.Paths)
 		var k []byte
 		var err error
 
-		k, err = json.Marshal(SnapshotGroupKey{Tags: tags, Hostname: hostname, Paths: paths})
+		k, err = json.Marshal(SnapshotGroupKey{Tags: tags, Hostname: hostname, Paths: paths, Labels: labels})
 
 		if err != nil {
 			return nil, false, err
@@ -115,5 +141,5 @@ func GroupSnapshots(snapshots Snapshots, groupBy SnapshotGroupByOptions) (map[st
 		snapshotGroups[string(k)] = append(snapshotGroups[string(k)], sn)
 	}
 
-	return snapshotGroups, groupBy.Tag || groupBy.Host || groupBy.Path, nil
+	return snapshotGroups, groupBy.Tag || groupBy.Host || groupBy.Path || len(groupBy.Labels) > 0, nil
 }
@@ -1,7 +1,9 @@
 package restic_test
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/restic/restic/internal/restic"
@@ -34,6 +36,11 @@ func TestGroupByOptions(t *testing.T) {
 			opts:       restic.SnapshotGroupByOptions{Host: true, Path: true, Tag: true},
 			normalized: "host,paths,tags",
 		},
+		{
+			from:       "host,label:env,label:team,label:env",
+			opts:       restic.SnapshotGroupByOptions{Host: true, Labels: []string{"env", "team"}},
+			normalized: "host,label:env,label:team",
+		},
 	} {
 		var opts restic.SnapshotGroupByOptions
 		test.OK(t, opts.Set(exp.from))
@@ -44,7 +51,35 @@ func TestGroupByOptions(t *testing.T) {
 	}
 
 	var opts restic.SnapshotGroupByOptions
+	test.Assert(t, opts.Set("label:") != nil, "missing error on empty label key")
 	err := opts.Set("tags,invalid")
 	test.Assert(t, err != nil, "missing error on invalid tags")
 	test.Assert(t, !opts.Host && !opts.Path && !opts.Tag, "unexpected opts %s %s %s", opts.Host, opts.Path, opts.Tag)
 }
+
+func TestGroupSnapshotsByLabel(t *testing.T) {
+	var snapshots restic.Snapshots
+	for _, labels := range []map[string]string{
+		{"env": "prod", "ticket": "INC1"},
+		{"env": "prod", "ticket": "INC2"},
+		{"env": "dev"},
+		nil,
+	} {
+		sn, err := restic.NewSnapshot([]string{"/home"}, nil, "foo", time.Now())
+		test.OK(t, err)
+		sn.Labels = labels
+		snapshots = append(snapshots, sn)
+	}
+
+	groups, grouped, err := restic.GroupSnapshots(snapshots, restic.SnapshotGroupByOptions{Labels: []string{"env"}})
+	test.OK(t, err)
+	test.Assert(t, grouped, "snapshots were not grouped")
+
+	sizes := make(map[string]int)
+	for k, list := range groups {
+		var key restic.SnapshotGroupKey
+		test.OK(t, json.Unmarshal([]byte(k), &key))
+		sizes[key.String()] = len(list)
+	}
+	test.Equals(t, map[string]int{"labels [env=prod]": 2, "labels [env=dev]": 1, "": 1}, sizes)
+}
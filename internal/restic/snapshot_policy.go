@@ -4,27 +4,119 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
 )
 
 // ExpirePolicy configures which snapshots should be automatically removed.
 type ExpirePolicy struct {
-	Last          int       // keep the last n snapshots
-	Hourly        int       // keep the last n hourly snapshots
-	Daily         int       // keep the last n daily snapshots
-	Weekly        int       // keep the last n weekly snapshots
-	Monthly       int       // keep the last n monthly snapshots
-	Yearly        int       // keep the last n yearly snapshots
-	Within        Duration  // keep snapshots made within this duration
-	WithinHourly  Duration  // keep hourly snapshots made within this duration
-	WithinDaily   Duration  // keep daily snapshots made within this duration
-	WithinWeekly  Duration  // keep weekly snapshots made within this duration
-	WithinMonthly Duration  // keep monthly snapshots made within this duration
-	WithinYearly  Duration  // keep yearly snapshots made within this duration
-	Tags          []TagList // keep all snapshots that include at least one of the tag lists.
+	Last            int       `json:"last,omitempty"`      // keep the last n snapshots
+	Hourly          int       `json:"hourly,omitempty"`    // keep the last n hourly snapshots
+	Daily           int       `json:"daily,omitempty"`     // keep the last n daily snapshots
+	Weekly          int       `json:"weekly,omitempty"`    // keep the last n weekly snapshots
+	Monthly         int       `json:"monthly,omitempty"`   // keep the last n monthly snapshots
+	Quarterly       int       `json:"quarterly,omitempty"` // keep the last n quarterly snapshots
+	Yearly          int       `json:"yearly,omitempty"`    // keep the last n yearly snapshots
+	Weekdays        Weekdays  `json:"weekdays,omitempty"`  // keep the snapshots of the last n days which are the given weekday
+	Within          Duration  `json:"within"`              // keep snapshots made within this duration
+	WithinHourly    Duration  `json:"within_hourly"`       // keep hourly snapshots made within this duration
+	WithinDaily     Duration  `json:"within_daily"`        // keep daily snapshots made within this duration
+	WithinWeekly    Duration  `json:"within_weekly"`       // keep weekly snapshots made within this duration
+	WithinMonthly   Duration  `json:"within_monthly"`      // keep monthly snapshots made within this duration
+	WithinQuarterly Duration  `json:"within_quarterly"`    // keep quarterly snapshots made within this duration
+	WithinYearly    Duration  `json:"within_yearly"`       // keep yearly snapshots made within this duration
+	Tags            []TagList `json:"tags,omitempty"`      // keep all snapshots that include at least one of the tag lists.
+
+	// FirstInPeriod keeps the first instead of the last snapshot of each
+	// hour, day, week, month, quarter or year.
+	FirstInPeriod bool `json:"first_in_period,omitempty"`
+	// WithinFromNow measures the within durations from the current time
+	// instead of the time of the latest snapshot.
+	WithinFromNow bool `json:"within_from_now,omitempty"`
+}
+
+// Weekday keeps the snapshots of the last Count days which are a Weekday.
+// Count is -1 for all such days.
+type Weekday struct {
+	Weekday time.Weekday
+	Count   int
+}
+
+// ParseWeekday parses a weekday rule in the form "sunday" or "sunday:4". The
+// name of the day may be abbreviated to three letters.
+func ParseWeekday(s string) (Weekday, error) {
+	name, count, hasCount := strings.Cut(strings.TrimSpace(s), ":")
+	w := Weekday{Count: -1}
+	if hasCount && count != "unlimited" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return Weekday{}, errors.Errorf("invalid number of days %q", count)
+		}
+		w.Count = n
+	}
+
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		day := strings.ToLower(d.String())
+		if name == day || name == day[:3] {
+			w.Weekday = d
+			return w, nil
+		}
+	}
+	return Weekday{}, errors.Errorf("invalid weekday %q", name)
+}
+
+func (w Weekday) String() string {
+	day := strings.ToLower(w.Weekday.String())
+	if w.Count == -1 {
+		return day
+	}
+	return fmt.Sprintf("%v:%d", day, w.Count)
+}
+
+// MarshalText returns the rule in the format accepted by ParseWeekday.
+func (w Weekday) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// UnmarshalText parses a rule using ParseWeekday.
+func (w *Weekday) UnmarshalText(text []byte) error {
+	v, err := ParseWeekday(string(text))
+	if err != nil {
+		return err
+	}
+	*w = v
+	return nil
+}
+
+// Weekdays is a list of Weekday rules, usable as a flag.
+type Weekdays []Weekday
+
+func (l Weekdays) String() string {
+	var parts []string
+	for _, w := range l {
+		parts = append(parts, w.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses and appends a weekday rule.
+func (l *Weekdays) Set(s string) error {
+	w, err := ParseWeekday(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, w)
+	return nil
+}
+
+// Type returns a description of the type.
+func (Weekdays) Type() string {
+	return "weekday[:n]"
 }
 
 func (e ExpirePolicy) String() (s string) {
@@ -40,6 +132,7 @@ func (e ExpirePolicy) String() (s string) {
 		{e.Daily, "daily"},
 		{e.Weekly, "weekly"},
 		{e.Monthly, "monthly"},
+		{e.Quarterly, "quarterly"},
 		{e.Yearly, "yearly"},
 	} {
 		if opt.count > 0 {
@@ -48,6 +141,14 @@ func (e ExpirePolicy) String() (s string) {
 			keeps = append(keeps, fmt.Sprintf("all %s", opt.descr))
 		}
 	}
+	for _, w := range e.Weekdays {
+		day := strings.ToLower(w.Weekday.String())
+		if w.Count == -1 {
+			keeps = append(keeps, fmt.Sprintf("all %s", day))
+		} else {
+			keeps = append(keeps, fmt.Sprintf("%d %s", w.Count, day))
+		}
+	}
 
 	if !e.WithinHourly.Zero() {
 		keepw = append(keepw, fmt.Sprintf("hourly snapshots within %v", e.WithinHourly))
@@ -65,6 +166,10 @@ func (e ExpirePolicy) String() (s string) {
 		keepw = append(keepw, fmt.Sprintf("monthly snapshots within %v", e.WithinMonthly))
 	}
 
+	if !e.WithinQuarterly.Zero() {
+		keepw = append(keepw, fmt.Sprintf("quarterly snapshots within %v", e.WithinQuarterly))
+	}
+
 	if !e.WithinYearly.Zero() {
 		keepw = append(keepw, fmt.Sprintf("yearly snapshots within %v", e.WithinYearly))
 	}
@@ -91,7 +196,11 @@ func (e ExpirePolicy) String() (s string) {
 		if s != "" {
 			s += " and "
 		}
-		s += fmt.Sprintf("all snapshots within %s of the newest", e.Within)
+		if e.WithinFromNow {
+			s += fmt.Sprintf("all snapshots within %s of now", e.Within)
+		} else {
+			s += fmt.Sprintf("all snapshots within %s of the newest", e.Within)
+		}
 	}
 
 	if s == "" {
@@ -100,16 +209,26 @@ func (e ExpirePolicy) String() (s string) {
 		s = "keep " + s
 	}
 
+	if e.FirstInPeriod {
+		s += ", using the first snapshot of each period"
+	}
+
 	return s
 }
 
 // Empty returns true if no policy has been configured (all values zero).
 func (e ExpirePolicy) Empty() bool {
-	if len(e.Tags) != 0 {
+	if len(e.Tags) != 0 || len(e.Weekdays) != 0 {
 		return false
 	}
 
-	empty := ExpirePolicy{Tags: e.Tags}
+	// the options which modify other rules are not a policy on their own
+	empty := ExpirePolicy{
+		Tags:          e.Tags,
+		Weekdays:      e.Weekdays,
+		FirstInPeriod: e.FirstInPeriod,
+		WithinFromNow: e.WithinFromNow,
+	}
 	return reflect.DeepEqual(e, empty)
 }
 
@@ -129,6 +248,11 @@ func yw(d time.Time, _ int) int {
 	return year*100 + week
 }
 
+// yq returns an integer in the form YYYYQ, where Q is the quarter.
+func yq(d time.Time, _ int) int {
+	return d.Year()*10 + (int(d.Month())-1)/3 + 1
+}
+
 // ym returns an integer in the form YYYYMM.
 func ym(d time.Time, _ int) int {
 	return d.Year()*100 + int(d.Month())
@@ -174,12 +298,13 @@ type KeepReason struct {
 
 	// the counters after evaluating the current snapshot
 	Counters struct {
-		Last    int `json:"last,omitempty"`
-		Hourly  int `json:"hourly,omitempty"`
-		Daily   int `json:"daily,omitempty"`
-		Weekly  int `json:"weekly,omitempty"`
-		Monthly int `json:"monthly,omitempty"`
-		Yearly  int `json:"yearly,omitempty"`
+		Last      int `json:"last,omitempty"`
+		Hourly    int `json:"hourly,omitempty"`
+		Daily     int `json:"daily,omitempty"`
+		Weekly    int `json:"weekly,omitempty"`
+		Monthly   int `json:"monthly,omitempty"`
+		Quarterly int `json:"quarterly,omitempty"`
+		Yearly    int `json:"yearly,omitempty"`
 	} `json:"counters"`
 }
 
@@ -195,22 +320,32 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 	}
 
 	// These buckets are for keeping last n snapshots of given type
-	var buckets = [6]struct {
+	type bucket struct {
 		Count  int
 		bucker func(d time.Time, nr int) int
+		// filter restricts the bucket to some snapshots if set
+		filter func(d time.Time) bool
 		Last   int
 		reason string
-	}{
-		{p.Last, always, -1, "last snapshot"},
-		{p.Hourly, ymdh, -1, "hourly snapshot"},
-		{p.Daily, ymd, -1, "daily snapshot"},
-		{p.Weekly, yw, -1, "weekly snapshot"},
-		{p.Monthly, ym, -1, "monthly snapshot"},
-		{p.Yearly, y, -1, "yearly snapshot"},
+	}
+	var buckets = []bucket{
+		{p.Last, always, nil, -1, "last snapshot"},
+		{p.Hourly, ymdh, nil, -1, "hourly snapshot"},
+		{p.Daily, ymd, nil, -1, "daily snapshot"},
+		{p.Weekly, yw, nil, -1, "weekly snapshot"},
+		{p.Monthly, ym, nil, -1, "monthly snapshot"},
+		{p.Quarterly, yq, nil, -1, "quarterly snapshot"},
+		{p.Yearly, y, nil, -1, "yearly snapshot"},
+	}
+	for _, w := range p.Weekdays {
+		day := w.Weekday
+		buckets = append(buckets, bucket{w.Count, ymd, func(d time.Time) bool {
+			return d.Weekday() == day
+		}, -1, strings.ToLower(day.String()) + " snapshot"})
 	}
 
 	// These buckets are for keeping snapshots of given type within duration
-	var bucketsWithin = [5]struct {
+	var bucketsWithin = [6]struct {
 		Within Duration
 		bucker func(d time.Time, nr int) int
 		Last   int
@@ -220,10 +355,20 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		{p.WithinDaily, ymd, -1, "daily within"},
 		{p.WithinWeekly, yw, -1, "weekly within"},
 		{p.WithinMonthly, ym, -1, "monthly within"},
+		{p.WithinQuarterly, yq, -1, "quarterly within"},
 		{p.WithinYearly, y, -1, "yearly within"},
 	}
 
 	latest := findLatestTimestamp(list)
+	if p.WithinFromNow {
+		latest = time.Now()
+	}
+
+	// firstInPeriod returns whether cur is the oldest snapshot of its period,
+	// that is the next older snapshot belongs to a different period.
+	firstInPeriod := func(nr int, bucker func(d time.Time, nr int) int) bool {
+		return nr == len(list)-1 || bucker(list[nr+1].Time, nr+1) != bucker(list[nr].Time, nr)
+	}
 
 	for nr, cur := range list {
 		var keepSnap bool
@@ -248,42 +393,57 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 
 		// Now update the other buckets and see if they have some counts left.
 		for i, b := range buckets {
+			if b.filter != nil && !b.filter(cur.Time) {
+				continue
+			}
 			// -1 means "keep all"
 			if b.Count > 0 || b.Count == -1 {
 				val := b.bucker(cur.Time, nr)
+				if p.FirstInPeriod {
+					if !firstInPeriod(nr, b.bucker) {
+						continue
+					}
+				} else if val == b.Last && nr != len(list)-1 {
+					continue
+				}
+
 				// also keep the oldest snapshot if the bucket has some counts left. This maximizes the
 				// the history length kept while some counts are left.
-				if val != b.Last || nr == len(list)-1 {
-					debug.Log("keep %v %v, bucker %v, val %v\n", cur.Time, cur.id.Str(), i, val)
-					keepSnap = true
-					if val == b.Last && nr == len(list)-1 {
-						b.reason = fmt.Sprintf("oldest %v", b.reason)
-					}
-					buckets[i].Last = val
-					if buckets[i].Count > 0 {
-						buckets[i].Count--
-					}
-					keepSnapReasons = append(keepSnapReasons, b.reason)
+				debug.Log("keep %v %v, bucker %v, val %v\n", cur.Time, cur.id.Str(), i, val)
+				keepSnap = true
+				if val == b.Last && nr == len(list)-1 {
+					b.reason = fmt.Sprintf("oldest %v", b.reason)
+				}
+				buckets[i].Last = val
+				if buckets[i].Count > 0 {
+					buckets[i].Count--
 				}
+				keepSnapReasons = append(keepSnapReasons, b.reason)
 			}
 		}
 
-		// If the timestamp is within range, and the snapshot is an hourly/daily/weekly/monthly/yearly snapshot, then keep it
+		// If the timestamp is within range, and the snapshot is an hourly/daily/weekly/monthly/quarterly/yearly snapshot, then keep it
 		for i, b := range bucketsWithin {
 			if !b.Within.Zero() {
 				t := latest.AddDate(-b.Within.Years, -b.Within.Months, -b.Within.Days).Add(time.Hour * time.Duration(-b.Within.Hours))
 
 				if cur.Time.After(t) {
 					val := b.bucker(cur.Time, nr)
-					if val != b.Last || nr == len(list)-1 {
-						debug.Log("keep %v, time %v, ID %v, bucker %v, val %v %v\n", b.reason, cur.Time, cur.id.Str(), i, val, b.Last)
-						keepSnap = true
-						if val == b.Last && nr == len(list)-1 {
-							b.reason = fmt.Sprintf("oldest %v", b.reason)
+					if p.FirstInPeriod {
+						if !firstInPeriod(nr, b.bucker) {
+							continue
 						}
-						bucketsWithin[i].Last = val
-						keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("%v %v", b.reason, b.Within))
+					} else if val == b.Last && nr != len(list)-1 {
+						continue
+					}
+
+					debug.Log("keep %v, time %v, ID %v, bucker %v, val %v %v\n", b.reason, cur.Time, cur.id.Str(), i, val, b.Last)
+					keepSnap = true
+					if val == b.Last && nr == len(list)-1 {
+						b.reason = fmt.Sprintf("oldest %v", b.reason)
 					}
+					bucketsWithin[i].Last = val
+					keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("%v %v", b.reason, b.Within))
 				}
 			}
 		}
@@ -299,7 +459,8 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 			kr.Counters.Daily = buckets[2].Count
 			kr.Counters.Weekly = buckets[3].Count
 			kr.Counters.Monthly = buckets[4].Count
-			kr.Counters.Yearly = buckets[5].Count
+			kr.Counters.Quarterly = buckets[5].Count
+			kr.Counters.Yearly = buckets[6].Count
 			reasons = append(reasons, kr)
 		} else {
 			remove = append(remove, cur)
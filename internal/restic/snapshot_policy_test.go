@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func parseTimeUTC(s string) time.Time {
@@ -25,11 +26,18 @@ func parseTimeUTC(s string) time.Time {
 // Returns the maximum number of snapshots to be kept according to this policy.
 // If any of the counts is -1 it will return 0.
 func policySum(e *restic.ExpirePolicy) int {
-	if e.Last == -1 || e.Hourly == -1 || e.Daily == -1 || e.Weekly == -1 || e.Monthly == -1 || e.Yearly == -1 {
+	if e.Last == -1 || e.Hourly == -1 || e.Daily == -1 || e.Weekly == -1 || e.Monthly == -1 || e.Quarterly == -1 || e.Yearly == -1 {
 		return 0
 	}
 
-	return e.Last + e.Hourly + e.Daily + e.Weekly + e.Monthly + e.Yearly
+	sum := e.Last + e.Hourly + e.Daily + e.Weekly + e.Monthly + e.Quarterly + e.Yearly
+	for _, w := range e.Weekdays {
+		if w.Count == -1 {
+			return 0
+		}
+		sum += w.Count
+	}
+	return sum
 }
 
 func TestExpireSnapshotOps(t *testing.T) {
@@ -41,6 +49,9 @@ func TestExpireSnapshotOps(t *testing.T) {
 		{true, 0, &restic.ExpirePolicy{}},
 		{true, 0, &restic.ExpirePolicy{Tags: []restic.TagList{}}},
 		{false, 22, &restic.ExpirePolicy{Daily: 7, Weekly: 2, Monthly: 3, Yearly: 10}},
+		{true, 0, &restic.ExpirePolicy{FirstInPeriod: true, WithinFromNow: true}},
+		{false, 6, &restic.ExpirePolicy{Quarterly: 4, Weekdays: restic.Weekdays{{Weekday: time.Sunday, Count: 2}}}},
+		{false, 0, &restic.ExpirePolicy{Weekdays: restic.Weekdays{{Weekday: time.Sunday, Count: -1}}}},
 	}
 	for i, d := range data {
 		isEmpty := d.p.Empty()
@@ -244,6 +255,15 @@ func TestApplyPolicy(t *testing.T) {
 		{Last: -1, Hourly: -1}, // keep all (Last overrides Hourly)
 		{Hourly: -1},           // keep all hourlies
 		{Daily: 3, Weekly: 2, Monthly: -1, Yearly: -1},
+		{Quarterly: 3},
+		{Quarterly: -1},
+		{WithinQuarterly: restic.ParseDurationOrPanic("1y")},
+		{Weekdays: restic.Weekdays{{Weekday: time.Sunday, Count: -1}}},
+		{Weekdays: restic.Weekdays{{Weekday: time.Monday, Count: 2}, {Weekday: time.Friday, Count: 1}}},
+		{Last: 1, Weekdays: restic.Weekdays{{Weekday: time.Saturday, Count: 3}}},
+		{Monthly: 6, FirstInPeriod: true},
+		{Daily: 3, Weekly: 2, Quarterly: 2, FirstInPeriod: true},
+		{WithinMonthly: restic.ParseDurationOrPanic("1y"), FirstInPeriod: true},
 	}
 
 	for i, p := range tests {
@@ -285,3 +305,52 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyPolicyWithinFromNow(t *testing.T) {
+	now := time.Now()
+	var snapshots restic.Snapshots
+	for _, days := range []int{40, 30, 20, 10} {
+		snapshots = append(snapshots, &restic.Snapshot{Time: now.AddDate(0, 0, -days)})
+	}
+
+	p := restic.ExpirePolicy{Within: restic.ParseDurationOrPanic("15d")}
+	keep, _, _ := restic.ApplyPolicy(snapshots, p)
+	rtest.Equals(t, 2, len(keep))
+
+	p.WithinFromNow = true
+	keep, remove, _ := restic.ApplyPolicy(snapshots, p)
+	rtest.Equals(t, 1, len(keep))
+	rtest.Equals(t, 3, len(remove))
+	rtest.Equals(t, now.AddDate(0, 0, -10), keep[0].Time)
+
+	p = restic.ExpirePolicy{WithinDaily: restic.ParseDurationOrPanic("5d"), WithinFromNow: true}
+	keep, _, _ = restic.ApplyPolicy(snapshots, p)
+	rtest.Equals(t, 0, len(keep))
+}
+
+func TestParseWeekday(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  restic.Weekday
+		str   string
+	}{
+		{"sunday", restic.Weekday{Weekday: time.Sunday, Count: -1}, "sunday"},
+		{"Mon:3", restic.Weekday{Weekday: time.Monday, Count: 3}, "monday:3"},
+		{"saturday:unlimited", restic.Weekday{Weekday: time.Saturday, Count: -1}, "saturday"},
+	} {
+		w, err := restic.ParseWeekday(test.input)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.want, w)
+		rtest.Equals(t, test.str, w.String())
+	}
+
+	for _, input := range []string{"", "sun:0", "sun:-1", "someday", "tue:x"} {
+		_, err := restic.ParseWeekday(input)
+		rtest.Assert(t, err != nil, "expected error for %q", input)
+	}
+
+	var p restic.ExpirePolicy
+	rtest.OK(t, json.Unmarshal([]byte(`{"weekdays":["sun:4","friday"]}`), &p))
+	rtest.Equals(t, restic.Weekdays{{Weekday: time.Sunday, Count: 4}, {Weekday: time.Friday, Count: -1}}, p.Weekdays)
+	rtest.Equals(t, "keep 4 sunday, all friday snapshots", p.String())
+}
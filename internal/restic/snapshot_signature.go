@@ -0,0 +1,174 @@
+package restic
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SnapshotSignature is an ed25519 signature of a snapshot, created by the key
+// PublicKey.
+type SnapshotSignature struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+var (
+	// ErrSnapshotUnsigned is returned when verifying a snapshot without signature.
+	ErrSnapshotUnsigned = errors.New("snapshot is not signed")
+	// ErrSnapshotUntrustedKey is returned when a snapshot was signed by a key
+	// which is not in the list of trusted keys.
+	ErrSnapshotUntrustedKey = errors.New("snapshot is signed by an untrusted key")
+	// ErrSnapshotInvalidSignature is returned when the signature does not match
+	// the snapshot.
+	ErrSnapshotInvalidSignature = errors.New("snapshot signature is invalid")
+)
+
+// unsignedFields are the fields of the stored snapshot which are not covered
+// by the signature. Tags, labels and the original snapshot ID are excluded such
+// that `tag` does not invalidate the signature.
+var unsignedFields = []string{"signature", "tags", "labels", "original"}
+
+// signedData returns the data covered by the snapshot signature. This is the
+// stored JSON object of the snapshot without unsignedFields, with sorted keys
+// and without whitespace. Using the stored JSON instead of the decoded snapshot
+// ensures that fields added by newer versions of restic are covered as well.
+func (sn *Snapshot) signedData() ([]byte, error) {
+	buf := sn.raw
+	if buf == nil {
+		var err error
+		buf, err = json.Marshal(sn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &obj); err != nil {
+		return nil, err
+	}
+	for _, field := range unsignedFields {
+		delete(obj, field)
+	}
+	return json.Marshal(obj)
+}
+
+// Sign signs the snapshot using key and stores the signature in the snapshot.
+func (sn *Snapshot) Sign(key ed25519.PrivateKey) error {
+	// the signature covers the snapshot as it will be saved
+	sn.raw = nil
+	buf, err := sn.signedData()
+	if err != nil {
+		return err
+	}
+
+	sn.Signature = &SnapshotSignature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, buf),
+	}
+	return nil
+}
+
+// VerifySignature checks that the snapshot has a valid signature. If trusted
+// is not empty, the snapshot must also be signed by one of the trusted keys.
+func (sn *Snapshot) VerifySignature(trusted TrustedKeys) error {
+	if sn.Signature == nil {
+		return ErrSnapshotUnsigned
+	}
+
+	key := ed25519.PublicKey(sn.Signature.PublicKey)
+	if len(key) != ed25519.PublicKeySize {
+		return ErrSnapshotInvalidSignature
+	}
+
+	buf, err := sn.signedData()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, buf, sn.Signature.Signature) {
+		return ErrSnapshotInvalidSignature
+	}
+
+	if len(trusted) > 0 && !trusted.Has(key) {
+		return ErrSnapshotUntrustedKey
+	}
+	return nil
+}
+
+// SigningKeyID returns a short identifier for a public signing key.
+func SigningKeyID(key []byte) string {
+	id := hex.EncodeToString(key)
+	if len(id) > 16 {
+		id = id[:16]
+	}
+	return id
+}
+
+// ParseSigningKey parses a PEM-encoded ed25519 private key in PKCS #8 format,
+// as generated by `openssl genpkey -algorithm ed25519`.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM-encoded private key found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParsePKCS8PrivateKey")
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ed25519 key")
+	}
+	return edKey, nil
+}
+
+// TrustedKeys is a list of public keys which are trusted to sign snapshots.
+type TrustedKeys []ed25519.PublicKey
+
+// Has returns whether key is a trusted key.
+func (t TrustedKeys) Has(key ed25519.PublicKey) bool {
+	for _, k := range t {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedKeys parses a list of PEM-encoded ed25519 public keys, as
+// generated by `openssl pkey -pubout`.
+func ParseTrustedKeys(data []byte) (TrustedKeys, error) {
+	var keys TrustedKeys
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "ParsePKIXPublicKey")
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an ed25519 key")
+		}
+		keys = append(keys, edKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM-encoded public key found")
+	}
+	return keys, nil
+}
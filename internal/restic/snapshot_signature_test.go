@@ -0,0 +1,120 @@
+package restic_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func newSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	rtest.OK(t, err)
+	return pub, priv
+}
+
+func TestSnapshotSignature(t *testing.T) {
+	pub, priv := newSigningKey(t)
+	otherPub, _ := newSigningKey(t)
+
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, nil, "foo", time.Now())
+	rtest.OK(t, err)
+	tree := restic.NewRandomID()
+	sn.Tree = &tree
+
+	err = sn.VerifySignature(nil)
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotUnsigned), "expected unsigned error, got %v", err)
+
+	rtest.OK(t, sn.Sign(priv))
+	rtest.OK(t, sn.VerifySignature(nil))
+	rtest.OK(t, sn.VerifySignature(restic.TrustedKeys{otherPub, pub}))
+	err = sn.VerifySignature(restic.TrustedKeys{otherPub})
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotUntrustedKey), "expected untrusted key error, got %v", err)
+
+	// the signature must survive a JSON roundtrip
+	buf, err := json.Marshal(sn)
+	rtest.OK(t, err)
+	var sn2 restic.Snapshot
+	rtest.OK(t, json.Unmarshal(buf, &sn2))
+	rtest.OK(t, sn2.VerifySignature(restic.TrustedKeys{pub}))
+
+	// changing tags must not invalidate the signature
+	sn2.AddTags([]string{"foo"})
+	rtest.OK(t, sn2.VerifySignature(restic.TrustedKeys{pub}))
+	// neither must changing labels
+	sn2.SetLabels(map[string]string{"env": "prod"})
+	rtest.OK(t, sn2.VerifySignature(restic.TrustedKeys{pub}))
+
+	// but a forged tree must
+	otherTree := restic.NewRandomID()
+	sn2.Tree = &otherTree
+	err = sn2.VerifySignature(nil)
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotInvalidSignature), "expected invalid signature error, got %v", err)
+}
+
+func TestSnapshotSignatureUnknownFields(t *testing.T) {
+	repo := repository.TestRepository(t)
+	pub, priv := newSigningKey(t)
+
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, []string{"foo"}, "foo", time.Now())
+	rtest.OK(t, err)
+	tree := restic.NewRandomID()
+	sn.Tree = &tree
+
+	// simulate a snapshot signed by a newer version which knows more fields
+	buf, err := json.Marshal(sn)
+	rtest.OK(t, err)
+	var obj map[string]json.RawMessage
+	rtest.OK(t, json.Unmarshal(buf, &obj))
+	obj["future_field"] = json.RawMessage(`{"b": 1, "a": [1, 2]}`)
+	delete(obj, "tags")
+	signed, err := json.Marshal(obj)
+	rtest.OK(t, err)
+	sig, err := json.Marshal(restic.SnapshotSignature{PublicKey: pub, Signature: ed25519.Sign(priv, signed)})
+	rtest.OK(t, err)
+	obj["signature"] = sig
+	obj["tags"] = json.RawMessage(`["foo"]`)
+
+	id, err := restic.SaveJSONUnpacked(context.TODO(), repo, restic.WriteableSnapshotFile, obj)
+	rtest.OK(t, err)
+	loaded, err := restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.OK(t, loaded.VerifySignature(restic.TrustedKeys{pub}))
+
+	// the unknown field is covered by the signature
+	obj["future_field"] = json.RawMessage(`"forged"`)
+	id, err = restic.SaveJSONUnpacked(context.TODO(), repo, restic.WriteableSnapshotFile, obj)
+	rtest.OK(t, err)
+	loaded, err = restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	err = loaded.VerifySignature(nil)
+	rtest.Assert(t, errors.Is(err, restic.ErrSnapshotInvalidSignature), "expected invalid signature error, got %v", err)
+}
+
+func TestParseSigningKeys(t *testing.T) {
+	pub, priv := newSigningKey(t)
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	rtest.OK(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	rtest.OK(t, err)
+
+	key, err := restic.ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	rtest.OK(t, err)
+	rtest.Assert(t, key.Equal(priv), "wrong private key parsed")
+
+	trusted, err := restic.ParseTrustedKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	rtest.OK(t, err)
+	rtest.Assert(t, trusted.Has(pub), "public key missing from trusted keys")
+
+	_, err = restic.ParseTrustedKeys([]byte("foo"))
+	rtest.Assert(t, err != nil, "missing error for invalid trusted keys")
+}
@@ -27,6 +27,48 @@ func TestTagList(t *testing.T) {
 	rtest.Assert(t, r, "Failed to match untagged snapshot")
 }
 
+func TestSnapshotLabels(t *testing.T) {
+	sn, err := restic.NewSnapshot([]string{"/home/foobar"}, nil, "foo", time.Now())
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.HasLabels([]string{""}), "Failed to match unlabeled snapshot")
+
+	rtest.Assert(t, sn.SetLabels(map[string]string{"env": "prod", "ticket": "INC123"}), "labels were not set")
+	rtest.Assert(t, !sn.SetLabels(map[string]string{"env": "prod"}), "unchanged label reported as changed")
+
+	for _, test := range []struct {
+		selectors []string
+		match     bool
+	}{
+		{[]string{"env=prod"}, true},
+		{[]string{"env"}, true},
+		{[]string{"env=prod", "ticket=INC123"}, true},
+		{[]string{"env=dev"}, false},
+		{[]string{"env=prod", "team"}, false},
+		{[]string{"env=prod", "!team"}, true},
+		{[]string{"!env"}, false},
+		{[]string{""}, false},
+	} {
+		rtest.Assert(t, sn.HasLabels(test.selectors) == test.match,
+			"unexpected result for %v, want %v", test.selectors, test.match)
+	}
+	rtest.Assert(t, sn.HasLabelList([]restic.LabelList{{"env=dev"}, {"ticket"}}), "Failed to match one of the label lists")
+
+	rtest.Assert(t, sn.RemoveLabels([]string{"env", "ticket", "missing"}), "labels were not removed")
+	rtest.Assert(t, sn.Labels == nil, "expected no labels, got %v", sn.Labels)
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := restic.ParseLabels([]string{"env=prod", " ticket=INC=123", "empty="})
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]string{"env": "prod", "ticket": "INC=123", "empty": ""}, labels)
+	rtest.Equals(t, []string{"empty=", "env=prod", "ticket=INC=123"}, restic.FormatLabels(labels))
+
+	for _, invalid := range []string{"env", "=prod", "a,b=c", "!env=prod"} {
+		_, err := restic.ParseLabels([]string{invalid})
+		rtest.Assert(t, err != nil, "missing error for label %q", invalid)
+	}
+}
+
 func TestLoadJSONUnpacked(t *testing.T) {
 	repository.TestAllVersions(t, testLoadJSONUnpacked)
 }
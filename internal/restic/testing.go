@@ -28,14 +28,15 @@ type fakeFileSystem struct {
 // saveFile reads from rd and saves the blobs in the repository. The list of
 // IDs is returned.
 func (fs *fakeFileSystem) saveFile(ctx context.Context, rd io.Reader) (blobs IDs) {
+	params := fs.repo.Config().ChunkerParams()
 	if fs.buf == nil {
-		fs.buf = make([]byte, chunker.MaxSize)
+		fs.buf = make([]byte, params.MaxSize)
 	}
 
 	if fs.chunker == nil {
-		fs.chunker = chunker.New(rd, fs.repo.Config().ChunkerPolynomial)
+		fs.chunker = params.NewChunker(rd)
 	} else {
-		fs.chunker.Reset(rd, fs.repo.Config().ChunkerPolynomial)
+		params.ResetChunker(fs.chunker, rd)
 	}
 
 	blobs = IDs{}
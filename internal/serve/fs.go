@@ -0,0 +1,385 @@
+package serve
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/restic"
+
+	"golang.org/x/net/webdav"
+)
+
+// fileSystem is a read-only webdav.FileSystem which contains the snapshots
+// of a repository.
+type fileSystem struct {
+	repo      restic.Repository
+	dirs      *fuse.SnapshotsDirStructure
+	blobCache *bloblru.Cache
+}
+
+// ensure that *fileSystem and *file implement these interfaces
+var _ webdav.FileSystem = &fileSystem{}
+var _ webdav.File = &file{}
+var _ webdav.ETager = &file{}
+
+func (fsys *fileSystem) Mkdir(_ context.Context, name string, _ os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrPermission}
+}
+
+func (fsys *fileSystem) RemoveAll(_ context.Context, name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+}
+
+func (fsys *fileSystem) Rename(_ context.Context, oldName, _ string) error {
+	return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrPermission}
+}
+
+func (fsys *fileSystem) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+	return fsys.open(ctx, name)
+}
+
+func (fsys *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	e, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (fsys *fileSystem) open(ctx context.Context, name string) (*file, error) {
+	e, err := fsys.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{fsys: fsys, entry: e, ctx: ctx}, nil
+}
+
+// entry is a file or directory, it implements os.FileInfo.
+type entry struct {
+	name string
+	// meta is set for the directories of the snapshots directory structure
+	meta *fuse.MetaDirData
+	// view is set for merged and history directories
+	view *fuse.View
+	// node is set for files and directories within a snapshot
+	node *restic.Node
+}
+
+// snapshot returns the snapshot if e is the root directory of a snapshot. A
+// link to the latest snapshot is served like the snapshot itself.
+func (e *entry) snapshot() *restic.Snapshot {
+	if e.meta == nil {
+		return nil
+	}
+	return e.meta.Snapshot()
+}
+
+func (e *entry) Name() string {
+	return e.name
+}
+
+func (e *entry) Size() int64 {
+	if e.node == nil || e.node.Type != restic.NodeTypeFile {
+		return 0
+	}
+	return int64(e.node.Size)
+}
+
+func (e *entry) Mode() os.FileMode {
+	if e.node == nil {
+		return os.ModeDir | 0555
+	}
+	if e.node.Type == restic.NodeTypeDir {
+		return os.ModeDir | e.node.Mode.Perm()
+	}
+	return e.node.Mode.Perm()
+}
+
+func (e *entry) ModTime() time.Time {
+	if e.node != nil {
+		return e.node.ModTime
+	}
+	if sn := e.snapshot(); sn != nil {
+		return sn.Time
+	}
+	return time.Time{}
+}
+
+func (e *entry) IsDir() bool {
+	return e.Mode().IsDir()
+}
+
+func (e *entry) Sys() any {
+	return nil
+}
+
+// subtree returns the tree of the directory e, it is nil if e is no
+// directory within a snapshot.
+func (e *entry) subtree() *restic.ID {
+	if sn := e.snapshot(); sn != nil {
+		return sn.Tree
+	}
+	if e.node != nil && e.node.Type == restic.NodeTypeDir {
+		return e.node.Subtree
+	}
+	return nil
+}
+
+// servable reports whether node is served, symlinks and special files are
+// not.
+func servable(node *restic.Node) bool {
+	return node.Type == restic.NodeTypeFile || node.Type == restic.NodeTypeDir
+}
+
+// lookup returns the entry for the slash separated path name.
+func (fsys *fileSystem) lookup(ctx context.Context, name string) (*entry, error) {
+	debug.Log("lookup %v", name)
+	meta, err := fsys.dirs.UpdatePrefix(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	name = path.Clean("/" + name)
+	e := &entry{name: "/", meta: meta}
+	if name == "/" {
+		return e, nil
+	}
+
+	for _, part := range strings.Split(name[1:], "/") {
+		if tree := e.subtree(); tree != nil {
+			t, err := restic.LoadTree(ctx, fsys.repo, *tree)
+			if err != nil {
+				return nil, err
+			}
+			node := t.Find(part)
+			if node == nil || !servable(node) {
+				return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+			}
+			e = &entry{name: part, node: node}
+			continue
+		}
+
+		if e.view != nil {
+			ve, ok, err := e.view.Lookup(ctx, fsys.repo, part)
+			if err != nil {
+				return nil, err
+			}
+			if !ok || (ve.Node != nil && !servable(ve.Node)) {
+				return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+			}
+			e = &entry{name: part, node: ve.Node, view: ve.View}
+			continue
+		}
+
+		var child *fuse.MetaDirData
+		if e.meta != nil {
+			child = e.meta.Names()[part]
+		}
+		if child == nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		e = &entry{name: part, meta: child, view: child.View()}
+	}
+
+	return e, nil
+}
+
+// readDir returns all entries of the directory e sorted by name.
+func (fsys *fileSystem) readDir(ctx context.Context, e *entry) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	if tree := e.subtree(); tree != nil {
+		t, err := restic.LoadTree(ctx, fsys.repo, *tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range t.Nodes {
+			if servable(node) {
+				entries = append(entries, &entry{name: node.Name, node: node})
+			}
+		}
+		return entries, nil
+	}
+
+	if e.view != nil {
+		viewEntries, err := e.view.Entries(ctx, fsys.repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, ve := range viewEntries {
+			if ve.Node == nil || servable(ve.Node) {
+				entries = append(entries, &entry{name: ve.Name, node: ve.Node, view: ve.View})
+			}
+		}
+		return entries, nil
+	}
+
+	if e.meta == nil {
+		return nil, errors.Errorf("%v is not a directory", e.name)
+	}
+	for name, meta := range e.meta.Names() {
+		entries = append(entries, &entry{name: name, meta: meta})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// file is an open file or directory.
+type file struct {
+	fsys  *fileSystem
+	entry *entry
+	ctx   context.Context
+
+	// cumsize[i] holds the cumulative size of the content blobs[:i] of a file,
+	// it is set by load
+	cumsize []uint64
+	offset  int64
+
+	// entries and pos are used by Readdir
+	entries []os.FileInfo
+	pos     int
+}
+
+// load determines the sizes of all blobs of the file.
+func (f *file) load(ctx context.Context) error {
+	if f.cumsize != nil || f.entry.IsDir() {
+		return nil
+	}
+
+	cumsize := make([]uint64, 1+len(f.entry.node.Content))
+	for i, id := range f.entry.node.Content {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		size, found := f.fsys.repo.LookupBlobSize(restic.DataBlob, id)
+		if !found {
+			return errors.Errorf("id %v not found in repository", id)
+		}
+		cumsize[i+1] = cumsize[i] + uint64(size)
+	}
+	f.cumsize = cumsize
+
+	if size := cumsize[len(cumsize)-1]; size != f.entry.node.Size {
+		debug.Log("sizes do not match: node.Size %v != size %v, using real size", f.entry.node.Size, size)
+		node := *f.entry.node
+		node.Size = size
+		f.entry = &entry{name: f.entry.name, node: &node}
+	}
+	return nil
+}
+
+// Read reads from the blob which contains the current offset. The blobs are
+// loaded through the blob cache, such that subsequent range requests for the
+// same part of a file do not load the blob again.
+func (f *file) Read(p []byte) (int, error) {
+	if f.entry.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.entry.name, Err: errors.New("is a directory")}
+	}
+	if err := f.load(f.ctx); err != nil {
+		return 0, err
+	}
+
+	offset := uint64(f.offset)
+	if offset >= f.cumsize[len(f.cumsize)-1] {
+		return 0, io.EOF
+	}
+
+	i := sort.Search(len(f.cumsize), func(i int) bool {
+		return f.cumsize[i] > offset
+	}) - 1
+
+	id := f.entry.node.Content[i]
+	blob, err := f.fsys.blobCache.GetOrCompute(id, func() ([]byte, error) {
+		return f.fsys.repo.LoadBlob(f.ctx, restic.DataBlob, id, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, blob[offset-f.cumsize[i]:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(f.ctx); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.entry.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.entry.name, Err: os.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.entry.name, Err: os.ErrPermission}
+}
+
+func (f *file) Readdir(count int) ([]os.FileInfo, error) {
+	if f.entries == nil {
+		entries, err := f.fsys.readDir(f.ctx, f.entry)
+		if err != nil {
+			return nil, err
+		}
+		f.entries = entries
+	}
+
+	rest := f.entries[f.pos:]
+	if count <= 0 {
+		f.pos = len(f.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(count, len(rest))]
+	f.pos += len(rest)
+	return rest, nil
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.entry, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// ETag returns an entity tag which identifies the content of the file.
+func (f *file) ETag(context.Context) (string, error) {
+	if f.entry.IsDir() {
+		return "", webdav.ErrNotImplemented
+	}
+	return f.etag(), nil
+}
+
+func (f *file) etag() string {
+	h := sha256.New()
+	for _, id := range f.entry.node.Content {
+		h.Write(id[:])
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
@@ -0,0 +1,189 @@
+// Package serve provides read-only access to the snapshots of a repository
+// via HTTP and WebDAV.
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fuse"
+	"github.com/restic/restic/internal/restic"
+
+	"golang.org/x/net/webdav"
+)
+
+// Config holds settings for the server.
+type Config struct {
+	Filter        restic.SnapshotFilter
+	TimeTemplate  string
+	PathTemplates []string
+	// Hosts lists the host names which are accepted in the Host header of a
+	// request in addition to localhost and loopback addresses.
+	Hosts []string
+}
+
+// Size of the blob cache which is shared by all requests.
+const blobCacheSize = 64 << 20
+
+// Server serves the snapshots of a repository in the same directory structure
+// as the fuse mount. Files can be downloaded using GET requests, including
+// range requests, and the directories can be listed using a browser or a
+// WebDAV client. All requests which would modify the repository are rejected.
+type Server struct {
+	fs    *fileSystem
+	dav   *webdav.Handler
+	hosts []string
+}
+
+// ensure that *Server implements http.Handler
+var _ http.Handler = &Server{}
+
+// New returns a server for the snapshots in repo.
+func New(repo restic.Repository, cfg Config) *Server {
+	debug.Log("serve.New(), config %v", cfg)
+
+	if len(cfg.PathTemplates) == 0 {
+		cfg.PathTemplates = fuse.DefaultPathTemplates
+	}
+
+	fsys := &fileSystem{
+		repo:      repo,
+		dirs:      fuse.NewSnapshotsDirStructure(repo, cfg.Filter, cfg.PathTemplates, cfg.TimeTemplate),
+		blobCache: bloblru.New(blobCacheSize),
+	}
+	return &Server{
+		fs:    fsys,
+		hosts: cfg.Hosts,
+		dav: &webdav.Handler{
+			FileSystem: fsys,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					debug.Log("%v %v: %v", r.Method, r.URL.Path, err)
+				}
+			},
+		},
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowedHost(r.Host) {
+		debug.Log("%v %v: rejecting host %q", r.Method, r.URL.Path, r.Host)
+		http.Error(w, "421 Misdirected Request", http.StatusMisdirectedRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.serveGet(w, r)
+	case http.MethodOptions, "PROPFIND":
+		s.dav.ServeHTTP(w, r)
+	default:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+		http.Error(w, "the repository is served read-only", http.StatusMethodNotAllowed)
+	}
+}
+
+// allowedHost reports whether a request for host may be answered. As the
+// server has no authentication, a website could otherwise read the repository
+// via the browser of the user by resolving its own domain name to the address
+// of the server (DNS rebinding).
+func (s *Server) allowedHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, h := range s.hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request) {
+	f, err := s.fs.open(r.Context(), r.URL.Path)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if f.entry.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		s.serveDir(w, r, f)
+		return
+	}
+
+	if err := f.load(r.Context()); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("Etag", f.etag())
+	http.ServeContent(w, r, f.entry.Name(), f.entry.ModTime(), f)
+}
+
+// serveDir writes a simple HTML listing of the directory f.
+func (s *Server) serveDir(w http.ResponseWriter, r *http.Request, f *file) {
+	entries, err := f.Readdir(0)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	title := html.EscapeString(r.URL.Path)
+	fmt.Fprintf(w, "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<title>%s</title>\n<h1>%s</h1>\n<pre>\n", title, title)
+	if r.URL.Path != "/" {
+		fmt.Fprintf(w, "<a href=\"../\">../</a>\n")
+	}
+	for _, fi := range entries {
+		name := fi.Name()
+		if fi.IsDir() {
+			name += "/"
+		}
+		// url.URL prefixes the name with "./" if it contains a colon
+		link := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	case errors.Is(err, context.Canceled):
+		// the client went away, there is no one to report the error to
+	default:
+		debug.Log("%v %v: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
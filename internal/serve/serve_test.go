@@ -0,0 +1,175 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sync/errgroup"
+)
+
+func request(t testing.TB, srv http.Handler, method, url string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	req.Host = "localhost:8000"
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	return w
+}
+
+func loadContent(t testing.TB, repo restic.Repository, node *restic.Node) []byte {
+	var data []byte
+	for _, id := range node.Content {
+		buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+		rtest.OK(t, err)
+		data = append(data, buf...)
+	}
+	return data
+}
+
+func TestServe(t *testing.T) {
+	repo := repository.TestRepository(t)
+	timestamp, err := time.Parse(time.RFC3339, "2017-01-24T10:42:56+01:00")
+	rtest.OK(t, err)
+	sn := restic.TestCreateSnapshot(t, repo, timestamp, 2)
+
+	tree, err := restic.LoadTree(context.TODO(), repo, *sn.Tree)
+	rtest.OK(t, err)
+	var node *restic.Node
+	for _, n := range tree.Nodes {
+		if n.Type == restic.NodeTypeFile && n.Size > 100 {
+			node = n
+			break
+		}
+	}
+	rtest.Assert(t, node != nil, "no file found in test snapshot")
+	content := loadContent(t, repo, node)
+
+	srv := New(repo, Config{TimeTemplate: time.RFC3339})
+	snapshotDir := "/ids/" + sn.ID().Str()
+
+	w := request(t, srv, http.MethodGet, "/", nil)
+	rtest.Equals(t, http.StatusOK, w.Code)
+	for _, dir := range []string{"ids/", "snapshots/", "hosts/", "tags/"} {
+		rtest.Assert(t, strings.Contains(w.Body.String(), `href="`+dir+`"`), "listing does not contain %v:\n%v", dir, w.Body)
+	}
+
+	w = request(t, srv, http.MethodGet, snapshotDir, nil)
+	rtest.Equals(t, http.StatusMovedPermanently, w.Code)
+	rtest.Equals(t, snapshotDir+"/", w.Header().Get("Location"))
+
+	w = request(t, srv, http.MethodGet, snapshotDir+"/", nil)
+	rtest.Equals(t, http.StatusOK, w.Code)
+	rtest.Assert(t, strings.Contains(w.Body.String(), node.Name), "listing does not contain %v:\n%v", node.Name, w.Body)
+
+	// the latest snapshot is available like the snapshot itself
+	w = request(t, srv, http.MethodGet, "/snapshots/latest/"+node.Name, nil)
+	rtest.Equals(t, http.StatusOK, w.Code)
+	rtest.Equals(t, content, w.Body.Bytes())
+
+	w = request(t, srv, http.MethodGet, snapshotDir+"/"+node.Name, nil)
+	rtest.Equals(t, http.StatusOK, w.Code)
+	rtest.Equals(t, content, w.Body.Bytes())
+	etag := w.Header().Get("Etag")
+	rtest.Assert(t, etag != "", "missing etag")
+
+	w = request(t, srv, http.MethodGet, snapshotDir+"/"+node.Name, http.Header{"Range": {"bytes=10-99"}})
+	rtest.Equals(t, http.StatusPartialContent, w.Code)
+	rtest.Equals(t, content[10:100], w.Body.Bytes())
+
+	w = request(t, srv, http.MethodGet, snapshotDir+"/"+node.Name, http.Header{"Range": {"bytes=10-99"}, "If-Range": {etag}})
+	rtest.Equals(t, http.StatusPartialContent, w.Code)
+
+	w = request(t, srv, http.MethodGet, snapshotDir+"/missing", nil)
+	rtest.Equals(t, http.StatusNotFound, w.Code)
+
+	w = request(t, srv, "PROPFIND", "/ids/", http.Header{"Depth": {"1"}})
+	rtest.Equals(t, http.StatusMultiStatus, w.Code)
+	rtest.Assert(t, strings.Contains(w.Body.String(), sn.ID().Str()), "PROPFIND does not contain snapshot:\n%v", w.Body)
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete, "MKCOL", "MOVE", "LOCK"} {
+		w = request(t, srv, method, snapshotDir+"/"+node.Name, nil)
+		rtest.Equals(t, http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestFileReadSeek(t *testing.T) {
+	repo := repository.TestRepository(t)
+	ctx := context.TODO()
+
+	// store the content in several blobs
+	rnd := rand.New(rand.NewSource(23))
+	var content []byte
+	var ids restic.IDs
+	wg, wgCtx := errgroup.WithContext(ctx)
+	repo.StartPackUploader(wgCtx, wg)
+	for _, size := range []int{1000, 1, 5000, 300} {
+		buf := make([]byte, size)
+		_, _ = rnd.Read(buf)
+		id, _, _, err := repo.SaveBlob(ctx, restic.DataBlob, buf, restic.ID{}, false)
+		rtest.OK(t, err)
+		content = append(content, buf...)
+		ids = append(ids, id)
+	}
+	rtest.OK(t, repo.Flush(ctx))
+
+	srv := New(repo, Config{})
+	node := &restic.Node{Name: "file", Type: restic.NodeTypeFile, Size: uint64(len(content)), Content: ids}
+	f := &file{fsys: srv.fs, entry: &entry{name: node.Name, node: node}, ctx: ctx}
+
+	for _, offset := range []int64{0, 999, 1000, 1001, 6000, int64(len(content)) - 1, int64(len(content))} {
+		pos, err := f.Seek(offset, io.SeekStart)
+		rtest.OK(t, err)
+		rtest.Equals(t, offset, pos)
+
+		data, err := io.ReadAll(f)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(content[offset:], data), "wrong data read at offset %d", offset)
+	}
+
+	pos, err := f.Seek(-10, io.SeekEnd)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(len(content)-10), pos)
+
+	_, err = f.Write([]byte("foo"))
+	rtest.Assert(t, err != nil, "write did not fail")
+}
+
+func TestServeHost(t *testing.T) {
+	repo := repository.TestRepository(t)
+	srv := New(repo, Config{TimeTemplate: time.RFC3339, Hosts: []string{"backup.example.com"}})
+
+	for _, test := range []struct {
+		host string
+		code int
+	}{
+		{"localhost:8000", http.StatusOK},
+		{"LOCALHOST", http.StatusOK},
+		{"127.0.0.1:8000", http.StatusOK},
+		{"[::1]:8000", http.StatusOK},
+		{"[::1]", http.StatusOK},
+		{"backup.example.com:8000", http.StatusOK},
+		{"attacker.example.com:8000", http.StatusMisdirectedRequest},
+		{"localhost.example.com", http.StatusMisdirectedRequest},
+		{"192.0.2.1:8000", http.StatusMisdirectedRequest},
+	} {
+		t.Run(test.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = test.host
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			rtest.Equals(t, test.code, w.Code)
+		})
+	}
+}